@@ -43,6 +43,10 @@ type DeclarationsModule struct {
 		// The flags will only be repackaged if this prop is true.
 		Exportable bool
 	}
+
+	// The aconfig files listed in srcs, for the aconfig_flag_index singleton
+	// to evaluate against every aconfig_value_set.
+	declarationFiles android.Paths
 }
 
 func DeclarationsFactory() android.Module {
@@ -118,6 +122,7 @@ func (module *DeclarationsModule) GenerateAndroidBuildActions(ctx android.Module
 
 	// Intermediate format
 	declarationFiles := android.PathsForModuleSrc(ctx, module.properties.Srcs)
+	module.declarationFiles = declarationFiles
 	intermediateCacheFilePath := android.PathForModuleOut(ctx, "intermediate.pb")
 	defaultPermission := ctx.Config().ReleaseAconfigFlagDefaultPermission()
 	inputFiles := make([]android.Path, len(declarationFiles))
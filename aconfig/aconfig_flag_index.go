@@ -0,0 +1,275 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"android/soong/android"
+)
+
+// A singleton that indexes which modules read each aconfig flag, and in which
+// containers those modules are installed, by combining the aconfig_declarations
+// modules, the values of every release config and the modules that depend on
+// codegen libraries (java_aconfig_library, cc_aconfig_library, ...).
+//
+// The flags are evaluated against the value sets of every release config of
+// the product, not just the current one, so that it can report the flags that
+// are enabled and read-only in every release config as candidates for cleanup.
+// The report is only written when the value sets of the release configs are
+// known.
+func AconfigFlagIndexFactory() android.Singleton {
+	return &aconfigFlagIndexSingleton{}
+}
+
+type aconfigFlagIndexSingleton struct {
+	outputs android.Paths
+}
+
+// The manifest read by aconfig_flag_index. See cmd/aconfig_flag_index.
+type flagIndexManifest struct {
+	Declarations   []flagIndexDeclarations  `json:"declarations"`
+	ReleaseConfigs []flagIndexReleaseConfig `json:"release_configs"`
+	Libraries      []flagIndexLibrary       `json:"libraries"`
+}
+
+type flagIndexDeclarations struct {
+	Module    string `json:"module"`
+	Package   string `json:"package"`
+	Container string `json:"container"`
+	Flags     string `json:"flags"`
+	Defaults  string `json:"defaults"`
+}
+
+type flagIndexReleaseConfig struct {
+	Name      string   `json:"name"`
+	ValueSets []string `json:"value_sets"`
+	Flags     []string `json:"flags"`
+}
+
+type flagIndexLibrary struct {
+	Name         string              `json:"name"`
+	Mode         string              `json:"mode,omitempty"`
+	Declarations []string            `json:"declarations"`
+	Consumers    []flagIndexConsumer `json:"consumers,omitempty"`
+}
+
+type flagIndexConsumer struct {
+	Module     string   `json:"module"`
+	Containers []string `json:"containers,omitempty"`
+}
+
+// dumpFlagStates writes the state and permission of each flag in an aconfig
+// cache file.
+func dumpFlagStates(ctx android.SingletonContext, cache android.Path, output android.WritablePath) {
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        aconfigFlagStatesRule,
+		Input:       cache,
+		Output:      output,
+		Description: "aconfig_flag_states",
+	})
+}
+
+// createFlagCache evaluates the flags of an aconfig_declarations module against
+// the values files, in order.
+func createFlagCache(ctx android.SingletonContext, d *DeclarationsModule, values android.Paths, output android.WritablePath) {
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        aconfigRule,
+		Output:      output,
+		Inputs:      append(append(android.Paths{}, d.declarationFiles...), values...),
+		Description: "aconfig_flag_index " + d.properties.Package,
+		Args: map[string]string{
+			"release_version":    ctx.Config().ReleaseVersion(),
+			"package":            d.properties.Package,
+			"container":          optionalVariable("--container ", d.properties.Container),
+			"declarations":       android.JoinPathsWithPrefix(d.declarationFiles, "--declarations "),
+			"values":             android.JoinPathsWithPrefix(values, " --values "),
+			"default-permission": optionalVariable(" --default-permission ", ctx.Config().ReleaseAconfigFlagDefaultPermission()),
+		},
+	})
+}
+
+// installedContainers returns the APEXes or the partition that the module is
+// installed in.
+func installedContainers(ctx android.SingletonContext, module android.Module) []string {
+	if apexInfo, ok := android.SingletonModuleProvider(ctx, module, android.ApexInfoProvider); ok && !apexInfo.IsForPlatform() {
+		return apexInfo.InApexModules
+	}
+	if module.IsSkipInstall() || len(module.FilesToInstall()) == 0 {
+		return nil
+	}
+	return []string{module.PartitionTag(ctx.DeviceConfig())}
+}
+
+func (this *aconfigFlagIndexSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var m flagIndexManifest
+	var inputs android.Paths
+
+	// Dump the flags of each aconfig_declarations module with the values of
+	// the current release config, and with their default values.
+	var declarationsModules []*DeclarationsModule
+	ctx.VisitAllModules(func(module android.Module) {
+		decl, ok := android.SingletonModuleProvider(ctx, module, android.AconfigDeclarationsProviderKey)
+		if !ok {
+			return
+		}
+		d, ok := module.(*DeclarationsModule)
+		if !ok {
+			return
+		}
+		name := ctx.ModuleName(module)
+		flags := android.PathForIntermediates(ctx, "aconfig_flag_index", "declarations", name+".txt")
+		dumpFlagStates(ctx, decl.IntermediateCacheOutputPath, flags)
+		defaultsCache := android.PathForIntermediates(ctx, "aconfig_flag_index", "defaults", name+".pb")
+		createFlagCache(ctx, d, nil, defaultsCache)
+		defaults := android.PathForIntermediates(ctx, "aconfig_flag_index", "defaults", name+".txt")
+		dumpFlagStates(ctx, defaultsCache, defaults)
+		inputs = append(inputs, flags, defaults)
+		m.Declarations = append(m.Declarations, flagIndexDeclarations{
+			Module:    name,
+			Package:   decl.Package,
+			Container: decl.Container,
+			Flags:     flags.String(),
+			Defaults:  defaults.String(),
+		})
+		declarationsModules = append(declarationsModules, d)
+	})
+
+	valueSets := make(map[string]valueSetProviderData)
+	ctx.VisitAllModules(func(module android.Module) {
+		if valueSet, ok := android.SingletonModuleProvider(ctx, module, valueSetProviderKey); ok {
+			valueSets[ctx.ModuleName(module)] = valueSet
+		}
+	})
+
+	// Evaluate the flags of each package against the values of the value
+	// sets of each release config, applied in the order of its
+	// RELEASE_ACONFIG_VALUE_SETS like aconfig_declarations does. Packages
+	// that none of the value sets have values for keep their default values.
+	// Unknown value sets fail the aconfig_flag_index rule rather than every
+	// build.
+	releaseConfigs := ctx.Config().ReleaseAconfigValueSetsByReleaseConfig()
+	var errors []string
+	for _, name := range android.SortedKeys(releaseConfigs) {
+		rc := flagIndexReleaseConfig{Name: name, ValueSets: releaseConfigs[name]}
+		for _, vs := range rc.ValueSets {
+			if _, ok := valueSets[vs]; !ok {
+				errors = append(errors, fmt.Sprintf("release config %s uses unknown aconfig_value_set %s", name, vs))
+			}
+		}
+		for _, d := range declarationsModules {
+			var values android.Paths
+			for _, vs := range rc.ValueSets {
+				values = append(values, valueSets[vs].AvailablePackages[d.properties.Package]...)
+			}
+			if len(values) == 0 {
+				continue
+			}
+			cache := android.PathForIntermediates(ctx, "aconfig_flag_index", "release_configs", name, ctx.ModuleName(d)+".pb")
+			createFlagCache(ctx, d, values, cache)
+			flags := android.PathForIntermediates(ctx, "aconfig_flag_index", "release_configs", name, ctx.ModuleName(d)+".txt")
+			dumpFlagStates(ctx, cache, flags)
+			inputs = append(inputs, flags)
+			rc.Flags = append(rc.Flags, flags.String())
+		}
+		m.ReleaseConfigs = append(m.ReleaseConfigs, rc)
+	}
+
+	// Find the modules that read the flags through codegen libraries, either
+	// directly or through static dependencies, and the containers they are
+	// installed in.
+	libraries := make(map[string]*flagIndexLibrary)
+	consumers := make(map[string]map[string][]string)
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled(ctx) {
+			return
+		}
+		name := ctx.ModuleName(module)
+		if codegen, ok := android.SingletonModuleProvider(ctx, module, android.CodegenInfoProvider); ok {
+			if _, ok := libraries[name]; !ok {
+				libraries[name] = &flagIndexLibrary{
+					Name:         name,
+					Mode:         codegen.ModeInfos[name].Mode,
+					Declarations: android.SortedUniqueStrings(codegen.AconfigDeclarations),
+				}
+			}
+			return
+		}
+		propagated, ok := android.SingletonModuleProvider(ctx, module, android.AconfigPropagatingProviderKey)
+		if !ok {
+			return
+		}
+		for library := range propagated.ModeInfos {
+			if consumers[library] == nil {
+				consumers[library] = make(map[string][]string)
+			}
+			consumers[library][name] = append(consumers[library][name], installedContainers(ctx, module)...)
+		}
+	})
+	for _, name := range android.SortedKeys(libraries) {
+		library := libraries[name]
+		for _, consumer := range android.SortedKeys(consumers[name]) {
+			library.Consumers = append(library.Consumers, flagIndexConsumer{
+				Module:     consumer,
+				Containers: android.SortedUniqueStrings(consumers[name][consumer]),
+			})
+		}
+		m.Libraries = append(m.Libraries, *library)
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to write the aconfig flag index manifest: %s", err)
+		return
+	}
+	manifestPath := android.PathForIntermediates(ctx, "aconfig_flag_index", "manifest.json")
+	android.WriteFileRule(ctx, manifestPath, string(manifest))
+
+	indexPath := android.PathForIntermediates(ctx, "aconfig_flag_index.json")
+	outputs := android.WritablePaths{indexPath}
+	var deadFlagsPath android.WritablePath
+	if len(releaseConfigs) > 0 {
+		deadFlagsPath = android.PathForIntermediates(ctx, "aconfig_dead_flags.txt")
+		outputs = append(outputs, deadFlagsPath)
+	}
+	this.outputs = outputs.Paths()
+	if len(errors) > 0 {
+		ctx.Build(pctx, android.BuildParams{
+			Rule:    android.ErrorRule,
+			Outputs: outputs,
+			Args: map[string]string{
+				"error": strings.Join(errors, ", "),
+			},
+		})
+	} else {
+		rule := android.NewRuleBuilder(pctx, ctx)
+		cmd := rule.Command().
+			BuiltTool("aconfig_flag_index").
+			FlagWithInput("--manifest ", manifestPath).
+			FlagWithOutput("--index ", indexPath).
+			Implicits(inputs)
+		if deadFlagsPath != nil {
+			cmd.FlagWithOutput("--dead_flags ", deadFlagsPath)
+		}
+		rule.Build("aconfig_flag_index", "aconfig_flag_index")
+	}
+	ctx.Phony("aconfig_flag_index", this.outputs...)
+}
+
+func (this *aconfigFlagIndexSingleton) MakeVars(ctx android.MakeVarsContext) {
+	ctx.DistForGoal("aconfig_flag_index", this.outputs...)
+}
@@ -0,0 +1,299 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// testCodegenLibrary stands in for the codegen modules, which are in the
+// aconfig/codegen package.
+type testCodegenLibrary struct {
+	android.ModuleBase
+	properties struct {
+		Aconfig_declarations string
+	}
+}
+
+type testCodegenLibraryDepTag struct {
+	blueprint.BaseDependencyTag
+}
+
+func testCodegenLibraryFactory() android.Module {
+	m := &testCodegenLibrary{}
+	m.AddProperties(&m.properties)
+	android.InitAndroidModule(m)
+	return m
+}
+
+func (m *testCodegenLibrary) DepsMutator(ctx android.BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), testCodegenLibraryDepTag{}, m.properties.Aconfig_declarations)
+}
+
+func (m *testCodegenLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	android.SetProvider(ctx, android.CodegenInfoProvider, android.CodegenInfo{
+		AconfigDeclarations: []string{m.properties.Aconfig_declarations},
+		ModeInfos: map[string]android.ModeInfo{
+			ctx.ModuleName(): {Container: "system", Mode: "production"},
+		},
+	})
+}
+
+type testConsumer struct {
+	android.ModuleBase
+	properties struct {
+		Libs        []string
+		Static_libs []string
+		Installable *bool
+	}
+}
+
+type testConsumerDepTag struct {
+	blueprint.BaseDependencyTag
+}
+
+type testConsumerStaticDepTag struct {
+	blueprint.BaseDependencyTag
+	android.AlwaysPropagateAconfigValidationDependencyTag
+}
+
+func testConsumerFactory() android.Module {
+	m := &testConsumer{}
+	m.AddProperties(&m.properties)
+	android.InitAndroidModule(m)
+	return m
+}
+
+func (m *testConsumer) DepsMutator(ctx android.BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), testConsumerDepTag{}, m.properties.Libs...)
+	ctx.AddDependency(ctx.Module(), testConsumerStaticDepTag{}, m.properties.Static_libs...)
+}
+
+func (m *testConsumer) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	out := android.PathForModuleOut(ctx, ctx.ModuleName())
+	android.WriteFileRule(ctx, out, "")
+	if proptools.BoolDefault(m.properties.Installable, true) {
+		ctx.InstallFile(android.PathForModuleInstall(ctx, "bin"), ctx.ModuleName(), out)
+	}
+}
+
+func TestAconfigFlagIndex(t *testing.T) {
+	bp := `
+		aconfig_declarations {
+			name: "foo_flags",
+			package: "com.example.foo",
+			container: "system",
+			srcs: ["foo.aconfig"],
+		}
+
+		aconfig_declarations {
+			name: "bar_flags",
+			package: "com.example.bar",
+			container: "system",
+			srcs: ["bar.aconfig"],
+		}
+
+		aconfig_values {
+			name: "foo_values_next",
+			package: "com.example.foo",
+			srcs: ["foo_next.values"],
+		}
+
+		aconfig_value_set {
+			name: "values_next",
+			values: ["foo_values_next"],
+		}
+
+		aconfig_values {
+			name: "foo_values_staging",
+			package: "com.example.foo",
+			srcs: ["foo_staging.values"],
+		}
+
+		aconfig_value_set {
+			name: "values_staging",
+			values: ["foo_values_staging"],
+		}
+
+		test_codegen_library {
+			name: "foo_flags_lib",
+			aconfig_declarations: "foo_flags",
+		}
+
+		test_consumer {
+			name: "foo_bin",
+			libs: ["foo_flags_lib"],
+		}
+
+		test_consumer {
+			name: "foo_lib",
+			libs: ["foo_flags_lib"],
+			installable: false,
+		}
+
+		test_consumer {
+			name: "foo_app",
+			static_libs: ["foo_lib"],
+		}
+
+		test_consumer {
+			name: "foo_test",
+			libs: ["foo_lib"],
+		}
+	`
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithAconfigBuildComponents,
+		android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+			ctx.RegisterModuleType("test_codegen_library", testCodegenLibraryFactory)
+			ctx.RegisterModuleType("test_consumer", testConsumerFactory)
+		}),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.ReleaseAconfigValueSetsByReleaseConfig = map[string][]string{
+				"next":          {"values_next"},
+				"trunk_staging": {"values_next", "values_staging"},
+			}
+		}),
+	).RunTestWithBp(t, bp)
+
+	singleton := result.SingletonForTests("aconfig_flag_index")
+
+	// The flags of com.example.foo are evaluated against the values of each
+	// release config, with its value sets applied in order.
+	cache := singleton.Output("aconfig_flag_index/release_configs/next/foo_flags.pb")
+	android.AssertStringDoesContain(t, "declarations", cache.Args["declarations"], "--declarations foo.aconfig")
+	android.AssertStringEquals(t, "values", " --values foo_next.values", cache.Args["values"])
+	android.AssertStringEquals(t, "container", "--container system", cache.Args["container"])
+	cache = singleton.Output("aconfig_flag_index/release_configs/trunk_staging/foo_flags.pb")
+	android.AssertStringEquals(t, "values", " --values foo_next.values --values foo_staging.values", cache.Args["values"])
+	singleton.Output("aconfig_flag_index/release_configs/next/foo_flags.txt")
+	singleton.Output("aconfig_flag_index/declarations/foo_flags.txt")
+	singleton.Output("aconfig_flag_index/declarations/bar_flags.txt")
+
+	// The flags of com.example.bar have their default values in every
+	// release config.
+	defaults := singleton.Output("aconfig_flag_index/defaults/bar_flags.pb")
+	android.AssertStringEquals(t, "values", "", defaults.Args["values"])
+	singleton.Output("aconfig_flag_index/defaults/bar_flags.txt")
+	if singleton.MaybeOutput("aconfig_flag_index/release_configs/next/bar_flags.pb").Rule != nil {
+		t.Errorf("expected bar_flags not to be evaluated against the values of next")
+	}
+
+	var m flagIndexManifest
+	content := android.ContentFromFileRuleForTests(t, result.TestContext, singleton.Output("aconfig_flag_index/manifest.json"))
+	content = android.StringRelativeToTop(result.Config, content)
+	if err := json.Unmarshal([]byte(content), &m); err != nil {
+		t.Fatal(err)
+	}
+	android.AssertIntEquals(t, "number of declarations", 2, len(m.Declarations))
+	android.AssertDeepEquals(t, "release configs", []flagIndexReleaseConfig{
+		{
+			Name:      "next",
+			ValueSets: []string{"values_next"},
+			Flags:     []string{"out/soong/.intermediates/aconfig_flag_index/release_configs/next/foo_flags.txt"},
+		},
+		{
+			Name:      "trunk_staging",
+			ValueSets: []string{"values_next", "values_staging"},
+			Flags:     []string{"out/soong/.intermediates/aconfig_flag_index/release_configs/trunk_staging/foo_flags.txt"},
+		},
+	}, m.ReleaseConfigs)
+	android.AssertDeepEquals(t, "libraries", []flagIndexLibrary{
+		{
+			Name:         "foo_flags_lib",
+			Mode:         "production",
+			Declarations: []string{"foo_flags"},
+			// foo_app reads the flags through its static dependency on
+			// foo_lib, but foo_test does not.
+			Consumers: []flagIndexConsumer{
+				{Module: "foo_app", Containers: []string{"system"}},
+				{Module: "foo_bin", Containers: []string{"system"}},
+				{Module: "foo_lib"},
+			},
+		},
+	}, m.Libraries)
+
+	index := singleton.Output("aconfig_flag_index.json")
+	android.AssertStringDoesContain(t, "index command", index.RuleParams.Command,
+		"--manifest out/soong/.intermediates/aconfig_flag_index/manifest.json")
+	android.AssertStringDoesContain(t, "index command", index.RuleParams.Command,
+		"--dead_flags out/soong/.intermediates/aconfig_dead_flags.txt")
+}
+
+func TestAconfigFlagIndexWithoutReleaseConfigs(t *testing.T) {
+	bp := `
+		aconfig_declarations {
+			name: "foo_flags",
+			package: "com.example.foo",
+			container: "system",
+			srcs: ["foo.aconfig"],
+		}
+
+		aconfig_values {
+			name: "foo_values_next",
+			package: "com.example.foo",
+			srcs: ["foo_next.values"],
+		}
+
+		aconfig_value_set {
+			name: "values_next",
+			values: ["foo_values_next"],
+		}
+	`
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithAconfigBuildComponents,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.ReleaseAconfigValueSets = []string{"values_next"}
+		}),
+	).RunTestWithBp(t, bp)
+
+	// Without the value sets of the release configs, the flags are indexed
+	// but no candidates for cleanup are reported.
+	singleton := result.SingletonForTests("aconfig_flag_index")
+	if singleton.MaybeOutput("aconfig_flag_index/release_configs/current/foo_flags.pb").Rule != nil {
+		t.Errorf("expected foo_flags not to be evaluated against the current value sets")
+	}
+	if singleton.MaybeOutput("aconfig_dead_flags.txt").Rule != nil {
+		t.Errorf("expected no report of the flags that are candidates for cleanup")
+	}
+	index := singleton.Output("aconfig_flag_index.json")
+	android.AssertStringDoesNotContain(t, "index command", index.RuleParams.Command, "--dead_flags")
+}
+
+func TestAconfigFlagIndexUnknownValueSet(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithAconfigBuildComponents,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.ReleaseAconfigValueSetsByReleaseConfig = map[string][]string{
+				"next": {"values_next"},
+			}
+		}),
+	).RunTestWithBp(t, "")
+
+	// Unknown value sets fail the aconfig_flag_index rule, not the analysis.
+	singleton := result.SingletonForTests("aconfig_flag_index")
+	index := singleton.Output("aconfig_flag_index.json")
+	android.AssertBoolEquals(t, "error rule", true, index.Rule == android.ErrorRule)
+	android.AssertStringEquals(t, "error", "release config next uses unknown aconfig_value_set values_next",
+		index.Args["error"])
+	android.AssertPathsRelativeToTopEquals(t, "outputs",
+		[]string{"out/soong/.intermediates/aconfig_flag_index.json", "out/soong/.intermediates/aconfig_dead_flags.txt"},
+		index.Outputs.Paths())
+}
@@ -161,6 +161,7 @@ func (this *CcAconfigLibraryCallbacks) GeneratorBuildActions(ctx cc.ModuleContex
 	})
 
 	android.SetProvider(ctx, android.CodegenInfoProvider, android.CodegenInfo{
+		AconfigDeclarations: []string{declarationsModules[0].Name()},
 		ModeInfos: map[string]android.ModeInfo{
 			ctx.ModuleName(): {
 				Container: declarations.Container,
@@ -70,11 +70,30 @@ var (
 				"$aconfig",
 			},
 		}, "gendir", "mode", "debug")
+
+	// For python_aconfig_library: Generate Python library
+	pythonRule = pctx.AndroidStaticRule("python_aconfig_library",
+		blueprint.RuleParams{
+			Command: `${aconfig} dump-cache --dedup` +
+				`    --format='{package} {name} {namespace} {state:bool} {permission}'` +
+				`    --cache ${in}` +
+				`    --out ${out}.flags` +
+				` && ${gen_python_aconfig_library}` +
+				`    --mode ${mode}` +
+				`    --flags ${out}.flags` +
+				`    -o ${out}` +
+				` && rm -f ${out}.flags`,
+			CommandDeps: []string{
+				"$aconfig",
+				"$gen_python_aconfig_library",
+			},
+		}, "mode")
 )
 
 func init() {
 	RegisterBuildComponents(android.InitRegistrationContext)
 	pctx.HostBinToolVariable("aconfig", "aconfig")
+	pctx.HostBinToolVariable("gen_python_aconfig_library", "gen_python_aconfig_library")
 	pctx.HostBinToolVariable("soong_zip", "soong_zip")
 }
 
@@ -82,5 +101,6 @@ func RegisterBuildComponents(ctx android.RegistrationContext) {
 	ctx.RegisterModuleType("aconfig_declarations_group", AconfigDeclarationsGroupFactory)
 	ctx.RegisterModuleType("cc_aconfig_library", CcAconfigLibraryFactory)
 	ctx.RegisterModuleType("java_aconfig_library", JavaDeclarationsLibraryFactory)
+	ctx.RegisterModuleType("python_aconfig_library", PythonAconfigLibraryFactory)
 	ctx.RegisterModuleType("rust_aconfig_library", RustAconfigLibraryFactory)
 }
@@ -0,0 +1,113 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"strings"
+
+	"android/soong/android"
+	"android/soong/python"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+type pythonDeclarationsTagType struct {
+	blueprint.BaseDependencyTag
+}
+
+var pythonDeclarationsTag = pythonDeclarationsTagType{}
+
+type PythonAconfigLibraryProperties struct {
+	// name of the aconfig_declarations module to generate a library for
+	Aconfig_declarations string
+
+	// default mode is "production", the other accepted modes are:
+	// "test": to generate test mode version of the library, with set_flag
+	// and reset_flags to override the values of the flags
+	// "exported": to generate exported mode version of the library
+	// "force-read-only": to generate force-read-only mode version of the library
+	// an error will be thrown if the mode is not supported
+	Mode *string
+}
+
+type PythonAconfigLibraryCallbacks struct {
+	properties PythonAconfigLibraryProperties
+}
+
+// python_aconfig_library generates a Python module from the provided aconfig
+// declaration, with a function returning the value of each flag. The module
+// is named after the package of the declarations, e.g. the flags of
+// com.example.package are imported with:
+//
+//	from com.example.package import flags
+//
+// It can be added to the libs of both host and device Python modules.
+func PythonAconfigLibraryFactory() android.Module {
+	callbacks := &PythonAconfigLibraryCallbacks{
+		properties: PythonAconfigLibraryProperties{},
+	}
+	return python.GeneratedPythonLibraryModuleFactory(callbacks)
+}
+
+func (this *PythonAconfigLibraryCallbacks) GeneratorProps() []interface{} {
+	return []interface{}{&this.properties}
+}
+
+func (this *PythonAconfigLibraryCallbacks) GeneratorDeps(ctx android.BottomUpMutatorContext) {
+	// Add a dependency for the declarations module
+	declarations := this.properties.Aconfig_declarations
+	if len(declarations) == 0 {
+		ctx.PropertyErrorf("aconfig_declarations", "aconfig_declarations property required")
+	} else {
+		ctx.AddDependency(ctx.Module(), pythonDeclarationsTag, declarations)
+	}
+}
+
+func (this *PythonAconfigLibraryCallbacks) GeneratorSources(ctx android.ModuleContext) android.Paths {
+	declarationsModules := ctx.GetDirectDepsWithTag(pythonDeclarationsTag)
+	if len(declarationsModules) != 1 {
+		// The missing dependency is reported by GeneratorDeps.
+		return nil
+	}
+	declarations, _ := android.OtherModuleProvider(ctx, declarationsModules[0], android.AconfigDeclarationsProviderKey)
+
+	mode := proptools.StringDefault(this.properties.Mode, "production")
+	if !isModeSupported(mode) {
+		ctx.PropertyErrorf("mode", "%q is not a supported mode", mode)
+	}
+
+	generatedSource := android.PathForModuleGen(ctx, append(strings.Split(declarations.Package, "."), "flags.py")...)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        pythonRule,
+		Input:       declarations.IntermediateCacheOutputPath,
+		Output:      generatedSource,
+		Description: "python_aconfig_library",
+		Args: map[string]string{
+			"mode": mode,
+		},
+	})
+
+	android.SetProvider(ctx, android.CodegenInfoProvider, android.CodegenInfo{
+		AconfigDeclarations: []string{declarationsModules[0].Name()},
+		ModeInfos: map[string]android.ModeInfo{
+			ctx.ModuleName(): {
+				Container: declarations.Container,
+				Mode:      mode,
+			}},
+	})
+
+	return android.Paths{generatedSource}
+}
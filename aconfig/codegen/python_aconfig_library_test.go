@@ -0,0 +1,133 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"testing"
+
+	"android/soong/android"
+	"android/soong/python"
+)
+
+var preparePythonAconfigLibraryTest = android.GroupFixturePreparers(
+	PrepareForTestWithAconfigBuildComponents,
+	python.PrepareForTestWithPythonBuildComponents,
+	android.PrepareForTestWithArchMutator,
+	android.PrepareForTestWithAllowMissingDependencies,
+)
+
+func TestPythonAconfigLibrary(t *testing.T) {
+	result := preparePythonAconfigLibraryTest.
+		ExtendWithErrorHandler(android.FixtureExpectsNoErrors).
+		RunTestWithBp(t, `
+			aconfig_declarations {
+				name: "my_aconfig_declarations",
+				package: "com.example.package",
+				container: "com.android.foo",
+				srcs: ["foo.aconfig"],
+			}
+
+			python_aconfig_library {
+				name: "my_python_aconfig_library",
+				aconfig_declarations: "my_aconfig_declarations",
+				host_supported: true,
+			}
+		`)
+
+	for _, variant := range []string{"android_arm64_armv8-a_PY3", "linux_glibc_x86_64_PY3"} {
+		module := result.ModuleForTests("my_python_aconfig_library", variant)
+		rule := module.Rule("python_aconfig_library")
+		android.AssertStringEquals(t, "rule must contain production mode", rule.Args["mode"], "production")
+
+		generated := "out/soong/.intermediates/my_python_aconfig_library/" + variant + "/gen/com/example/package/flags.py"
+		android.AssertPathRelativeToTopEquals(t, "generated source", generated, rule.Output)
+
+		// The generated module is added to the library as com/example/package/flags.py.
+		srcsZip := module.Output("my_python_aconfig_library.py.srcszip")
+		android.AssertStringDoesContain(t, "srcs zip args", srcsZip.Args["args"],
+			"-C out/soong/.intermediates/my_python_aconfig_library/"+variant+"/gen/ -f "+generated)
+	}
+}
+
+var pythonCodegenModeTestData = []struct {
+	setting, expected string
+}{
+	{"", "production"},
+	{"mode: `production`,", "production"},
+	{"mode: `test`,", "test"},
+	{"mode: `exported`,", "exported"},
+	{"mode: `force-read-only`,", "force-read-only"},
+}
+
+func TestPythonCodegenMode(t *testing.T) {
+	for _, testData := range pythonCodegenModeTestData {
+		testPythonCodegenModeHelper(t, testData.setting, testData.expected)
+	}
+}
+
+func testPythonCodegenModeHelper(t *testing.T, bpMode string, ruleMode string) {
+	t.Helper()
+	result := preparePythonAconfigLibraryTest.
+		ExtendWithErrorHandler(android.FixtureExpectsNoErrors).
+		RunTestWithBp(t, fmt.Sprintf(`
+			aconfig_declarations {
+				name: "my_aconfig_declarations",
+				package: "com.example.package",
+				container: "com.android.foo",
+				srcs: ["foo.aconfig"],
+			}
+			python_aconfig_library {
+				name: "my_python_aconfig_library",
+				aconfig_declarations: "my_aconfig_declarations",
+				%s
+			}
+		`, bpMode))
+
+	module := result.ModuleForTests("my_python_aconfig_library", "android_arm64_armv8-a_PY3")
+	rule := module.Rule("python_aconfig_library")
+	android.AssertStringEquals(t, "rule must contain test mode", rule.Args["mode"], ruleMode)
+}
+
+var incorrectPythonCodegenModeTestData = []struct {
+	setting, expectedErr string
+}{
+	{"mode: `unsupported`,", "mode: \"unsupported\" is not a supported mode"},
+}
+
+func TestIncorrectPythonCodegenMode(t *testing.T) {
+	for _, testData := range incorrectPythonCodegenModeTestData {
+		testIncorrectPythonCodegenModeHelper(t, testData.setting, testData.expectedErr)
+	}
+}
+
+func testIncorrectPythonCodegenModeHelper(t *testing.T, bpMode string, err string) {
+	t.Helper()
+	preparePythonAconfigLibraryTest.
+		ExtendWithErrorHandler(android.FixtureExpectsOneErrorPattern(err)).
+		RunTestWithBp(t, fmt.Sprintf(`
+			aconfig_declarations {
+				name: "my_aconfig_declarations",
+				package: "com.example.package",
+				container: "com.android.foo",
+				srcs: ["foo.aconfig"],
+			}
+			python_aconfig_library {
+				name: "my_python_aconfig_library",
+				aconfig_declarations: "my_aconfig_declarations",
+				%s
+			}
+		`, bpMode))
+}
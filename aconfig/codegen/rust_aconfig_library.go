@@ -89,6 +89,7 @@ func (a *aconfigDecorator) GenerateSource(ctx rust.ModuleContext, deps rust.Path
 	a.BaseSourceProvider.OutputFiles = android.Paths{generatedSource}
 
 	android.SetProvider(ctx, android.CodegenInfoProvider, android.CodegenInfo{
+		AconfigDeclarations: []string{declarationsModules[0].Name()},
 		ModeInfos: map[string]android.ModeInfo{
 			ctx.ModuleName(): {
 				Container: declarations.Container,
@@ -54,6 +54,17 @@ var (
 			Restat: true,
 		})
 
+	// For aconfig_flag_index: Dump the state and permission of each flag
+	aconfigFlagStatesRule = pctx.AndroidStaticRule("aconfig_flag_states",
+		blueprint.RuleParams{
+			Command: `${aconfig} dump-cache --dedup --format='{fully_qualified_name} {state:bool} {permission}'` +
+				` --cache ${in}` +
+				` --out ${out}`,
+			CommandDeps: []string{
+				"${aconfig}",
+			},
+		})
+
 	// For all_aconfig_declarations: Combine all parsed_flags proto files
 	AllDeclarationsRule = pctx.AndroidStaticRule("All_aconfig_declarations_dump",
 		blueprint.RuleParams{
@@ -114,4 +125,5 @@ func RegisterBuildComponents(ctx android.RegistrationContext) {
 	ctx.RegisterModuleType("aconfig_value_set", ValueSetFactory)
 	ctx.RegisterParallelSingletonType("all_aconfig_declarations", AllAconfigDeclarationsFactory)
 	ctx.RegisterParallelSingletonType("exported_java_aconfig_library", ExportedJavaDeclarationsLibraryFactory)
+	ctx.RegisterParallelSingletonType("aconfig_flag_index", AconfigFlagIndexFactory)
 }
@@ -54,18 +54,8 @@ func (p *buildinfoPropModule) OutputFiles(tag string) (Paths, error) {
 	return Paths{p.outputFilePath}, nil
 }
 
-func getBuildVariant(config Config) string {
-	if config.Eng() {
-		return "eng"
-	} else if config.Debuggable() {
-		return "userdebug"
-	} else {
-		return "user"
-	}
-}
-
 func getBuildFlavor(config Config) string {
-	buildFlavor := config.DeviceProduct() + "-" + getBuildVariant(config)
+	buildFlavor := config.DeviceProduct() + "-" + config.BuildVariant()
 	if InList("address", config.SanitizeDevice()) && !strings.Contains(buildFlavor, "_asan") {
 		buildFlavor += "_asan"
 	}
@@ -101,7 +91,7 @@ func (p *buildinfoPropModule) GenerateAndroidBuildActions(ctx ModuleContext) {
 	rule := NewRuleBuilder(pctx, ctx)
 
 	config := ctx.Config()
-	buildVariant := getBuildVariant(config)
+	buildVariant := config.BuildVariant()
 	buildFlavor := getBuildFlavor(config)
 
 	cmd := rule.Command().BuiltTool("buildinfo")
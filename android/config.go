@@ -198,6 +198,12 @@ func (c Config) ReleaseAconfigValueSets() []string {
 	return c.config.productVariables.ReleaseAconfigValueSets
 }
 
+// The aconfig value sets of every release config of the product, derived from
+// their RELEASE_ACONFIG_VALUE_SETS
+func (c Config) ReleaseAconfigValueSetsByReleaseConfig() map[string][]string {
+	return c.config.productVariables.ReleaseAconfigValueSetsByReleaseConfig
+}
+
 // The flag default permission value passed to aconfig
 // derived from RELEASE_ACONFIG_FLAG_DEFAULT_PERMISSION
 func (c Config) ReleaseAconfigFlagDefaultPermission() string {
@@ -1116,6 +1122,18 @@ func (c *config) BuildType() string {
 	return String(c.productVariables.BuildType)
 }
 
+// BuildVariant returns the TARGET_BUILD_VARIANT of the build: eng, userdebug or
+// user.
+func (c *config) BuildVariant() string {
+	if c.Eng() {
+		return "eng"
+	} else if c.Debuggable() {
+		return "userdebug"
+	} else {
+		return "user"
+	}
+}
+
 // DevicePrimaryArchType returns the ArchType for the first configured device architecture, or
 // Common if there are no device architectures.
 func (c *config) DevicePrimaryArchType() ArchType {
@@ -2071,6 +2089,31 @@ func (c *deviceConfig) CheckVendorSeappViolations() bool {
 	return Bool(c.config.productVariables.CheckVendorSeappViolations)
 }
 
+// LicensePolicyFile returns the path of the policy that the license metadata of
+// containers is checked against, or an empty string if the product has none.
+func (c *deviceConfig) LicensePolicyFile() string {
+	return String(c.config.productVariables.LicensePolicyFile)
+}
+
+// ProvenanceRepoManifest returns the path of the repo manifest that records the
+// revisions of the source tree in the SLSA provenance, or an empty string if
+// there is none.
+func (c *deviceConfig) ProvenanceRepoManifest() string {
+	return String(c.config.productVariables.ProvenanceRepoManifest)
+}
+
+// ProvenanceSigningKey returns the path of the private key that signs the SLSA
+// provenance, or an empty string if it is not signed with a local key.
+func (c *deviceConfig) ProvenanceSigningKey() string {
+	return String(c.config.productVariables.ProvenanceSigningKey)
+}
+
+// ProvenanceSigningCommand returns the command that signs the SLSA provenance,
+// or an empty string if it is not signed with a command.
+func (c *deviceConfig) ProvenanceSigningCommand() string {
+	return String(c.config.productVariables.ProvenanceSigningCommand)
+}
+
 func (c *config) GetBuildFlag(name string) (string, bool) {
 	val, ok := c.productVariables.BuildFlags[name]
 	return val, ok
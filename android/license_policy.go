@@ -0,0 +1,55 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"github.com/google/blueprint"
+)
+
+var (
+	_ = pctx.HostBinToolVariable("licensePolicyCheckCmd", "check_license_policy")
+
+	licensePolicyCheckRule = pctx.AndroidStaticRule("licensePolicyCheckRule", blueprint.RuleParams{
+		Command:     "${licensePolicyCheckCmd} --policy ${policy} -o $out -d ${out}.d $in",
+		CommandDeps: []string{"${licensePolicyCheckCmd}"},
+		Deps:        blueprint.DepsGCC,
+		Depfile:     "${out}.d",
+		Description: "license policy check",
+	}, "policy")
+)
+
+// BuildLicensePolicyCheck checks the license metadata graph of the container
+// built by the current context module against the license policy of the
+// product. It returns the timestamp file of the check, to be added as a
+// validation of the rule that builds the container, or nothing if the product
+// has no license policy.
+func BuildLicensePolicyCheck(ctx ModuleContext) Paths {
+	policyFile := ctx.DeviceConfig().LicensePolicyFile()
+	if policyFile == "" {
+		return nil
+	}
+	policy := PathForSource(ctx, policyFile)
+	timestamp := PathForModuleOut(ctx, "license_policy_check.timestamp")
+	ctx.Build(pctx, BuildParams{
+		Rule:     licensePolicyCheckRule,
+		Input:    ctx.LicenseMetadataFile(),
+		Implicit: policy,
+		Output:   timestamp,
+		Args: map[string]string{
+			"policy": policy.String(),
+		},
+	})
+	return Paths{timestamp}
+}
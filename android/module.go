@@ -2672,17 +2672,23 @@ type IDECustomizedModuleName interface {
 }
 
 type IdeInfo struct {
-	Deps              []string `json:"dependencies,omitempty"`
-	Srcs              []string `json:"srcs,omitempty"`
-	Aidl_include_dirs []string `json:"aidl_include_dirs,omitempty"`
-	Jarjar_rules      []string `json:"jarjar_rules,omitempty"`
-	Jars              []string `json:"jars,omitempty"`
-	Classes           []string `json:"class,omitempty"`
-	Installed_paths   []string `json:"installed,omitempty"`
-	SrcJars           []string `json:"srcjars,omitempty"`
-	Paths             []string `json:"path,omitempty"`
-	Static_libs       []string `json:"static_libs,omitempty"`
-	Libs              []string `json:"libs,omitempty"`
+	Deps               []string `json:"dependencies,omitempty"`
+	Srcs               []string `json:"srcs,omitempty"`
+	Aidl_include_dirs  []string `json:"aidl_include_dirs,omitempty"`
+	Jarjar_rules       []string `json:"jarjar_rules,omitempty"`
+	Jars               []string `json:"jars,omitempty"`
+	Classes            []string `json:"class,omitempty"`
+	Installed_paths    []string `json:"installed,omitempty"`
+	SrcJars            []string `json:"srcjars,omitempty"`
+	Paths              []string `json:"path,omitempty"`
+	Static_libs        []string `json:"static_libs,omitempty"`
+	Libs               []string `json:"libs,omitempty"`
+	Kotlin_src_dirs    []string `json:"kotlin_src_dirs,omitempty"`
+	Generated_src_dirs []string `json:"generated_src_dirs,omitempty"`
+	Resource_dirs      []string `json:"resource_dirs,omitempty"`
+	Sdk_version        string   `json:"sdk_version,omitempty"`
+	System_modules     string   `json:"system_modules,omitempty"`
+	Java_version       string   `json:"java_version,omitempty"`
 }
 
 func CheckBlueprintSyntax(ctx BaseModuleContext, filename string, contents string) []error {
@@ -0,0 +1,52 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+// SbomPhonyName returns the name of the phony target that builds the SBOMs of
+// the container built by the named module.
+func SbomPhonyName(moduleName string) string {
+	return moduleName + "-sbom"
+}
+
+// BuildSbomFromLicenseMetadata writes out SPDX and CycloneDX SBOMs for the
+// container built by the current context module, and adds them to the
+// <module>-sbom phony target. The SBOMs describe the packages and files found
+// by walking the license metadata of the container. stripPrefix lists the
+// prefixes to remove from the paths of the files in the container that are not
+// in its license install map.
+func BuildSbomFromLicenseMetadata(ctx ModuleContext, container Path, stripPrefix []string) (spdx, cycloneDx Path) {
+	licenseMetadata := ctx.LicenseMetadataFile()
+	if licenseMetadata == nil {
+		return nil, nil
+	}
+	spdxFile := PathForModuleOut(ctx, "sbom", container.Base()+".spdx.json")
+	cycloneDxFile := PathForModuleOut(ctx, "sbom", container.Base()+".cdx.json")
+
+	rule := NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("gen_sbom").
+		FlagWithOutput("--spdx ", spdxFile).
+		FlagWithOutput("--cyclonedx ", cycloneDxFile).
+		FlagWithDepFile("-d ", spdxFile.ReplaceExtension(ctx, "d")).
+		FlagWithArg("--product ", ctx.ModuleName()).
+		FlagForEachArg("--strip_prefix ", stripPrefix).
+		// The files in the container are hashed, so they must all be built.
+		Implicit(container).
+		Input(licenseMetadata)
+	rule.Build("sbom", "SBOM for "+container.Base())
+
+	ctx.Phony(SbomPhonyName(ctx.ModuleName()), spdxFile, cycloneDxFile)
+	return spdxFile, cycloneDxFile
+}
@@ -539,6 +539,10 @@ type ProductVariables struct {
 	ReleaseVersion          string   `json:",omitempty"`
 	ReleaseAconfigValueSets []string `json:",omitempty"`
 
+	// The RELEASE_ACONFIG_VALUE_SETS of every release config of the product,
+	// for aconfig_flag_index.
+	ReleaseAconfigValueSetsByReleaseConfig map[string][]string `json:",omitempty"`
+
 	ReleaseAconfigFlagDefaultPermission string `json:",omitempty"`
 
 	ReleaseDefaultModuleBuildFromSource *bool `json:",omitempty"`
@@ -568,6 +572,14 @@ type ProductVariables struct {
 	OemProperties []string `json:",omitempty"`
 
 	DisableSoongConfigTrace *bool `json:",omitempty"`
+
+	// The license policy that the license metadata of containers is checked against, e.g.
+	// build/soong/compliance/license_policy.json. Containers are not checked if it is unset.
+	LicensePolicyFile *string `json:",omitempty"`
+
+	ProvenanceRepoManifest   *string `json:",omitempty"`
+	ProvenanceSigningKey     *string `json:",omitempty"`
+	ProvenanceSigningCommand *string `json:",omitempty"`
 }
 
 type PartitionQualifiedVariablesType struct {
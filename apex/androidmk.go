@@ -291,6 +291,14 @@ func (a *apexBundle) androidMkForType() android.AndroidMkData {
 					goal, a.installedFilesFile.String(), distFile)
 				fmt.Fprintf(w, "$(call declare-0p-target,%s)\n", a.installedFilesFile.String())
 			}
+			if a.contentManifestFile != nil {
+				goal := "checkbuild"
+				distFile := name + "-content-manifest.json"
+				fmt.Fprintln(w, ".PHONY:", goal)
+				fmt.Fprintf(w, "$(call dist-for-goals,%s,%s:%s)\n",
+					goal, a.contentManifestFile.String(), distFile)
+				fmt.Fprintf(w, "$(call declare-0p-target,%s)\n", a.contentManifestFile.String())
+			}
 			for _, dist := range data.Entries.GetDistForGoals(a) {
 				fmt.Fprintf(w, dist)
 			}
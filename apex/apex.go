@@ -136,6 +136,15 @@ type apexBundleProperties struct {
 	// Rust binaries with prefer_rlib:true add unnecessary dependencies.
 	Unwanted_transitive_deps []string
 
+	// Whether to check that the native files in this APEX only reference the symbols of the stub
+	// libraries outside of the APEX that are available at its min_sdk_version. Default is true.
+	Symbol_check *bool
+
+	// Whether to check that the DT_NEEDED libraries of the native files in this APEX resolve in
+	// its linker namespace, given the provideNativeLibs and requireNativeLibs of its
+	// apex_manifest.json. Default is true.
+	Linker_namespace_check *bool
+
 	// Whether this APEX is considered updatable or not. When set to true, this will enforce
 	// additional rules for making sure that the APEX is truly updatable. To be updatable,
 	// min_sdk_version should be set as well. This will also disable the size optimizations like
@@ -429,12 +438,19 @@ type apexBundle struct {
 	// GenerateAndroidBuildActions.
 	filesInfo []apexFile
 
+	// List of the stub libraries outside of this APEX that the native files in it link against.
+	// This is filled in the first part of GenerateAndroidBuildActions.
+	requiredStubLibraries []apexStubLibrary
+
 	// List of other module names that should be installed when this APEX gets installed (LOCAL_REQUIRED_MODULES).
 	makeModulesToInstall []string
 
 	///////////////////////////////////////////////////////////////////////////////////////////
 	// Outputs (final and intermediates)
 
+	// Processed apex manifest in JSON format, with the provided and required native libs
+	manifestJsonFullOut android.WritablePath
+
 	// Processed apex manifest in JSONson format (for Q)
 	manifestJsonOut android.WritablePath
 
@@ -474,6 +490,9 @@ type apexBundle struct {
 	// debugging purpose.
 	installedFilesFile android.WritablePath
 
+	// Content manifest listing the files in the APEX with their size, SHA-256 and source module.
+	contentManifestFile android.WritablePath
+
 	// List of module names that this APEX is including (to be shown via *-deps-info target).
 	// Used for debugging purpose.
 	android.ApexBundleDepsInfo
@@ -549,6 +568,9 @@ type apexFile struct {
 	transitiveDep bool
 	isJniLib      bool
 
+	// true if this is a transitive dependency that is only reached through the JNI libraries
+	requiredByJniLib bool
+
 	multilib string
 
 	// TODO(jiyong): remove this
@@ -586,6 +608,18 @@ func (af *apexFile) apexRelativePath(path string) string {
 	return filepath.Join(af.installDir, path)
 }
 
+// inclusionReason returns why this apex file is in the APEX: "direct", "transitive" or
+// "required_by_jni_lib".
+func (af *apexFile) inclusionReason() string {
+	if !af.transitiveDep {
+		return "direct"
+	}
+	if af.requiredByJniLib {
+		return "required_by_jni_lib"
+	}
+	return "transitive"
+}
+
 // path returns path of this apex file relative to the APEX root
 func (af *apexFile) path() string {
 	return af.apexRelativePath(af.stem())
@@ -1910,6 +1944,14 @@ func (a *apexBundle) commonBuildActions(ctx android.ModuleContext) bool {
 	return true
 }
 
+// apexStubLibrary is a library outside of the APEX that the native files in the APEX link
+// against through its stubs.
+type apexStubLibrary struct {
+	stem     string
+	multilib string
+	stubs    []cc.SharedStubLibrary
+}
+
 type visitorContext struct {
 	// all the files that will be included in this APEX
 	filesInfo []apexFile
@@ -1918,6 +1960,9 @@ type visitorContext struct {
 	provideNativeLibs []string
 	requireNativeLibs []string
 
+	// stub libraries behind requireNativeLibs
+	requiredStubLibraries []apexStubLibrary
+
 	handleSpecialLibs bool
 
 	// if true, raise error on duplicate apexFile
@@ -1926,9 +1971,43 @@ type visitorContext struct {
 	// visitor skips these from this list of module names
 	unwantedTransitiveDeps []string
 
+	// the direct dependencies that are JNI libraries and the other direct dependencies, and
+	// the dependencies of each indirect module, used to find the modules that are only
+	// reached through the JNI libraries
+	jniLibs       []blueprint.Module
+	nonJniDirects []blueprint.Module
+	indirectDeps  map[blueprint.Module][]blueprint.Module
+
 	aconfigFiles []android.Path
 }
 
+// markRequiredByJniLib marks the transitive dependencies that are reached through the JNI
+// libraries but not through any other direct dependency. This is done once all the
+// dependencies are walked because WalkDeps only descends into a module the first time it
+// reaches it.
+func (vctx *visitorContext) markRequiredByJniLib() {
+	reachable := func(roots []blueprint.Module) map[blueprint.Module]bool {
+		ret := make(map[blueprint.Module]bool)
+		queue := append([]blueprint.Module(nil), roots...)
+		for len(queue) > 0 {
+			m := queue[0]
+			queue = queue[1:]
+			if ret[m] {
+				continue
+			}
+			ret[m] = true
+			queue = append(queue, vctx.indirectDeps[m]...)
+		}
+		return ret
+	}
+	fromJniLibs := reachable(vctx.jniLibs)
+	fromOthers := reachable(vctx.nonJniDirects)
+	for i := range vctx.filesInfo {
+		f := &vctx.filesInfo[i]
+		f.requiredByJniLib = f.transitiveDep && f.module != nil && fromJniLibs[f.module] && !fromOthers[f.module]
+	}
+}
+
 func (vctx *visitorContext) normalizeFileInfo(mctx android.ModuleContext) {
 	encountered := make(map[string]apexFile)
 	for _, f := range vctx.filesInfo {
@@ -1954,6 +2033,9 @@ func (vctx *visitorContext) normalizeFileInfo(mctx android.ModuleContext) {
 			// If a module is added as both a JNI library and a regular shared library, consider it as a
 			// JNI library.
 			e.isJniLib = e.isJniLib || f.isJniLib
+			// If a module is reached both through a JNI library and otherwise, consider it as
+			// a regular transitive dependency.
+			e.requiredByJniLib = e.requiredByJniLib && f.requiredByJniLib
 			encountered[dest] = e
 		}
 	}
@@ -1978,6 +2060,11 @@ func (a *apexBundle) depVisitor(vctx *visitorContext, ctx android.ModuleContext,
 	}
 	depName := ctx.OtherModuleName(child)
 	if _, isDirectDep := parent.(*apexBundle); isDirectDep {
+		if depTag == jniLibTag {
+			vctx.jniLibs = append(vctx.jniLibs, child)
+		} else {
+			vctx.nonJniDirects = append(vctx.nonJniDirects, child)
+		}
 		switch depTag {
 		case sharedLibTag, jniLibTag:
 			isJniLib := depTag == jniLibTag
@@ -2177,6 +2264,7 @@ func (a *apexBundle) depVisitor(vctx *visitorContext, ctx android.ModuleContext,
 	if !ok {
 		return false
 	}
+	vctx.indirectDeps[parent] = append(vctx.indirectDeps[parent], child)
 	// We cannot use a switch statement on `depTag` here as the checked
 	// tags used below are private (e.g. `cc.sharedDepTag`).
 	if cc.IsSharedDepTag(depTag) || cc.IsRuntimeDepTag(depTag) {
@@ -2204,6 +2292,13 @@ func (a *apexBundle) depVisitor(vctx *visitorContext, ctx android.ModuleContext,
 					}
 				}
 				vctx.requireNativeLibs = append(vctx.requireNativeLibs, af.stem())
+				if stubsInfo, ok := android.OtherModuleProvider(ctx, child, cc.SharedLibraryStubsProvider); ok {
+					vctx.requiredStubLibraries = append(vctx.requiredStubLibraries, apexStubLibrary{
+						stem:     af.stem(),
+						multilib: af.multilib,
+						stubs:    stubsInfo.SharedStubLibraries,
+					})
+				}
 				// Don't track further
 				return false
 			}
@@ -2360,8 +2455,10 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		handleSpecialLibs:      !android.Bool(a.properties.Ignore_system_library_special_case),
 		checkDuplicate:         a.shouldCheckDuplicate(ctx),
 		unwantedTransitiveDeps: a.properties.Unwanted_transitive_deps,
+		indirectDeps:           make(map[blueprint.Module][]blueprint.Module),
 	}
 	ctx.WalkDepsBlueprint(func(child, parent blueprint.Module) bool { return a.depVisitor(&vctx, ctx, child, parent) })
+	vctx.markRequiredByJniLib()
 	vctx.normalizeFileInfo(ctx)
 	if a.privateKeyFile == nil {
 		if ctx.Config().AllowMissingDependencies() {
@@ -2409,6 +2506,7 @@ func (a *apexBundle) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	// 3) some fields in apexBundle struct are configured
 	a.installDir = android.PathForModuleInstall(ctx, "apex")
 	a.filesInfo = vctx.filesInfo
+	a.requiredStubLibraries = vctx.requiredStubLibraries
 	a.aconfigFiles = android.FirstUniquePaths(vctx.aconfigFiles)
 
 	a.setPayloadFsType(ctx)
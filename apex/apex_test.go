@@ -15,6 +15,7 @@
 package apex
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"path/filepath"
@@ -1306,6 +1307,206 @@ func TestApex_PlatformUsesLatestStubFromApex(t *testing.T) {
 	ensureContains(t, libplatformLdflags, "libstub/android_arm64_armv8-a_shared_current/libstub.so ")
 }
 
+func TestApexSymbolCheck(t *testing.T) {
+	t.Parallel()
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			min_sdk_version: "30",
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["libold", "libnew"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+			min_sdk_version: "30",
+		}
+
+		cc_library {
+			name: "libold",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			stubs: {
+				versions: ["29", "31"],
+			},
+		}
+
+		cc_library {
+			name: "libnew",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			stubs: {
+				versions: ["31"],
+			},
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex")
+	rule := module.Rule("apex_symbol_check")
+	cmd := rule.RuleParams.Command
+	ensureContains(t, cmd, "--apex myapex ")
+	ensureContains(t, cmd, "--min_sdk_version 30 ")
+	ensureContains(t, cmd, "--elf lib64/mylib.so=out/soong/.intermediates/mylib/android_arm64_armv8-a_shared_apex30/mylib.so ")
+	// libold is linked against its latest stubs, but only the symbols of its version 29 stubs
+	// are available at the min_sdk_version.
+	ensureContains(t, cmd, "--stubs libold.so:"+
+		"out/soong/.intermediates/libold/android_arm64_armv8-a_shared_29/gen/abi_symbol_list.txt:"+
+		"out/soong/.intermediates/libold/android_arm64_armv8-a_shared_current/gen/abi_symbol_list.txt ")
+	// libnew has no stubs up to the min_sdk_version, so it doesn't exist on the oldest devices
+	// and there is nothing to check it against.
+	ensureNotContains(t, cmd, "libnew")
+
+	// The check runs as a validation of the APEX.
+	signapk := module.Rule("signapk")
+	android.AssertStringListContains(t, "signapk validations", signapk.Validations.Strings(),
+		"out/soong/.intermediates/myapex/android_common_myapex/apex_symbol_check.timestamp")
+}
+
+func TestApexSymbolCheckDisabled(t *testing.T) {
+	t.Parallel()
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			min_sdk_version: "30",
+			symbol_check: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["libold"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+			min_sdk_version: "30",
+		}
+
+		cc_library {
+			name: "libold",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			stubs: {
+				versions: ["29", "31"],
+			},
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex")
+	if rule := module.MaybeRule("apex_symbol_check"); rule.Rule != nil {
+		t.Errorf("expected no apex_symbol_check rule with symbol_check: false")
+	}
+	android.AssertStringListDoesNotContain(t, "signapk validations", module.Rule("signapk").Validations.Strings(),
+		"out/soong/.intermediates/myapex/android_common_myapex/apex_symbol_check.timestamp")
+}
+
+func TestApexLinkerNamespaceCheck(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			updatable: false,
+		}
+
+		apex_test {
+			name: "mytestapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex", "mytestapex"],
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex")
+	rule := module.Rule("linker_namespace_check")
+	cmd := rule.RuleParams.Command
+	ensureContains(t, cmd, "--type apex ")
+	ensureContains(t, cmd, "--name myapex ")
+	ensureContains(t, cmd, "--apex_manifest out/soong/.intermediates/myapex/android_common_myapex/apex_manifest_full.json ")
+	ensureContains(t, cmd, "--root out/soong/.intermediates/myapex/android_common_myapex/image.apex ")
+	android.AssertStringListContains(t, "linker_namespace_check implicits", rule.Implicits.Strings(),
+		"out/soong/.intermediates/myapex/android_common_myapex/myapex.apex.unsigned")
+
+	// The check runs as a validation of the APEX.
+	signapk := module.Rule("signapk")
+	android.AssertStringListContains(t, "signapk validations", signapk.Validations.Strings(),
+		"out/soong/.intermediates/myapex/android_common_myapex/linker_namespace_check.timestamp")
+
+	// Test APEXes are not checked.
+	testModule := ctx.ModuleForTests("mytestapex", "android_common_mytestapex")
+	if testModule.MaybeRule("linker_namespace_check").Rule != nil {
+		t.Errorf("expected no linker_namespace_check for mytestapex")
+	}
+}
+
+func TestApexLinkerNamespaceCheckDisabled(t *testing.T) {
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			updatable: false,
+			linker_namespace_check: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: ["myapex"],
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex")
+	if rule := module.MaybeRule("linker_namespace_check"); rule.Rule != nil {
+		t.Errorf("expected no linker_namespace_check rule with linker_namespace_check: false")
+	}
+	android.AssertStringListDoesNotContain(t, "signapk validations", module.Rule("signapk").Validations.Strings(),
+		"out/soong/.intermediates/myapex/android_common_myapex/linker_namespace_check.timestamp")
+}
+
 func TestApexWithExplicitStubsDependency(t *testing.T) {
 	ctx := testApex(t, `
 		apex {
@@ -7824,6 +8025,170 @@ func TestApexWithJniLibs(t *testing.T) {
 	ensureListContains(t, names(rule.Args["requireNativeLibs"]), "libfoo.shared_from_rust.so")
 }
 
+func TestApexContentManifest(t *testing.T) {
+	t.Parallel()
+	ctx := testApex(t, `
+		apex {
+			name: "myapex",
+			key: "myapex.key",
+			native_shared_libs: ["mylib"],
+			jni_libs: ["libjni"],
+			updatable: false,
+		}
+
+		apex_key {
+			name: "myapex.key",
+			public_key: "testkey.avbpubkey",
+			private_key: "testkey.pem",
+		}
+
+		cc_library {
+			name: "mylib",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["mylib2"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+		}
+
+		cc_library {
+			name: "mylib2",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+		}
+
+		cc_library {
+			name: "libjni",
+			srcs: ["mylib.cpp"],
+			shared_libs: ["libjnidep"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+		}
+
+		cc_library {
+			name: "libjnidep",
+			srcs: ["mylib.cpp"],
+			system_shared_libs: [],
+			stl: "none",
+			apex_available: [ "myapex" ],
+		}
+	`)
+
+	module := ctx.ModuleForTests("myapex", "android_common_myapex")
+	type content struct {
+		Path   string `json:"path"`
+		Module string `json:"module"`
+		Reason string `json:"reason"`
+	}
+	var contents []content
+	contentsJson := android.ContentFromFileRuleForTests(t, ctx, module.Output("content-manifest-contents.json"))
+	if err := json.Unmarshal([]byte(contentsJson), &contents); err != nil {
+		t.Fatal(err)
+	}
+	android.AssertDeepEquals(t, "contents", []content{
+		{Path: "lib64/libjni.so", Module: "libjni", Reason: "direct"},
+		{Path: "lib64/libjnidep.so", Module: "libjnidep", Reason: "required_by_jni_lib"},
+		{Path: "lib64/mylib.so", Module: "mylib", Reason: "direct"},
+		{Path: "lib64/mylib2.so", Module: "mylib2", Reason: "transitive"},
+	}, contents)
+
+	rule := module.Rule("content-manifest.myapex")
+	ensureContains(t, rule.RuleParams.Command, "apex_diff manifest --apex myapex "+
+		"--image_dir out/soong/.intermediates/myapex/android_common_myapex/image.apex "+
+		"--contents out/soong/.intermediates/myapex/android_common_myapex/content-manifest-contents.json "+
+		"-o out/soong/.intermediates/myapex/android_common_myapex/content-manifest.json")
+}
+
+func TestApexContentManifestDiamond(t *testing.T) {
+	t.Parallel()
+	// liba and libb both depend on libshared, so libshared and its dependencies are not
+	// only required by the JNI library whichever of them it is, and whichever path the
+	// dependency walk reaches libshared through first.
+	for _, tc := range []struct {
+		name      string
+		nativeLib string
+		jniLib    string
+	}{
+		{name: "jni lib first", nativeLib: "libb", jniLib: "liba"},
+		{name: "jni lib last", nativeLib: "liba", jniLib: "libb"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := testApex(t, `
+				apex {
+					name: "myapex",
+					key: "myapex.key",
+					native_shared_libs: ["`+tc.nativeLib+`"],
+					jni_libs: ["`+tc.jniLib+`"],
+					updatable: false,
+				}
+
+				apex_key {
+					name: "myapex.key",
+					public_key: "testkey.avbpubkey",
+					private_key: "testkey.pem",
+				}
+
+				cc_library {
+					name: "liba",
+					srcs: ["mylib.cpp"],
+					shared_libs: ["libshared"],
+					system_shared_libs: [],
+					stl: "none",
+					apex_available: [ "myapex" ],
+				}
+
+				cc_library {
+					name: "libb",
+					srcs: ["mylib.cpp"],
+					shared_libs: ["libshared"],
+					system_shared_libs: [],
+					stl: "none",
+					apex_available: [ "myapex" ],
+				}
+
+				cc_library {
+					name: "libshared",
+					srcs: ["mylib.cpp"],
+					shared_libs: ["libshareddep"],
+					system_shared_libs: [],
+					stl: "none",
+					apex_available: [ "myapex" ],
+				}
+
+				cc_library {
+					name: "libshareddep",
+					srcs: ["mylib.cpp"],
+					system_shared_libs: [],
+					stl: "none",
+					apex_available: [ "myapex" ],
+				}
+			`)
+
+			module := ctx.ModuleForTests("myapex", "android_common_myapex")
+			type content struct {
+				Path   string `json:"path"`
+				Module string `json:"module"`
+				Reason string `json:"reason"`
+			}
+			var contents []content
+			contentsJson := android.ContentFromFileRuleForTests(t, ctx, module.Output("content-manifest-contents.json"))
+			if err := json.Unmarshal([]byte(contentsJson), &contents); err != nil {
+				t.Fatal(err)
+			}
+			android.AssertDeepEquals(t, "contents", []content{
+				{Path: "lib64/liba.so", Module: "liba", Reason: "direct"},
+				{Path: "lib64/libb.so", Module: "libb", Reason: "direct"},
+				{Path: "lib64/libshared.so", Module: "libshared", Reason: "transitive"},
+				{Path: "lib64/libshareddep.so", Module: "libshareddep", Reason: "transitive"},
+			}, contents)
+		})
+	}
+}
+
 func TestApexMutatorsDontRunIfDisabled(t *testing.T) {
 	ctx := testApex(t, `
 		apex {
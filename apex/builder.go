@@ -27,6 +27,8 @@ import (
 	"android/soong/aconfig"
 	"android/soong/android"
 	"android/soong/java"
+	"android/soong/linkerconfig"
+	"android/soong/provenance"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/proptools"
@@ -298,7 +300,7 @@ func (a *apexBundle) buildManifest(ctx android.ModuleContext, provideNativeLibs,
 		}
 	}
 
-	manifestJsonFullOut := android.PathForModuleOut(ctx, "apex_manifest_full.json")
+	a.manifestJsonFullOut = android.PathForModuleOut(ctx, "apex_manifest_full.json")
 	defaultVersion := android.DefaultUpdatableModuleVersion
 	if a.properties.Variant_version != nil {
 		defaultVersionInt, err := strconv.Atoi(defaultVersion)
@@ -322,7 +324,7 @@ func (a *apexBundle) buildManifest(ctx android.ModuleContext, provideNativeLibs,
 	ctx.Build(pctx, android.BuildParams{
 		Rule:   apexManifestRule,
 		Input:  src,
-		Output: manifestJsonFullOut,
+		Output: a.manifestJsonFullOut,
 		Args: map[string]string{
 			"provideNativeLibs": strings.Join(provideNativeLibs, " "),
 			"requireNativeLibs": strings.Join(requireNativeLibs, " "),
@@ -338,7 +340,7 @@ func (a *apexBundle) buildManifest(ctx android.ModuleContext, provideNativeLibs,
 		a.manifestJsonOut = android.PathForModuleOut(ctx, "apex_manifest.json")
 		ctx.Build(pctx, android.BuildParams{
 			Rule:   stripApexManifestRule,
-			Input:  manifestJsonFullOut,
+			Input:  a.manifestJsonFullOut,
 			Output: a.manifestJsonOut,
 		})
 	}
@@ -347,7 +349,7 @@ func (a *apexBundle) buildManifest(ctx android.ModuleContext, provideNativeLibs,
 	a.manifestPbOut = android.PathForModuleOut(ctx, "apex_manifest.pb")
 	ctx.Build(pctx, android.BuildParams{
 		Rule:   pbApexManifestRule,
-		Input:  manifestJsonFullOut,
+		Input:  a.manifestJsonFullOut,
 		Output: a.manifestPbOut,
 	})
 }
@@ -428,6 +430,52 @@ func (a *apexBundle) buildInstalledFilesFile(ctx android.ModuleContext, builtApe
 	return output.OutputPath
 }
 
+// buildContentManifest creates a build rule for the content-manifest.json file, which lists
+// each file in this APEX with its size, SHA-256, the module it comes from and why it was
+// included. Two content manifests can be compared with `apex_diff diff` to find the modules
+// that make an APEX grow.
+func (a *apexBundle) buildContentManifest(ctx android.ModuleContext, builtApex android.Path, imageDir android.Path) android.OutputPath {
+	type content struct {
+		Path   string `json:"path"`
+		Module string `json:"module"`
+		Reason string `json:"reason"`
+	}
+	var contents []content
+	for _, fi := range a.filesInfo {
+		moduleName := fi.androidMkModuleName
+		if fi.module != nil {
+			moduleName = ctx.OtherModuleName(fi.module)
+		}
+		reason := fi.inclusionReason()
+		paths := append([]string{fi.path()}, fi.symlinkPaths()...)
+		for _, d := range fi.dataPaths {
+			paths = append(paths, fi.apexRelativePath(d.ToRelativeInstallPath()))
+		}
+		for _, path := range paths {
+			contents = append(contents, content{Path: path, Module: moduleName, Reason: reason})
+		}
+	}
+	contentsFile := android.PathForModuleOut(ctx, "content-manifest-contents.json")
+	contentsJson, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		panic(fmt.Errorf("error while marshalling to %q: %#v", contentsFile, err))
+	}
+	android.WriteFileRule(ctx, contentsFile, string(contentsJson))
+
+	output := android.PathForModuleOut(ctx, "content-manifest.json")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("apex_diff").
+		Text("manifest").
+		FlagWithArg("--apex ", a.Name()).
+		FlagWithArg("--image_dir ", imageDir.String()).
+		FlagWithInput("--contents ", contentsFile).
+		FlagWithOutput("-o ", output).
+		Implicit(builtApex)
+	rule.Build("content-manifest."+a.Name(), "APEX content manifest")
+	return output.OutputPath
+}
+
 // buildBundleConfig creates a build rule for the bundle config file that will control the bundle
 // creation process.
 func (a *apexBundle) buildBundleConfig(ctx android.ModuleContext) android.OutputPath {
@@ -943,6 +991,11 @@ func (a *apexBundle) buildApex(ctx android.ModuleContext) {
 	}
 	var validations android.Paths
 	validations = append(validations, runApexLinkerconfigValidation(ctx, unsignedOutputFile.OutputPath, imageDir.OutputPath))
+	// The VNDK APEX and test APEXes are not loaded in the namespaces that linkerconfig generates.
+	if !a.testApex && !a.vndkApex && proptools.BoolDefault(a.properties.Linker_namespace_check, true) {
+		validations = append(validations, linkerconfig.BuildApexLinkerNamespaceCheck(ctx, a.Name(), imageDir,
+			a.manifestJsonFullOut, unsignedOutputFile))
+	}
 	// TODO(b/279688635) deapexer supports [ext4]
 	if !a.testApex && suffix == imageApexSuffix && ext4 == a.payloadFsType {
 		validations = append(validations, runApexSepolicyTests(ctx, unsignedOutputFile.OutputPath))
@@ -951,6 +1004,10 @@ func (a *apexBundle) buildApex(ctx android.ModuleContext) {
 		validations = append(validations,
 			runApexElfCheckerUnwanted(ctx, unsignedOutputFile.OutputPath, a.properties.Unwanted_transitive_deps))
 	}
+	validations = append(validations, android.BuildLicensePolicyCheck(ctx)...)
+	if !a.testApex && proptools.BoolDefault(a.properties.Symbol_check, true) {
+		validations = append(validations, a.runApexSymbolCheck(ctx)...)
+	}
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        rule,
 		Description: "signapk",
@@ -1013,6 +1070,16 @@ func (a *apexBundle) buildApex(ctx android.ModuleContext) {
 
 	// installed-files.txt is dist'ed
 	a.installedFilesFile = a.buildInstalledFilesFile(ctx, a.outputFile, imageDir)
+	a.contentManifestFile = a.buildContentManifest(ctx, a.outputFile, imageDir)
+
+	// SBOMs describing the contents of the APEX, built with `m <apex>-sbom`.
+	android.BuildSbomFromLicenseMetadata(ctx, a.outputFile, []string{
+		android.PathForModuleInstall(ctx).String() + "/",
+		android.PathForModuleInPartitionInstall(ctx, "apex").String() + "/",
+	})
+
+	// SLSA provenance of the APEX, built with `m <apex>-provenance`.
+	provenance.GenerateSlsaProvenance(ctx, a.outputFile)
 
 	a.apexKeysPath = writeApexKeys(ctx, a)
 }
@@ -1244,3 +1311,72 @@ func runApexElfCheckerUnwanted(ctx android.ModuleContext, apexFile android.Outpu
 	})
 	return timestamp
 }
+
+// runApexSymbolCheck checks that the native files in the APEX only reference the symbols of the
+// stub libraries outside of the APEX that are available at the min_sdk_version of the APEX. The
+// files are linked against the latest stubs, so a symbol that is introduced later links fine but
+// fails to resolve on older devices.
+func (a *apexBundle) runApexSymbolCheck(ctx android.ModuleContext) android.Paths {
+	minSdkVersion := a.minSdkVersion(ctx)
+	if minSdkVersion.IsNone() || minSdkVersion.IsPreview() {
+		return nil
+	}
+
+	var implicits android.Paths
+	stubs := make(map[string][]string)
+	encountered := make(map[string]bool)
+	for _, lib := range a.requiredStubLibraries {
+		key := lib.multilib + "/" + lib.stem
+		if encountered[key] || len(lib.stubs) == 0 {
+			continue
+		}
+		encountered[key] = true
+		// The stubs are sorted by version, and the latest one is linked against.
+		latest := lib.stubs[len(lib.stubs)-1].SymbolList
+		if latest == nil {
+			continue
+		}
+		// Use the stubs of the highest version up to the min_sdk_version. A library without
+		// stubs at that version is skipped: it doesn't exist on the oldest devices the APEX
+		// supports, so the APEX has to guard its use of the library anyway.
+		var available android.Path
+		for _, stub := range lib.stubs {
+			version, err := android.ApiLevelFromUser(ctx, stub.Version)
+			if err == nil && version.LessThanOrEqualTo(minSdkVersion) {
+				available = stub.SymbolList
+			}
+		}
+		if available == nil {
+			continue
+		}
+		implicits = append(implicits, available, latest)
+		stubs[lib.multilib] = append(stubs[lib.multilib], lib.stem+":"+available.String()+":"+latest.String())
+	}
+	if len(stubs) == 0 {
+		return nil
+	}
+
+	elfs := make(map[string][]string)
+	for _, fi := range a.filesInfo {
+		if fi.class == nativeSharedLib || fi.class == nativeExecutable {
+			elfs[fi.multilib] = append(elfs[fi.multilib], fi.path()+"="+fi.builtFile.String())
+			implicits = append(implicits, fi.builtFile)
+		}
+	}
+
+	timestamp := android.PathForModuleOut(ctx, "apex_symbol_check.timestamp")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	// The ELF files of each architecture are checked against the stubs of the same architecture.
+	for _, multilib := range android.SortedKeys(stubs) {
+		rule.Command().
+			BuiltTool("apex_symbol_check").
+			FlagWithArg("--apex ", a.Name()).
+			FlagWithArg("--min_sdk_version ", minSdkVersion.String()).
+			FlagForEachArg("--elf ", elfs[multilib]).
+			FlagForEachArg("--stubs ", stubs[multilib]).
+			Implicits(implicits)
+	}
+	rule.Command().Text("touch").Output(timestamp)
+	rule.Build("apex_symbol_check", "apex symbol check "+a.Name())
+	return android.Paths{timestamp}
+}
@@ -205,6 +205,69 @@ func (r FixRequest) AddMatchingExtensions(pattern string) (result FixRequest) {
 	return result
 }
 
+// AddSteps returns a FixRequest that applies the given steps after the steps of r.
+func (r FixRequest) AddSteps(steps ...FixStep) (result FixRequest) {
+	result.steps = append([]FixStep(nil), r.steps...)
+	result.steps = append(result.steps, steps...)
+	return result
+}
+
+// An Edit removes values from a list property of a module in an Android.bp file. Tools that
+// suggest changes to Android.bp files, like unused_deps, write lists of edits that bpfix -edits
+// applies.
+type Edit struct {
+	File     string   `json:"file"`
+	Module   string   `json:"module"`
+	Property string   `json:"property"`
+	Remove   []string `json:"remove"`
+}
+
+// EditsFixStep returns a fix step that applies the edits to the modules of a file. The File of the
+// edits is not checked, callers are expected to pass only the edits of the file being fixed.
+func EditsFixStep(edits []Edit) FixStep {
+	return FixStep{
+		Name: "applyEdits",
+		Fix: func(f *Fixer) error {
+			return applyEdits(f, edits)
+		},
+	}
+}
+
+func applyEdits(f *Fixer, edits []Edit) error {
+	for _, def := range f.tree.Defs {
+		mod, ok := def.(*parser.Module)
+		if !ok {
+			continue
+		}
+		name, ok := getLiteralStringPropertyValue(mod, "name")
+		if !ok {
+			continue
+		}
+		for _, edit := range edits {
+			if edit.Module != name {
+				continue
+			}
+			listValue, ok := getLiteralListProperty(mod, edit.Property)
+			if !ok {
+				continue
+			}
+			newValues := []parser.Expression{}
+			for _, v := range listValue.Values {
+				if stringValue, ok := v.(*parser.String); ok && inList(stringValue.Value, edit.Remove) {
+					continue
+				}
+				newValues = append(newValues, v)
+			}
+			if len(newValues) == 0 && len(listValue.Values) != 0 {
+				removeProperty(mod, edit.Property)
+			} else {
+				listValue.Values = newValues
+			}
+		}
+	}
+	return nil
+}
+
 type Fixer struct {
 	tree *parser.File
 }
@@ -1014,6 +1014,76 @@ func TestRemoveEmptyLibDependencies(t *testing.T) {
 	}
 }
 
+func TestApplyEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		out   string
+		edits []Edit
+	}{
+		{
+			name: "remove values",
+			in: `
+				cc_library {
+					name: "foo",
+					shared_libs: [
+						"libbar",
+						"libbaz",
+					],
+					header_libs: ["libbar_headers"],
+				}
+
+				cc_library {
+					name: "bar",
+					shared_libs: ["libbaz"],
+				}
+			`,
+			out: `
+				cc_library {
+					name: "foo",
+					shared_libs: [
+						"libbar",
+
+					],
+
+				}
+
+				cc_library {
+					name: "bar",
+					shared_libs: ["libbaz"],
+				}
+			`,
+			edits: []Edit{
+				{Module: "foo", Property: "shared_libs", Remove: []string{"libbaz"}},
+				{Module: "foo", Property: "header_libs", Remove: []string{"libbar_headers"}},
+			},
+		},
+		{
+			name: "missing property",
+			in: `
+				cc_library {
+					name: "foo",
+				}
+			`,
+			out: `
+				cc_library {
+					name: "foo",
+				}
+			`,
+			edits: []Edit{
+				{Module: "foo", Property: "static_libs", Remove: []string{"libbar"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runPass(t, test.in, test.out, func(fixer *Fixer) error {
+				return applyEdits(fixer, test.edits)
+			})
+		})
+	}
+}
+
 func TestRemoveHidlInterfaceTypes(t *testing.T) {
 	tests := []struct {
 		name string
@@ -20,6 +20,7 @@ package cmd_lib
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -38,6 +39,10 @@ var (
 	list   = flag.Bool("l", false, "list files whose formatting differs from bpfmt's")
 	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
 	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+
+	// apply the edits in a JSON file, such as the edits suggested by unused_deps, instead of the
+	// default fixes
+	edits = flag.String("edits", "", "apply the edits listed in the given JSON file instead of the default fixes")
 )
 
 var (
@@ -128,9 +133,44 @@ func walkDir(path string, fixRequest bpfix.FixRequest) {
 	filepath.Walk(path, makeFileVisitor(fixRequest))
 }
 
+// applyEdits applies the edits listed in a JSON file to the Android.bp files they name.
+func applyEdits(editsFile string) {
+	data, err := ioutil.ReadFile(editsFile)
+	if err != nil {
+		report(err)
+		return
+	}
+	var allEdits []bpfix.Edit
+	if err := json.Unmarshal(data, &allEdits); err != nil {
+		report(fmt.Errorf("failed to parse %s: %s", editsFile, err))
+		return
+	}
+
+	var files []string
+	editsByFile := make(map[string][]bpfix.Edit)
+	for _, edit := range allEdits {
+		if _, exists := editsByFile[edit.File]; !exists {
+			files = append(files, edit.File)
+		}
+		editsByFile[edit.File] = append(editsByFile[edit.File], edit)
+	}
+
+	for _, file := range files {
+		fixRequest := bpfix.NewFixRequest().AddSteps(bpfix.EditsFixStep(editsByFile[file]))
+		if err := openAndProcess(file, os.Stdout, fixRequest); err != nil {
+			report(err)
+		}
+	}
+}
+
 func Run() {
 	flag.Parse()
 
+	if *edits != "" {
+		applyEdits(*edits)
+		return
+	}
+
 	fixRequest := bpfix.NewFixRequest().AddAll()
 
 	if flag.NArg() == 0 {
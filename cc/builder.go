@@ -51,6 +51,17 @@ var (
 		},
 		"ccCmd", "cFlags", "postCmd")
 
+	// Rule to precompile a C++ header with the flags of the C++ sources that include it. Outputs
+	// a .d depfile so that the header is precompiled again when any header it includes changes.
+	ccPch = pctx.AndroidRemoteStaticRule("ccPch", android.RemoteRuleSupports{Goma: true, RBE: true},
+		blueprint.RuleParams{
+			Depfile:     "${out}.d",
+			Deps:        blueprint.DepsGCC,
+			Command:     "$relPwd ${config.CcWrapper}$ccCmd -x c++-header $cFlags -MD -MF ${out}.d -o $out $in",
+			CommandDeps: []string{"$ccCmd"},
+		},
+		"ccCmd", "cFlags")
+
 	// Rule to invoke gcc with given command and flags, but no dependencies.
 	ccNoDeps = pctx.AndroidStaticRule("ccNoDeps",
 		blueprint.RuleParams{
@@ -413,6 +424,8 @@ type builderFlags struct {
 
 	yacc *YaccProperties
 	lex  *LexProperties
+
+	pch android.OptionalPath // Header to precompile and include in C++ sources
 }
 
 // StripFlags represents flags related to stripping. This is separate from builderFlags, as these
@@ -435,6 +448,7 @@ type Objects struct {
 	coverageFiles android.Paths
 	sAbiDumpFiles android.Paths
 	kytheFiles    android.Paths
+	depFiles      android.Paths // copies of the depfiles, kept for the unused deps report
 }
 
 func (a Objects) Copy() Objects {
@@ -445,6 +459,7 @@ func (a Objects) Copy() Objects {
 		coverageFiles: append(android.Paths{}, a.coverageFiles...),
 		sAbiDumpFiles: append(android.Paths{}, a.sAbiDumpFiles...),
 		kytheFiles:    append(android.Paths{}, a.kytheFiles...),
+		depFiles:      append(android.Paths{}, a.depFiles...),
 	}
 }
 
@@ -456,6 +471,7 @@ func (a Objects) Append(b Objects) Objects {
 		coverageFiles: append(a.coverageFiles, b.coverageFiles...),
 		sAbiDumpFiles: append(a.sAbiDumpFiles, b.sAbiDumpFiles...),
 		kytheFiles:    append(a.kytheFiles, b.kytheFiles...),
+		depFiles:      append(a.depFiles, b.depFiles...),
 	}
 }
 
@@ -489,6 +505,8 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 	if flags.emitXrefs && ctx.Module() == ctx.PrimaryModule() {
 		kytheFiles = make(android.Paths, 0, len(srcFiles))
 	}
+	var depFiles android.Paths
+	keepDepFiles := unusedDepsReportEnabled(ctx.Config())
 
 	// Produce fully expanded flags for use by C tools, C compiles, C++ tools, C++ compiles, and asm compiles
 	// respectively.
@@ -564,6 +582,14 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 		return "$" + kind + n
 	}
 
+	// The header is precompiled once for all C++ sources that can use it. Other clang tools include
+	// the header directly, as they may not be able to read a header precompiled by a different clang.
+	var pchFile android.Path
+	if flags.pch.Valid() && hasPchSrcs(srcFiles) {
+		pchFile = transformHeaderToPch(ctx, subdir, flags.pch.Path(), cppflags, flags.sdclang,
+			pathDeps, cFlagsDeps)
+	}
+
 	for i, srcFile := range srcFiles {
 		objFile := android.ObjPathWithExt(ctx, subdir, srcFile, "o")
 
@@ -599,6 +625,8 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 		dump := flags.sAbiDump
 		rule := cc
 		emitXref := flags.emitXrefs
+		implicits := cFlagsDeps
+		var pchFlags, includePchFlags string
 
 		switch srcFile.Ext() {
 		case ".s":
@@ -621,6 +649,11 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 			ccCmd = "clang++"
 			moduleFlags = cppflags
 			moduleToolingFlags = toolingCppflags
+			if pchFile != nil && usesPch(srcFile) {
+				pchFlags = " -include-pch " + pchFile.String()
+				includePchFlags = " -include " + flags.pch.String()
+				implicits = append(android.Paths{pchFile}, cFlagsDeps...)
+			}
 		case ".rs":
 			// A source provider (e.g. rust_bindgen) may provide both rs and c files.
 			// Ignore the rs files.
@@ -649,6 +682,13 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 		}
 
 		var implicitOutputs android.WritablePaths
+		if keepDepFiles && rule == cc {
+			// Ninja deletes the depfile after reading it, keep a copy for the unused deps report.
+			depFile := android.ObjPathWithExt(ctx, subdir, srcFile, "deps")
+			postCmd += " && cp ${out}.d " + depFile.String()
+			implicitOutputs = append(implicitOutputs, depFile)
+			depFiles = append(depFiles, depFile)
+		}
 		if coverage {
 			gcnoFile := android.ObjPathWithExt(ctx, subdir, srcFile, "gcno")
 			implicitOutputs = append(implicitOutputs, gcnoFile)
@@ -661,15 +701,19 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 			Output:          objFile,
 			ImplicitOutputs: implicitOutputs,
 			Input:           srcFile,
-			Implicits:       cFlagsDeps,
+			Implicits:       implicits,
 			OrderOnly:       pathDeps,
 			Args: map[string]string{
-				"cFlags":  shareFlags("cFlags", moduleFlags+extraFlags),
+				"cFlags":  shareFlags("cFlags", moduleFlags+pchFlags+extraFlags),
 				"ccCmd":   ccCmd, // short and not shared
 				"postCmd": postCmd,
 			},
 		})
 
+		// Clang tools other than the compiler include the precompiled header as source.
+		moduleFlags += includePchFlags
+		moduleToolingFlags += includePchFlags
+
 		// Register post-process build statements (such as for tidy or kythe).
 		if emitXref && ctx.Module() == ctx.PrimaryModule() {
 			kytheFile := android.ObjPathWithExt(ctx, subdir, srcFile, "kzip")
@@ -756,7 +800,56 @@ func transformSourceToObj(ctx ModuleContext, subdir string, srcFiles, noTidySrcs
 		coverageFiles: coverageFiles,
 		sAbiDumpFiles: sAbiDumpFiles,
 		kytheFiles:    kytheFiles,
+		depFiles:      depFiles,
+	}
+}
+
+// usesPch returns true if the source file is compiled with the precompiled C++ header of the
+// module. Objective-C++ sources cannot use a header precompiled as C++.
+func usesPch(srcFile android.Path) bool {
+	switch srcFile.Ext() {
+	case ".cpp", ".cc", ".cxx":
+		return true
 	}
+	return false
+}
+
+func hasPchSrcs(srcFiles android.Paths) bool {
+	for _, srcFile := range srcFiles {
+		if usesPch(srcFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate a rule for precompiling a C++ header with the flags used to compile the C++ sources
+// that include it
+func transformHeaderToPch(ctx ModuleContext, subdir string, header android.Path, cppflags string,
+	sdclang bool, pathDeps android.Paths, cFlagsDeps android.Paths) android.Path {
+
+	pchFile := android.ObjPathWithExt(ctx, subdir, header, "pch")
+
+	ccCmd := "${config.ClangBin}/clang++"
+	if sdclang {
+		ccCmd = "${config.SDClangBin}/clang++"
+		cppflags += " ${config.SDClangFlags}"
+	}
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        ccPch,
+		Description: "clang++ pch " + header.Rel(),
+		Output:      pchFile,
+		Input:       header,
+		Implicits:   cFlagsDeps,
+		OrderOnly:   pathDeps,
+		Args: map[string]string{
+			"ccCmd":  ccCmd,
+			"cFlags": cppflags,
+		},
+	})
+
+	return pchFile
 }
 
 // Generate a rule for compiling multiple .o files to a static library (.a)
@@ -862,6 +955,14 @@ func transformObjToDynamicBinary(ctx android.ModuleContext,
 		ldCmd = "${config.ClangBin}/clang++"
 	}
 
+	// lld has no option to write the files loaded by --trace to a file, it prints them to stdout.
+	// The trace is written by the local shell, not by the remote link action.
+	var linkTrace android.WritablePath
+	if unusedDepsReportEnabled(ctx.Config()) && !ctx.Darwin() && !ctx.Windows() {
+		linkTrace = unusedDepsLinkTraceFile(ctx)
+		extraFlags += " -Wl,--trace > " + linkTrace.String()
+	}
+
 	var libFlagsList []string
 
 	if len(flags.libFlags) > 0 {
@@ -916,6 +1017,9 @@ func transformObjToDynamicBinary(ctx android.ModuleContext,
 		args["implicitOutputs"] = strings.Join(implicitOutputs.Strings(), ",")
 		args["implicitInputs"] = strings.Join(deps.Strings(), ",")
 	}
+	if linkTrace != nil {
+		implicitOutputs = append(implicitOutputs, linkTrace)
+	}
 
 	ctx.Build(pctx, android.BuildParams{
 		Rule:            rule,
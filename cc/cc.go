@@ -84,6 +84,9 @@ func RegisterCCBuildComponents(ctx android.RegistrationContext) {
 	})
 
 	ctx.RegisterParallelSingletonType("kythe_extract_all", kytheExtractAllFactory)
+	ctx.RegisterParallelSingletonType("unused_deps_report", unusedDepsReportSingletonFactory)
+	ctx.RegisterParallelSingletonType("native_coverage_report", nativeCoverageReportSingletonFactory)
+	ctx.RegisterParallelSingletonType("compdb_generator", compDBGeneratorSingleton)
 }
 
 // Deps is a struct containing module names of dependencies, separated by the kind of dependency.
@@ -279,6 +282,8 @@ type Flags struct {
 
 	Yacc *YaccProperties
 	Lex  *LexProperties
+
+	Pch android.OptionalPath // Header to precompile and include in C++ sources
 }
 
 // Properties used to compile all C or C++ modules
@@ -908,6 +913,11 @@ type Module struct {
 	objFiles android.Paths
 	// Tidy .tidy file output paths for this compilation module
 	tidyFiles android.Paths
+	// Library dependencies listed in the properties of this module, the headers reexported by the
+	// dependencies and the headers reexported by this module, for the unused deps report
+	unusedDepsCandidates   []unusedDepsDep
+	unusedDepsDepReexports []unusedDepsReexport
+	unusedDepsReexports    []unusedDepsReexport
 
 	// For apex variants, this is set as apex.min_sdk_version
 	apexSdkVersion android.ApiLevel
@@ -2073,6 +2083,10 @@ func (c *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 		c.outputFile = android.OptionalPathForPath(outputFile)
 
 		c.maybeUnhideFromMake()
+		c.setNativeCoverageReportInfo(ctx)
+	}
+	if unusedDepsReportEnabled(ctx.Config()) {
+		c.generateUnusedDepsReport(ctx, objs)
 	}
 	if c.testModule {
 		android.SetProvider(ctx, testing.TestModuleProviderKey, testing.TestModuleProviderData{})
@@ -2998,12 +3012,23 @@ func (c *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 		}
 
 		ccDep, ok := dep.(LinkableInterface)
-		if !ok {
+		// Some LinkableInterface modules also generate C++ sources and headers (e.g.
+		// rust_cxx_bridge), they provide GeneratedCcSourcesInfo and are handled like genrules
+		// when used as generated sources or headers.
+		var genRule genrule.SourceFileGenerator
+		var isGenerator bool
+		if ok {
+			genRule, isGenerator = android.OtherModuleProvider(ctx, dep, GeneratedCcSourcesInfoProvider)
+		} else {
+			genRule, isGenerator = dep.(genrule.SourceFileGenerator)
+		}
+		isGenDepTag := depTag == genSourceDepTag || depTag == genHeaderDepTag || depTag == genHeaderExportDepTag
+		if !ok || isGenDepTag {
 
 			// handling for a few module types that aren't cc Module but that are also supported
 			switch depTag {
 			case genSourceDepTag:
-				if genRule, ok := dep.(genrule.SourceFileGenerator); ok {
+				if isGenerator {
 					depPaths.GeneratedSources = append(depPaths.GeneratedSources,
 						genRule.GeneratedSourceFiles()...)
 				} else {
@@ -3012,7 +3037,7 @@ func (c *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 				// Support exported headers from a generated_sources dependency
 				fallthrough
 			case genHeaderDepTag, genHeaderExportDepTag:
-				if genRule, ok := dep.(genrule.SourceFileGenerator); ok {
+				if isGenerator {
 					depPaths.GeneratedDeps = append(depPaths.GeneratedDeps,
 						genRule.GeneratedDeps()...)
 					dirs := genRule.GeneratedHeaderDirs()
@@ -3281,6 +3306,12 @@ func (c *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 					c.sabi.Properties.ReexportedSystemIncludes, depExporterInfo.SystemIncludeDirs.Strings()...)
 			}
 
+			if unusedDepsReportEnabled(ctx.Config()) {
+				depReexports, _ := android.OtherModuleProvider(ctx, dep, unusedDepsReexportsProvider)
+				c.recordUnusedDepsCandidate(ctx, libDepTag, ccDep.BaseModuleName(), linkFile, depExporterInfo,
+					depReexports)
+			}
+
 			makeLibName := MakeLibName(ctx, c, ccDep, ccDep.BaseModuleName()) + libDepTag.makeSuffix
 			switch {
 			case libDepTag.header():
@@ -16,6 +16,7 @@ package cc
 
 import (
 	"android/soong/android"
+	"android/soong/genrule"
 	"bytes"
 	_ "embed"
 	"fmt"
@@ -60,6 +61,26 @@ var defaultUnportableFlags []string = []string{
 	"-Wno-subobject-linkage",
 }
 
+// Mapping of the libraries linked into tests and benchmarks that aren't mapped explicitly with
+// library_mapping.
+var defaultExtraLibsMapping = map[string]LibraryMappingProperty{
+	"libgtest": {
+		Android_name:   "libgtest",
+		Mapped_name:    "GTest::gtest",
+		Package_system: "GTest",
+	},
+	"libgtest_main": {
+		Android_name:   "libgtest_main",
+		Mapped_name:    "GTest::gtest_main",
+		Package_system: "GTest",
+	},
+	"libgoogle-benchmark": {
+		Android_name:   "libgoogle-benchmark",
+		Mapped_name:    "benchmark::benchmark",
+		Package_system: "benchmark",
+	},
+}
+
 var ignoredSystemLibs []string = []string{
 	"libc++",
 	"libc++_static",
@@ -95,7 +116,9 @@ type CmakeSnapshotProperties struct {
 	// Flags to skip when building outside Android.
 	Cflags_ignored []string
 
-	// Mapping between library names used in Android tree and externally.
+	// Mapping between library names used in Android tree and externally. Dependencies of the
+	// modules that are neither in the snapshot nor mapped are reported as errors. The libraries
+	// of tests and benchmarks are mapped to the GTest and benchmark packages by default.
 	Library_mapping []LibraryMappingProperty
 
 	// List of cflags that are not portable between compilers that could potentially be used to
@@ -140,13 +163,6 @@ func parseTemplate(templateContents string) *template.Template {
 			templateListBuilder(&list, itemPrefix, items)
 			return list.String()
 		},
-		"toStrings": func(files android.Paths) []string {
-			strings := make([]string, len(files))
-			for idx, file := range files {
-				strings[idx] = file.String()
-			}
-			return strings
-		},
 		"concat5": func(list1 []string, list2 []string, list3 []string, list4 []string, list5 []string) []string {
 			return append(append(append(append(list1, list2...), list3...), list4...), list5...)
 		},
@@ -184,6 +200,8 @@ func parseTemplate(templateContents string) *template.Template {
 			return m.compiler.(CompiledInterface).Srcs()
 		},
 		"getModuleType": getModuleType,
+		"isGtest":       isGtest,
+		"cmakeSources":  cmakeSourcePaths,
 		"getCompilerProperties": func(m *Module) BaseCompilerProperties {
 			return m.compiler.baseCompilerProps()
 		},
@@ -194,8 +212,9 @@ func parseTemplate(templateContents string) *template.Template {
 		"getLinkerProperties": func(m *Module) BaseLinkerProperties {
 			return m.linker.baseLinkerProps()
 		},
-		"getExtraLibs":   getExtraLibs,
-		"getIncludeDirs": getIncludeDirs,
+		"getExtraLibs":          getExtraLibs,
+		"getIncludeDirs":        getIncludeDirs,
+		"getPrivateIncludeDirs": getPrivateIncludeDirs,
 		"mapLibraries": func(ctx android.ModuleContext, m *Module, libs []string, mapping map[string]LibraryMappingProperty) []string {
 			var mappedLibs []string
 			for _, lib := range libs {
@@ -297,20 +316,51 @@ func (m *CmakeSnapshot) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		pprop.SystemPackages = slices.Compact(pprop.SystemPackages)
 	}
 
+	// Tests and benchmarks are linked against the system packages of their frameworks, unless
+	// they are mapped explicitly.
+	for lib, mapping := range defaultExtraLibsMapping {
+		if _, exists := pprop.LibraryMapping[lib]; !exists {
+			pprop.LibraryMapping[lib] = mapping
+		}
+	}
+
 	// Generating CMakeLists.txt rules for all modules in dependency tree
 	moduleDirs := map[string][]string{}
 	sourceFiles := map[string]android.Path{}
+	generatedFiles := map[string]android.Path{}
+	generatedIncludes := map[string][]string{}
+	skippedModules := map[string]string{}
 	visitedModules := map[string]bool{}
+	var snapshotModules []*Module
 	var pregeneratedModules []*Module
 	ctx.WalkDeps(func(dep_a android.Module, parent android.Module) bool {
 		moduleName := ctx.OtherModuleName(dep_a)
+		if gen, ok := dep_a.(genrule.SourceFileGenerator); ok {
+			if _, isCc := dep_a.(*Module); !isCc {
+				// Generated sources and headers are copied into the snapshot, as they can't be
+				// generated outside Android.
+				for _, file := range slices.Concat(gen.GeneratedSourceFiles(), gen.GeneratedDeps()) {
+					generatedFiles[file.String()] = file
+				}
+				switch ctx.OtherModuleDependencyTag(dep_a) {
+				case genHeaderDepTag, genHeaderExportDepTag:
+					parentName := ctx.OtherModuleName(parent)
+					for _, dir := range gen.GeneratedHeaderDirs() {
+						generatedIncludes[parentName] = append(generatedIncludes[parentName],
+							"${GENERATED_DIR}/"+cmakeGeneratedRelPath(ctx, dir))
+					}
+				}
+				return false
+			}
+		}
 		if visited := visitedModules[moduleName]; visited {
 			return false // visit only once
 		}
 		visitedModules[moduleName] = true
 		dep, ok := dep_a.(*Module)
 		if !ok {
-			return false // not a cc module
+			skippedModules[android.RemoveOptionalPrebuiltPrefix(moduleName)] = "not a cc module"
+			return false
 		}
 		if mapping, ok := pprop.LibraryMapping[moduleName]; ok {
 			if mapping.Package_pregenerated != "" {
@@ -325,7 +375,8 @@ func (m *CmakeSnapshot) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			return false // system libs built in-tree for Android
 		}
 		if dep.compiler == nil {
-			return false // unsupported module type (e.g. prebuilt)
+			skippedModules[android.RemoveOptionalPrebuiltPrefix(moduleName)] = "unsupported module type (e.g. prebuilt)"
+			return false
 		}
 		isAidlModule := dep.compiler.baseCompilerProps().AidlInterface.Lang != ""
 
@@ -333,6 +384,7 @@ func (m *CmakeSnapshot) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			ctx.OtherModulePropertyErrorf(dep, "cmake_snapshot_supported",
 				"CMake snapshots not supported, despite being a dependency for %s",
 				ctx.OtherModuleName(parent))
+			skippedModules[android.RemoveOptionalPrebuiltPrefix(moduleName)] = "CMake snapshots not supported"
 			return false
 		}
 
@@ -340,35 +392,58 @@ func (m *CmakeSnapshot) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			fmt.Println("WalkDeps: " + ctx.OtherModuleName(parent) + " -> " + moduleName)
 		}
 
-		// Generate CMakeLists.txt fragment for this module
+		snapshotModules = append(snapshotModules, dep)
+
+		if m.Properties.Include_sources {
+			files, _ := android.OtherModuleProvider(ctx, dep, cmakeSnapshotSourcesProvider)
+			for _, file := range files {
+				sourceFiles[file.String()] = file
+			}
+		}
+
+		// if it's AIDL module, no need to dive into their dependencies
+		return !isAidlModule
+	})
+
+	// Find the system packages of the test frameworks used by the modules in the snapshot
+	for _, dep := range snapshotModules {
+		for _, lib := range getExtraLibs(dep) {
+			if mapping := pprop.LibraryMapping[lib]; mapping.Package_system != "" {
+				pprop.SystemPackages = append(pprop.SystemPackages, mapping.Package_system)
+			}
+		}
+	}
+	sort.Strings(pprop.SystemPackages)
+	pprop.SystemPackages = slices.Compact(pprop.SystemPackages)
+
+	// Generate CMakeLists.txt fragments for all modules
+	snapshotModuleNames := map[string]bool{}
+	for _, dep := range snapshotModules {
+		snapshotModuleNames[ctx.OtherModuleName(dep)] = true
+	}
+	for _, dep := range snapshotModules {
 		templateToUse := templateCmakeModuleCc
-		if isAidlModule {
+		if dep.compiler.baseCompilerProps().AidlInterface.Lang != "" {
 			templateToUse = templateCmakeModuleAidl
 		}
 		moduleFragment := executeTemplate(templateToUse, &templateBuffer, struct {
-			Ctx      *android.ModuleContext
-			M        *Module
-			Snapshot *CmakeSnapshot
-			Pprop    *cmakeProcessedProperties
+			Ctx               *android.ModuleContext
+			M                 *Module
+			Snapshot          *CmakeSnapshot
+			Pprop             *cmakeProcessedProperties
+			GeneratedIncludes []string
 		}{
 			&ctx,
 			dep,
 			m,
 			&pprop,
+			android.FirstUniqueStrings(generatedIncludes[ctx.OtherModuleName(dep)]),
 		})
 		moduleDir := ctx.OtherModuleDir(dep)
 		moduleDirs[moduleDir] = append(moduleDirs[moduleDir], moduleFragment)
 
-		if m.Properties.Include_sources {
-			files, _ := android.OtherModuleProvider(ctx, dep, cmakeSnapshotSourcesProvider)
-			for _, file := range files {
-				sourceFiles[file.String()] = file
-			}
-		}
-
-		// if it's AIDL module, no need to dive into their dependencies
-		return !isAidlModule
-	})
+		m.reportUnresolvedDeps(ctx, dep, &pprop, snapshotModuleNames, skippedModules)
+	}
 
 	// Enumerate sources for pregenerated modules
 	if m.Properties.Include_sources {
@@ -460,10 +535,46 @@ func (m *CmakeSnapshot) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			FlagWithRspFileInputList("-r ", prebuiltsRspFile, prebuiltsList)
 	}
 
+	// Packaging all generated sources and headers into the zip file
+	if len(generatedFiles) > 0 {
+		var generatedList android.Paths
+		for _, key := range android.SortedKeys(generatedFiles) {
+			generatedList = append(generatedList, generatedFiles[key])
+		}
+
+		generatedRspFile := android.PathForModuleObj(ctx, ctx.ModuleName()+"_generated.rsp")
+		zipCmd.
+			FlagWithArg("-C ", android.PathForArbitraryOutput(ctx).String()).
+			FlagWithArg("-P ", "generated").
+			FlagWithRspFileInputList("-r ", generatedRspFile, generatedList)
+	}
+
 	// Finish generating the final zip file
 	zipRule.Build(m.zipPath.String(), "archiving "+ctx.ModuleName())
 }
 
+// reportUnresolvedDeps reports the dependencies of a module in the snapshot that are neither in
+// the snapshot nor mapped to a package, as the generated CMake project would fail to link them.
+func (m *CmakeSnapshot) reportUnresolvedDeps(ctx android.ModuleContext, dep *Module,
+	pprop *cmakeProcessedProperties, snapshotModules map[string]bool, skippedModules map[string]string) {
+
+	props := dep.linker.baseLinkerProps()
+	libs := slices.Concat(props.Whole_static_libs, props.Static_libs, props.Shared_libs,
+		props.Header_libs, getExtraLibs(dep))
+	for _, lib := range android.FirstUniqueStrings(libs) {
+		if _, exists := pprop.LibraryMapping[lib]; exists || snapshotModules[lib] ||
+			slices.Contains(ignoredSystemLibs, lib) || !ctx.OtherModuleExists(lib) {
+			continue
+		}
+		reason, skipped := skippedModules[lib]
+		if !skipped {
+			reason = "not a dependency of the host variant"
+		}
+		ctx.OtherModuleErrorf(dep, "Dependency %s can't be included in CMake snapshot %s: %s. "+
+			"Add it to library_mapping.", lib, ctx.ModuleName(), reason)
+	}
+}
+
 func (m *CmakeSnapshot) OutputFiles(tag string) (android.Paths, error) {
 	switch tag {
 	case "":
@@ -514,6 +625,35 @@ func getExtraLibs(m *Module) []string {
 	return nil
 }
 
+// cmakeGeneratedRelPath returns the path of a generated file in the generated directory of the
+// snapshot.
+func cmakeGeneratedRelPath(ctx android.PathContext, path android.Path) string {
+	rel, err := filepath.Rel(android.PathForArbitraryOutput(ctx).String(), path.String())
+	if err != nil {
+		panic(err)
+	}
+	return rel
+}
+
+// cmakeSourcePaths returns the paths of source files in the CMake project. Generated files are
+// copied into the snapshot, other files are referenced in the Android source tree.
+func cmakeSourcePaths(ctx android.ModuleContext, files android.Paths) []string {
+	paths := make([]string, len(files))
+	for idx, file := range files {
+		if _, generated := file.(android.WritablePath); generated {
+			paths[idx] = "${GENERATED_DIR}/" + cmakeGeneratedRelPath(ctx, file)
+		} else {
+			paths[idx] = "${ANDROID_BUILD_TOP}/" + file.String()
+		}
+	}
+	return paths
+}
+
+func isGtest(m *Module) bool {
+	test, ok := m.linker.(*testBinary)
+	return ok && test.testDecorator.gtest()
+}
+
 func getIncludeDirs(ctx android.ModuleContext, m *Module) []string {
 	moduleDir := ctx.OtherModuleDir(m) + string(filepath.Separator)
 	switch decorator := m.compiler.(type) {
@@ -523,6 +663,19 @@ func getIncludeDirs(ctx android.ModuleContext, m *Module) []string {
 	return nil
 }
 
+// getPrivateIncludeDirs returns the include dirs used to compile the module, i.e. the directory of
+// the module and the local_include_dirs and include_dirs properties.
+func getPrivateIncludeDirs(ctx android.ModuleContext, m *Module) []string {
+	props := m.compiler.baseCompilerProps()
+	moduleDir := ctx.OtherModuleDir(m)
+	var dirs []string
+	if includeBuildDirectory(props.Include_build_directory) {
+		dirs = append(dirs, moduleDir)
+	}
+	dirs = append(dirs, sliceWithPrefix(moduleDir+string(filepath.Separator), props.Local_include_dirs)...)
+	return append(dirs, props.Include_dirs...)
+}
+
 func cmakeSnapshotLoadHook(ctx android.LoadHookContext) {
 	props := struct {
 		Target struct {
@@ -113,3 +113,114 @@ func TestCmakeSnapshotAsTestData(t *testing.T) {
 	wasGenerated(t, &snapshotModule, "CMakeLists.txt", "rawFileCopy")
 	wasGenerated(t, &snapshotModule, "foo.zip", "")
 }
+
+func TestCmakeSnapshotWithTestAndGeneratedSources(t *testing.T) {
+	t.Parallel()
+	xtra := android.FixtureAddTextFile("some/module/Android.bp", `
+		genrule {
+			name: "foo_gen_srcs",
+			cmd: "touch $(out)",
+			out: ["gen.cpp"],
+		}
+
+		genrule {
+			name: "foo_gen_headers",
+			cmd: "touch $(out)",
+			out: ["foo_gen.h"],
+		}
+
+		cc_library_static {
+			name: "libgtest",
+			host_supported: true,
+		}
+
+		cc_library_static {
+			name: "libgtest_main",
+			host_supported: true,
+		}
+
+		cc_binary {
+			name: "foo_binary",
+			host_supported: true,
+			cmake_snapshot_supported: true,
+			srcs: ["main.cpp", ":foo_gen_srcs"],
+			generated_headers: ["foo_gen_headers"],
+		}
+
+		cc_test {
+			name: "foo_test",
+			host_supported: true,
+			cmake_snapshot_supported: true,
+			srcs: ["foo_test.cpp"],
+			target: {
+				android: {enabled: false},
+			},
+		}
+	`)
+	result := android.GroupFixturePreparers(PrepareForIntegrationTestWithCc, xtra).RunTestWithBp(t, `
+		cc_cmake_snapshot {
+			name: "foo",
+			modules: [
+				"foo_binary",
+				"foo_test",
+			],
+		}`)
+
+	if runtime.GOOS != "linux" {
+		t.Skip("CMake snapshots are only supported on Linux")
+	}
+
+	snapshotModule := result.ModuleForTests("foo", "linux_glibc_x86_64")
+
+	moduleCmake := android.ContentFromFileRuleForTests(t, result.TestContext,
+		snapshotModule.Output("some/module/CMakeLists.txt"))
+	android.AssertStringDoesContain(t, "generated source", moduleCmake,
+		"${GENERATED_DIR}/.intermediates/some/module/foo_gen_srcs/gen/gen.cpp")
+	android.AssertStringDoesContain(t, "generated header dir", moduleCmake,
+		"${GENERATED_DIR}/.intermediates/some/module/foo_gen_headers/gen")
+	android.AssertStringDoesContain(t, "binary install", moduleCmake, "install(TARGETS foo_binary)")
+	android.AssertStringDoesContain(t, "test registration", moduleCmake, "gtest_discover_tests(foo_test)")
+	android.AssertStringDoesContain(t, "gtest mapping", moduleCmake, "GTest::gtest_main")
+
+	mainCmake := android.ContentFromFileRuleForTests(t, result.TestContext,
+		snapshotModule.Output("CMakeLists.txt"))
+	android.AssertStringDoesContain(t, "gtest package", mainCmake, "find_package(GTest REQUIRED)")
+
+	zip := snapshotModule.Output("foo.zip")
+	android.AssertStringDoesContain(t, "zip command", zip.RuleParams.Command, "-P generated")
+	zipInputs := append(append(android.Paths(nil), zip.Inputs...), zip.Implicits...)
+	android.AssertStringListContains(t, "zip inputs", android.PathsRelativeToTop(zipInputs),
+		"out/soong/.intermediates/some/module/foo_gen_srcs/gen/gen.cpp")
+}
+
+func TestCmakeSnapshotUnresolvedDependency(t *testing.T) {
+	t.Parallel()
+	xtra := android.FixtureAddTextFile("some/module/Android.bp", `
+		cc_prebuilt_library_static {
+			name: "libprebuilt",
+			host_supported: true,
+			srcs: ["libprebuilt.a"],
+		}
+
+		cc_binary {
+			name: "foo_binary",
+			host_supported: true,
+			cmake_snapshot_supported: true,
+			static_libs: ["libprebuilt"],
+		}
+	`)
+	android.GroupFixturePreparers(
+		PrepareForIntegrationTestWithCc,
+		xtra,
+		android.FixtureAddFile("some/module/libprebuilt.a", nil),
+	).
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`Dependency libprebuilt can't be included in CMake snapshot foo: unsupported module type`)).
+		RunTestWithBp(t, `
+		cc_cmake_snapshot {
+			name: "foo",
+			modules: [
+				"foo_binary",
+			],
+		}`)
+}
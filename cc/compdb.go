@@ -21,6 +21,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/google/blueprint"
+
 	"android/soong/android"
 )
 
@@ -30,10 +32,16 @@ import (
 // at ${OUT_DIR}/soong/development/ide/compdb/compile_commands.json. It will also symlink it
 // to ${SOONG_LINK_COMPDB_TO} if set. In general this should be created by running
 // make SOONG_GEN_COMPDB=1 nothing to get all targets.
-
-func init() {
-	android.RegisterParallelSingletonType("compdb_generator", compDBGeneratorSingleton)
-}
+//
+// The singleton also generates a compile_commands.json fragment for each cc module, built by the
+// compdb-<module> phony target, and one for each directory containing cc modules, built by the
+// compdb-dir-<directory> phony target. The fragments include entries for the headers generated for
+// the modules, which point at the files in the directories where they are generated. The compdb
+// phony target merges the fragments of the directories listed in
+// ${OUT_DIR}/soong/development/ide/compdb/dirs.txt and their subdirectories, or of all directories
+// if it lists none, into ${OUT_DIR}/soong/development/ide/compdb/merged/compile_commands.json. The
+// fragments are only written when one of these targets is built, and the list of directories is
+// read by merge_compdb when the merge runs, so neither needs an environment variable to be set.
 
 func compDBGeneratorSingleton() android.Singleton {
 	return &compdbGeneratorSingleton{}
@@ -44,6 +52,9 @@ type compdbGeneratorSingleton struct{}
 const (
 	compdbFilename                = "compile_commands.json"
 	compdbOutputProjectsDirectory = "development/ide/compdb"
+	compdbFragmentsDirectory      = "development/ide/compdb/fragments"
+	compdbMergedDirectory         = "development/ide/compdb/merged"
+	compdbDirsFilename            = "development/ide/compdb/dirs.txt"
 
 	// Environment variables used to modify behavior of this singleton.
 	envVariableGenerateCompdb          = "SOONG_GEN_COMPDB"
@@ -51,6 +62,25 @@ const (
 	envVariableCompdbLink              = "SOONG_LINK_COMPDB_TO"
 )
 
+var (
+	_ = pctx.HostBinToolVariable("mergeCompdbCmd", "merge_compdb")
+
+	mergeCompdb = pctx.AndroidStaticRule("mergeCompdb",
+		blueprint.RuleParams{
+			Command:        "${mergeCompdbCmd} -o ${out} ${flags} @${out}.rsp",
+			CommandDeps:    []string{"${mergeCompdbCmd}"},
+			Rspfile:        "${out}.rsp",
+			RspfileContent: "${in}",
+		}, "flags")
+
+	// Creates the empty list of directories whose fragments are merged, unless it was already
+	// written by the user.
+	compdbDirs = pctx.AndroidStaticRule("compdbDirs",
+		blueprint.RuleParams{
+			Command: "test -f ${out} || touch ${out}",
+		})
+)
+
 // A compdb entry. The compile_commands.json file is a list of these.
 type compDbEntry struct {
 	Directory string   `json:"directory"`
@@ -60,6 +90,8 @@ type compDbEntry struct {
 }
 
 func (c *compdbGeneratorSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	generateCompdbFragments(ctx)
+
 	if !ctx.Config().IsEnvTrue(envVariableGenerateCompdb) {
 		return
 	}
@@ -141,7 +173,7 @@ func getArguments(src android.Path, ctx android.SingletonContext, ccModule *Modu
 		isAsm = false
 		isCpp = false
 		clangPath = ccPath
-	case ".cpp", ".cc", ".cxx", ".mm":
+	case ".cpp", ".cc", ".cxx", ".mm", ".h", ".hh", ".hpp", ".hxx":
 		isAsm = false
 		isCpp = true
 		clangPath = cxxPath
@@ -165,6 +197,9 @@ func getArguments(src android.Path, ctx android.SingletonContext, ccModule *Modu
 	}
 	args = append(args, expandAllVars(ctx, ccModule.flags.SystemIncludeFlags)...)
 	args = append(args, expandAllVars(ctx, ccModule.flags.NoOverrideFlags)...)
+	if ccModule.flags.Pch.Valid() && usesPch(src) {
+		args = append(args, "-include", ccModule.flags.Pch.String())
+	}
 	args = append(args, src.String())
 	return args
 }
@@ -175,6 +210,15 @@ func generateCompdbProject(compiledModule CompiledInterface, ctx android.Singlet
 		return
 	}
 
+	for _, entry := range compdbEntries(ctx, ccModule, srcs) {
+		if _, ok := builds[entry.File]; !ok {
+			builds[entry.File] = entry
+		}
+	}
+}
+
+// compdbEntries returns the compdb entries of the given sources of a module.
+func compdbEntries(ctx android.SingletonContext, ccModule *Module, srcs android.Paths) []compDbEntry {
 	pathToCC, err := ctx.Eval(pctx, "${config.ClangBin}")
 	ccPath := "/bin/false"
 	cxxPath := "/bin/false"
@@ -182,15 +226,100 @@ func generateCompdbProject(compiledModule CompiledInterface, ctx android.Singlet
 		ccPath = filepath.Join(pathToCC, "clang")
 		cxxPath = filepath.Join(pathToCC, "clang++")
 	}
+
+	// The arguments only depend on the extension of the source, apart from the source itself
+	// that is the last argument.
+	argsByExt := make(map[string][]string)
+	entries := make([]compDbEntry, 0, len(srcs))
 	for _, src := range srcs {
-		if _, ok := builds[src.String()]; !ok {
-			builds[src.String()] = compDbEntry{
-				Directory: android.AbsSrcDirForExistingUseCases(),
-				Arguments: getArguments(src, ctx, ccModule, ccPath, cxxPath),
-				File:      src.String(),
-			}
+		args, ok := argsByExt[src.Ext()]
+		if !ok {
+			args = getArguments(src, ctx, ccModule, ccPath, cxxPath)
+			args = args[:len(args)-1]
+			argsByExt[src.Ext()] = args
 		}
+		entries = append(entries, compDbEntry{
+			Directory: android.AbsSrcDirForExistingUseCases(),
+			Arguments: append(append([]string(nil), args...), src.String()),
+			File:      src.String(),
+		})
 	}
+	return entries
+}
+
+// generateCompdbFragments generates the compdb fragments of each module and directory, and the
+// merged compdb of the directories listed in dirs.txt.
+func generateCompdbFragments(ctx android.SingletonContext) {
+	// Only the first variant of a module that has sources is used.
+	fragments := make(map[string]android.Path)
+	dirFragments := make(map[string]android.Paths)
+	ctx.VisitAllModules(func(module android.Module) {
+		ccModule, ok := module.(*Module)
+		if !ok || fragments[ccModule.Name()] != nil {
+			return
+		}
+		compiledModule, ok := ccModule.compiler.(CompiledInterface)
+		if !ok || len(compiledModule.Srcs()) == 0 {
+			return
+		}
+
+		srcs := compiledModule.Srcs()
+		if generated, ok := ccModule.compiler.(interface{ generatedHeaders() android.Paths }); ok {
+			srcs = append(srcs, generated.generatedHeaders()...)
+		}
+		dat, err := json.Marshal(compdbEntries(ctx, ccModule, srcs))
+		if err != nil {
+			ctx.Errorf("Failed to marshal compdb fragment of %s: %s", ccModule.Name(), err)
+			return
+		}
+
+		dir := ctx.ModuleDir(module)
+		fragment := android.PathForOutput(ctx, compdbFragmentsDirectory, "modules", dir, ccModule.Name()+".json")
+		android.WriteFileRule(ctx, fragment, string(dat))
+		ctx.Phony("compdb-"+ccModule.Name(), fragment)
+		fragments[ccModule.Name()] = fragment
+		dirFragments[dir] = append(dirFragments[dir], fragment)
+	})
+
+	if len(dirFragments) == 0 {
+		return
+	}
+
+	dirsRoot := android.PathForOutput(ctx, compdbFragmentsDirectory, "dirs")
+	var dirs android.Paths
+	for _, dir := range android.SortedKeys(dirFragments) {
+		out := dirsRoot.Join(ctx, dir, compdbFilename)
+		ctx.Build(pctx, android.BuildParams{
+			Rule:        mergeCompdb,
+			Description: "compdb " + dir,
+			Output:      out,
+			Inputs:      dirFragments[dir],
+		})
+		ctx.Phony("compdb-dir-"+dir, out)
+		dirs = append(dirs, out)
+	}
+
+	dirsFile := android.PathForOutput(ctx, compdbDirsFilename)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        compdbDirs,
+		Description: "compdb dirs",
+		Output:      dirsFile,
+	})
+
+	// merge_compdb selects the fragments of the directories listed in dirs.txt when it runs, so
+	// that the selection can be changed without regenerating the build.
+	out := android.PathForOutput(ctx, compdbMergedDirectory, compdbFilename)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        mergeCompdb,
+		Description: "compdb",
+		Output:      out,
+		Inputs:      dirs,
+		Implicit:    dirsFile,
+		Args: map[string]string{
+			"flags": "-dirs " + dirsFile.String() + " -fragments_root " + dirsRoot.String(),
+		},
+	})
+	ctx.Phony("compdb", out)
 }
 
 func evalAndSplitVariable(ctx android.SingletonContext, str string) ([]string, error) {
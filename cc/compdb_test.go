@@ -0,0 +1,90 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestCompdbFragments(t *testing.T) {
+	t.Parallel()
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureAddTextFile("foo/Android.bp", `
+			genrule {
+				name: "genrule_foo",
+				cmd: "generate-foo",
+				out: ["generated/foo.h"],
+				export_include_dirs: ["generated"],
+			}
+
+			cc_library_static {
+				name: "libfoo",
+				srcs: ["foo.cpp"],
+				generated_headers: ["genrule_foo"],
+			}
+		`),
+		android.FixtureAddTextFile("foo/baz/Android.bp", `
+			cc_library_static {
+				name: "libbaz",
+				srcs: ["baz.c"],
+			}
+		`),
+		android.FixtureAddTextFile("bar/Android.bp", `
+			cc_library_static {
+				name: "libbar",
+				srcs: ["bar.cpp"],
+			}
+		`),
+		android.FixtureAddFile("foo/foo.cpp", nil),
+		android.FixtureAddFile("foo/baz/baz.c", nil),
+		android.FixtureAddFile("bar/bar.cpp", nil),
+	).RunTest(t)
+
+	singleton := result.SingletonForTests("compdb_generator")
+
+	fragment := singleton.Output("development/ide/compdb/fragments/modules/foo/libfoo.json")
+	var entries []compDbEntry
+	if err := json.Unmarshal([]byte(android.ContentFromFileRuleForTests(t, result.TestContext, fragment)), &entries); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.File)
+		android.AssertStringEquals(t, "last argument of "+entry.File, entry.File,
+			entry.Arguments[len(entry.Arguments)-1])
+	}
+	genHeader := result.ModuleForTests("genrule_foo", "").Output("generated/foo.h").Output
+	android.AssertArrayString(t, "libfoo compdb files", []string{"foo/foo.cpp", genHeader.String()}, files)
+
+	dirFoo := singleton.Output("development/ide/compdb/fragments/dirs/foo/compile_commands.json")
+	android.AssertArrayString(t, "foo directory fragments", []string{fragment.Output.String()}, dirFoo.Inputs.Strings())
+	dirBaz := singleton.Output("development/ide/compdb/fragments/dirs/foo/baz/compile_commands.json")
+	dirBar := singleton.Output("development/ide/compdb/fragments/dirs/bar/compile_commands.json")
+
+	// The fragments of every directory are inputs of the merge, which selects the directories
+	// listed in dirs.txt when it runs.
+	dirs := singleton.Output("development/ide/compdb/dirs.txt")
+	merged := singleton.Output("development/ide/compdb/merged/compile_commands.json")
+	android.AssertArrayString(t, "merged fragments",
+		[]string{dirBar.Output.String(), dirFoo.Output.String(), dirBaz.Output.String()}, merged.Inputs.Strings())
+	android.AssertStringListContains(t, "merge implicits", merged.Implicits.Strings(), dirs.Output.String())
+	android.AssertStringEquals(t, "merge flags",
+		"-dirs out/soong/development/ide/compdb/dirs.txt -fragments_root out/soong/development/ide/compdb/fragments/dirs",
+		android.StringRelativeToTop(result.Config, merged.Args["flags"]))
+}
@@ -55,6 +55,12 @@ type BaseCompilerProperties struct {
 	// list of module-specific flags that will be used for C++ compiles
 	Cppflags []string `android:"arch_variant"`
 
+	// header file to precompile once per variant with the same flags as the C++ sources of the
+	// module. The precompiled header is passed to every .cpp, .cc and .cxx source with
+	// -include-pch, and clang-tidy, header-abi-dumper and the compilation database include the
+	// header itself instead.
+	Pch *string `android:"path,arch_variant"`
+
 	// list of module-specific flags that will be used for C compiles
 	Conlyflags []string `android:"arch_variant"`
 
@@ -284,6 +290,18 @@ func (compiler *baseCompiler) Srcs() android.Paths {
 	return append(android.Paths{}, compiler.srcs...)
 }
 
+// generatedHeaders returns the headers generated for the sources of the module, such as the
+// aidl and proto headers and the headers of genrule dependencies.
+func (compiler *baseCompiler) generatedHeaders() android.Paths {
+	var headers android.Paths
+	for _, dep := range compiler.pathDeps {
+		if _, ok := dep.(android.WritablePath); ok && inList(dep.Ext(), HeaderExts) {
+			headers = append(headers, dep)
+		}
+	}
+	return headers
+}
+
 func (compiler *baseCompiler) appendCflags(flags []string) {
 	compiler.Properties.Cflags.AppendSimpleValue(flags)
 }
@@ -406,6 +424,10 @@ func (compiler *baseCompiler) compilerFlags(ctx ModuleContext, flags Flags, deps
 	flags.Yacc = compiler.Properties.Yacc
 	flags.Lex = compiler.Properties.Lex
 
+	if compiler.Properties.Pch != nil {
+		flags.Pch = android.OptionalPathForPath(android.PathForModuleSrc(ctx, *compiler.Properties.Pch))
+	}
+
 	flags.ClangVerify = compiler.Properties.Clang_verify
 	if compiler.Properties.Clang_verify {
 		flags.Local.CFlags = append(flags.Local.CFlags, "-Xclang", "-verify")
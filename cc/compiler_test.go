@@ -15,6 +15,8 @@
 package cc
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"android/soong/android"
@@ -44,3 +46,83 @@ func TestIsThirdParty(t *testing.T) {
 		}
 	}
 }
+
+func TestPch(t *testing.T) {
+	t.Parallel()
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureAddTextFile("pch.h", ""),
+	).RunTestWithBp(t, `
+		cc_defaults {
+			name: "pch_defaults",
+			pch: "pch.h",
+		}
+
+		cc_library_static {
+			name: "libfoo",
+			defaults: ["pch_defaults"],
+			srcs: ["foo.cpp"],
+			tidy: true,
+		}
+
+		cc_library_shared {
+			name: "libabi",
+			defaults: ["pch_defaults"],
+			srcs: ["abi.cpp"],
+			header_abi_checker: {
+				enabled: true,
+			},
+		}
+
+		cc_library_static {
+			name: "libbar",
+			defaults: ["pch_defaults"],
+			srcs: ["bar.c"],
+		}
+	`)
+
+	libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_static")
+	pch := libfoo.Output("obj/pch.pch")
+	android.AssertPathRelativeToTopEquals(t, "pch input", "pch.h", pch.Input)
+
+	obj := libfoo.Output("obj/foo.o")
+	pchFlag := " -include-pch " + pch.Output.String()
+	android.AssertStringDoesContain(t, "cc cFlags", obj.Args["cFlags"], pchFlag)
+	android.AssertStringListContains(t, "cc implicits", obj.Implicits.Strings(), pch.Output.String())
+	android.AssertStringEquals(t, "pch cFlags match cc cFlags",
+		strings.Replace(obj.Args["cFlags"], pchFlag, "", 1), pch.Args["cFlags"])
+	android.AssertStringDoesContain(t, "pch command uses the compiler wrapper",
+		pch.RuleParams.Command, "${config.CcWrapper}$ccCmd")
+
+	// clang-tidy includes the header instead of the precompiled header.
+	tidy := libfoo.Output("obj/foo.tidy")
+	android.AssertStringDoesContain(t, "tidy cFlags", tidy.Args["cFlags"], " -include pch.h")
+	android.AssertStringDoesNotContain(t, "tidy cFlags", tidy.Args["cFlags"], "-include-pch")
+
+	// So does header-abi-dumper.
+	libabi := result.ModuleForTests("libabi", "android_arm64_armv8-a_shared")
+	sdump := libabi.Output("obj/abi.sdump")
+	android.AssertStringDoesContain(t, "sdump cFlags", sdump.Args["cFlags"], " -include pch.h")
+	android.AssertStringDoesNotContain(t, "sdump cFlags", sdump.Args["cFlags"], "-include-pch")
+	android.AssertStringDoesContain(t, "cc cFlags", libabi.Output("obj/abi.o").Args["cFlags"], "-include-pch")
+
+	// So does the compilation database.
+	fragment := result.SingletonForTests("compdb_generator").Output("development/ide/compdb/fragments/modules/libfoo.json")
+	var entries []compDbEntry
+	if err := json.Unmarshal([]byte(android.ContentFromFileRuleForTests(t, result.TestContext, fragment)), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 compdb entry for libfoo, got %d", len(entries))
+	}
+	args := strings.Join(entries[0].Arguments, " ")
+	android.AssertStringDoesContain(t, "compdb arguments", args, " -include pch.h foo.cpp")
+	android.AssertStringDoesNotContain(t, "compdb arguments", args, "-include-pch")
+
+	// C sources cannot use a header precompiled as C++.
+	libbar := result.ModuleForTests("libbar", "android_arm64_armv8-a_static")
+	if libbar.MaybeOutput("obj/pch.pch").Rule != nil {
+		t.Errorf("expected no precompiled header for libbar")
+	}
+	android.AssertStringDoesNotContain(t, "cc cFlags", libbar.Output("obj/bar.o").Args["cFlags"], "-include-pch")
+}
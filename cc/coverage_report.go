@@ -0,0 +1,150 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// This file implements the native_coverage_report singleton, which turns the .profraw files
+// written by host tests built with NATIVE_COVERAGE=true and CLANG_COVERAGE=true into lcov and
+// HTML reports. The host tests must be run with LLVM_PROFILE_FILE pointing to a file in one of
+// the directories listed in NATIVE_COVERAGE_PROFRAW_DIRS, which defaults to
+// $OUT_DIR/soong/native_coverage/profraw. The reports can be restricted to the sources of the
+// modules listed in NATIVE_COVERAGE_REPORT_MODULES.
+//
+// The reports are built by running m native_coverage_report, and written to
+// $OUT_DIR/soong/native_coverage/coverage.lcov and coverage_html.zip.
+
+const (
+	envVariableCoverageProfrawDirs   = "NATIVE_COVERAGE_PROFRAW_DIRS"
+	envVariableCoverageReportModules = "NATIVE_COVERAGE_REPORT_MODULES"
+
+	nativeCoverageReportDir = "native_coverage"
+)
+
+var (
+	_ = pctx.HostBinToolVariable("covmergeCmd", "covmerge")
+
+	nativeCoverageReport = pctx.AndroidStaticRule("nativeCoverageReport",
+		blueprint.RuleParams{
+			Command: "${covmergeCmd} -llvm_profdata ${config.ClangBin}/llvm-profdata " +
+				"-llvm_cov ${config.ClangBin}/llvm-cov -binaries ${in} ${profrawDirs} ${modules} " +
+				"-lcov ${out} -html ${html} -d ${out}.d",
+			CommandDeps: []string{
+				"${covmergeCmd}",
+				"${config.ClangBin}/llvm-profdata",
+				"${config.ClangBin}/llvm-cov",
+			},
+			Depfile: "${out}.d",
+			Deps:    blueprint.DepsGCC,
+		}, "profrawDirs", "modules", "html")
+)
+
+// NativeCoverageReportInfo is provided by the host modules that link a binary or a shared library
+// instrumented for clang coverage.
+type NativeCoverageReportInfo struct {
+	// The unstripped binary or shared library, which contains the coverage mapping.
+	UnstrippedBinary android.Path
+}
+
+var NativeCoverageReportInfoProvider = blueprint.NewProvider[NativeCoverageReportInfo]()
+
+// SetNativeCoverageReportInfo provides the unstripped output of a host module for the native
+// coverage report if the module was built with clang coverage.
+func SetNativeCoverageReportInfo(ctx android.ModuleContext, coverageEnabled bool, unstripped android.Path) {
+	if !ctx.Host() || !coverageEnabled || unstripped == nil || !ctx.DeviceConfig().ClangCoverageEnabled() {
+		return
+	}
+	android.SetProvider(ctx, NativeCoverageReportInfoProvider, NativeCoverageReportInfo{
+		UnstrippedBinary: unstripped,
+	})
+}
+
+func (c *Module) setNativeCoverageReportInfo(ctx ModuleContext) {
+	if c.coverage == nil || !c.outputFile.Valid() {
+		return
+	}
+	library, isLibrary := c.linker.(libraryInterface)
+	if c.Binary() || isLibrary && library.shared() {
+		SetNativeCoverageReportInfo(ctx, c.coverage.Properties.CoverageEnabled, c.UnstrippedOutputFile())
+	}
+}
+
+func nativeCoverageReportSingletonFactory() android.Singleton {
+	return &nativeCoverageReportSingleton{}
+}
+
+type nativeCoverageReportSingleton struct{}
+
+func (n *nativeCoverageReportSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !ctx.DeviceConfig().ClangCoverageEnabled() {
+		return
+	}
+
+	var lines []string
+	var binaries android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		info, ok := android.SingletonModuleProvider(ctx, module, NativeCoverageReportInfoProvider)
+		if !ok {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s",
+			ctx.ModuleName(module), ctx.ModuleDir(module), info.UnstrippedBinary.String()))
+		binaries = append(binaries, info.UnstrippedBinary)
+	})
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+
+	binariesFile := android.PathForOutput(ctx, nativeCoverageReportDir, "binaries.txt")
+	android.WriteFileRule(ctx, binariesFile, strings.Join(lines, "\n"))
+
+	profrawDirs := strings.Fields(ctx.Config().Getenv(envVariableCoverageProfrawDirs))
+	if len(profrawDirs) == 0 {
+		profrawDirs = []string{android.PathForOutput(ctx, nativeCoverageReportDir, "profraw").String()}
+	}
+	var modules string
+	if list := strings.Fields(ctx.Config().Getenv(envVariableCoverageReportModules)); len(list) > 0 {
+		modules = "-modules " + strings.Join(list, ",")
+	}
+
+	// The .profraw files are written by the tests outside of the build, so they can't be known
+	// here. covmerge lists them and the directories that contain them in the depfile, which
+	// reruns the report when a .profraw file is added or removed.
+	lcovFile := android.PathForOutput(ctx, nativeCoverageReportDir, "coverage.lcov")
+	htmlZip := android.PathForOutput(ctx, nativeCoverageReportDir, "coverage_html.zip")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           nativeCoverageReport,
+		Description:    "native coverage report",
+		Output:         lcovFile,
+		ImplicitOutput: htmlZip,
+		Input:          binariesFile,
+		Implicits:      binaries,
+		Args: map[string]string{
+			"profrawDirs": android.JoinWithPrefix(profrawDirs, "-profraw_dir "),
+			"modules":     modules,
+			"html":        htmlZip.String(),
+		},
+	})
+	ctx.Phony("native_coverage_report", lcovFile, htmlZip)
+}
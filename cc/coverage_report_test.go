@@ -0,0 +1,94 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func TestNativeCoverageReport(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires linux")
+	}
+
+	t.Parallel()
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.ClangCoverage = proptools.BoolPtr(true)
+			variables.Native_coverage = proptools.BoolPtr(true)
+			variables.NativeCoveragePaths = []string{"*"}
+		}),
+		android.FixtureMergeEnv(map[string]string{
+			envVariableCoverageProfrawDirs:   "/tmp/profraw_a /tmp/profraw_b",
+			envVariableCoverageReportModules: "libfoo foo_test",
+		}),
+	).RunTestWithBp(t, `
+		cc_library {
+			name: "libfoo",
+			host_supported: true,
+			srcs: ["foo.cpp"],
+		}
+
+		cc_library {
+			name: "libnocov",
+			host_supported: true,
+			srcs: ["foo.cpp"],
+			native_coverage: false,
+		}
+
+		cc_test_host {
+			name: "foo_test",
+			srcs: ["foo.cpp"],
+			shared_libs: [
+				"libfoo",
+				"libnocov",
+			],
+			gtest: false,
+		}
+	`)
+
+	const variant = "linux_glibc_x86_64"
+	libfoo := result.ModuleForTests("libfoo", variant+"_shared_cov").Module().(*Module)
+	fooTest := result.ModuleForTests("foo_test", variant+"_cov").Module().(*Module)
+	libnocov := result.ModuleForTests("libnocov", variant+"_shared").Module().(*Module)
+
+	report := result.SingletonForTests("native_coverage_report").Output("native_coverage/coverage.lcov")
+	implicits := report.Implicits.Strings()
+	android.AssertStringListContains(t, "report implicits", implicits, libfoo.UnstrippedOutputFile().String())
+	android.AssertStringListContains(t, "report implicits", implicits, fooTest.UnstrippedOutputFile().String())
+	android.AssertStringListDoesNotContain(t, "report implicits", implicits, libnocov.UnstrippedOutputFile().String())
+	android.AssertStringEquals(t, "profraw dirs", "-profraw_dir /tmp/profraw_a -profraw_dir /tmp/profraw_b",
+		report.Args["profrawDirs"])
+	android.AssertStringEquals(t, "modules", "-modules libfoo,foo_test", report.Args["modules"])
+	// The .profraw files are tracked through the depfile written by covmerge.
+	android.AssertStringEquals(t, "report depfile", "${out}.d", report.RuleParams.Depfile)
+	android.AssertStringDoesContain(t, "report command", report.RuleParams.Command, "-d ${out}.d")
+
+	binaries := android.ContentFromFileRuleForTests(t, result.TestContext,
+		result.SingletonForTests("native_coverage_report").Output("native_coverage/binaries.txt"))
+	android.AssertStringDoesContain(t, "binaries", binaries,
+		"foo_test\t.\t"+fooTest.UnstrippedOutputFile().String())
+	android.AssertStringDoesNotContain(t, "binaries", binaries, "libnocov")
+
+	// Device modules are not part of the host coverage report.
+	android.AssertStringListDoesNotContain(t, "report implicits", implicits,
+		result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared_cov").Module().(*Module).UnstrippedOutputFile().String())
+}
@@ -419,6 +419,10 @@ type libraryDecorator struct {
 
 	versionScriptPath android.OptionalPath
 
+	// Location of the list of symbols exported by the stubs variant, generated from the
+	// symbol file at the version of the stubs.
+	stubsSymbolListPath android.Path
+
 	postInstallCmds []string
 
 	skipAPIDefine bool
@@ -634,6 +638,7 @@ func (library *libraryDecorator) compile(ctx ModuleContext, flags Flags, deps Pa
 		objs := compileStubLibrary(ctx, flags, nativeAbiResult.stubSrc)
 		library.versionScriptPath = android.OptionalPathForPath(
 			nativeAbiResult.versionScript)
+		library.stubsSymbolListPath = nativeAbiResult.symbolList
 
 		// Parse symbol file to get API list for coverage
 		if library.stubsVersion() == "current" && ctx.PrimaryArch() && !ctx.inRecovery() && !ctx.inProduct() && !ctx.inVendor() {
@@ -727,6 +732,7 @@ type versionedInterface interface {
 	isStubsImplementationRequired() bool
 	setStubsVersion(string)
 	stubsVersion() string
+	stubsSymbolList() android.Path
 
 	stubsVersions(ctx android.BaseMutatorContext) []string
 	setAllStubsVersions([]string)
@@ -1195,6 +1201,7 @@ func addStubDependencyProviders(ctx ModuleContext) {
 			flagInfo, _ := android.OtherModuleProvider(ctx, stub, FlagExporterInfoProvider)
 			stubsInfo = append(stubsInfo, SharedStubLibrary{
 				Version:           moduleLibraryInterface(stub).stubsVersion(),
+				SymbolList:        moduleLibraryInterface(stub).stubsSymbolList(),
 				SharedLibraryInfo: stubInfo,
 				FlagExporterInfo:  flagInfo,
 			})
@@ -1962,6 +1969,10 @@ func (library *libraryDecorator) stubsVersion() string {
 	return library.MutatedProperties.StubsVersion
 }
 
+func (library *libraryDecorator) stubsSymbolList() android.Path {
+	return library.stubsSymbolListPath
+}
+
 func (library *libraryDecorator) setBuildStubs(isLatest bool) {
 	library.MutatedProperties.BuildStubs = true
 	library.MutatedProperties.IsLatestVersion = isLatest
@@ -326,7 +326,10 @@ var SharedLibraryInfoProvider = blueprint.NewProvider[SharedLibraryInfo]()
 type SharedStubLibrary struct {
 	// The version of the stub (corresponding to the stable version of the shared library being
 	// stubbed).
-	Version           string
+	Version string
+	// The list of symbols exported by the stub, or nil if the stub is not generated from a
+	// symbol file.
+	SymbolList        android.Path
 	SharedLibraryInfo SharedLibraryInfo
 	FlagExporterInfo  FlagExporterInfo
 }
@@ -381,3 +384,31 @@ type FlagExporterInfo struct {
 }
 
 var FlagExporterInfoProvider = blueprint.NewProvider[FlagExporterInfo]()
+
+// GeneratedCcSourcesInfo is provided by the linkable modules that also generate C++ sources and
+// headers, e.g. rust_cxx_bridge, so that cc modules can use them like genrules in the
+// generated_sources, generated_headers and export_generated_headers properties.
+type GeneratedCcSourcesInfo struct {
+	// The generated sources and headers.
+	Sources android.Paths
+	// The directories containing the generated headers.
+	HeaderDirs android.Paths
+	// The files that the cc modules using the generated headers depend on.
+	Deps android.Paths
+}
+
+var GeneratedCcSourcesInfoProvider = blueprint.NewProvider[GeneratedCcSourcesInfo]()
+
+// GeneratedSourceFiles, GeneratedHeaderDirs and GeneratedDeps implement
+// genrule.SourceFileGenerator.
+func (g GeneratedCcSourcesInfo) GeneratedSourceFiles() android.Paths {
+	return g.Sources
+}
+
+func (g GeneratedCcSourcesInfo) GeneratedHeaderDirs() android.Paths {
+	return g.HeaderDirs
+}
+
+func (g GeneratedCcSourcesInfo) GeneratedDeps() android.Paths {
+	return g.Deps
+}
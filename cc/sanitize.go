@@ -38,6 +38,11 @@ var (
 	}
 	asanLdflags = []string{"-Wl,-u,__asan_preinit"}
 
+	msanCflags = []string{
+		"-fno-omit-frame-pointer",
+		"-fsanitize-memory-track-origins",
+	}
+
 	// DO NOT ADD MLLVM FLAGS HERE! ADD THEM BELOW TO hwasanCommonFlags.
 	hwasanCflags = []string{
 		"-fno-omit-frame-pointer",
@@ -103,6 +108,7 @@ const (
 	Memtag_heap
 	Memtag_stack
 	Memtag_globals
+	Msan
 	cfi // cfi is last to prevent it running before incompatible mutators
 )
 
@@ -116,6 +122,7 @@ var Sanitizers = []SanitizerType{
 	Memtag_heap,
 	Memtag_stack,
 	Memtag_globals,
+	Msan,
 	cfi, // cfi is last to prevent it running before incompatible mutators
 }
 
@@ -142,6 +149,8 @@ func (t SanitizerType) variationName() string {
 		return "memtag_globals"
 	case Fuzzer:
 		return "fuzzer"
+	case Msan:
+		return "msan"
 	default:
 		panic(fmt.Errorf("unknown SanitizerType %d", t))
 	}
@@ -170,6 +179,8 @@ func (t SanitizerType) name() string {
 		return "shadow-call-stack"
 	case Fuzzer:
 		return "fuzzer"
+	case Msan:
+		return "memory"
 	default:
 		panic(fmt.Errorf("unknown SanitizerType %d", t))
 	}
@@ -177,7 +188,7 @@ func (t SanitizerType) name() string {
 
 func (t SanitizerType) registerMutators(ctx android.RegisterMutatorsContext) {
 	switch t {
-	case cfi, Hwasan, Asan, tsan, Fuzzer, scs, Memtag_stack:
+	case cfi, Hwasan, Asan, tsan, Fuzzer, scs, Memtag_stack, Msan:
 		sanitizer := &sanitizerSplitMutator{t}
 		ctx.TopDown(t.variationName()+"_markapexes", sanitizer.markSanitizableApexesMutator)
 		ctx.Transition(t.variationName(), sanitizer)
@@ -198,6 +209,10 @@ func (t SanitizerType) shouldPropagateToSharedLibraryDeps() bool {
 		// because a library sanitized for fuzzer can't be linked from a library that isn't sanitized
 		// for fuzzer.
 		return true
+	case Msan:
+		// MSan reports false positives for memory initialized by uninstrumented code, so every
+		// library in the tree, static or shared, must be instrumented.
+		return true
 	default:
 		return false
 	}
@@ -224,6 +239,8 @@ func (*Module) SanitizerSupported(t SanitizerType) bool {
 		return true
 	case Memtag_globals:
 		return true
+	case Msan:
+		return true
 	default:
 		return false
 	}
@@ -231,7 +248,7 @@ func (*Module) SanitizerSupported(t SanitizerType) bool {
 
 // incompatibleWithCfi returns true if a sanitizer is incompatible with CFI.
 func (t SanitizerType) incompatibleWithCfi() bool {
-	return t == Asan || t == Fuzzer || t == Hwasan
+	return t == Asan || t == Fuzzer || t == Hwasan || t == Msan
 }
 
 type SanitizeUserProps struct {
@@ -251,6 +268,12 @@ type SanitizeUserProps struct {
 	// HWASan (Hardware Address sanitizer).
 	// Use of hwasan sanitizer disables cfi, address, thread, and scudo sanitizers.
 	Hwaddress *bool `android:"arch_variant"`
+	// MSan (Memory sanitizer), only available on 64-bit linux_glibc hosts, incompatible with
+	// static binaries.
+	// Always runs in a diagnostic mode.
+	// Use of memory sanitizer disables cfi and scudo sanitizers.
+	// Address, Hwaddress and Thread sanitizers take precedence over this sanitizer.
+	Memory *bool `android:"arch_variant"`
 
 	// Undefined behavior sanitizer
 	All_undefined *bool `android:"arch_variant"`
@@ -333,6 +356,8 @@ type sanitizeMutatedProperties struct {
 	Thread *bool `blueprint:"mutated"`
 	// Whether HWASan (Hardware Address sanitizer) is enabled for this module
 	Hwaddress *bool `blueprint:"mutated"`
+	// Whether MSan (Memory sanitizer) is enabled for this module
+	Memory *bool `blueprint:"mutated"`
 
 	// Whether Undefined behavior sanitizer is enabled for this module
 	All_undefined *bool `blueprint:"mutated"`
@@ -425,6 +450,7 @@ func (p *sanitizeMutatedProperties) copyUserPropertiesToMutated(userProps *Sanit
 	p.Fuzzer = userProps.Fuzzer
 	p.Hwaddress = userProps.Hwaddress
 	p.Integer_overflow = userProps.Integer_overflow
+	p.Memory = userProps.Memory
 	p.Memtag_heap = userProps.Memtag_heap
 	p.Memtag_stack = userProps.Memtag_stack
 	p.Memtag_globals = userProps.Memtag_globals
@@ -512,6 +538,10 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 			s.Fuzzer = proptools.BoolPtr(true)
 		}
 
+		if found, globalSanitizers = removeFromList("memory", globalSanitizers); found && s.Memory == nil {
+			s.Memory = proptools.BoolPtr(true)
+		}
+
 		if found, globalSanitizers = removeFromList("safe-stack", globalSanitizers); found && s.Safestack == nil {
 			s.Safestack = proptools.BoolPtr(true)
 		}
@@ -731,6 +761,12 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 		s.Address = nil
 		s.Fuzzer = nil
 		s.Thread = nil
+		s.Memory = nil
+	}
+
+	// MSan runtimes only exist for 64-bit linux_glibc hosts.
+	if ctx.Os() != android.Linux || !ctx.toolchain().Is64Bit() {
+		s.Memory = nil
 	}
 
 	if Bool(s.All_undefined) {
@@ -747,12 +783,12 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 	if ctx.Os() != android.Windows && (Bool(s.All_undefined) || Bool(s.Undefined) || Bool(s.Address) || Bool(s.Thread) ||
 		Bool(s.Fuzzer) || Bool(s.Safestack) || Bool(s.Cfi) || Bool(s.Integer_overflow) || len(s.Misc_undefined) > 0 ||
 		Bool(s.Scudo) || Bool(s.Hwaddress) || Bool(s.Scs) || Bool(s.Memtag_heap) || Bool(s.Memtag_stack) ||
-		Bool(s.Memtag_globals)) {
+		Bool(s.Memtag_globals) || Bool(s.Memory)) {
 		sanitize.Properties.SanitizerEnabled = true
 	}
 
-	// Disable Scudo if ASan or TSan is enabled, or if it's disabled globally.
-	if Bool(s.Address) || Bool(s.Thread) || Bool(s.Hwaddress) || ctx.Config().DisableScudo() {
+	// Disable Scudo if ASan, TSan or MSan is enabled, or if it's disabled globally.
+	if Bool(s.Address) || Bool(s.Thread) || Bool(s.Hwaddress) || Bool(s.Memory) || ctx.Config().DisableScudo() {
 		s.Scudo = nil
 	}
 
@@ -761,6 +797,19 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 		s.Thread = nil
 	}
 
+	// MSan can't be combined with the other sanitizers that use shadow memory.
+	if Bool(s.Address) || Bool(s.Hwaddress) || Bool(s.Thread) {
+		s.Memory = nil
+	}
+
+	// MSan is incompatible with CFI, and the fuzzer variants of dependencies are not instrumented
+	// for MSan.
+	if Bool(s.Memory) {
+		s.Cfi = nil
+		s.Diag.Cfi = nil
+		s.Fuzzer = nil
+	}
+
 	// TODO(b/131771163): CFI transiently depends on LTO, and thus Fuzzer is
 	// mutually incompatible.
 	if Bool(s.Fuzzer) {
@@ -858,6 +907,13 @@ func (s *sanitize) flags(ctx ModuleContext, flags Flags) Flags {
 		}
 	}
 
+	if Bool(sanProps.Memory) {
+		flags.Local.CFlags = append(flags.Local.CFlags, msanCflags...)
+		// -nodefaultlibs (provided with libc++) prevents the driver from linking
+		// libraries needed with -fsanitize=memory.
+		flags.Local.LdFlags = append(flags.Local.LdFlags, "-Wl,--no-as-needed")
+	}
+
 	if Bool(sanProps.Fuzzer) {
 		flags.Local.CFlags = append(flags.Local.CFlags, "-fsanitize=fuzzer-no-link")
 
@@ -1055,6 +1111,8 @@ func (s *sanitize) getSanitizerBoolPtr(t SanitizerType) *bool {
 		return s.Properties.SanitizeMutated.Memtag_globals
 	case Fuzzer:
 		return s.Properties.SanitizeMutated.Fuzzer
+	case Msan:
+		return s.Properties.SanitizeMutated.Memory
 	default:
 		panic(fmt.Errorf("unknown SanitizerType %d", t))
 	}
@@ -1070,7 +1128,8 @@ func (sanitize *sanitize) isUnsanitizedVariant() bool {
 		!sanitize.isSanitizerEnabled(Memtag_heap) &&
 		!sanitize.isSanitizerEnabled(Memtag_stack) &&
 		!sanitize.isSanitizerEnabled(Memtag_globals) &&
-		!sanitize.isSanitizerEnabled(Fuzzer)
+		!sanitize.isSanitizerEnabled(Fuzzer) &&
+		!sanitize.isSanitizerEnabled(Msan)
 }
 
 // isVariantOnProductionDevice returns true if variant is for production devices (no non-production sanitizers enabled).
@@ -1078,7 +1137,8 @@ func (sanitize *sanitize) isVariantOnProductionDevice() bool {
 	return !sanitize.isSanitizerEnabled(Asan) &&
 		!sanitize.isSanitizerEnabled(Hwasan) &&
 		!sanitize.isSanitizerEnabled(tsan) &&
-		!sanitize.isSanitizerEnabled(Fuzzer)
+		!sanitize.isSanitizerEnabled(Fuzzer) &&
+		!sanitize.isSanitizerEnabled(Msan)
 }
 
 func (sanitize *sanitize) SetSanitizer(t SanitizerType, b bool) {
@@ -1114,6 +1174,8 @@ func (sanitize *sanitize) SetSanitizer(t SanitizerType, b bool) {
 		sanitize.Properties.Sanitize.Memtag_globals = bPtr
 	case Fuzzer:
 		sanitize.Properties.SanitizeMutated.Fuzzer = bPtr
+	case Msan:
+		sanitize.Properties.SanitizeMutated.Memory = bPtr
 	default:
 		panic(fmt.Errorf("unknown SanitizerType %d", t))
 	}
@@ -1417,6 +1479,32 @@ func sanitizerRuntimeDepsMutator(mctx android.TopDownMutatorContext) {
 	}
 }
 
+// checkMsanDeps reports an error for each linked dependency of an MSan module that opted out of
+// MSan. MSan reports false positives for memory initialized by uninstrumented code, so such a
+// dependency can't be silently mixed in. The prebuilt toolchain runtime libraries are exempt.
+func checkMsanDeps(mctx android.BottomUpMutatorContext) {
+	mctx.VisitDirectDeps(func(dep android.Module) {
+		tag := mctx.OtherModuleDependencyTag(dep)
+		if !IsSanitizableDependencyTag(tag) {
+			return
+		}
+		if libTag, ok := tag.(libraryDependencyTag); ok && libTag.header() {
+			return
+		}
+		if l, ok := dep.(LinkableInterface); ok && l.IsPrebuilt() {
+			return
+		}
+		d, ok := dep.(PlatformSanitizeable)
+		if !ok || d.IsSanitizerEnabled(Msan) {
+			return
+		}
+		if d.SanitizeNever() || d.IsSanitizerExplicitlyDisabled(Msan) {
+			mctx.ModuleErrorf("depends on %q, which is not built with MemorySanitizer; "+
+				"remove sanitize.never or sanitize.memory: false from it", mctx.OtherModuleName(dep))
+		}
+	})
+}
+
 // Add the dependency to the runtime library for each of the sanitizer variants
 func sanitizerRuntimeMutator(mctx android.BottomUpMutatorContext) {
 	if c, ok := mctx.Module().(*Module); ok && c.sanitize != nil {
@@ -1428,6 +1516,10 @@ func sanitizerRuntimeMutator(mctx android.BottomUpMutatorContext) {
 
 		sanProps := &c.sanitize.Properties.SanitizeMutated
 
+		if Bool(sanProps.Memory) {
+			checkMsanDeps(mctx)
+		}
+
 		if Bool(sanProps.All_undefined) {
 			sanitizers = append(sanitizers, "undefined")
 		} else {
@@ -1478,6 +1570,11 @@ func sanitizerRuntimeMutator(mctx android.BottomUpMutatorContext) {
 			sanitizers = append(sanitizers, "thread")
 		}
 
+		if Bool(sanProps.Memory) {
+			sanitizers = append(sanitizers, "memory")
+			diagSanitizers = append(diagSanitizers, "memory")
+		}
+
 		if Bool(sanProps.Safestack) {
 			sanitizers = append(sanitizers, "safe-stack")
 		}
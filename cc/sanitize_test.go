@@ -414,6 +414,168 @@ func TestTsan(t *testing.T) {
 	})
 }
 
+func TestMsan(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires linux")
+	}
+
+	t.Parallel()
+	bp := `
+	cc_binary {
+		name: "bin_with_msan",
+		host_supported: true,
+		srcs: ["src.cc"],
+		shared_libs: ["libshared"],
+		static_libs: ["libstatic"],
+		sanitize: {
+			memory: true,
+		}
+	}
+
+	cc_binary {
+		name: "bin_no_msan",
+		host_supported: true,
+		srcs: ["src.cc"],
+		shared_libs: ["libshared"],
+		static_libs: ["libstatic"],
+	}
+
+	cc_library_shared {
+		name: "libshared",
+		host_supported: true,
+		srcs: ["src.cc"],
+		shared_libs: ["libtransitive"],
+	}
+
+	cc_library_shared {
+		name: "libtransitive",
+		host_supported: true,
+		srcs: ["src.cc"],
+	}
+
+	cc_library_shared {
+		name: "libnever",
+		host_supported: true,
+		srcs: ["src.cc"],
+		sanitize: {
+			never: true,
+		}
+	}
+
+	cc_library_static {
+		name: "libstatic",
+		host_supported: true,
+		srcs: ["src.cc"],
+	}
+
+	cc_library_static {
+		name: "libnomsan",
+		host_supported: true,
+		srcs: ["src.cc"],
+		sanitize: {
+			memory: false,
+		}
+	}
+`
+
+	const variant = "linux_glibc_x86_64"
+	const msanFlag = "-fsanitize=memory"
+	msanVariant := variant + "_msan"
+	sharedVariant := variant + "_shared"
+	sharedMsanVariant := sharedVariant + "_msan"
+	staticVariant := variant + "_static"
+	staticMsanVariant := staticVariant + "_msan"
+
+	expectMsanCflags := func(t *testing.T, m android.TestingModule, expected bool) {
+		t.Helper()
+		cflags := m.Output("obj/src.o").Args["cFlags"]
+		if expected {
+			android.AssertStringDoesContain(t, m.Module().Name()+" cflags", cflags, msanFlag)
+		} else {
+			android.AssertStringDoesNotContain(t, m.Module().Name()+" cflags", cflags, msanFlag)
+		}
+	}
+
+	t.Run("property", func(t *testing.T) {
+		result := prepareForCcTest.RunTestWithBp(t, bp)
+		ctx := result.TestContext
+
+		binWithMsan := result.ModuleForTests("bin_with_msan", msanVariant)
+		binNoMsan := result.ModuleForTests("bin_no_msan", variant)
+
+		// All shared and static dependencies of the msan binary are instrumented.
+		libSharedMsan := result.ModuleForTests("libshared", sharedMsanVariant)
+		libTransitiveMsan := result.ModuleForTests("libtransitive", sharedMsanVariant)
+		libStaticMsan := result.ModuleForTests("libstatic", staticMsanVariant)
+
+		libShared := result.ModuleForTests("libshared", sharedVariant)
+		libStatic := result.ModuleForTests("libstatic", staticVariant)
+
+		expectSharedLinkDep(t, ctx, binWithMsan, libSharedMsan)
+		expectSharedLinkDep(t, ctx, libSharedMsan, libTransitiveMsan)
+		expectStaticLinkDep(t, ctx, binWithMsan, libStaticMsan)
+		expectNoSharedLinkDep(t, ctx, binWithMsan, libShared)
+		expectNoStaticLinkDep(t, ctx, binWithMsan, libStatic)
+
+		expectSharedLinkDep(t, ctx, binNoMsan, libShared)
+		expectStaticLinkDep(t, ctx, binNoMsan, libStatic)
+
+		expectMsanCflags(t, binWithMsan, true)
+		expectMsanCflags(t, libSharedMsan, true)
+		expectMsanCflags(t, libTransitiveMsan, true)
+		expectMsanCflags(t, libStaticMsan, true)
+		expectMsanCflags(t, binNoMsan, false)
+		expectMsanCflags(t, libShared, false)
+
+		android.AssertStringListDoesNotContain(t, "msan libraries have undefined symbols",
+			strings.Fields(libSharedMsan.Description("link").Args["ldFlags"]), "-Wl,--no-undefined")
+
+		// MSan is not supported on devices or musl hosts.
+		android.AssertStringListDoesNotContain(t, "device variants of bin_with_msan",
+			result.ModuleVariantsForTests("bin_with_msan"), "android_arm64_armv8-a_msan")
+	})
+
+	t.Run("SANITIZE_HOST", func(t *testing.T) {
+		result := android.GroupFixturePreparers(
+			prepareForCcTest,
+			android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+				variables.SanitizeHost = []string{"memory"}
+			}),
+		).RunTestWithBp(t, bp)
+		ctx := result.TestContext
+
+		binNoMsan := result.ModuleForTests("bin_no_msan", msanVariant)
+		libShared := result.ModuleForTests("libshared", sharedMsanVariant)
+		libStatic := result.ModuleForTests("libstatic", staticMsanVariant)
+
+		expectSharedLinkDep(t, ctx, binNoMsan, libShared)
+		expectStaticLinkDep(t, ctx, binNoMsan, libStatic)
+		expectMsanCflags(t, binNoMsan, true)
+		expectMsanCflags(t, result.ModuleForTests("libnever", sharedVariant), false)
+	})
+
+	// Uninstrumented libraries can't be mixed into an msan binary.
+	for lib, prop := range map[string]string{"libnever": "shared_libs", "libnomsan": "static_libs"} {
+		t.Run("opted out "+lib, func(t *testing.T) {
+			prepareForCcTest.
+				ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+					`module "bin_with_opted_out_dep" variant "`+msanVariant+`": depends on "`+lib+
+						`", which is not built with MemorySanitizer`)).
+				RunTestWithBp(t, bp+`
+				cc_binary {
+					name: "bin_with_opted_out_dep",
+					host_supported: true,
+					srcs: ["src.cc"],
+					`+prop+`: ["`+lib+`"],
+					sanitize: {
+						memory: true,
+					}
+				}
+			`)
+		})
+	}
+}
+
 func TestMiscUndefined(t *testing.T) {
 	if runtime.GOOS != "linux" {
 		t.Skip("requires linux")
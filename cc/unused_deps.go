@@ -0,0 +1,268 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"encoding/json"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// This file implements an opt-in report of the header_libs, shared_libs and static_libs of cc
+// modules that are not used. When SOONG_UNUSED_DEPS_REPORT is set, the compile
+// rules keep a copy of their depfiles and the link rules write the files loaded by lld --trace. The
+// unused_deps tool reads them, along with the dependencies declared in the Android.bp file of each
+// module variant, and the unused_deps_report singleton merges the reports of all variants into
+// $OUT/soong/unused_deps.json. The edits suggested by the report are also written to
+// $OUT/soong/unused_deps_edits.json, which can be applied with bpfix -edits.
+//
+// The headers reexported with the export_*_lib_headers properties may be included by the reverse
+// dependencies of the module rather than by the module itself. Each module publishes the headers it
+// reexports, along with the ones reexported by the dependencies it reexports, and the reverse
+// dependencies record which of them they include, so that the merged report only lists the
+// export_*_lib_headers entries that nothing includes.
+//
+// The report is built by running m unused_deps_report with SOONG_UNUSED_DEPS_REPORT=true.
+
+const envVariableUnusedDepsReport = "SOONG_UNUSED_DEPS_REPORT"
+
+var (
+	_ = pctx.HostBinToolVariable("unusedDepsCmd", "unused_deps")
+
+	unusedDeps = pctx.AndroidStaticRule("unusedDeps",
+		blueprint.RuleParams{
+			Command:     "${unusedDepsCmd} -o ${out} ${in}",
+			CommandDeps: []string{"${unusedDepsCmd}"},
+		})
+
+	unusedDepsMerge = pctx.AndroidStaticRule("unusedDepsMerge",
+		blueprint.RuleParams{
+			Command:        "${unusedDepsCmd} -merge -o ${out} -edits ${edits} @${out}.rsp",
+			CommandDeps:    []string{"${unusedDepsCmd}"},
+			Rspfile:        "${out}.rsp",
+			RspfileContent: "${in}",
+		}, "edits")
+)
+
+func unusedDepsReportEnabled(config android.Config) bool {
+	return config.IsEnvTrue(envVariableUnusedDepsReport)
+}
+
+// unusedDepsLinkTraceFile returns the file that the output of lld --trace, which lists the object
+// files, the archive members and the shared libraries loaded when linking the module, is written to.
+func unusedDepsLinkTraceFile(ctx android.ModuleContext) android.WritablePath {
+	return android.PathForModuleOut(ctx, "unused_deps", "link_trace.txt")
+}
+
+// unusedDepsDep is a dependency declared in the Android.bp file of a module. The JSON format must
+// be kept in sync with cmd/unused_deps.
+type unusedDepsDep struct {
+	Name        string   `json:"name"`
+	Property    string   `json:"property"`
+	IncludeDirs []string `json:"include_dirs,omitempty"`
+	LinkFile    string   `json:"link_file,omitempty"`
+	// Reexported is true if the headers of the dependency are reexported with an
+	// export_*_lib_headers property, so that reverse dependencies may use them.
+	Reexported bool `json:"reexported,omitempty"`
+
+	linkPath android.Path
+}
+
+// unusedDepsReexport is a dependency whose headers a module reexports with an
+// export_*_lib_headers property. The JSON format must be kept in sync with cmd/unused_deps.
+type unusedDepsReexport struct {
+	Module      string   `json:"module"`
+	File        string   `json:"file"`
+	Name        string   `json:"name"`
+	IncludeDirs []string `json:"include_dirs,omitempty"`
+}
+
+// unusedDepsInput is the input of the unused_deps tool for a module variant.
+type unusedDepsInput struct {
+	Module    string          `json:"module"`
+	Variant   string          `json:"variant"`
+	File      string          `json:"file"`
+	DepFiles  []string        `json:"dep_files"`
+	LinkTrace string          `json:"link_trace,omitempty"`
+	Output    string          `json:"output,omitempty"`
+	Deps      []unusedDepsDep `json:"deps"`
+	// DepReexports are the headers reexported by the dependencies of the module variant.
+	DepReexports []unusedDepsReexport `json:"dep_reexports,omitempty"`
+}
+
+// unusedDepsReportProvider provides the unused deps report of a module variant.
+var unusedDepsReportProvider = blueprint.NewProvider[android.Path]()
+
+// unusedDepsReexportsProvider provides the headers that a module variant reexports, including the
+// ones reexported by the dependencies whose headers it reexports.
+var unusedDepsReexportsProvider = blueprint.NewProvider[[]unusedDepsReexport]()
+
+// recordUnusedDepsCandidate records a library dependency of the module if it is listed in the
+// properties of the module, as opposed to being added implicitly by Soong. It also records the
+// headers reexported by the dependency, which the module may include, and the headers that the
+// module reexports in turn.
+func (c *Module) recordUnusedDepsCandidate(ctx android.ModuleContext, libDepTag libraryDependencyTag,
+	name string, linkFile android.OptionalPath, exporterInfo FlagExporterInfo,
+	depReexports []unusedDepsReexport) {
+
+	if c.linker == nil {
+		return
+	}
+	props := c.linker.baseLinkerProps()
+
+	c.unusedDepsDepReexports = append(c.unusedDepsDepReexports, depReexports...)
+	if libDepTag.reexportFlags {
+		c.unusedDepsReexports = append(c.unusedDepsReexports, depReexports...)
+	}
+
+	includeDirs := append(exporterInfo.IncludeDirs.Strings(), exporterInfo.SystemIncludeDirs.Strings()...)
+	add := func(property string, list []string, exportList []string, linked bool) {
+		if !inList(name, list) {
+			return
+		}
+		dep := unusedDepsDep{
+			Name:        name,
+			Property:    property,
+			IncludeDirs: includeDirs,
+			Reexported:  inList(name, exportList),
+		}
+		if linked && linkFile.Valid() {
+			dep.LinkFile = linkFile.String()
+			dep.linkPath = linkFile.Path()
+		}
+		c.unusedDepsCandidates = append(c.unusedDepsCandidates, dep)
+		if dep.Reexported {
+			c.unusedDepsReexports = append(c.unusedDepsReexports, unusedDepsReexport{
+				Module:      ctx.ModuleName(),
+				File:        ctx.BlueprintsFile(),
+				Name:        name,
+				IncludeDirs: includeDirs,
+			})
+		}
+	}
+
+	switch {
+	case libDepTag.header():
+		add("header_libs", props.Header_libs, props.Export_header_lib_headers, false)
+	case libDepTag.shared():
+		add("shared_libs", props.Shared_libs, props.Export_shared_lib_headers, true)
+	case libDepTag.static() && !libDepTag.wholeStatic:
+		add("static_libs", props.Static_libs, props.Export_static_lib_headers, true)
+	}
+}
+
+// generateUnusedDepsReport generates the rule that checks which of the declared dependencies of the
+// module variant are not used.
+func (c *Module) generateUnusedDepsReport(ctx ModuleContext, objs Objects) {
+	if len(c.unusedDepsReexports) > 0 {
+		android.SetProvider(ctx, unusedDepsReexportsProvider, c.unusedDepsReexports)
+	}
+
+	candidates := c.unusedDepsCandidates
+	depReexports := c.unusedDepsDepReexports
+	if len(objs.depFiles) == 0 {
+		// Without compiled sources only the reexported headers, which the reverse dependencies may
+		// include, can be checked.
+		candidates = nil
+		for _, dep := range c.unusedDepsCandidates {
+			if dep.Reexported {
+				candidates = append(candidates, dep)
+			}
+		}
+		depReexports = nil
+	}
+	if len(candidates) == 0 && len(depReexports) == 0 {
+		return
+	}
+
+	input := unusedDepsInput{
+		Module:       ctx.ModuleName(),
+		Variant:      ctx.ModuleSubDir(),
+		File:         ctx.BlueprintsFile(),
+		DepFiles:     objs.depFiles.Strings(),
+		Deps:         candidates,
+		DepReexports: depReexports,
+	}
+	implicits := append(android.Paths(nil), objs.depFiles...)
+
+	// Only linked modules write a link trace and have dynamic symbols to check the shared and
+	// static libraries against.
+	library, isLibrary := c.linker.(libraryInterface)
+	linked := c.Binary() || isLibrary && library.shared()
+	if linked && c.outputFile.Valid() && !ctx.Darwin() && !ctx.Windows() {
+		linkTrace := unusedDepsLinkTraceFile(ctx)
+		input.LinkTrace = linkTrace.String()
+		input.Output = c.outputFile.String()
+		implicits = append(implicits, linkTrace, c.outputFile.Path())
+		for _, dep := range candidates {
+			if dep.linkPath != nil {
+				implicits = append(implicits, dep.linkPath)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(input, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal unused deps input: %s", err)
+		return
+	}
+	inputFile := android.PathForModuleOut(ctx, "unused_deps", "input.json")
+	android.WriteFileRule(ctx, inputFile, string(data))
+
+	reportFile := android.PathForModuleOut(ctx, "unused_deps", "report.json")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        unusedDeps,
+		Description: "unused deps " + ctx.ModuleName(),
+		Output:      reportFile,
+		Input:       inputFile,
+		Implicits:   implicits,
+	})
+	android.SetProvider(ctx, unusedDepsReportProvider, android.Path(reportFile))
+}
+
+func unusedDepsReportSingletonFactory() android.Singleton {
+	return &unusedDepsReportSingleton{}
+}
+
+type unusedDepsReportSingleton struct{}
+
+func (u *unusedDepsReportSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !unusedDepsReportEnabled(ctx.Config()) {
+		return
+	}
+
+	var reports android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if report, ok := android.SingletonModuleProvider(ctx, module, unusedDepsReportProvider); ok {
+			reports = append(reports, report)
+		}
+	})
+
+	reportFile := android.PathForOutput(ctx, "unused_deps.json")
+	editsFile := android.PathForOutput(ctx, "unused_deps_edits.json")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           unusedDepsMerge,
+		Description:    "unused deps report",
+		Output:         reportFile,
+		ImplicitOutput: editsFile,
+		Inputs:         reports,
+		Args: map[string]string{
+			"edits": editsFile.String(),
+		},
+	})
+	ctx.Phony("unused_deps_report", reportFile, editsFile)
+}
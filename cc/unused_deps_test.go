@@ -0,0 +1,151 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestUnusedDepsReport(t *testing.T) {
+	t.Parallel()
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureMergeEnv(map[string]string{
+			envVariableUnusedDepsReport: "true",
+		}),
+	).RunTestWithBp(t, `
+		cc_library_headers {
+			name: "libfoo_headers",
+			export_include_dirs: ["include"],
+		}
+
+		cc_library_static {
+			name: "libbar",
+			srcs: ["bar.cpp"],
+		}
+
+		cc_library_shared {
+			name: "libbaz",
+			srcs: ["baz.cpp"],
+		}
+
+		cc_library_headers {
+			name: "libqux_headers",
+			export_include_dirs: ["include"],
+		}
+
+		cc_binary {
+			name: "foo",
+			srcs: ["foo.cpp"],
+			header_libs: ["libfoo_headers"],
+			static_libs: ["libbar"],
+			shared_libs: ["libbaz"],
+		}
+
+		cc_library_shared {
+			name: "libqux",
+			srcs: ["qux.cpp"],
+			header_libs: ["libqux_headers"],
+			export_header_lib_headers: ["libqux_headers"],
+			shared_libs: ["libbaz"],
+			export_shared_lib_headers: ["libbaz"],
+		}
+
+		cc_binary {
+			name: "qux",
+			srcs: ["qux.cpp"],
+			shared_libs: ["libqux"],
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_arm64_armv8-a")
+
+	obj := foo.Output("obj/foo.o")
+	depFile := foo.Output("obj/foo.deps")
+	android.AssertStringDoesContain(t, "cc postCmd", obj.Args["postCmd"], "cp ${out}.d "+depFile.Output.String())
+
+	linkTrace := foo.Output("unused_deps/link_trace.txt")
+	android.AssertStringDoesContain(t, "ld flags", linkTrace.Args["ldFlags"],
+		"-Wl,--trace > "+linkTrace.Output.String())
+
+	var input unusedDepsInput
+	content := android.ContentFromFileRuleForTests(t, result.TestContext, foo.Output("unused_deps/input.json"))
+	if err := json.Unmarshal([]byte(content), &input); err != nil {
+		t.Fatal(err)
+	}
+	android.AssertStringEquals(t, "module", "foo", input.Module)
+	android.AssertStringEquals(t, "file", "Android.bp", input.File)
+	android.AssertArrayString(t, "dep files", []string{depFile.Output.String()}, input.DepFiles)
+	android.AssertStringEquals(t, "link trace", linkTrace.Output.String(), input.LinkTrace)
+
+	var properties []string
+	for _, dep := range input.Deps {
+		properties = append(properties, dep.Property+":"+dep.Name)
+	}
+	android.AssertArrayString(t, "deps", []string{
+		"header_libs:libfoo_headers",
+		"shared_libs:libbaz",
+		"static_libs:libbar",
+	}, android.SortedUniqueStrings(properties))
+
+	report := foo.Output("unused_deps/report.json")
+	android.AssertStringListContains(t, "report implicits", report.Implicits.Strings(), linkTrace.Output.String())
+
+	merged := result.SingletonForTests("unused_deps_report").Output("unused_deps.json")
+	android.AssertStringListContains(t, "merged inputs", merged.Inputs.Strings(), report.Output.String())
+
+	// The dependencies whose headers are reexported are marked, so that the report also checks their
+	// export_*_lib_headers entries.
+	qux := result.ModuleForTests("libqux", "android_arm64_armv8-a_shared")
+	var quxInput unusedDepsInput
+	content = android.ContentFromFileRuleForTests(t, result.TestContext, qux.Output("unused_deps/input.json"))
+	if err := json.Unmarshal([]byte(content), &quxInput); err != nil {
+		t.Fatal(err)
+	}
+	var reexported []string
+	properties = nil
+	for _, dep := range quxInput.Deps {
+		properties = append(properties, dep.Property+":"+dep.Name)
+		if dep.Reexported {
+			reexported = append(reexported, dep.Name)
+		}
+	}
+	android.AssertArrayString(t, "libqux deps", []string{
+		"header_libs:libqux_headers",
+		"shared_libs:libbaz",
+	}, android.SortedUniqueStrings(properties))
+	android.AssertArrayString(t, "libqux reexported deps", []string{"libbaz", "libqux_headers"},
+		android.SortedUniqueStrings(reexported))
+
+	// The reverse dependencies of libqux are given the headers it reexports, to record whether they
+	// include them.
+	quxBin := result.ModuleForTests("qux", "android_arm64_armv8-a")
+	var quxBinInput unusedDepsInput
+	content = android.ContentFromFileRuleForTests(t, result.TestContext, quxBin.Output("unused_deps/input.json"))
+	if err := json.Unmarshal([]byte(content), &quxBinInput); err != nil {
+		t.Fatal(err)
+	}
+	var depReexports []string
+	for _, r := range quxBinInput.DepReexports {
+		android.AssertStringEquals(t, "reexporting module", "libqux", r.Module)
+		android.AssertStringEquals(t, "reexporting module file", "Android.bp", r.File)
+		depReexports = append(depReexports, r.Name)
+	}
+	android.AssertArrayString(t, "qux dep reexports", []string{"libbaz", "libqux_headers"},
+		android.SortedUniqueStrings(depReexports))
+}
@@ -81,6 +81,8 @@ func flagsToBuilderFlags(in Flags) builderFlags {
 
 		yacc: in.Yacc,
 		lex:  in.Lex,
+
+		pch: in.Pch,
 	}
 }
 
@@ -0,0 +1,321 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// aconfig_flag_index combines the aconfig flag declarations, the flag values of
+// every release config and the modules that read the flags through codegen
+// libraries into an index of flag -> consuming modules -> installed containers,
+// and reports the flags that are enabled and read-only in every release config
+// as candidates for cleanup.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// manifest is written by the aconfig_flag_index singleton.
+type manifest struct {
+	Declarations   []declarations  `json:"declarations"`
+	ReleaseConfigs []releaseConfig `json:"release_configs"`
+	Libraries      []library       `json:"libraries"`
+}
+
+// declarations is an aconfig_declarations module.
+type declarations struct {
+	Module    string `json:"module"`
+	Package   string `json:"package"`
+	Container string `json:"container"`
+
+	// Flags is the dump of the flags with the values of the current release
+	// config.
+	Flags string `json:"flags"`
+
+	// Defaults is the dump of the flags with their declared default values.
+	Defaults string `json:"defaults"`
+}
+
+// releaseConfig is a release config and the aconfig_value_sets in its
+// RELEASE_ACONFIG_VALUE_SETS.
+type releaseConfig struct {
+	Name      string   `json:"name"`
+	ValueSets []string `json:"value_sets"`
+
+	// Flags lists the dumps of the flags of each package that the value sets
+	// have values for, with the values of the value sets applied in order.
+	// The flags of the other packages have their default values.
+	Flags []string `json:"flags"`
+}
+
+// library is a codegen library, e.g. a java_aconfig_library.
+type library struct {
+	Name         string     `json:"name"`
+	Mode         string     `json:"mode,omitempty"`
+	Declarations []string   `json:"declarations"`
+	Consumers    []consumer `json:"consumers,omitempty"`
+}
+
+// consumer is a module that depends on a codegen library.
+type consumer struct {
+	Module     string   `json:"module"`
+	Containers []string `json:"containers,omitempty"`
+}
+
+// flagState is the state of a flag in a dump written with the
+// "{fully_qualified_name} {state:bool} {permission}" format.
+type flagState struct {
+	enabled  bool
+	readOnly bool
+}
+
+func (s flagState) String() string {
+	state := "disabled"
+	if s.enabled {
+		state = "enabled"
+	}
+	if s.readOnly {
+		return state + " read-only"
+	}
+	return state + " read-write"
+}
+
+// reader is a module that reads a flag through a codegen library.
+type reader struct {
+	Library    string   `json:"library"`
+	Mode       string   `json:"mode,omitempty"`
+	Module     string   `json:"module"`
+	Containers []string `json:"containers,omitempty"`
+}
+
+// indexEntry is the entry of a flag in the index.
+type indexEntry struct {
+	Flag         string   `json:"flag"`
+	Package      string   `json:"package"`
+	Declarations string   `json:"declarations"`
+	Container    string   `json:"container"`
+	Enabled      bool     `json:"enabled"`
+	ReadOnly     bool     `json:"read_only"`
+	Readers      []reader `json:"readers,omitempty"`
+
+	// ReleaseConfigs lists the release configs the flag is enabled and
+	// read-only in.
+	ReleaseConfigs []string `json:"release_configs,omitempty"`
+
+	// Dead is true if the flag is enabled and read-only in the current
+	// release config and in every other release config.
+	Dead bool `json:"dead,omitempty"`
+}
+
+func readFlagStates(r io.Reader) (map[string]flagState, error) {
+	ret := make(map[string]flagState)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line %q, expected <flag> <state> <permission>", scanner.Text())
+		}
+		ret[fields[0]] = flagState{
+			enabled:  fields[1] == "true",
+			readOnly: strings.EqualFold(fields[2], "READ_ONLY"),
+		}
+	}
+	return ret, scanner.Err()
+}
+
+func readFlagStatesFile(file string) (map[string]flagState, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret, err := readFlagStates(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return ret, nil
+}
+
+// buildIndex returns the index entries of the flags, sorted by name. current
+// and defaults map the name of each aconfig_declarations module to the flags
+// it declares with their state in the current release config and their
+// default state. releaseConfigs maps the name of each release config to the
+// states of the flags of the packages its value sets have values for; the
+// other flags have their default state.
+func buildIndex(m *manifest, current, defaults map[string]map[string]flagState, releaseConfigs map[string]map[string]flagState) []*indexEntry {
+	readers := make(map[string][]reader)
+	for _, l := range m.Libraries {
+		for _, d := range l.Declarations {
+			for _, c := range l.Consumers {
+				readers[d] = append(readers[d], reader{
+					Library:    l.Name,
+					Mode:       l.Mode,
+					Module:     c.Module,
+					Containers: c.Containers,
+				})
+			}
+		}
+	}
+
+	var ret []*indexEntry
+	for _, d := range m.Declarations {
+		for name, state := range current[d.Module] {
+			e := &indexEntry{
+				Flag:         name,
+				Package:      d.Package,
+				Declarations: d.Module,
+				Container:    d.Container,
+				Enabled:      state.enabled,
+				ReadOnly:     state.readOnly,
+				Readers:      readers[d.Module],
+			}
+			dead := state.enabled && state.readOnly
+			for _, rc := range sortedKeys(releaseConfigs) {
+				rcState, ok := releaseConfigs[rc][name]
+				if !ok {
+					rcState = defaults[d.Module][name]
+				}
+				if rcState.enabled && rcState.readOnly {
+					e.ReleaseConfigs = append(e.ReleaseConfigs, rc)
+				} else {
+					dead = false
+				}
+			}
+			e.Dead = dead && len(releaseConfigs) > 0
+			ret = append(ret, e)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Flag < ret[j].Flag })
+	return ret
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// writeDeadFlags writes the flags that are enabled and read-only in every
+// release config, with the modules that still read them.
+func writeDeadFlags(w io.Writer, index []*indexEntry) {
+	for _, e := range index {
+		if !e.Dead {
+			continue
+		}
+		fmt.Fprintf(w, "%s (%s, declared by %s): enabled read-only in %s\n",
+			e.Flag, e.Container, e.Declarations, strings.Join(e.ReleaseConfigs, ", "))
+		if len(e.Readers) == 0 {
+			fmt.Fprintf(w, "    not read by any module\n")
+		}
+		for _, r := range e.Readers {
+			containers := "not installed"
+			if len(r.Containers) > 0 {
+				containers = strings.Join(r.Containers, ", ")
+			}
+			fmt.Fprintf(w, "    read by %s through %s (%s)\n", r.Module, r.Library, containers)
+		}
+	}
+}
+
+func run(manifestFile, indexFile, deadFlagsFile string) error {
+	buf, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return fmt.Errorf("%s: %w", manifestFile, err)
+	}
+
+	current := make(map[string]map[string]flagState)
+	defaults := make(map[string]map[string]flagState)
+	for _, d := range m.Declarations {
+		if current[d.Module], err = readFlagStatesFile(d.Flags); err != nil {
+			return err
+		}
+		if defaults[d.Module], err = readFlagStatesFile(d.Defaults); err != nil {
+			return err
+		}
+	}
+	releaseConfigs := make(map[string]map[string]flagState)
+	for _, rc := range m.ReleaseConfigs {
+		states := make(map[string]flagState)
+		for _, file := range rc.Flags {
+			s, err := readFlagStatesFile(file)
+			if err != nil {
+				return err
+			}
+			for name, state := range s {
+				states[name] = state
+			}
+		}
+		releaseConfigs[rc.Name] = states
+	}
+
+	index := buildIndex(m, current, defaults, releaseConfigs)
+
+	buf, err = json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(indexFile, append(buf, '\n'), 0666); err != nil {
+		return err
+	}
+
+	if deadFlagsFile == "" {
+		return nil
+	}
+	f, err := os.Create(deadFlagsFile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	writeDeadFlags(w, index)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+
+	manifestFile := flags.String("manifest", "", "manifest written by the aconfig_flag_index singleton")
+	indexFile := flags.String("index", "", "output JSON index of the flags")
+	deadFlagsFile := flags.String("dead_flags", "", "optional output report of the flags that are candidates for cleanup")
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 0 || *manifestFile == "" || *indexFile == "" {
+		fmt.Fprintf(os.Stderr, "usage: aconfig_flag_index --manifest <file> --index <file> [--dead_flags <file>]\n")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if err := run(*manifestFile, *indexFile, *deadFlagsFile); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
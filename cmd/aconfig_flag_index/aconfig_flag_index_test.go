@@ -0,0 +1,130 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustReadFlagStates(t *testing.T, s string) map[string]flagState {
+	t.Helper()
+	ret, err := readFlagStates(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestReadFlagStates(t *testing.T) {
+	states := mustReadFlagStates(t, "com.foo.a true READ_ONLY\ncom.foo.b false READ_WRITE\n\n")
+	expected := map[string]flagState{
+		"com.foo.a": {enabled: true, readOnly: true},
+		"com.foo.b": {enabled: false, readOnly: false},
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected %v, got %v", expected, states)
+	}
+
+	if _, err := readFlagStates(strings.NewReader("com.foo.a true\n")); err == nil {
+		t.Errorf("expected an error for a line without a permission")
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	m := &manifest{
+		Declarations: []declarations{
+			{Module: "foo_flags", Package: "com.foo", Container: "system"},
+		},
+		Libraries: []library{
+			{
+				Name:         "foo_flags_java_lib",
+				Mode:         "production",
+				Declarations: []string{"foo_flags"},
+				Consumers: []consumer{
+					{Module: "FooApp", Containers: []string{"system"}},
+					{Module: "foo-service", Containers: []string{"com.android.foo"}},
+				},
+			},
+		},
+	}
+	current := map[string]map[string]flagState{
+		"foo_flags": mustReadFlagStates(t, `
+com.foo.ramped true READ_ONLY
+com.foo.ramping true READ_ONLY
+com.foo.rw true READ_WRITE
+com.foo.launched true READ_ONLY
+com.foo.unset true READ_ONLY
+`),
+	}
+	defaults := map[string]map[string]flagState{
+		"foo_flags": mustReadFlagStates(t, `
+com.foo.ramped false READ_ONLY
+com.foo.ramping false READ_ONLY
+com.foo.rw false READ_WRITE
+com.foo.launched true READ_ONLY
+com.foo.unset false READ_ONLY
+`),
+	}
+	// The dumps of the release configs have the values of their value sets
+	// applied in order, e.g. trunk_staging layers a value set that enables
+	// com.foo.ramping over the value set of next.
+	releaseConfigs := map[string]map[string]flagState{
+		"next": mustReadFlagStates(t, `
+com.foo.ramped true READ_ONLY
+com.foo.ramping false READ_ONLY
+com.foo.rw true READ_WRITE
+com.foo.launched true READ_ONLY
+com.foo.unset true READ_ONLY
+`),
+		"trunk_staging": mustReadFlagStates(t, `
+com.foo.ramped true READ_ONLY
+com.foo.ramping true READ_ONLY
+com.foo.rw true READ_WRITE
+com.foo.launched true READ_ONLY
+com.foo.unset true READ_ONLY
+`),
+		// A release config whose value sets have no values for com.foo
+		// has the default values of its flags, so com.foo.ramped is not
+		// dead even though it is enabled in every other release config.
+		"mainline": {},
+	}
+
+	index := buildIndex(m, current, defaults, releaseConfigs)
+
+	var dead []string
+	for _, e := range index {
+		if e.Dead {
+			dead = append(dead, e.Flag)
+		}
+		if len(e.Readers) != 2 || e.Readers[1].Module != "foo-service" {
+			t.Errorf("unexpected readers of %s: %v", e.Flag, e.Readers)
+		}
+	}
+	if expected := []string{"com.foo.launched"}; !reflect.DeepEqual(dead, expected) {
+		t.Errorf("expected dead flags %v, got %v", expected, dead)
+	}
+
+	report := &strings.Builder{}
+	writeDeadFlags(report, index)
+	expected := "com.foo.launched (system, declared by foo_flags): enabled read-only in " +
+		"mainline, next, trunk_staging\n" +
+		"    read by FooApp through foo_flags_java_lib (system)\n" +
+		"    read by foo-service through foo_flags_java_lib (com.android.foo)\n"
+	if report.String() != expected {
+		t.Errorf("expected report:\n%s\ngot:\n%s", expected, report.String())
+	}
+}
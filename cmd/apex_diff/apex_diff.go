@@ -0,0 +1,391 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// apex_diff writes the content manifest of an APEX, listing each file in the
+// payload with its size, SHA-256, the module it comes from and why it was
+// included, and compares two content manifests or two .apex files, attributing
+// the size delta to modules. The files of .apex files are attributed to modules
+// through the content manifests that Soong writes alongside them.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// manifest is the content manifest of an APEX, written by `apex_diff manifest`.
+type manifest struct {
+	Apex  string `json:"apex"`
+	Files []file `json:"files"`
+}
+
+type file struct {
+	// Path is the path of the file relative to the root of the APEX payload.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256,omitempty"`
+
+	// Symlink is the target of the file if it is a symlink.
+	Symlink string `json:"symlink,omitempty"`
+
+	// Module is the module that the file comes from, and Reason is why it was
+	// included: "direct", "transitive" or "required_by_jni_lib", or "generated"
+	// for the files that the APEX build adds, like apex_manifest.pb.
+	Module string `json:"module,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// content is an entry of the contents file written by Soong, which maps the
+// files in the APEX to the modules they come from.
+type content struct {
+	Path   string `json:"path"`
+	Module string `json:"module"`
+	Reason string `json:"reason"`
+}
+
+// contents returns the modules of the files in the content manifest.
+func (m *manifest) contents() []content {
+	var ret []content
+	for _, f := range m.Files {
+		if f.Module != "" && f.Reason != "generated" {
+			ret = append(ret, content{Path: f.Path, Module: f.Module, Reason: f.Reason})
+		}
+	}
+	return ret
+}
+
+func (m *manifest) size() int64 {
+	var ret int64
+	for _, f := range m.Files {
+		ret += f.Size
+	}
+	return ret
+}
+
+// readImageDir lists the files in the unpacked payload of an APEX. The files
+// that are in contents are attributed to their modules, and the others to the
+// APEX itself.
+func readImageDir(apex, dir string, contents []content) (*manifest, error) {
+	modules := make(map[string]content)
+	for _, c := range contents {
+		modules[c.Path] = c
+	}
+
+	m := &manifest{Apex: apex}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f := file{Path: filepath.ToSlash(rel)}
+		if c, ok := modules[f.Path]; ok {
+			f.Module = c.Module
+			f.Reason = c.Reason
+		} else if apex != "" {
+			f.Module = apex
+			f.Reason = "generated"
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			if f.Symlink, err = os.Readlink(path); err != nil {
+				return err
+			}
+		} else if f.Size, f.Sha256, err = hashFile(path); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m, nil
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// deapexer extracts the payload of .apex files.
+type deapexer struct {
+	deapexer  string
+	debugfs   string
+	fsckerofs string
+}
+
+// readApex extracts the payload of an .apex or .capex file and lists its files. The files
+// are attributed to modules through the content manifest of the APEX.
+func (d *deapexer) readApex(apexFile string, contentManifest *manifest) (*manifest, error) {
+	dir, err := os.MkdirTemp("", "apex_diff")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	extractDir := filepath.Join(dir, "payload")
+	cmd := exec.Command(d.deapexer, "--debugfs_path", d.debugfs, "--fsckerofs_path", d.fsckerofs,
+		"extract", apexFile, extractDir)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %w", apexFile, err)
+	}
+	return readImageDir(contentManifest.Apex, extractDir, contentManifest.contents())
+}
+
+func readManifest(file string) (*manifest, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return m, nil
+}
+
+// fileDiff is a file that was added, removed or changed.
+type fileDiff struct {
+	path    string
+	oldSize int64
+	newSize int64
+	old     *file
+	new     *file
+}
+
+func (f fileDiff) delta() int64 {
+	return f.newSize - f.oldSize
+}
+
+func (f fileDiff) status() string {
+	switch {
+	case f.old == nil:
+		return "added"
+	case f.new == nil:
+		return "removed"
+	}
+	return "changed"
+}
+
+// moduleDiff is the size delta of the files of a module.
+type moduleDiff struct {
+	module  string
+	oldSize int64
+	newSize int64
+	files   []fileDiff
+}
+
+func (m moduleDiff) delta() int64 {
+	return m.newSize - m.oldSize
+}
+
+// diffManifests returns the modules whose files were added, removed or
+// changed, sorted by decreasing size delta. Files that are not attributed to a
+// module are attributed to their path.
+func diffManifests(oldManifest, newManifest *manifest) []moduleDiff {
+	oldFiles := make(map[string]*file)
+	for i := range oldManifest.Files {
+		oldFiles[oldManifest.Files[i].Path] = &oldManifest.Files[i]
+	}
+	newFiles := make(map[string]*file)
+	for i := range newManifest.Files {
+		newFiles[newManifest.Files[i].Path] = &newManifest.Files[i]
+	}
+
+	modules := make(map[string]*moduleDiff)
+	add := func(f fileDiff) {
+		// Attribute the file to its module in the new APEX, if any.
+		module := f.path
+		if f.new != nil && f.new.Module != "" {
+			module = f.new.Module
+		} else if f.old != nil && f.old.Module != "" {
+			module = f.old.Module
+		}
+		if modules[module] == nil {
+			modules[module] = &moduleDiff{module: module}
+		}
+		modules[module].oldSize += f.oldSize
+		modules[module].newSize += f.newSize
+		modules[module].files = append(modules[module].files, f)
+	}
+	for _, f := range newManifest.Files {
+		old := oldFiles[f.Path]
+		if old == nil {
+			add(fileDiff{path: f.Path, newSize: f.Size, new: newFiles[f.Path]})
+		} else if old.Size != f.Size || old.Sha256 != f.Sha256 || old.Symlink != f.Symlink {
+			add(fileDiff{path: f.Path, oldSize: old.Size, newSize: f.Size, old: old, new: newFiles[f.Path]})
+		}
+	}
+	for _, f := range oldManifest.Files {
+		if newFiles[f.Path] == nil {
+			add(fileDiff{path: f.Path, oldSize: f.Size, old: oldFiles[f.Path]})
+		}
+	}
+
+	var ret []moduleDiff
+	for _, m := range modules {
+		sort.Slice(m.files, func(i, j int) bool { return m.files[i].path < m.files[j].path })
+		ret = append(ret, *m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].delta() != ret[j].delta() {
+			return ret[i].delta() > ret[j].delta()
+		}
+		return ret[i].module < ret[j].module
+	})
+	return ret
+}
+
+func writeReport(w io.Writer, oldManifest, newManifest *manifest, diffs []moduleDiff) {
+	oldSize, newSize := oldManifest.size(), newManifest.size()
+	fmt.Fprintf(w, "%s: %d -> %d bytes (%+d)\n", newManifest.Apex, oldSize, newSize, newSize-oldSize)
+	if len(diffs) == 0 {
+		fmt.Fprintf(w, "no changes\n")
+		return
+	}
+	for _, m := range diffs {
+		fmt.Fprintf(w, "\n%+d %s\n", m.delta(), m.module)
+		for _, f := range m.files {
+			reason := ""
+			if f.new != nil && f.new.Reason != "" {
+				reason = ", " + f.new.Reason
+			}
+			fmt.Fprintf(w, "    %s %s: %d -> %d bytes (%+d%s)\n", f.status(), f.path, f.oldSize, f.newSize, f.delta(), reason)
+		}
+	}
+}
+
+func manifestCommand(args []string) error {
+	flags := flag.NewFlagSet("manifest", flag.ExitOnError)
+	apex := flags.String("apex", "", "name of the APEX")
+	imageDir := flags.String("image_dir", "", "directory with the contents of the APEX payload")
+	contentsFile := flags.String("contents", "", "JSON list of the files in the APEX with their modules")
+	out := flags.String("o", "", "output content manifest")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 || *apex == "" || *imageDir == "" || *out == "" {
+		return fmt.Errorf("usage: apex_diff manifest --apex <name> --image_dir <dir> [--contents <file>] -o <file>")
+	}
+
+	var contents []content
+	if *contentsFile != "" {
+		buf, err := os.ReadFile(*contentsFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(buf, &contents); err != nil {
+			return fmt.Errorf("%s: %w", *contentsFile, err)
+		}
+	}
+	m, err := readImageDir(*apex, *imageDir, contents)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, append(buf, '\n'), 0666)
+}
+
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	d := &deapexer{}
+	flags.StringVar(&d.deapexer, "deapexer", "deapexer", "path to deapexer, to compare .apex files")
+	flags.StringVar(&d.debugfs, "debugfs", "debugfs_static", "path to debugfs, to compare .apex files")
+	flags.StringVar(&d.fsckerofs, "fsckerofs", "fsck.erofs", "path to fsck.erofs, to compare .apex files")
+	oldContents := flags.String("old_contents", "", "content manifest of the old .apex file")
+	newContents := flags.String("new_contents", "", "content manifest of the new .apex file")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: apex_diff diff [--old_contents <file>] [--new_contents <file>] " +
+			"<old content manifest or .apex> <new content manifest or .apex>")
+	}
+
+	var manifests []*manifest
+	for i, contentsFile := range []string{*oldContents, *newContents} {
+		arg := flags.Arg(i)
+		var m *manifest
+		var err error
+		switch filepath.Ext(arg) {
+		case ".apex", ".capex":
+			// The files extracted from an .apex file are attributed to
+			// modules through its content manifest.
+			if contentsFile == "" {
+				return fmt.Errorf("%s: comparing .apex files requires their content manifests, "+
+					"pass --old_contents and --new_contents", arg)
+			}
+			var contentManifest *manifest
+			if contentManifest, err = readManifest(contentsFile); err != nil {
+				return err
+			}
+			m, err = d.readApex(arg, contentManifest)
+		default:
+			m, err = readManifest(arg)
+		}
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, m)
+	}
+
+	writeReport(os.Stdout, manifests[0], manifests[1], diffManifests(manifests[0], manifests[1]))
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: apex_diff manifest|diff [flags]\n")
+		os.Exit(1)
+	}
+	var err error
+	switch os.Args[1] {
+	case "manifest":
+		err = manifestCommand(os.Args[2:])
+	case "diff":
+		err = diffCommand(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
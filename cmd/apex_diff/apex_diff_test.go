@@ -0,0 +1,151 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadImageDir(t *testing.T) {
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"apex_manifest.pb": "manifest",
+		"lib64/libfoo.so":  "foo",
+		"lib64/libbar.so":  "barbar",
+		"bin/foo_commands": "",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/system/lib64/libc++.so", filepath.Join(dir, "lib64/libc++.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := readImageDir("com.android.foo", dir, []content{
+		{Path: "lib64/libfoo.so", Module: "libfoo", Reason: "direct"},
+		{Path: "lib64/libbar.so", Module: "libbar", Reason: "required_by_jni_lib"},
+		{Path: "lib64/libc++.so", Module: "libc++", Reason: "transitive"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []file{
+		{Path: "apex_manifest.pb", Size: 8, Sha256: "05b3abf2579a5eb66403cd78be557fd860633a1fe2103c7642030defe32c657f", Module: "com.android.foo", Reason: "generated"},
+		{Path: "bin/foo_commands", Size: 0, Sha256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Module: "com.android.foo", Reason: "generated"},
+		{Path: "lib64/libbar.so", Size: 6, Sha256: "08a2d3c63bf9fc88276d97a9e8df5f841fd772724ad10f119f7e516f228b74c6", Module: "libbar", Reason: "required_by_jni_lib"},
+		{Path: "lib64/libc++.so", Symlink: "/system/lib64/libc++.so", Module: "libc++", Reason: "transitive"},
+		{Path: "lib64/libfoo.so", Size: 3, Sha256: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", Module: "libfoo", Reason: "direct"},
+	}
+	if !reflect.DeepEqual(m.Files, expected) {
+		t.Errorf("expected files:\n%+v\ngot:\n%+v", expected, m.Files)
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	oldManifest := &manifest{
+		Apex: "com.android.foo",
+		Files: []file{
+			{Path: "apex_manifest.pb", Size: 100, Sha256: "a", Module: "com.android.foo", Reason: "generated"},
+			{Path: "lib64/libfoo.so", Size: 1000, Sha256: "b", Module: "libfoo", Reason: "direct"},
+			{Path: "lib64/libold.so", Size: 300, Sha256: "c", Module: "libold", Reason: "transitive"},
+			{Path: "lib64/libsame.so", Size: 50, Sha256: "d", Module: "libsame", Reason: "transitive"},
+		},
+	}
+	newManifest := &manifest{
+		Apex: "com.android.foo",
+		Files: []file{
+			{Path: "apex_manifest.pb", Size: 100, Sha256: "a", Module: "com.android.foo", Reason: "generated"},
+			{Path: "lib/libfoo.so", Size: 800, Sha256: "e", Module: "libfoo", Reason: "direct"},
+			{Path: "lib64/libfoo.so", Size: 1200, Sha256: "f", Module: "libfoo", Reason: "direct"},
+			{Path: "lib64/libnew.so", Size: 400, Sha256: "g", Module: "libnew", Reason: "required_by_jni_lib"},
+			{Path: "lib64/libsame.so", Size: 50, Sha256: "d", Module: "libsame", Reason: "transitive"},
+		},
+	}
+
+	diffs := diffManifests(oldManifest, newManifest)
+	var modules []string
+	var deltas []int64
+	for _, d := range diffs {
+		modules = append(modules, d.module)
+		deltas = append(deltas, d.delta())
+	}
+	if expected := []string{"libfoo", "libnew", "libold"}; !reflect.DeepEqual(modules, expected) {
+		t.Errorf("expected modules %v, got %v", expected, modules)
+	}
+	if expected := []int64{1000, 400, -300}; !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("expected deltas %v, got %v", expected, deltas)
+	}
+
+	report := &strings.Builder{}
+	writeReport(report, oldManifest, newManifest, diffs)
+	expected := `com.android.foo: 1450 -> 2550 bytes (+1100)
+
++1000 libfoo
+    added lib/libfoo.so: 0 -> 800 bytes (+800, direct)
+    changed lib64/libfoo.so: 1000 -> 1200 bytes (+200, direct)
+
++400 libnew
+    added lib64/libnew.so: 0 -> 400 bytes (+400, required_by_jni_lib)
+
+-300 libold
+    removed lib64/libold.so: 300 -> 0 bytes (-300)
+`
+	if report.String() != expected {
+		t.Errorf("expected report:\n%s\ngot:\n%s", expected, report.String())
+	}
+}
+
+func TestDiffManifestsWithoutModules(t *testing.T) {
+	// Files without modules are attributed to their path.
+	oldManifest := &manifest{Files: []file{{Path: "lib64/libfoo.so", Size: 10, Sha256: "a"}}}
+	newManifest := &manifest{Files: []file{{Path: "lib64/libfoo.so", Size: 10, Sha256: "b"}}}
+	diffs := diffManifests(oldManifest, newManifest)
+	if len(diffs) != 1 || diffs[0].module != "lib64/libfoo.so" || diffs[0].delta() != 0 {
+		t.Errorf("unexpected diff %+v", diffs)
+	}
+}
+
+func TestManifestContents(t *testing.T) {
+	m := &manifest{
+		Apex: "com.android.foo",
+		Files: []file{
+			{Path: "apex_manifest.pb", Size: 100, Sha256: "a", Module: "com.android.foo", Reason: "generated"},
+			{Path: "lib64/libfoo.so", Size: 1000, Sha256: "b", Module: "libfoo", Reason: "direct"},
+			{Path: "lib64/libbar.so", Size: 300, Sha256: "c", Module: "libbar", Reason: "transitive"},
+		},
+	}
+	expected := []content{
+		{Path: "lib64/libfoo.so", Module: "libfoo", Reason: "direct"},
+		{Path: "lib64/libbar.so", Module: "libbar", Reason: "transitive"},
+	}
+	if contents := m.contents(); !reflect.DeepEqual(contents, expected) {
+		t.Errorf("expected contents %+v, got %+v", expected, contents)
+	}
+}
+
+func TestDiffApexWithoutContents(t *testing.T) {
+	err := diffCommand([]string{"old.apex", "new.apex"})
+	if err == nil || !strings.Contains(err.Error(), "old.apex: comparing .apex files requires their content manifests") {
+		t.Errorf("expected an error about the missing content manifests, got %v", err)
+	}
+}
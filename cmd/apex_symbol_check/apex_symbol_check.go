@@ -0,0 +1,267 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// apex_symbol_check verifies that the ELF files in the payload of an APEX only
+// reference the symbols of the stub libraries outside of the APEX that are
+// available at the min_sdk_version of the APEX.
+package main
+
+import (
+	"bufio"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type multiString []string
+
+func (ms *multiString) String() string     { return strings.Join(*ms, ", ") }
+func (ms *multiString) Set(s string) error { *ms = append(*ms, s); return nil }
+
+// payloadElf is an ELF file in the payload of the APEX.
+type payloadElf struct {
+	// path is the path of the file in the APEX.
+	path string
+
+	// needed lists the DT_NEEDED entries of the file.
+	needed []string
+
+	// undefined lists the undefined dynamic symbols of the file that must be
+	// resolved at load time, i.e. that are not weak.
+	undefined []string
+
+	// defined is the set of dynamic symbols defined by the file.
+	defined map[string]bool
+}
+
+// stubLibrary is a library outside of the APEX that the payload links
+// against through its stubs.
+type stubLibrary struct {
+	name string
+
+	// available is the set of symbols exported by the stubs at the
+	// min_sdk_version of the APEX.
+	available map[string]bool
+
+	// latest is the set of symbols exported by the latest stubs, which the
+	// payload is linked against.
+	latest map[string]bool
+}
+
+// violation is a symbol referenced by a payload ELF file that is only exported
+// by stubs newer than the min_sdk_version of the APEX.
+type violation struct {
+	path    string
+	symbol  string
+	library string
+}
+
+func (v violation) String() string {
+	return fmt.Sprintf("%s: %s from %s", v.path, v.symbol, v.library)
+}
+
+// check returns the undefined symbols of the payload ELF files that resolve to
+// a stub library in which they are not available yet, sorted by path and
+// symbol. Symbols that aren't exported by any needed stub library are expected
+// to come from the APEX itself or from libraries without stubs, and are not
+// checked.
+func check(elfs []*payloadElf, stubs []*stubLibrary) []violation {
+	stubsByName := make(map[string]*stubLibrary)
+	for _, s := range stubs {
+		stubsByName[s.name] = s
+	}
+	elfsByName := make(map[string]*payloadElf)
+	for _, e := range elfs {
+		elfsByName[filepath.Base(e.path)] = e
+	}
+
+	var ret []violation
+	for _, e := range elfs {
+	symbols:
+		for _, symbol := range e.undefined {
+			var from *stubLibrary
+			for _, needed := range e.needed {
+				if dep, ok := elfsByName[needed]; ok && dep.defined[symbol] {
+					continue symbols
+				}
+				s, ok := stubsByName[needed]
+				if !ok {
+					continue
+				}
+				if s.available[symbol] {
+					continue symbols
+				}
+				if from == nil && s.latest[symbol] {
+					from = s
+				}
+			}
+			if from != nil {
+				ret = append(ret, violation{path: e.path, symbol: symbol, library: from.name})
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].path != ret[j].path {
+			return ret[i].path < ret[j].path
+		}
+		return ret[i].symbol < ret[j].symbol
+	})
+	return ret
+}
+
+// readElf reads the dynamic section and symbols of the ELF file that is
+// installed at path in the APEX.
+func readElf(path, file string) (*payloadElf, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	symbols, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	ret := &payloadElf{path: path, needed: needed, defined: make(map[string]bool)}
+	for _, symbol := range symbols {
+		if symbol.Name == "" {
+			continue
+		}
+		if symbol.Section != elf.SHN_UNDEF {
+			ret.defined[symbol.Name] = true
+		} else if elf.ST_BIND(symbol.Info) != elf.STB_WEAK {
+			// Weak references are allowed to be missing, which is how code
+			// guarded by availability checks references newer symbols.
+			ret.undefined = append(ret.undefined, symbol.Name)
+		}
+	}
+	return ret, nil
+}
+
+// readSymbolList reads a symbol list written by ndkstubgen, which has one
+// symbol per line after an "[abi_symbol_list]" header.
+func readSymbolList(r io.Reader) (map[string]bool, error) {
+	ret := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "[") {
+			continue
+		}
+		ret[line] = true
+	}
+	return ret, scanner.Err()
+}
+
+func readSymbolListFile(file string) (map[string]bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret, err := readSymbolList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return ret, nil
+}
+
+// parseStubs parses a --stubs argument of the form
+// <library>:<available symbol list>:<latest symbol list>.
+func parseStubs(arg string) (*stubLibrary, error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid --stubs argument %q, expected <library>:<available>:<latest>", arg)
+	}
+	available, err := readSymbolListFile(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	latest, err := readSymbolListFile(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	return &stubLibrary{name: parts[0], available: available, latest: latest}, nil
+}
+
+func run(w io.Writer, apexName, minSdkVersion string, elfArgs, stubsArgs []string) (bool, error) {
+	var elfs []*payloadElf
+	for _, arg := range elfArgs {
+		path, file, ok := strings.Cut(arg, "=")
+		if !ok {
+			return false, fmt.Errorf("invalid --elf argument %q, expected <path in apex>=<file>", arg)
+		}
+		e, err := readElf(path, file)
+		if err != nil {
+			return false, err
+		}
+		elfs = append(elfs, e)
+	}
+	var stubs []*stubLibrary
+	for _, arg := range stubsArgs {
+		s, err := parseStubs(arg)
+		if err != nil {
+			return false, err
+		}
+		stubs = append(stubs, s)
+	}
+
+	violations := check(elfs, stubs)
+	if len(violations) > 0 {
+		fmt.Fprintf(w, "%s: %d symbol(s) referenced by the payload are not available at min_sdk_version %s:\n",
+			apexName, len(violations), minSdkVersion)
+		for _, v := range violations {
+			fmt.Fprintf(w, "    %s\n", v.String())
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+
+	apexName := flags.String("apex", "", "name of the apex, for error messages")
+	minSdkVersion := flags.String("min_sdk_version", "", "min_sdk_version of the apex, for error messages")
+	var elfArgs, stubsArgs multiString
+	flags.Var(&elfArgs, "elf", "<path in apex>=<file> of an ELF file in the payload")
+	flags.Var(&stubsArgs, "stubs", "<library>:<available symbol list>:<latest symbol list> of a library outside of the apex")
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 0 || *apexName == "" || *minSdkVersion == "" {
+		fmt.Fprintf(os.Stderr, "usage: apex_symbol_check --apex <name> --min_sdk_version <level> [--elf <path>=<file>]... [--stubs <library>:<available>:<latest>]...\n")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	ok, err := run(os.Stderr, *apexName, *minSdkVersion, elfArgs, stubsArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
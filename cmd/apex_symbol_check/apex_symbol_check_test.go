@@ -0,0 +1,81 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func symbolSet(symbols ...string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, s := range symbols {
+		ret[s] = true
+	}
+	return ret
+}
+
+func TestCheck(t *testing.T) {
+	libc := &stubLibrary{
+		name:      "libc.so",
+		available: symbolSet("malloc", "free"),
+		latest:    symbolSet("malloc", "free", "pidfd_open", "posix_spawn"),
+	}
+	libnew := &stubLibrary{
+		name:      "libnew.so",
+		available: symbolSet("old_api"),
+		latest:    symbolSet("old_api", "new_api"),
+	}
+	elfs := []*payloadElf{
+		{
+			path:      "bin/foo",
+			needed:    []string{"libc.so", "libfoo.so"},
+			undefined: []string{"malloc", "posix_spawn", "foo_helper", "pidfd_open"},
+		},
+		{
+			path:      "lib64/libfoo.so",
+			needed:    []string{"libc.so", "libnew.so", "libbar.so"},
+			undefined: []string{"free", "new_api", "bar_helper"},
+			defined:   symbolSet("foo_helper", "pidfd_open"),
+		},
+	}
+
+	expected := []violation{
+		{path: "bin/foo", symbol: "posix_spawn", library: "libc.so"},
+		{path: "lib64/libfoo.so", symbol: "new_api", library: "libnew.so"},
+	}
+	if actual := check(elfs, []*stubLibrary{libc, libnew}); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestReadSymbolList(t *testing.T) {
+	symbols, err := readSymbolList(strings.NewReader("[abi_symbol_list]\nmalloc\nfree\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := symbolSet("malloc", "free"); !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("expected %v, got %v", expected, symbols)
+	}
+}
+
+func TestParseStubs(t *testing.T) {
+	for _, arg := range []string{"libc.so", "libc.so:a", ":a:b", "libc.so:a:", "libc.so::b"} {
+		if _, err := parseStubs(arg); err == nil {
+			t.Errorf("expected an error for %q", arg)
+		}
+	}
+}
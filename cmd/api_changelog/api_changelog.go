@@ -0,0 +1,337 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// api_changelog compares the API signature files generated by droidstubs modules against the API
+// signature files of the last finalized release and writes a changelog of the APIs that were
+// added, removed or deprecated as JSON and HTML.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	inputsFile = flag.String("inputs", "", "JSON file listing the API files to compare")
+	jsonOut    = flag.String("json", "", "output JSON changelog")
+	htmlOut    = flag.String("html", "", "output HTML changelog")
+)
+
+// input is a single API surface of a module as written by the api_changelog singleton.
+type input struct {
+	Module                  string `json:"module"`
+	Scope                   string `json:"scope"`
+	StubsType               string `json:"stubs_type"`
+	ApiFile                 string `json:"api_file"`
+	RemovedApiFile          string `json:"removed_api_file"`
+	LastReleasedApiFile     string `json:"last_released_api_file"`
+	LastReleasedRemovedFile string `json:"last_released_removed_api_file"`
+}
+
+// changes lists the APIs of a single API surface of a module that changed since the last release.
+type changes struct {
+	Module     string   `json:"module"`
+	Scope      string   `json:"scope"`
+	StubsType  string   `json:"stubs_type"`
+	Added      []string `json:"added"`
+	Removed    []string `json:"removed"`
+	Deprecated []string `json:"deprecated"`
+}
+
+func (c changes) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Deprecated) == 0
+}
+
+// api maps the signature of each API in a signature file to whether it is deprecated.
+type api map[string]bool
+
+// parseApi parses a metalava signature file. Each class is identified by its fully qualified name
+// and each member by the fully qualified name of its class followed by the member declaration,
+// ignoring annotations, the deprecated modifier and constant values.
+func parseApi(r io.Reader) (api, error) {
+	result := make(api)
+	pkg := ""
+	var classes []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Strip the comments that follow constant values, e.g. "field public static final int A = 10; // 0xa".
+		if i := strings.Index(line, "; //"); i >= 0 {
+			line = line[:i+1]
+		}
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		switch {
+		case line == "}":
+			if len(classes) > 0 {
+				classes = classes[:len(classes)-1]
+			} else {
+				pkg = ""
+			}
+		case strings.HasPrefix(line, "package ") && strings.HasSuffix(line, "{"):
+			pkg = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "package "), "{"))
+		case strings.HasSuffix(line, "{"):
+			deprecated, decl := normalize(strings.TrimSuffix(line, "{"))
+			name := className(decl)
+			if name == "" {
+				return nil, fmt.Errorf("unable to parse class declaration %q", line)
+			}
+			class := pkg + "." + name
+			classes = append(classes, class)
+			result[class] = deprecated
+		case strings.HasSuffix(line, ";"):
+			if len(classes) == 0 {
+				return nil, fmt.Errorf("member %q outside of a class", line)
+			}
+			deprecated, decl := normalize(strings.TrimSuffix(line, ";"))
+			result[classes[len(classes)-1]+" "+decl] = deprecated
+		default:
+			return nil, fmt.Errorf("unable to parse line %q", line)
+		}
+	}
+	return result, scanner.Err()
+}
+
+// annotationRegexp matches annotations, including any arguments, e.g. "@IntRange(from=0) ".
+var annotationRegexp = regexp.MustCompile(`@[\w.]+(\([^)]*\))?\s*`)
+
+// normalize strips annotations, the deprecated modifier and constant values from a declaration,
+// and reports whether the declaration was deprecated.
+func normalize(decl string) (bool, string) {
+	if i := strings.Index(decl, " = "); i >= 0 {
+		decl = decl[:i]
+	}
+	deprecated := false
+	for _, field := range strings.Fields(decl) {
+		if field == "deprecated" || field == "@Deprecated" {
+			deprecated = true
+		}
+	}
+	// Protect the @interface keyword from being treated as an annotation.
+	decl = strings.ReplaceAll(decl, "@interface", "\x00interface")
+	decl = annotationRegexp.ReplaceAllString(decl, "")
+	decl = strings.ReplaceAll(decl, "\x00interface", "@interface")
+	var fields []string
+	for _, field := range strings.Fields(decl) {
+		if field != "deprecated" {
+			fields = append(fields, field)
+		}
+	}
+	return deprecated, strings.Join(fields, " ")
+}
+
+// className returns the name of the class declared by a normalized class declaration.
+func className(decl string) string {
+	fields := strings.Fields(decl)
+	for i, field := range fields {
+		switch field {
+		case "class", "interface", "@interface", "enum", "record":
+			if i+1 < len(fields) {
+				return fields[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+func readApi(file string) (api, error) {
+	if file == "" {
+		return api{}, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	result, err := parseApi(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return result, nil
+}
+
+// diff returns the APIs that were added, removed or deprecated between previous and current.
+// APIs that are newly listed in the removed API file are reported as removed.
+func diff(previous, current, previousRemoved, currentRemoved api) (added, removed, deprecated []string) {
+	for sig, isDeprecated := range current {
+		if wasDeprecated, ok := previous[sig]; !ok {
+			added = append(added, sig)
+		} else if isDeprecated && !wasDeprecated {
+			deprecated = append(deprecated, sig)
+		}
+	}
+	for sig := range previous {
+		if _, ok := current[sig]; !ok {
+			removed = append(removed, sig)
+		}
+	}
+	for sig := range currentRemoved {
+		if _, ok := previousRemoved[sig]; !ok {
+			if _, ok := previous[sig]; !ok {
+				removed = append(removed, sig)
+			}
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(deprecated)
+	return added, removed, deprecated
+}
+
+func changelog(inputs []input) ([]changes, error) {
+	var result []changes
+	for _, in := range inputs {
+		previous, err := readApi(in.LastReleasedApiFile)
+		if err != nil {
+			return nil, err
+		}
+		current, err := readApi(in.ApiFile)
+		if err != nil {
+			return nil, err
+		}
+		previousRemoved, err := readApi(in.LastReleasedRemovedFile)
+		if err != nil {
+			return nil, err
+		}
+		currentRemoved, err := readApi(in.RemovedApiFile)
+		if err != nil {
+			return nil, err
+		}
+		c := changes{
+			Module:    in.Module,
+			Scope:     in.Scope,
+			StubsType: in.StubsType,
+		}
+		c.Added, c.Removed, c.Deprecated = diff(previous, current, previousRemoved, currentRemoved)
+		if !c.empty() {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+var htmlTemplate = template.Must(template.New("changelog").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API changelog</title>
+<style>
+body { font-family: sans-serif; }
+code { display: block; }
+.added { color: #188038; }
+.removed { color: #c5221f; }
+.deprecated { color: #b06000; }
+</style>
+</head>
+<body>
+<h1>API changelog</h1>
+{{- if not .}}
+<p>No API changes since the last release.</p>
+{{- end}}
+{{- range .}}
+<h2>{{.Module}} ({{if .Scope}}{{.Scope}}, {{end}}{{.StubsType}})</h2>
+{{- if .Added}}
+<h3>Added</h3>
+{{- range .Added}}
+<code class="added">{{.}}</code>
+{{- end}}
+{{- end}}
+{{- if .Removed}}
+<h3>Removed</h3>
+{{- range .Removed}}
+<code class="removed">{{.}}</code>
+{{- end}}
+{{- end}}
+{{- if .Deprecated}}
+<h3>Deprecated</h3>
+{{- range .Deprecated}}
+<code class="deprecated">{{.}}</code>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+func writeJson(w io.Writer, c []changes) error {
+	if c == nil {
+		c = []changes{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+func writeHtml(w io.Writer, c []changes) error {
+	return htmlTemplate.Execute(w, c)
+}
+
+func writeFile(file string, c []changes, write func(io.Writer, []changes) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(f, c); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return f.Close()
+}
+
+func main() {
+	flag.Parse()
+
+	if *inputsFile == "" || *jsonOut == "" || *htmlOut == "" {
+		fmt.Fprintf(os.Stderr, "usage: %s --inputs <inputs.json> --json <out.json> --html <out.html>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error: %s\n", os.Args[0], err.Error())
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	data, err := os.ReadFile(*inputsFile)
+	if err != nil {
+		return err
+	}
+	var inputs []input
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", *inputsFile, err)
+	}
+
+	c, err := changelog(inputs)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(*jsonOut, c, writeJson); err != nil {
+		return err
+	}
+	return writeFile(*htmlOut, c, writeHtml)
+}
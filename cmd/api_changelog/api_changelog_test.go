@@ -0,0 +1,142 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const previousApi = `// Signature format: 2.0
+package android.foo {
+
+  public class Foo {
+    ctor public Foo();
+    method public void bar();
+    method @Nullable public String baz(@NonNull String);
+    field public static final int QUX = 1; // 0x1
+  }
+
+  public static interface Foo.Listener {
+    method public void onFoo();
+  }
+
+}
+
+`
+
+const currentApi = `// Signature format: 2.0
+package android.foo {
+
+  public class Foo {
+    ctor public Foo();
+    method @Deprecated public void bar();
+    method @Nullable public String baz(@NonNull String);
+    method public void quux();
+    field public static final int QUX = 2; // 0x2
+  }
+
+  @Deprecated public static interface Foo.Listener {
+  }
+
+}
+
+`
+
+const currentRemovedApi = `// Signature format: 2.0
+package android.foo {
+
+  public static interface Foo.Listener {
+    method public void onFoo();
+  }
+
+}
+
+`
+
+func mustParseApi(t *testing.T, s string) api {
+	t.Helper()
+	a, err := parseApi(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestParseApi(t *testing.T) {
+	expected := api{
+		"android.foo.Foo":                                     false,
+		"android.foo.Foo ctor public Foo()":                   false,
+		"android.foo.Foo method public void bar()":            false,
+		"android.foo.Foo method public String baz(String)":    false,
+		"android.foo.Foo field public static final int QUX":   false,
+		"android.foo.Foo.Listener":                            false,
+		"android.foo.Foo.Listener method public void onFoo()": false,
+	}
+	if got := mustParseApi(t, previousApi); !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseApi() = %v, want %v", got, expected)
+	}
+
+	if _, err := parseApi(strings.NewReader("package a {\n  method public void a();\n}\n")); err == nil {
+		t.Errorf("expected error for member outside of a class")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	added, removed, deprecated := diff(
+		mustParseApi(t, previousApi),
+		mustParseApi(t, currentApi),
+		api{},
+		mustParseApi(t, currentRemovedApi))
+
+	check := func(name string, got, expected []string) {
+		t.Helper()
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s = %q, want %q", name, got, expected)
+		}
+	}
+	check("added", added, []string{"android.foo.Foo method public void quux()"})
+	check("removed", removed, []string{"android.foo.Foo.Listener method public void onFoo()"})
+	check("deprecated", deprecated, []string{
+		"android.foo.Foo method public void bar()",
+		"android.foo.Foo.Listener",
+	})
+}
+
+func TestWriteHtml(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := writeHtml(buf, []changes{{
+		Module:    "foo",
+		Scope:     "public",
+		StubsType: "everything",
+		Added:     []string{"android.foo.Foo method public <T> void bar(T)"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<h2>foo (public, everything)</h2>",
+		`<code class="added">android.foo.Foo method public &lt;T&gt; void bar(T)</code>`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected html to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "<h3>Removed</h3>") {
+		t.Errorf("unexpected removed section in html:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Assembles an Android App Bundle (.aab) from a base module zip, i.e. a zip containing the
+// proto format resources, manifest, dex files, assets and native libraries laid out the way
+// bundletool expects them. Run it without arguments to see usage details.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	android_bundle_proto "android/soong/cmd/extract_apks/bundle_proto"
+	"android/soong/jar"
+	"android/soong/third_party/zip"
+)
+
+const (
+	bundleConfigName = "BundleConfig.pb"
+	baseModuleName   = "base"
+	nativeConfigName = "native.pb"
+)
+
+var (
+	outputFile        = flag.String("o", "", "output .aab file")
+	baseModule        = flag.String("base", "", "base module zip")
+	bundletoolVersion = flag.String("bundletool-version", "", "version of bundletool to record in the BundleConfig")
+	uncompressDex     = flag.Bool("uncompress-dex", false, "keep dex files uncompressed in the generated APKs")
+	uncompressJni     = flag.Bool("uncompress-native-libs", false, "keep native libraries uncompressed in the generated APKs")
+	uncompressedGlobs = &globList{}
+)
+
+type globList []string
+
+func (l *globList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *globList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// The ABI directory names used in APKs, mapped to their bundle ABI alias.
+var abiAliases = map[string]android_bundle_proto.Abi_AbiAlias{
+	"armeabi":     android_bundle_proto.Abi_ARMEABI,
+	"armeabi-v7a": android_bundle_proto.Abi_ARMEABI_V7A,
+	"arm64-v8a":   android_bundle_proto.Abi_ARM64_V8A,
+	"x86":         android_bundle_proto.Abi_X86,
+	"x86_64":      android_bundle_proto.Abi_X86_64,
+	"mips":        android_bundle_proto.Abi_MIPS,
+	"mips64":      android_bundle_proto.Abi_MIPS64,
+}
+
+type bundleOptions struct {
+	bundletoolVersion string
+	uncompressDex     bool
+	uncompressJni     bool
+	uncompressedGlobs []string
+}
+
+// bundleConfig returns the BundleConfig describing how bundletool should generate APKs from the
+// bundle.
+func bundleConfig(opts bundleOptions) *android_bundle_proto.BundleConfig {
+	config := &android_bundle_proto.BundleConfig{
+		Bundletool: &android_bundle_proto.Bundletool{
+			Version: opts.bundletoolVersion,
+		},
+		Optimizations: &android_bundle_proto.Optimizations{
+			UncompressNativeLibraries: &android_bundle_proto.UncompressNativeLibraries{
+				Enabled: opts.uncompressJni,
+			},
+			UncompressDexFiles: &android_bundle_proto.UncompressDexFiles{
+				Enabled: opts.uncompressDex,
+			},
+		},
+		Type: android_bundle_proto.BundleConfig_REGULAR,
+	}
+	if len(opts.uncompressedGlobs) > 0 {
+		config.Compression = &android_bundle_proto.Compression{
+			UncompressedGlob: opts.uncompressedGlobs,
+		}
+	}
+	return config
+}
+
+// nativeLibraryDirs returns the sorted list of lib/<abi> directories found in the module.
+func nativeLibraryDirs(files []*zip.File) ([]string, error) {
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) < 3 || parts[0] != "lib" {
+			continue
+		}
+		if _, ok := abiAliases[parts[1]]; !ok {
+			return nil, fmt.Errorf("unsupported ABI %q for native library %q", parts[1], f.Name)
+		}
+		dirs["lib/"+parts[1]] = true
+	}
+	var ret []string
+	for dir := range dirs {
+		ret = append(ret, dir)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// nativeConfig returns the serialized NativeLibraries proto that targets each of the lib/<abi>
+// directories at its ABI. The NativeLibraries message is not part of the bundle protos in this
+// tree, so it is encoded directly:
+//
+//	message NativeLibraries { repeated TargetedNativeDirectory directory = 1; }
+//	message TargetedNativeDirectory { string path = 1; NativeDirectoryTargeting targeting = 2; }
+func nativeConfig(dirs []string) ([]byte, error) {
+	var ret []byte
+	for _, dir := range dirs {
+		targeting, err := proto.Marshal(&android_bundle_proto.NativeDirectoryTargeting{
+			Abi: &android_bundle_proto.Abi{Alias: abiAliases[strings.TrimPrefix(dir, "lib/")]},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var directory []byte
+		directory = protowire.AppendTag(directory, 1, protowire.BytesType)
+		directory = protowire.AppendString(directory, dir)
+		directory = protowire.AppendTag(directory, 2, protowire.BytesType)
+		directory = protowire.AppendBytes(directory, targeting)
+
+		ret = protowire.AppendTag(ret, 1, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, directory)
+	}
+	return ret, nil
+}
+
+func writeEntry(w *zip.Writer, name string, data []byte) error {
+	fh := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	fh.SetModTime(jar.DefaultTime)
+	fh.SetMode(0644)
+	entry, err := w.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
+
+// buildBundle writes a bundle containing the BundleConfig and the entries of the base module,
+// moved into the base/ directory.
+func buildBundle(w *zip.Writer, base *zip.Reader, opts bundleOptions) error {
+	config, err := proto.Marshal(bundleConfig(opts))
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(w, bundleConfigName, config); err != nil {
+		return err
+	}
+
+	hasManifest := false
+	for _, f := range base.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if f.Name == "manifest/AndroidManifest.xml" {
+			hasManifest = true
+		}
+		if f.Name == nativeConfigName {
+			return fmt.Errorf("base module already contains %s", nativeConfigName)
+		}
+		if err := w.CopyFrom(f, baseModuleName+"/"+f.Name); err != nil {
+			return err
+		}
+	}
+	if !hasManifest {
+		return fmt.Errorf("base module does not contain manifest/AndroidManifest.xml")
+	}
+
+	dirs, err := nativeLibraryDirs(base.File)
+	if err != nil {
+		return err
+	}
+	if len(dirs) > 0 {
+		native, err := nativeConfig(dirs)
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(w, baseModuleName+"/"+nativeConfigName, native); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s -o <output.aab> -base <base module zip> [-bundletool-version <version>] "+
+		"[-uncompress-dex] [-uncompress-native-libs] [-uncompressed-glob <glob>]...\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Var(uncompressedGlobs, "uncompressed-glob", "glob of files to leave uncompressed in the generated APKs, may be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if *outputFile == "" || *baseModule == "" || flag.NArg() != 0 {
+		usage()
+	}
+
+	base, err := zip.OpenReader(*baseModule)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer base.Close()
+
+	out, err := os.Create(*outputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := zip.NewWriter(out)
+	err = buildBundle(w, &base.Reader, bundleOptions{
+		bundletoolVersion: *bundletoolVersion,
+		uncompressDex:     *uncompressDex,
+		uncompressJni:     *uncompressJni,
+		uncompressedGlobs: *uncompressedGlobs,
+	})
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		os.Remove(*outputFile)
+		log.Fatalf("%s: %s", *outputFile, err)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	android_bundle_proto "android/soong/cmd/extract_apks/bundle_proto"
+	"android/soong/third_party/zip"
+)
+
+func createZip(t *testing.T, names ...string) *zip.Reader {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readEntry(t *testing.T, f *zip.File) []byte {
+	t.Helper()
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodeNativeConfig decodes a NativeLibraries proto into a map of directory to ABI.
+func decodeNativeConfig(t *testing.T, b []byte) map[string]android_bundle_proto.Abi_AbiAlias {
+	t.Helper()
+	ret := make(map[string]android_bundle_proto.Abi_AbiAlias)
+	for len(b) > 0 {
+		_, _, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		directory, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatalf("malformed native.pb")
+		}
+		b = b[n:]
+
+		var path string
+		targeting := &android_bundle_proto.NativeDirectoryTargeting{}
+		for len(directory) > 0 {
+			num, _, n := protowire.ConsumeTag(directory)
+			directory = directory[n:]
+			value, n := protowire.ConsumeBytes(directory)
+			if n < 0 {
+				t.Fatalf("malformed native.pb")
+			}
+			directory = directory[n:]
+			switch num {
+			case 1:
+				path = string(value)
+			case 2:
+				if err := proto.Unmarshal(value, targeting); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		ret[path] = targeting.GetAbi().GetAlias()
+	}
+	return ret
+}
+
+func TestBuildBundle(t *testing.T) {
+	base := createZip(t,
+		"manifest/AndroidManifest.xml",
+		"resources.pb",
+		"res/layout/main.xml",
+		"assets/foo.txt",
+		"dex/classes.dex",
+		"dex/classes2.dex",
+		"root/META-INF/services/foo",
+		"lib/arm64-v8a/libfoo.so",
+		"lib/armeabi-v7a/libfoo.so",
+	)
+
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	err := buildBundle(w, base, bundleOptions{
+		bundletoolVersion: "1.15.0",
+		uncompressDex:     true,
+		uncompressedGlobs: []string{"res/raw/**"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	files := make(map[string]*zip.File)
+	for _, f := range bundle.File {
+		names = append(names, f.Name)
+		files[f.Name] = f
+	}
+	expectedNames := []string{
+		"BundleConfig.pb",
+		"base/manifest/AndroidManifest.xml",
+		"base/resources.pb",
+		"base/res/layout/main.xml",
+		"base/assets/foo.txt",
+		"base/dex/classes.dex",
+		"base/dex/classes2.dex",
+		"base/root/META-INF/services/foo",
+		"base/lib/arm64-v8a/libfoo.so",
+		"base/lib/armeabi-v7a/libfoo.so",
+		"base/native.pb",
+	}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("bundle entries:\n%q\nwant:\n%q", names, expectedNames)
+	}
+
+	if got := string(readEntry(t, files["base/dex/classes.dex"])); got != "dex/classes.dex" {
+		t.Errorf("base/dex/classes.dex contents = %q, want %q", got, "dex/classes.dex")
+	}
+
+	config := &android_bundle_proto.BundleConfig{}
+	if err := proto.Unmarshal(readEntry(t, files["BundleConfig.pb"]), config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.GetBundletool().GetVersion(); got != "1.15.0" {
+		t.Errorf("bundletool version = %q, want %q", got, "1.15.0")
+	}
+	if !config.GetOptimizations().GetUncompressDexFiles().GetEnabled() {
+		t.Errorf("expected dex files to be uncompressed")
+	}
+	if config.GetOptimizations().GetUncompressNativeLibraries().GetEnabled() {
+		t.Errorf("expected native libraries to be compressed")
+	}
+	if got := config.GetCompression().GetUncompressedGlob(); !reflect.DeepEqual(got, []string{"res/raw/**"}) {
+		t.Errorf("uncompressed globs = %q, want %q", got, []string{"res/raw/**"})
+	}
+
+	expectedNative := map[string]android_bundle_proto.Abi_AbiAlias{
+		"lib/arm64-v8a":   android_bundle_proto.Abi_ARM64_V8A,
+		"lib/armeabi-v7a": android_bundle_proto.Abi_ARMEABI_V7A,
+	}
+	if got := decodeNativeConfig(t, readEntry(t, files["base/native.pb"])); !reflect.DeepEqual(got, expectedNative) {
+		t.Errorf("native.pb = %v, want %v", got, expectedNative)
+	}
+}
+
+func TestBuildBundleErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files []string
+	}{
+		{"missing manifest", []string{"resources.pb", "dex/classes.dex"}},
+		{"unsupported abi", []string{"manifest/AndroidManifest.xml", "lib/sparc/libfoo.so"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := zip.NewWriter(&bytes.Buffer{})
+			if err := buildBundle(w, createZip(t, tc.files...), bundleOptions{}); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
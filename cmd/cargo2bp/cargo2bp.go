@@ -0,0 +1,542 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/bpfix/bpfix"
+)
+
+type RewriteNames map[string]string
+
+func (r RewriteNames) String() string {
+	return ""
+}
+
+func (r RewriteNames) Set(v string) error {
+	split := strings.SplitN(v, "=", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("Must be in the form of <package>=<module>")
+	}
+	r[split[0]] = split[1]
+	return nil
+}
+
+var rewriteNames = make(RewriteNames)
+
+type Exclude map[string]bool
+
+func (e Exclude) String() string {
+	return ""
+}
+
+func (e Exclude) Set(v string) error {
+	e[v] = true
+	return nil
+}
+
+var excludes = make(Exclude)
+
+// ExtraCfgs maps package names to the cfgs that their build scripts would set.
+type ExtraCfgs map[string][]string
+
+func (e ExtraCfgs) String() string {
+	return ""
+}
+
+func (e ExtraCfgs) Set(v string) error {
+	split := strings.SplitN(v, "=", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("Must be in the form of <package>=<cfg>")
+	}
+	e[split[0]] = append(e[split[0]], split[1])
+	return nil
+}
+
+var extraCfgs = make(ExtraCfgs)
+
+// Build script modes.
+const (
+	buildScriptsFlag = "flag"
+	buildScriptsStub = "stub"
+)
+
+// libModuleName returns the Android.bp module name of the library of a package.
+func libModuleName(pkg, crateName string) string {
+	if name, ok := rewriteNames[pkg]; ok {
+		return name
+	}
+	return "lib" + crateName
+}
+
+// bpModule is a module written to the Android.bp file.
+type bpModule struct {
+	Type     string
+	Name     string
+	Comments []string
+
+	HostSupported bool
+	CrateName     string
+	Srcs          []string
+	Edition       string
+	Features      []string
+	Cfgs          []string
+	Rustlibs      []string
+	ProcMacros    []string
+	Aliases       []string
+	Version       string
+	Test          bool
+
+	// The properties of the rust_bindgen and genrule build script stubs.
+	WrapperSrc string
+	SourceStem string
+	Out        string
+	Cmd        string
+}
+
+var bpTemplate = template.Must(template.New("bp").Parse(`
+{{range .Comments}}// {{.}}
+{{end}}{{.Type}} {
+    name: "{{.Name}}",
+    {{- if .HostSupported}}
+    host_supported: true,
+    {{- end}}
+    {{- if .CrateName}}
+    crate_name: "{{.CrateName}}",
+    {{- end}}
+    {{- if .Version}}
+    cargo_env_compat: true,
+    cargo_pkg_version: "{{.Version}}",
+    {{- end}}
+    {{- if .WrapperSrc}}
+    wrapper_src: "{{.WrapperSrc}}",
+    source_stem: "{{.SourceStem}}",
+    {{- end}}
+    {{- if .Srcs}}
+    srcs: [
+        {{- range .Srcs}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Out}}
+    out: ["{{.Out}}"],
+    cmd: "{{.Cmd}}",
+    {{- end}}
+    {{- if .Test}}
+    test_suites: ["general-tests"],
+    auto_gen_config: true,
+    {{- end}}
+    {{- if .Edition}}
+    edition: "{{.Edition}}",
+    {{- end}}
+    {{- if .Features}}
+    features: [
+        {{- range .Features}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Cfgs}}
+    cfgs: [
+        {{- range .Cfgs}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Rustlibs}}
+    rustlibs: [
+        {{- range .Rustlibs}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .ProcMacros}}
+    proc_macros: [
+        {{- range .ProcMacros}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Aliases}}
+    aliases: [
+        {{- range .Aliases}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+}
+`))
+
+// bpString escapes a string for a Blueprint string literal.
+func bpString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func bpStrings(list []string) []string {
+	var ret []string
+	for _, s := range list {
+		ret = append(ret, bpString(s))
+	}
+	return ret
+}
+
+// depProps sets the rustlibs, proc_macros and aliases properties of a module.
+func (m *bpModule) depProps(deps []dep) {
+	for _, d := range deps {
+		name := libModuleName(d.Package, d.CrateName)
+		if d.ProcMacro {
+			m.ProcMacros = append(m.ProcMacros, name)
+		} else {
+			m.Rustlibs = append(m.Rustlibs, name)
+		}
+		if d.Alias != "" {
+			m.Aliases = append(m.Aliases, d.CrateName+":"+d.Alias)
+		}
+	}
+	m.Rustlibs = proptools.FirstUniqueStrings(m.Rustlibs)
+	m.ProcMacros = proptools.FirstUniqueStrings(m.ProcMacros)
+	m.Aliases = proptools.FirstUniqueStrings(m.Aliases)
+	sort.Strings(m.Rustlibs)
+	sort.Strings(m.ProcMacros)
+	sort.Strings(m.Aliases)
+}
+
+// cfgs returns the cfgs given on the command line for the modules of a package. The features
+// are set with the features property instead.
+func cfgs(c *crate) []string {
+	return bpStrings(extraCfgs[c.Name])
+}
+
+// generate returns the Android.bp modules for the local packages of the workspace, and the
+// warnings about what could not be converted.
+func generate(crates []*crate, buildScripts string) ([]*bpModule, []string) {
+	var modules []*bpModule
+	var warnings []string
+
+	sorted := append([]*crate(nil), crates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, c := range sorted {
+		if excludes[c.Name] {
+			continue
+		}
+		src := func(path string) string {
+			return filepath.Join(c.Dir, path)
+		}
+
+		var libComments []string
+		var generatedSrcs []string
+		if c.BuildScript != "" && c.Lib != nil {
+			libName := libModuleName(c.Name, c.Lib.Name)
+			switch {
+			case buildScripts == buildScriptsStub && c.UsesBindgen:
+				stub := &bpModule{
+					Type: "rust_bindgen",
+					Name: libName + "_bindgen",
+					Comments: []string{
+						fmt.Sprintf("TODO: port the bindgen invocation of %s to this module.", src(c.BuildScript)),
+					},
+					HostSupported: true,
+					CrateName:     c.Lib.Name + "_bindgen",
+					WrapperSrc:    src("wrapper.h"),
+					SourceStem:    "bindings",
+				}
+				modules = append(modules, stub)
+				generatedSrcs = append(generatedSrcs, ":"+stub.Name)
+			case buildScripts == buildScriptsStub:
+				stub := &bpModule{
+					Type: "genrule",
+					Name: libName + "_build_out",
+					Comments: []string{
+						fmt.Sprintf("TODO: port %s to this module, the build fails until it is.", src(c.BuildScript)),
+					},
+					Srcs: []string{src(c.BuildScript)},
+					Out:  c.Lib.Name + "_build_out.rs",
+					Cmd:  bpString(fmt.Sprintf("echo '%s: the build script has not been ported' >&2 && false", c.Name)),
+				}
+				modules = append(modules, stub)
+				generatedSrcs = append(generatedSrcs, ":"+stub.Name)
+			default:
+				libComments = append(libComments,
+					fmt.Sprintf("TODO: %s was not converted, port what it generates or the cfgs it sets.", src(c.BuildScript)))
+			}
+			warnings = append(warnings, fmt.Sprintf("%s has a build script %s", c.Name, src(c.BuildScript)))
+		}
+
+		if c.Lib != nil {
+			lib := &bpModule{
+				Type:          "rust_library",
+				Name:          libModuleName(c.Name, c.Lib.Name),
+				Comments:      libComments,
+				HostSupported: true,
+				CrateName:     c.Lib.Name,
+				Srcs:          append([]string{src(c.Lib.Src)}, generatedSrcs...),
+				Edition:       stringOr(c.Lib.Edition, c.Edition),
+				Features:      bpStrings(c.Features),
+				Cfgs:          cfgs(c),
+				Version:       c.Version,
+			}
+			if c.Lib.ProcMacro {
+				lib.Type = "rust_proc_macro"
+				lib.HostSupported = false
+			}
+			lib.depProps(c.Deps)
+			modules = append(modules, lib)
+
+			if c.Lib.Test {
+				test := *lib
+				test.Type = "rust_test"
+				test.Name = c.Lib.Name + "_test_" + strings.ReplaceAll(strings.TrimSuffix(c.Lib.Src, ".rs"), "/", "_")
+				test.Comments = nil
+				test.Test = true
+				test.Rustlibs, test.ProcMacros, test.Aliases = nil, nil, nil
+				test.depProps(append(append([]dep(nil), c.Deps...), c.DevDeps...))
+				if c.Lib.ProcMacro {
+					test.Type = "rust_test_host"
+				}
+				modules = append(modules, &test)
+			}
+		}
+
+		for _, t := range c.Tests {
+			test := &bpModule{
+				Type:          "rust_test",
+				Name:          crateName(c.Name) + "_test_" + strings.ReplaceAll(strings.TrimSuffix(t.Src, ".rs"), "/", "_"),
+				HostSupported: true,
+				CrateName:     t.Name,
+				Srcs:          []string{src(t.Src)},
+				Edition:       stringOr(t.Edition, c.Edition),
+				Features:      bpStrings(c.Features),
+				Cfgs:          cfgs(c),
+				Version:       c.Version,
+				Test:          true,
+			}
+			deps := append(append([]dep(nil), c.Deps...), c.DevDeps...)
+			if c.Lib != nil {
+				deps = append(deps, dep{Package: c.Name, CrateName: c.Lib.Name, ProcMacro: c.Lib.ProcMacro})
+			}
+			test.depProps(deps)
+			modules = append(modules, test)
+		}
+	}
+	return modules, warnings
+}
+
+func rerunForRegen(filename string) error {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(buf))
+
+	// Skip the first line in the file
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			if scanner.Err() != nil {
+				return scanner.Err()
+			} else {
+				return fmt.Errorf("unexpected EOF")
+			}
+		}
+	}
+
+	// Extract the old args from the file
+	line := scanner.Text()
+	if strings.HasPrefix(line, "// cargo2bp ") {
+		line = strings.TrimPrefix(line, "// cargo2bp ")
+	} else if line == "// cargo2bp" {
+		line = ""
+	} else {
+		return fmt.Errorf("unexpected second line: %q", line)
+	}
+	args := strings.Fields(line)
+
+	// Append all current command line args except -regen <file> to the ones from the file
+	for i := 1; i < len(os.Args); i++ {
+		if os.Args[i] == "-regen" || os.Args[i] == "--regen" {
+			i++
+		} else {
+			args = append(args, os.Args[i])
+		}
+	}
+
+	cmd := os.Args[0] + " " + strings.Join(args, " ")
+	// Re-exec cargo2bp with the new arguments
+	output, err := exec.Command("/bin/sh", "-c", cmd).Output()
+	if exitErr, _ := err.(*exec.ExitError); exitErr != nil {
+		return fmt.Errorf("failed to run %s\n%s", cmd, string(exitErr.Stderr))
+	} else if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, output, 0666)
+}
+
+// runCargoMetadata runs cargo metadata in the current directory.
+func runCargoMetadata() (io.Reader, error) {
+	cmd := exec.Command("cargo", "metadata", "--format-version", "1", "--locked")
+	var stdoutb, stderrb bytes.Buffer
+	cmd.Stdout = &stdoutb
+	cmd.Stderr = &stderrb
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Running %q to dump the Cargo metadata failed: %v, stderr:\n%s\n"+
+			"Use -offline to read Cargo.toml and Cargo.lock directly.",
+			cmd.String(), err, stderrb.Bytes())
+	}
+	return &stdoutb, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `cargo2bp, a tool to create Android.bp files from Cargo workspaces
+
+The tool reads the packages and the resolved features and dependencies of a Cargo workspace to
+create an Android.bp that can compile the local packages of the workspace, i.e. the workspace
+members and their path dependencies. This needs to be run from the same directory as the
+workspace Cargo.toml file.
+
+Usage: %s [-offline] [-metadata <file>] [-rewrite <package>=<module>] [-exclude <package>]
+          [-cfg <package>=<cfg>] [-build-scripts flag|stub] [-strict] [-regen <file>]
+
+  -offline
+     Read Cargo.toml and Cargo.lock directly instead of running cargo metadata. Only the
+     features of the local packages are resolved.
+  -metadata <file>
+     Read the output of cargo metadata --format-version 1 from <file> instead of running it.
+  -rewrite <package>=<module>
+     Use <module> for the library of the Cargo package <package>, instead of lib<crate_name>.
+  -exclude <package>
+     Don't put the specified package in the Android.bp file.
+  -cfg <package>=<cfg>
+     Add <cfg> to the cfgs of the modules of <package>, e.g. to replace a build script.
+  -build-scripts flag|stub
+     With flag, the default, the libraries with build scripts get a TODO comment. With stub, a
+     rust_bindgen module is generated for the build scripts using bindgen and a genrule that
+     fails until it is ported for the others, and the stubs are added to the library srcs.
+  -strict
+     Exit with an error if a build script was not converted.
+  -regen <file>
+     Read arguments from <file> and overwrite it.
+
+`, os.Args[0])
+	}
+
+	var regen string
+	var offline bool
+	var metadataFile string
+	var buildScripts string
+	var strict bool
+
+	flag.BoolVar(&offline, "offline", false, "Read Cargo.toml and Cargo.lock directly")
+	flag.StringVar(&metadataFile, "metadata", "", "Read cargo metadata output from file")
+	flag.Var(&rewriteNames, "rewrite", "Module name of a package library")
+	flag.Var(&excludes, "exclude", "Exclude package")
+	flag.Var(&extraCfgs, "cfg", "Extra cfg of a package")
+	flag.StringVar(&buildScripts, "build-scripts", buildScriptsFlag, "How to convert build scripts: flag or stub")
+	flag.BoolVar(&strict, "strict", false, "Fail if a build script was not converted")
+	flag.StringVar(&regen, "regen", "", "Rewrite specified file")
+	flag.Parse()
+
+	if regen != "" {
+		err := rerunForRegen(regen)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Unused argument detected: %v\n", flag.Args())
+		os.Exit(1)
+	}
+	if buildScripts != buildScriptsFlag && buildScripts != buildScriptsStub {
+		fmt.Fprintf(os.Stderr, "Invalid -build-scripts %q, must be flag or stub\n", buildScripts)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat("Cargo.toml"); err != nil {
+		fmt.Fprintln(os.Stderr, "Cargo.toml file not found")
+		os.Exit(1)
+	}
+
+	var crates []*crate
+	var err error
+	switch {
+	case offline:
+		crates, err = loadManifests(".")
+	case metadataFile != "":
+		var f *os.File
+		if f, err = os.Open(metadataFile); err == nil {
+			crates, err = loadMetadata(f)
+			f.Close()
+		}
+	default:
+		var r io.Reader
+		if r, err = runCargoMetadata(); err == nil {
+			crates, err = loadMetadata(r)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	modules, warnings := generate(crates, buildScripts)
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintln(buf, "// Automatically generated with:")
+	fmt.Fprintln(buf, "// cargo2bp", strings.Join(proptools.ShellEscapeList(os.Args[1:]), " "))
+
+	for _, m := range modules {
+		err := bpTemplate.Execute(buf, m)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing", m.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	out, err := bpfix.Reformat(buf.String())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error formatting output", err)
+		os.Exit(1)
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	if strict && buildScripts == buildScriptsFlag && len(warnings) > 0 {
+		fmt.Fprintln(os.Stderr, "Build scripts were not converted, use -build-scripts stub or -exclude")
+		os.Exit(1)
+	}
+
+	os.Stdout.WriteString(out)
+}
@@ -0,0 +1,406 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML(`
+# comment
+[package]
+name = "foo" # trailing comment
+edition.workspace = true
+description = """
+multi \
+  line"""
+authors = [
+    'a',
+    "b\"c",
+]
+
+[dependencies]
+bar = { version = "1", features = ["x"], optional = true }
+
+[target.'cfg(unix)'.dependencies]
+libc = "0.2"
+
+[[test]]
+name = "t1"
+
+[[test]]
+name = "t2"
+harness = false
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tomlTable{
+		"package": tomlTable{
+			"name":        "foo",
+			"edition":     tomlTable{"workspace": true},
+			"description": "multi line",
+			"authors":     []interface{}{"a", `b"c`},
+		},
+		"dependencies": tomlTable{
+			"bar": tomlTable{"version": "1", "features": []interface{}{"x"}, "optional": true},
+		},
+		"target": tomlTable{
+			"cfg(unix)": tomlTable{"dependencies": tomlTable{"libc": "0.2"}},
+		},
+		"test": []interface{}{
+			tomlTable{"name": "t1"},
+			tomlTable{"name": "t2", "harness": false},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML() = %#v\nwant %#v", got, want)
+	}
+
+	for _, invalid := range []string{"a = ", "a = \"b", "[a\nb = 1", "a = 1\na = 2", "a = [1 2]"} {
+		if _, err := parseTOML(invalid); err == nil {
+			t.Errorf("parseTOML(%q) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestCfgMatches(t *testing.T) {
+	testCases := []struct {
+		spec string
+		want bool
+	}{
+		{`cfg(unix)`, true},
+		{`cfg(windows)`, false},
+		{`cfg(not(windows))`, true},
+		{`cfg(target_os = "android")`, true},
+		{`cfg(target_os = "macos")`, false},
+		{`cfg(any(target_os = "macos", target_os = "linux"))`, true},
+		{`cfg(all(unix, target_arch = "wasm32"))`, false},
+		{`x86_64-unknown-linux-gnu`, true},
+		{`x86_64-pc-windows-msvc`, false},
+	}
+	for _, tc := range testCases {
+		got, err := cfgMatches(tc.spec)
+		if err != nil {
+			t.Errorf("cfgMatches(%q) failed: %s", tc.spec, err)
+		} else if got != tc.want {
+			t.Errorf("cfgMatches(%q) = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestLoadMetadata(t *testing.T) {
+	metadata := `{
+  "workspace_root": "/ws",
+  "workspace_members": ["foo 1.0.0 (path+file:///ws/foo)"],
+  "packages": [
+    {
+      "id": "foo 1.0.0 (path+file:///ws/foo)", "name": "foo", "version": "1.0.0", "source": null,
+      "manifest_path": "/ws/foo/Cargo.toml", "edition": "2021",
+      "targets": [
+        {"name": "foo", "kind": ["lib"], "src_path": "/ws/foo/src/lib.rs", "edition": "2021", "test": true},
+        {"name": "it", "kind": ["test"], "src_path": "/ws/foo/tests/it.rs", "edition": "2021", "test": true},
+        {"name": "build-script-build", "kind": ["custom-build"], "src_path": "/ws/foo/build.rs", "edition": "2021"}
+      ],
+      "dependencies": [
+        {"name": "serde-json", "rename": "json", "kind": null},
+        {"name": "derive", "rename": null, "kind": null}
+      ]
+    },
+    {
+      "id": "serde-json 1.0.0 (registry+https://github.com/rust-lang/crates.io-index)", "name": "serde-json",
+      "version": "1.0.0", "source": "registry+https://github.com/rust-lang/crates.io-index",
+      "manifest_path": "/cargo/serde-json/Cargo.toml", "edition": "2018",
+      "targets": [{"name": "serde_json", "kind": ["lib"], "src_path": "/cargo/serde-json/src/lib.rs"}]
+    },
+    {
+      "id": "derive 1.0.0 (path+file:///ws/derive)", "name": "derive", "version": "1.0.0", "source": null,
+      "manifest_path": "/ws/derive/Cargo.toml", "edition": "2021",
+      "targets": [{"name": "derive", "kind": ["proc-macro"], "src_path": "/ws/derive/src/lib.rs", "test": false}]
+    },
+    {
+      "id": "bindgen 0.69.0 (registry+https://github.com/rust-lang/crates.io-index)", "name": "bindgen",
+      "version": "0.69.0", "source": "registry+https://github.com/rust-lang/crates.io-index",
+      "manifest_path": "/cargo/bindgen/Cargo.toml", "edition": "2018",
+      "targets": [{"name": "bindgen", "kind": ["lib"], "src_path": "/cargo/bindgen/lib.rs"}]
+    },
+    {
+      "id": "winapi 0.3.0 (registry+https://github.com/rust-lang/crates.io-index)", "name": "winapi",
+      "version": "0.3.0", "source": "registry+https://github.com/rust-lang/crates.io-index",
+      "manifest_path": "/cargo/winapi/Cargo.toml", "edition": "2018",
+      "targets": [{"name": "winapi", "kind": ["lib"], "src_path": "/cargo/winapi/lib.rs"}]
+    }
+  ],
+  "resolve": {
+    "nodes": [
+      {
+        "id": "foo 1.0.0 (path+file:///ws/foo)",
+        "features": ["std", "default"],
+        "deps": [
+          {"name": "json", "pkg": "serde-json 1.0.0 (registry+https://github.com/rust-lang/crates.io-index)",
+           "dep_kinds": [{"kind": null, "target": null}, {"kind": "dev", "target": null}]},
+          {"name": "derive", "pkg": "derive 1.0.0 (path+file:///ws/derive)",
+           "dep_kinds": [{"kind": null, "target": null}]},
+          {"name": "bindgen", "pkg": "bindgen 0.69.0 (registry+https://github.com/rust-lang/crates.io-index)",
+           "dep_kinds": [{"kind": "build", "target": null}]},
+          {"name": "winapi", "pkg": "winapi 0.3.0 (registry+https://github.com/rust-lang/crates.io-index)",
+           "dep_kinds": [{"kind": null, "target": "cfg(windows)"}]}
+        ]
+      },
+      {"id": "derive 1.0.0 (path+file:///ws/derive)", "features": [], "deps": []},
+      {"id": "serde-json 1.0.0 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "bindgen 0.69.0 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "winapi 0.3.0 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []}
+    ]
+  }
+}`
+	got, err := loadMetadata(strings.NewReader(metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	derive := dep{Package: "derive", CrateName: "derive", ProcMacro: true}
+	json := dep{Package: "serde-json", CrateName: "serde_json", Alias: "json"}
+	want := []*crate{
+		{
+			Name:        "foo",
+			Version:     "1.0.0",
+			Dir:         "foo",
+			Edition:     "2021",
+			Lib:         &target{Name: "foo", Src: "src/lib.rs", Edition: "2021", Test: true},
+			Tests:       []target{{Name: "it", Src: "tests/it.rs", Edition: "2021", Test: true}},
+			Features:    []string{"default", "std"},
+			Deps:        []dep{derive, json},
+			DevDeps:     []dep{json},
+			BuildScript: "build.rs",
+			UsesBindgen: true,
+		},
+		{
+			Name:    "derive",
+			Version: "1.0.0",
+			Dir:     "derive",
+			Edition: "2021",
+			Lib:     &target{Name: "derive", Src: "src/lib.rs", ProcMacro: true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMetadata() =")
+		for _, c := range got {
+			t.Errorf("  %+v", *c)
+		}
+		t.Errorf("want")
+		for _, c := range want {
+			t.Errorf("  %+v", *c)
+		}
+	}
+}
+
+func TestLoadManifests(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Cargo.toml", `
+[workspace]
+members = ["crates/*"]
+
+[workspace.package]
+edition = "2021"
+
+[workspace.dependencies]
+util = { path = "util", default-features = false }
+`)
+	write("crates/app/Cargo.toml", `
+[package]
+name = "app"
+version = "0.1.0"
+edition.workspace = true
+
+[features]
+default = ["fast"]
+fast = ["util/simd", "dep:log", "extra?/on"]
+
+[dependencies]
+util = { workspace = true }
+log = { version = "0.4", optional = true }
+extra = { path = "../extra", optional = true }
+renamed = { package = "other-crate", version = "1" }
+
+[dev-dependencies]
+macros = { path = "../macros" }
+`)
+	write("crates/app/src/lib.rs", "")
+	write("crates/app/tests/smoke.rs", "")
+	write("crates/app/build.rs", "")
+	write("crates/extra/Cargo.toml", `
+[package]
+name = "extra"
+version = "0.1.0"
+
+[features]
+on = []
+`)
+	write("crates/extra/src/lib.rs", "")
+	write("crates/macros/Cargo.toml", `
+[package]
+name = "macros"
+version = "0.1.0"
+edition = "2018"
+
+[lib]
+proc-macro = true
+test = false
+`)
+	write("crates/macros/src/lib.rs", "")
+	write("util/Cargo.toml", `
+[package]
+name = "util"
+version = "0.2.0"
+
+[features]
+default = ["std"]
+std = []
+simd = []
+`)
+	write("util/src/lib.rs", "")
+
+	crates, err := loadManifests(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*crate)
+	for _, c := range crates {
+		got[c.Name] = c
+	}
+
+	app := got["app"]
+	if app == nil {
+		t.Fatalf("app not found in %v", crates)
+	}
+	if app.Edition != "2021" || app.BuildScript != "build.rs" {
+		t.Errorf("app edition = %q, build script = %q", app.Edition, app.BuildScript)
+	}
+	if want := []string{"default", "fast"}; !reflect.DeepEqual(app.Features, want) {
+		t.Errorf("app features = %v, want %v", app.Features, want)
+	}
+	wantDeps := []dep{
+		{Package: "log", CrateName: "log"},
+		{Package: "other-crate", CrateName: "other_crate", Alias: "renamed"},
+		{Package: "util", CrateName: "util"},
+	}
+	if !reflect.DeepEqual(app.Deps, wantDeps) {
+		t.Errorf("app deps = %+v, want %+v", app.Deps, wantDeps)
+	}
+	wantDevDeps := []dep{{Package: "macros", CrateName: "macros", ProcMacro: true}}
+	if !reflect.DeepEqual(app.DevDeps, wantDevDeps) {
+		t.Errorf("app dev deps = %+v, want %+v", app.DevDeps, wantDevDeps)
+	}
+	if len(app.Tests) != 1 || app.Tests[0].Src != "tests/smoke.rs" {
+		t.Errorf("app tests = %+v", app.Tests)
+	}
+
+	// util is a path dependency with default features disabled.
+	if util := got["util"]; util == nil || !reflect.DeepEqual(util.Features, []string{"simd"}) {
+		t.Errorf("util = %+v, want features [simd]", util)
+	}
+	// extra is not enabled, so the weak feature isn't either.
+	if extra := got["extra"]; extra == nil || len(extra.Features) != 0 {
+		t.Errorf("extra = %+v, want no features", extra)
+	}
+	if macros := got["macros"]; macros == nil || !macros.Lib.ProcMacro || macros.Lib.Test {
+		t.Errorf("macros = %+v, want a proc macro without unit tests", macros)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	crates := []*crate{
+		{
+			Name:        "foo-bar",
+			Version:     "1.0.0",
+			Dir:         "foo",
+			Edition:     "2021",
+			Lib:         &target{Name: "foo_bar", Src: "src/lib.rs", Test: true},
+			Tests:       []target{{Name: "it", Src: "tests/it.rs"}},
+			Features:    []string{"std"},
+			Deps:        []dep{{Package: "derive", CrateName: "derive", ProcMacro: true}, {Package: "serde-json", CrateName: "serde_json", Alias: "json"}},
+			DevDeps:     []dep{{Package: "quickcheck", CrateName: "quickcheck"}},
+			BuildScript: "build.rs",
+		},
+	}
+	rewriteNames["serde-json"] = "libserde_json_android"
+	defer delete(rewriteNames, "serde-json")
+
+	modules, warnings := generate(crates, buildScriptsStub)
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want one build script warning", warnings)
+	}
+	var names []string
+	for _, m := range modules {
+		names = append(names, m.Type+" "+m.Name)
+	}
+	wantNames := []string{
+		"genrule libfoo_bar_build_out",
+		"rust_library libfoo_bar",
+		"rust_test foo_bar_test_src_lib",
+		"rust_test foo_bar_test_tests_it",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("modules = %v, want %v", names, wantNames)
+	}
+
+	lib := modules[1]
+	if want := []string{"foo/src/lib.rs", ":libfoo_bar_build_out"}; !reflect.DeepEqual(lib.Srcs, want) {
+		t.Errorf("lib srcs = %v, want %v", lib.Srcs, want)
+	}
+	if want := []string{"libserde_json_android"}; !reflect.DeepEqual(lib.Rustlibs, want) {
+		t.Errorf("lib rustlibs = %v, want %v", lib.Rustlibs, want)
+	}
+	if want := []string{"libderive"}; !reflect.DeepEqual(lib.ProcMacros, want) {
+		t.Errorf("lib proc_macros = %v, want %v", lib.ProcMacros, want)
+	}
+	if want := []string{"serde_json:json"}; !reflect.DeepEqual(lib.Aliases, want) {
+		t.Errorf("lib aliases = %v, want %v", lib.Aliases, want)
+	}
+
+	unitTest := modules[2]
+	if want := []string{"libquickcheck", "libserde_json_android"}; !reflect.DeepEqual(unitTest.Rustlibs, want) {
+		t.Errorf("unit test rustlibs = %v, want %v", unitTest.Rustlibs, want)
+	}
+	integrationTest := modules[3]
+	if want := []string{"libfoo_bar", "libquickcheck", "libserde_json_android"}; !reflect.DeepEqual(integrationTest.Rustlibs, want) {
+		t.Errorf("integration test rustlibs = %v, want %v", integrationTest.Rustlibs, want)
+	}
+
+	var buf strings.Builder
+	if err := bpTemplate.Execute(&buf, lib); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`rust_library {`, `crate_name: "foo_bar",`, `edition: "2021",`, `"std",`, `cargo_pkg_version: "1.0.0",`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,580 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// This file reads Cargo.toml and Cargo.lock files directly, for use when cargo can't be run,
+// e.g. when the registry isn't reachable. The feature resolution only covers the local packages
+// of the workspace, which is what is converted to Android.bp modules.
+
+// manifest is a parsed Cargo.toml of a local package.
+type manifest struct {
+	name     string
+	version  string
+	dir      string
+	edition  string
+	lib      *target
+	tests    []target
+	build    string
+	features map[string][]string
+	// member is true for the workspace members, as opposed to their path dependencies.
+	member bool
+
+	deps      []manifestDep
+	devDeps   []manifestDep
+	buildDeps []manifestDep
+}
+
+// manifestDep is an entry of one of the dependencies tables of a Cargo.toml.
+type manifestDep struct {
+	// key is the name of the dependency in the manifest, which is the crate name it is
+	// imported as.
+	key  string
+	pkg  string
+	path string
+	// pathFromRoot is true if path was inherited from the workspace, which makes it relative to
+	// the workspace root instead of the package.
+	pathFromRoot    bool
+	optional        bool
+	defaultFeatures bool
+	features        []string
+}
+
+// workspace holds the [workspace] table of the root Cargo.toml, which packages can inherit
+// from.
+type workspace struct {
+	pkg  tomlTable
+	deps tomlTable
+}
+
+func readTOML(path string) (tomlTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	table, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return table, nil
+}
+
+// inherited returns the value of a [package] key, which may be inherited from the workspace
+// with key.workspace = true.
+func (w *workspace) inherited(pkg tomlTable, key string) string {
+	if t := pkg.table(key); t != nil && t.boolean("workspace", false) && w.pkg != nil {
+		return w.pkg.str(key)
+	}
+	return pkg.str(key)
+}
+
+// parseManifest converts a parsed Cargo.toml of the package in dir, relative to root.
+func parseManifest(root, dir string, toml tomlTable, ws *workspace) (*manifest, error) {
+	pkg := toml.table("package")
+	if pkg == nil {
+		return nil, fmt.Errorf("%s: no [package]", filepath.Join(dir, "Cargo.toml"))
+	}
+	m := &manifest{
+		name:     pkg.str("name"),
+		version:  ws.inherited(pkg, "version"),
+		dir:      dir,
+		edition:  ws.inherited(pkg, "edition"),
+		features: make(map[string][]string),
+	}
+	if m.edition == "" {
+		m.edition = "2015"
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(root, dir, path))
+		return err == nil
+	}
+
+	lib := toml.table("lib")
+	if lib != nil || exists("src/lib.rs") {
+		if lib == nil {
+			lib = tomlTable{}
+		}
+		m.lib = &target{
+			Name:      crateName(m.name),
+			Src:       "src/lib.rs",
+			Edition:   m.edition,
+			ProcMacro: lib.boolean("proc-macro", lib.boolean("proc_macro", false)),
+			Test:      lib.boolean("test", true),
+		}
+		if name := lib.str("name"); name != "" {
+			m.lib.Name = crateName(name)
+		}
+		if path := lib.str("path"); path != "" {
+			m.lib.Src = path
+		}
+	}
+
+	seenTests := make(map[string]bool)
+	for _, t := range toml.tables("test") {
+		name := t.str("name")
+		path := t.str("path")
+		if path == "" {
+			path = filepath.Join("tests", name+".rs")
+		}
+		seenTests[path] = true
+		m.tests = append(m.tests, target{Name: crateName(name), Src: path, Edition: m.edition, Test: true})
+	}
+	if pkg.boolean("autotests", true) {
+		autoTests, _ := filepath.Glob(filepath.Join(root, dir, "tests", "*.rs"))
+		sort.Strings(autoTests)
+		for _, path := range autoTests {
+			rel := filepath.Join("tests", filepath.Base(path))
+			if !seenTests[rel] {
+				name := strings.TrimSuffix(filepath.Base(path), ".rs")
+				m.tests = append(m.tests, target{Name: crateName(name), Src: rel, Edition: m.edition, Test: true})
+			}
+		}
+	}
+
+	switch build := pkg["build"].(type) {
+	case string:
+		m.build = build
+	case bool:
+		if build && exists("build.rs") {
+			m.build = "build.rs"
+		}
+	default:
+		if exists("build.rs") {
+			m.build = "build.rs"
+		}
+	}
+
+	for name, v := range toml.table("features") {
+		list, _ := v.([]interface{})
+		features := []string{}
+		for _, f := range list {
+			if s, ok := f.(string); ok {
+				features = append(features, s)
+			}
+		}
+		m.features[name] = features
+	}
+
+	var err error
+	addDeps := func(table tomlTable) {
+		if err != nil {
+			return
+		}
+		var deps []manifestDep
+		for _, key := range []string{"dependencies", "dev-dependencies", "dev_dependencies", "build-dependencies", "build_dependencies"} {
+			deps, err = ws.parseDeps(table.table(key))
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(key, "dev"):
+				m.devDeps = append(m.devDeps, deps...)
+			case strings.HasPrefix(key, "build"):
+				m.buildDeps = append(m.buildDeps, deps...)
+			default:
+				m.deps = append(m.deps, deps...)
+			}
+		}
+	}
+	addDeps(toml)
+	targetSpecs := toml.table("target")
+	for _, spec := range sortedKeys(targetSpecs) {
+		var matches bool
+		matches, err = cfgMatches(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filepath.Join(dir, "Cargo.toml"), err)
+		}
+		if matches {
+			addDeps(targetSpecs.table(spec))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Join(dir, "Cargo.toml"), err)
+	}
+	return m, nil
+}
+
+func (w *workspace) parseDeps(table tomlTable) ([]manifestDep, error) {
+	var deps []manifestDep
+	for _, key := range sortedKeys(table) {
+		d := manifestDep{key: key, pkg: key, defaultFeatures: true}
+		var spec tomlTable
+		switch v := table[key].(type) {
+		case string:
+		case tomlTable:
+			spec = v
+		default:
+			return nil, fmt.Errorf("invalid dependency %q", key)
+		}
+		if spec.boolean("workspace", false) {
+			inherited := w.deps.table(key)
+			if inherited == nil {
+				if _, ok := w.deps[key].(string); !ok {
+					return nil, fmt.Errorf("dependency %q is not in [workspace.dependencies]", key)
+				}
+				inherited = tomlTable{}
+			}
+			d.pkg = stringOr(inherited.str("package"), key)
+			d.path = inherited.str("path")
+			d.pathFromRoot = d.path != ""
+			d.defaultFeatures = inherited.boolean("default-features", inherited.boolean("default_features", true))
+			d.features = inherited.strs("features")
+		}
+		if spec != nil {
+			d.pkg = stringOr(spec.str("package"), d.pkg)
+			if path := spec.str("path"); path != "" {
+				d.path = path
+				d.pathFromRoot = false
+			}
+			d.optional = spec.boolean("optional", false)
+			d.defaultFeatures = spec.boolean("default-features", spec.boolean("default_features", d.defaultFeatures))
+			d.features = append(d.features, spec.strs("features")...)
+		}
+		deps = append(deps, d)
+	}
+	return deps, nil
+}
+
+func stringOr(s, def string) string {
+	if s != "" {
+		return s
+	}
+	return def
+}
+
+func sortedKeys(table tomlTable) []string {
+	var keys []string
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadManifests reads the Cargo.toml files of the workspace in root: the root package, the
+// workspace members and their path dependencies in the workspace. It also reads the versions of
+// the locked packages from Cargo.lock, if it exists.
+func loadManifests(root string) ([]*crate, error) {
+	rootToml, err := readTOML(filepath.Join(root, "Cargo.toml"))
+	if err != nil {
+		return nil, err
+	}
+	ws := &workspace{}
+	var dirs []string
+	if w := rootToml.table("workspace"); w != nil {
+		ws.pkg = w.table("package")
+		ws.deps = w.table("dependencies")
+		excluded := make(map[string]bool)
+		for _, e := range w.strs("exclude") {
+			excluded[filepath.Clean(e)] = true
+		}
+		for _, member := range w.strs("members") {
+			matches, err := filepath.Glob(filepath.Join(root, member))
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(matches)
+			for _, match := range matches {
+				dir, _ := filepath.Rel(root, match)
+				if _, err := os.Stat(filepath.Join(match, "Cargo.toml")); err == nil && !excluded[dir] {
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+	}
+	if rootToml.table("package") != nil {
+		dirs = append([]string{"."}, dirs...)
+	}
+
+	locked := make(map[string][]string)
+	if lock, err := readTOML(filepath.Join(root, "Cargo.lock")); err == nil {
+		for _, p := range lock.tables("package") {
+			locked[p.str("name")] = append(locked[p.str("name")], p.str("version"))
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	members := make(map[string]bool)
+	for _, dir := range dirs {
+		members[filepath.Clean(dir)] = true
+	}
+
+	manifests := make(map[string]*manifest)
+	var ordered []*manifest
+	visited := make(map[string]bool)
+	for len(dirs) > 0 {
+		dir := filepath.Clean(dirs[0])
+		dirs = dirs[1:]
+		if visited[dir] {
+			continue
+		}
+		visited[dir] = true
+
+		toml := rootToml
+		if dir != "." {
+			if toml, err = readTOML(filepath.Join(root, dir, "Cargo.toml")); err != nil {
+				return nil, err
+			}
+		}
+		m, err := parseManifest(root, dir, toml, ws)
+		if err != nil {
+			return nil, err
+		}
+		m.member = members[dir]
+		if m.version == "" && len(locked[m.name]) == 1 {
+			m.version = locked[m.name][0]
+		}
+		if other, ok := manifests[m.name]; ok {
+			return nil, fmt.Errorf("package %q is in both %s and %s", m.name, other.dir, m.dir)
+		}
+		manifests[m.name] = m
+		ordered = append(ordered, m)
+
+		// Path dependencies in the workspace are local packages too.
+		for _, deps := range [][]manifestDep{m.deps, m.devDeps, m.buildDeps} {
+			for _, d := range deps {
+				if d.path == "" {
+					continue
+				}
+				depDir := filepath.Join(dir, d.path)
+				if d.pathFromRoot {
+					depDir = filepath.Clean(d.path)
+				}
+				if !strings.HasPrefix(depDir, "..") {
+					dirs = append(dirs, depDir)
+				}
+			}
+		}
+	}
+
+	features := resolveFeatures(manifests, ordered)
+
+	var crates []*crate
+	for _, m := range ordered {
+		c := &crate{
+			Name:        m.name,
+			Version:     m.version,
+			Dir:         m.dir,
+			Edition:     m.edition,
+			Lib:         m.lib,
+			Tests:       m.tests,
+			Features:    features[m.name].features(),
+			BuildScript: m.build,
+		}
+		for _, d := range m.buildDeps {
+			if d.pkg == "bindgen" {
+				c.UsesBindgen = true
+			}
+		}
+		enabled := features[m.name]
+		convert := func(deps []manifestDep) []dep {
+			var ret []dep
+			for _, d := range deps {
+				if d.optional && !enabled.deps[d.key] {
+					continue
+				}
+				converted := dep{Package: d.pkg, CrateName: crateName(d.pkg)}
+				if local := manifests[d.pkg]; local != nil {
+					if local.lib == nil {
+						continue
+					}
+					converted.CrateName = local.lib.Name
+					converted.ProcMacro = local.lib.ProcMacro
+				}
+				if alias := crateName(d.key); alias != converted.CrateName {
+					converted.Alias = alias
+				}
+				ret = append(ret, converted)
+			}
+			return sortDeps(ret)
+		}
+		c.Deps = convert(m.deps)
+		c.DevDeps = convert(m.devDeps)
+		crates = append(crates, c)
+	}
+	return crates, nil
+}
+
+// enabledFeatures are the features and optional dependencies enabled for a package.
+type enabledFeatures struct {
+	m *manifest
+	// set holds the enabled features, including the implicit features of optional dependencies.
+	set  map[string]bool
+	deps map[string]bool
+	// explicitDeps is true if the package uses the dep: syntax, which removes the implicit
+	// features of optional dependencies.
+	explicitDeps bool
+}
+
+func (e *enabledFeatures) features() []string {
+	if e == nil {
+		return nil
+	}
+	var features []string
+	for f := range e.set {
+		if _, declared := e.m.features[f]; declared || !e.explicitDeps {
+			features = append(features, f)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// resolveFeatures unifies the features requested for the local packages, starting with the
+// default features of the workspace members, like cargo build --workspace does.
+func resolveFeatures(manifests map[string]*manifest, ordered []*manifest) map[string]*enabledFeatures {
+	enabled := make(map[string]*enabledFeatures)
+	get := func(pkg string) *enabledFeatures {
+		m := manifests[pkg]
+		if m == nil {
+			return nil
+		}
+		if enabled[pkg] == nil {
+			e := &enabledFeatures{m: m, set: make(map[string]bool), deps: make(map[string]bool)}
+			for _, values := range m.features {
+				for _, v := range values {
+					if strings.HasPrefix(v, "dep:") {
+						e.explicitDeps = true
+					}
+				}
+			}
+			enabled[pkg] = e
+		}
+		return enabled[pkg]
+	}
+
+	// weak holds the dep?/feature requests, which only apply if the dependency is enabled by
+	// something else.
+	type weakRequest struct {
+		e       *enabledFeatures
+		depKey  string
+		feature string
+	}
+	var weak []weakRequest
+
+	var requestFeature func(pkg, feature string)
+	var enableDep func(e *enabledFeatures, key string)
+
+	findDeps := func(e *enabledFeatures, key string) []manifestDep {
+		var found []manifestDep
+		for _, deps := range [][]manifestDep{e.m.deps, e.m.devDeps, e.m.buildDeps} {
+			for _, d := range deps {
+				if d.key == key {
+					found = append(found, d)
+				}
+			}
+		}
+		return found
+	}
+
+	enableDep = func(e *enabledFeatures, key string) {
+		if e.deps[key] {
+			return
+		}
+		e.deps[key] = true
+		for _, d := range findDeps(e, key) {
+			if d.optional && !e.explicitDeps {
+				e.set[key] = true
+			}
+			requestDepFeatures(d, requestFeature)
+		}
+	}
+
+	requestFeature = func(pkg, feature string) {
+		e := get(pkg)
+		if e == nil || e.set[feature] {
+			return
+		}
+		values, declared := e.m.features[feature]
+		if !declared {
+			// An optional dependency used as a feature.
+			for _, d := range findDeps(e, feature) {
+				if d.optional {
+					enableDep(e, feature)
+				}
+			}
+			return
+		}
+		e.set[feature] = true
+		for _, v := range values {
+			switch {
+			case strings.HasPrefix(v, "dep:"):
+				enableDep(e, strings.TrimPrefix(v, "dep:"))
+			case strings.Contains(v, "?/"):
+				depKey, depFeature, _ := strings.Cut(v, "?/")
+				weak = append(weak, weakRequest{e, depKey, depFeature})
+			case strings.Contains(v, "/"):
+				depKey, depFeature, _ := strings.Cut(v, "/")
+				enableDep(e, depKey)
+				for _, d := range findDeps(e, depKey) {
+					requestFeature(d.pkg, depFeature)
+				}
+			default:
+				requestFeature(pkg, v)
+			}
+		}
+	}
+
+	for _, m := range ordered {
+		e := get(m.name)
+		for _, deps := range [][]manifestDep{m.deps, m.devDeps, m.buildDeps} {
+			for _, d := range deps {
+				if !d.optional {
+					enableDep(e, d.key)
+				}
+			}
+		}
+		if m.member {
+			requestFeature(m.name, "default")
+		}
+	}
+
+	// Apply the weak requests until nothing changes, as applying them may enable dependencies
+	// and add more weak requests.
+	applied := make(map[weakRequest]bool)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(weak); i++ {
+			w := weak[i]
+			if applied[w] || !w.e.deps[w.depKey] {
+				continue
+			}
+			applied[w] = true
+			changed = true
+			for _, d := range findDeps(w.e, w.depKey) {
+				requestFeature(d.pkg, w.feature)
+			}
+		}
+	}
+	return enabled
+}
+
+// requestDepFeatures requests the features that a dependency entry enables on its package.
+func requestDepFeatures(d manifestDep, requestFeature func(pkg, feature string)) {
+	if d.defaultFeatures {
+		requestFeature(d.pkg, "default")
+	}
+	for _, f := range d.features {
+		requestFeature(d.pkg, f)
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// crate is a local package of the Cargo workspace, which is converted to Android.bp modules.
+type crate struct {
+	Name    string
+	Version string
+	// Dir is the directory of the package, relative to the workspace root.
+	Dir     string
+	Edition string
+
+	Lib   *target
+	Tests []target
+
+	// Features are the resolved features of the package.
+	Features []string
+
+	Deps    []dep
+	DevDeps []dep
+
+	// BuildScript is the path of the build script relative to Dir, if the package has one.
+	BuildScript string
+	// UsesBindgen is true if the build script depends on bindgen.
+	UsesBindgen bool
+}
+
+// target is a library or test target of a package.
+type target struct {
+	// Name is the crate name of the target.
+	Name string
+	// Src is the crate root, relative to the directory of the package.
+	Src       string
+	Edition   string
+	ProcMacro bool
+	// Test is false if the unit tests of the library are disabled.
+	Test bool
+}
+
+// dep is a dependency of a package on the library of another package.
+type dep struct {
+	Package   string
+	CrateName string
+	// Alias is the name the dependency is renamed to, if any.
+	Alias     string
+	ProcMacro bool
+}
+
+// crateName returns the name of the crate for a package or target name.
+func crateName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func sortDeps(deps []dep) []dep {
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Package != deps[j].Package {
+			return deps[i].Package < deps[j].Package
+		}
+		return deps[i].Alias < deps[j].Alias
+	})
+	var ret []dep
+	for i, d := range deps {
+		if i == 0 || d != deps[i-1] {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// cfgMatches returns whether a target-specific dependency applies to Android and Linux hosts.
+// The target is either a target triple or a cfg() expression.
+func cfgMatches(spec string) (bool, error) {
+	spec = strings.TrimSpace(spec)
+	if !strings.HasPrefix(spec, "cfg(") {
+		return strings.Contains(spec, "linux") || strings.Contains(spec, "android"), nil
+	}
+	p := &cfgParser{s: spec}
+	v, err := p.parse()
+	if err != nil {
+		return false, fmt.Errorf("invalid target %q: %s", spec, err)
+	}
+	p.skipSpaces()
+	if p.pos != len(p.s) {
+		return false, fmt.Errorf("invalid target %q: trailing %q", spec, p.s[p.pos:])
+	}
+	return v, nil
+}
+
+// cfgValues are the cfg options set when building for both Android and Linux hosts.
+var cfgValues = map[string][]string{
+	"unix":          nil,
+	"target_family": {"unix"},
+	"target_os":     {"android", "linux"},
+	"target_env":    {"", "gnu", "musl"},
+}
+
+type cfgParser struct {
+	s   string
+	pos int
+}
+
+func (p *cfgParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *cfgParser) ident() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.s) && (isBareKeyChar(p.s[p.pos]) && p.s[p.pos] != '-') {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *cfgParser) consume(c byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *cfgParser) parse() (bool, error) {
+	name := p.ident()
+	if name == "" {
+		return false, fmt.Errorf("expected identifier at %d", p.pos)
+	}
+	switch name {
+	case "cfg", "not", "all", "any":
+		if !p.consume('(') {
+			return false, fmt.Errorf("expected '(' after %s", name)
+		}
+		var values []bool
+		for !p.consume(')') {
+			v, err := p.parse()
+			if err != nil {
+				return false, err
+			}
+			values = append(values, v)
+			p.consume(',')
+		}
+		switch name {
+		case "cfg", "not":
+			if len(values) != 1 {
+				return false, fmt.Errorf("%s() takes one argument", name)
+			}
+			return values[0] != (name == "not"), nil
+		case "all":
+			for _, v := range values {
+				if !v {
+					return false, nil
+				}
+			}
+			return true, nil
+		default:
+			for _, v := range values {
+				if v {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+
+	values, known := cfgValues[name]
+	if !p.consume('=') {
+		return known && values == nil, nil
+	}
+	p.skipSpaces()
+	if !p.consume('"') {
+		return false, fmt.Errorf("expected string at %d", p.pos)
+	}
+	end := strings.IndexByte(p.s[p.pos:], '"')
+	if end < 0 {
+		return false, fmt.Errorf("unterminated string")
+	}
+	value := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+	for _, v := range values {
+		if v == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// The subset of the output of cargo metadata --format-version 1 read by cargo2bp.
+type cargoMetadata struct {
+	Packages         []metadataPackage `json:"packages"`
+	WorkspaceMembers []string          `json:"workspace_members"`
+	WorkspaceRoot    string            `json:"workspace_root"`
+	Resolve          *struct {
+		Nodes []metadataNode `json:"nodes"`
+	} `json:"resolve"`
+}
+
+type metadataPackage struct {
+	ID           string               `json:"id"`
+	Name         string               `json:"name"`
+	Version      string               `json:"version"`
+	Source       *string              `json:"source"`
+	ManifestPath string               `json:"manifest_path"`
+	Edition      string               `json:"edition"`
+	Targets      []metadataTarget     `json:"targets"`
+	Dependencies []metadataDependency `json:"dependencies"`
+}
+
+type metadataTarget struct {
+	Name    string   `json:"name"`
+	Kind    []string `json:"kind"`
+	SrcPath string   `json:"src_path"`
+	Edition string   `json:"edition"`
+	Test    bool     `json:"test"`
+}
+
+type metadataDependency struct {
+	Name   string  `json:"name"`
+	Rename *string `json:"rename"`
+	Kind   *string `json:"kind"`
+}
+
+type metadataNode struct {
+	ID   string `json:"id"`
+	Deps []struct {
+		Name     string `json:"name"`
+		Pkg      string `json:"pkg"`
+		DepKinds []struct {
+			Kind   *string `json:"kind"`
+			Target *string `json:"target"`
+		} `json:"dep_kinds"`
+	} `json:"deps"`
+	Features []string `json:"features"`
+}
+
+func (t metadataTarget) hasKind(kinds ...string) bool {
+	for _, k := range t.Kind {
+		for _, kind := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *metadataPackage) lib() *metadataTarget {
+	for i, t := range p.Targets {
+		if t.hasKind("lib", "rlib", "dylib", "cdylib", "staticlib", "proc-macro") {
+			return &p.Targets[i]
+		}
+	}
+	return nil
+}
+
+// loadMetadata reads the output of cargo metadata and returns the local packages of the
+// workspace, i.e. the workspace members and the path dependencies in the workspace.
+func loadMetadata(r io.Reader) ([]*crate, error) {
+	var metadata cargoMetadata
+	if err := json.NewDecoder(r).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse cargo metadata: %s", err)
+	}
+	if metadata.Resolve == nil {
+		return nil, fmt.Errorf("cargo metadata has no dependency resolution, don't pass --no-deps")
+	}
+
+	packages := make(map[string]*metadataPackage)
+	for i := range metadata.Packages {
+		packages[metadata.Packages[i].ID] = &metadata.Packages[i]
+	}
+	members := make(map[string]bool)
+	for _, id := range metadata.WorkspaceMembers {
+		members[id] = true
+	}
+
+	var crates []*crate
+	for _, node := range metadata.Resolve.Nodes {
+		pkg := packages[node.ID]
+		if pkg == nil {
+			return nil, fmt.Errorf("unknown package %q in the dependency resolution", node.ID)
+		}
+		dir, err := filepath.Rel(metadata.WorkspaceRoot, filepath.Dir(pkg.ManifestPath))
+		if err != nil {
+			return nil, err
+		}
+		local := pkg.Source == nil && !strings.HasPrefix(dir, "..")
+		if !members[node.ID] && !local {
+			continue
+		}
+
+		c := &crate{
+			Name:     pkg.Name,
+			Version:  pkg.Version,
+			Dir:      dir,
+			Edition:  pkg.Edition,
+			Features: append([]string(nil), node.Features...),
+		}
+		pkgDir := filepath.Dir(pkg.ManifestPath)
+		for _, t := range pkg.Targets {
+			src, err := filepath.Rel(pkgDir, t.SrcPath)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case t.hasKind("custom-build"):
+				c.BuildScript = src
+			case t.hasKind("test"):
+				c.Tests = append(c.Tests, target{Name: crateName(t.Name), Src: src, Edition: t.Edition, Test: true})
+			case c.Lib == nil && t.hasKind("lib", "rlib", "dylib", "cdylib", "staticlib", "proc-macro"):
+				c.Lib = &target{
+					Name:      crateName(t.Name),
+					Src:       src,
+					Edition:   t.Edition,
+					ProcMacro: t.hasKind("proc-macro"),
+					Test:      t.Test,
+				}
+			}
+		}
+
+		renamed := make(map[string]bool)
+		for _, d := range pkg.Dependencies {
+			if d.Rename != nil {
+				renamed[crateName(*d.Rename)] = true
+			}
+		}
+		for _, nodeDep := range node.Deps {
+			depPkg := packages[nodeDep.Pkg]
+			if depPkg == nil {
+				return nil, fmt.Errorf("unknown dependency %q of %s", nodeDep.Pkg, pkg.Name)
+			}
+			depLib := depPkg.lib()
+			if depLib == nil {
+				continue
+			}
+			d := dep{
+				Package:   depPkg.Name,
+				CrateName: crateName(depLib.Name),
+				ProcMacro: depLib.hasKind("proc-macro"),
+			}
+			if renamed[nodeDep.Name] && nodeDep.Name != d.CrateName {
+				d.Alias = nodeDep.Name
+			}
+			for _, kind := range nodeDep.DepKinds {
+				if kind.Target != nil {
+					matches, err := cfgMatches(*kind.Target)
+					if err != nil {
+						return nil, err
+					}
+					if !matches {
+						continue
+					}
+				}
+				switch {
+				case kind.Kind == nil:
+					c.Deps = append(c.Deps, d)
+				case *kind.Kind == "dev":
+					c.DevDeps = append(c.DevDeps, d)
+				case *kind.Kind == "build":
+					if depPkg.Name == "bindgen" {
+						c.UsesBindgen = true
+					}
+				}
+			}
+		}
+		c.Deps = sortDeps(c.Deps)
+		c.DevDeps = sortDeps(c.DevDeps)
+		sort.Strings(c.Features)
+		crates = append(crates, c)
+	}
+	return crates, nil
+}
@@ -0,0 +1,496 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlTable is a TOML table. Values are strings, int64s, bools, []interface{} or tomlTables.
+// Floats and dates are kept as strings, Cargo manifests don't use them for anything cargo2bp
+// reads.
+type tomlTable map[string]interface{}
+
+// parseTOML parses the subset of TOML used by Cargo.toml and Cargo.lock files.
+func parseTOML(data string) (tomlTable, error) {
+	p := &tomlParser{s: data, line: 1}
+	root := tomlTable{}
+	current := root
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			current, err = p.parseHeader(root)
+		} else {
+			err = p.parseKeyValue(current)
+			if err == nil {
+				err = p.endOfLine()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *tomlParser) next() byte {
+	c := p.s[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpaces skips spaces, tabs and comments, but not newlines.
+func (p *tomlParser) skipSpaces() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// skipBlank skips spaces, comments and newlines.
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() != '\n' {
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpaces()
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q after value", p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *tomlParser) expect(c byte) error {
+	p.skipSpaces()
+	if p.peek() != c {
+		return p.errorf("expected %q, found %q", c, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+// parseHeader parses a [table] or [[array.of.tables]] header and returns the table that the
+// following keys are added to.
+func (p *tomlParser) parseHeader(root tomlTable) (tomlTable, error) {
+	p.next()
+	array := p.peek() == '['
+	if array {
+		p.next()
+	}
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	if array {
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.endOfLine(); err != nil {
+		return nil, err
+	}
+
+	table, err := p.subTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if array {
+		list, _ := table[last].([]interface{})
+		if _, exists := table[last]; exists && list == nil {
+			return nil, p.errorf("%q is not an array of tables", strings.Join(keys, "."))
+		}
+		t := tomlTable{}
+		table[last] = append(list, t)
+		return t, nil
+	}
+	return p.subTable(table, []string{last})
+}
+
+// subTable returns the table at the given keys, creating the missing ones. Arrays of tables
+// resolve to their last element.
+func (p *tomlParser) subTable(table tomlTable, keys []string) (tomlTable, error) {
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+			t := tomlTable{}
+			table[key] = t
+			table = t
+		case tomlTable:
+			table = v
+		case []interface{}:
+			t, ok := v[len(v)-1].(tomlTable)
+			if !ok {
+				return nil, p.errorf("%q is not a table", key)
+			}
+			table = t
+		default:
+			return nil, p.errorf("%q is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// parseKey parses a dotted key.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpaces()
+		var key string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case c == '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected key, found %q", p.peek())
+			}
+			key = p.s[start:p.pos]
+		}
+		keys = append(keys, key)
+		p.skipSpaces()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.next()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseKeyValue(table tomlTable) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	table, err = p.subTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return p.errorf("duplicate key %q", strings.Join(keys, "."))
+	}
+	table[last] = value
+	return nil
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	p.skipSpaces()
+	switch {
+	case strings.HasPrefix(p.s[p.pos:], `"""`):
+		return p.parseMultiLineString(`"""`, true)
+	case strings.HasPrefix(p.s[p.pos:], `'''`):
+		return p.parseMultiLineString(`'''`, false)
+	case p.peek() == '"':
+		return p.parseBasicString()
+	case p.peek() == '\'':
+		return p.parseLiteralString()
+	case p.peek() == '[':
+		return p.parseArray()
+	case p.peek() == '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	token := p.s[start:p.pos]
+	switch token {
+	case "":
+		return nil, p.errorf("expected value, found %q", p.peek())
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if i, err := strconv.ParseInt(strings.ReplaceAll(token, "_", ""), 0, 64); err == nil {
+		return i, nil
+	}
+	return token, nil
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.next()
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if err := p.parseEscape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder) error {
+	if p.eof() {
+		return p.errorf("unterminated escape")
+	}
+	c := p.next()
+	switch c {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil {
+			return p.errorf("invalid unicode escape %q", p.s[p.pos:p.pos+n])
+		}
+		p.pos += n
+		b.WriteRune(rune(r))
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.next()
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		if p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		p.pos++
+	}
+	if p.eof() {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.s[start:p.pos]
+	p.next()
+	return s, nil
+}
+
+func (p *tomlParser) parseMultiLineString(delim string, escapes bool) (string, error) {
+	p.pos += len(delim)
+	// A newline immediately following the opening delimiter is trimmed.
+	if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.next()
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.s[p.pos:], delim) {
+			p.pos += len(delim)
+			return b.String(), nil
+		}
+		c := p.next()
+		if escapes && c == '\\' {
+			// A line ending backslash trims the following whitespace.
+			if rest := strings.TrimLeft(p.s[p.pos:], " \t\r"); strings.HasPrefix(rest, "\n") {
+				for !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.peek())) {
+					p.next()
+				}
+				continue
+			}
+			if err := p.parseEscape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+}
+
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	p.next()
+	list := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.next()
+			return list, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array, found %q", p.peek())
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (tomlTable, error) {
+	p.next()
+	table := tomlTable{}
+	p.skipSpaces()
+	if p.peek() == '}' {
+		p.next()
+		return table, nil
+	}
+	for {
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+			p.next()
+			return table, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table, found %q", p.peek())
+		}
+	}
+}
+
+// Helpers for reading values out of tables, returning the zero value if the key is missing or
+// has another type.
+
+func (t tomlTable) table(key string) tomlTable {
+	v, _ := t[key].(tomlTable)
+	return v
+}
+
+func (t tomlTable) tables(key string) []tomlTable {
+	list, _ := t[key].([]interface{})
+	var tables []tomlTable
+	for _, v := range list {
+		if table, ok := v.(tomlTable); ok {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+func (t tomlTable) str(key string) string {
+	v, _ := t[key].(string)
+	return v
+}
+
+func (t tomlTable) boolean(key string, def bool) bool {
+	if v, ok := t[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (t tomlTable) strs(key string) []string {
+	list, _ := t[key].([]interface{})
+	var strs []string
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
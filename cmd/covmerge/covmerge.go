@@ -0,0 +1,315 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// covmerge turns the .profraw files written by host tests built with NATIVE_COVERAGE into lcov
+// and HTML coverage reports. It merges the .profraw files found in the given directories with
+// llvm-profdata, then runs llvm-cov on the unstripped coverage binaries listed in the binaries
+// file. The reports can be restricted to the sources of a set of modules.
+//
+// The binaries file has one line per binary, with the module name, the module directory and the
+// path of the unstripped binary separated by tabs. It is written by the native_coverage_report
+// singleton in Soong.
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type multiString []string
+
+func (m *multiString) String() string     { return strings.Join(*m, ", ") }
+func (m *multiString) Set(s string) error { *m = append(*m, s); return nil }
+
+var (
+	llvmProfdata = flag.String("llvm_profdata", "llvm-profdata", "path to llvm-profdata")
+	llvmCov      = flag.String("llvm_cov", "llvm-cov", "path to llvm-cov")
+	binariesFile = flag.String("binaries", "", "file listing the module, directory and path of each coverage binary")
+	modules      = flag.String("modules", "", "comma separated list of modules to restrict the reports to")
+	lcovFile     = flag.String("lcov", "", "output lcov file")
+	htmlZip      = flag.String("html", "", "output zip file of the HTML report")
+	depFile      = flag.String("d", "", "output depfile listing the .profraw files and directories")
+
+	profrawDirs multiString
+)
+
+func init() {
+	flag.Var(&profrawDirs, "profraw_dir", "directory to search for .profraw files, may be repeated")
+}
+
+// binary is a coverage binary built by a module.
+type binary struct {
+	module string
+	dir    string
+	path   string
+}
+
+// parseBinaries parses the binaries file written by Soong.
+func parseBinaries(r io.Reader) ([]binary, error) {
+	var binaries []binary
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected 3 tab separated fields, got %q", line, text)
+		}
+		binaries = append(binaries, binary{module: fields[0], dir: fields[1], path: fields[2]})
+	}
+	return binaries, scanner.Err()
+}
+
+// sourceFilters returns the directories of the given modules, which restrict the reports to
+// the sources of the modules. It returns nil if no module is given, and an error if one of the
+// modules didn't build a coverage binary.
+func sourceFilters(binaries []binary, moduleList []string) ([]string, error) {
+	if len(moduleList) == 0 {
+		return nil, nil
+	}
+	dirs := make(map[string]string)
+	for _, b := range binaries {
+		dirs[b.module] = b.dir
+	}
+	var filters []string
+	seen := make(map[string]bool)
+	for _, m := range moduleList {
+		dir, ok := dirs[m]
+		if !ok {
+			return nil, fmt.Errorf("module %q has no host coverage binary", m)
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			filters = append(filters, dir)
+		}
+	}
+	sort.Strings(filters)
+	return filters, nil
+}
+
+// findProfraws returns the .profraw files in the given directories and their subdirectories,
+// and the directories that were searched. A missing directory is replaced by its nearest existing
+// parent in the returned directories, so that creating it later reruns the report.
+func findProfraws(roots []string) (files, dirs []string, err error) {
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					if parent := existingParent(root); parent != "" {
+						dirs = append(dirs, parent)
+					}
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				dirs = append(dirs, path)
+			} else if strings.HasSuffix(path, ".profraw") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, dirs, nil
+}
+
+// existingParent returns the nearest parent of path that exists, or "" if there is none.
+func existingParent(path string) string {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return ""
+		}
+	}
+}
+
+// objectArgs returns the arguments that pass the existing binaries to llvm-cov. The first binary
+// is passed as a positional argument and the others with -object.
+func objectArgs(binaries []binary) []string {
+	var args []string
+	for _, b := range binaries {
+		if _, err := os.Stat(b.path); err != nil {
+			continue
+		}
+		if len(args) > 0 {
+			args = append(args, "-object")
+		}
+		args = append(args, b.path)
+	}
+	return args
+}
+
+func run(name string, args []string, stdout io.Writer) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %s\n%s", filepath.Base(name), err, stderr.String())
+	}
+	return nil
+}
+
+// zipDir writes the files in dir to a zip file, with paths relative to dir.
+func zipDir(dir, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		entry, err := w.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func writeDepFile(out string, target string, deps []string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:", target)
+	for _, dep := range deps {
+		fmt.Fprintf(&buf, " \\\n  %s", strings.ReplaceAll(dep, " ", "\\ "))
+	}
+	buf.WriteString("\n")
+	return os.WriteFile(out, buf.Bytes(), 0666)
+}
+
+func covmerge() error {
+	f, err := os.Open(*binariesFile)
+	if err != nil {
+		return err
+	}
+	binaries, err := parseBinaries(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s", *binariesFile, err)
+	}
+
+	var moduleList []string
+	if *modules != "" {
+		moduleList = strings.Split(*modules, ",")
+	}
+	filters, err := sourceFilters(binaries, moduleList)
+	if err != nil {
+		return err
+	}
+
+	profraws, dirs, err := findProfraws(profrawDirs)
+	if err != nil {
+		return err
+	}
+	if *depFile != "" {
+		// The directories are dependencies too so that new .profraw files rerun the report.
+		if err := writeDepFile(*depFile, *lcovFile, append(append([]string(nil), dirs...), profraws...)); err != nil {
+			return err
+		}
+	}
+	if len(profraws) == 0 {
+		return fmt.Errorf("no .profraw files found in %s; run the host tests with "+
+			"LLVM_PROFILE_FILE set to a file in one of these directories", profrawDirs.String())
+	}
+
+	objects := objectArgs(binaries)
+	if len(objects) == 0 {
+		return fmt.Errorf("none of the coverage binaries in %s exist", *binariesFile)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "covmerge")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	profdata := filepath.Join(tmpDir, "merged.profdata")
+	if err := run(*llvmProfdata, append([]string{"merge", "-sparse", "-o", profdata}, profraws...), nil); err != nil {
+		return err
+	}
+
+	covArgs := append([]string{"-instr-profile=" + profdata}, objects...)
+	covArgs = append(covArgs, filters...)
+
+	if *lcovFile != "" {
+		var lcov bytes.Buffer
+		if err := run(*llvmCov, append([]string{"export", "-format=lcov"}, covArgs...), &lcov); err != nil {
+			return err
+		}
+		if err := os.WriteFile(*lcovFile, lcov.Bytes(), 0666); err != nil {
+			return err
+		}
+	}
+
+	if *htmlZip != "" {
+		htmlDir := filepath.Join(tmpDir, "html")
+		if err := run(*llvmCov, append([]string{"show", "-format=html", "-output-dir=" + htmlDir}, covArgs...), nil); err != nil {
+			return err
+		}
+		if err := zipDir(htmlDir, *htmlZip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *binariesFile == "" || len(profrawDirs) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: covmerge -binaries <file> -profraw_dir <dir> [-modules <list>] [-lcov <file>] [-html <zip>]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if err := covmerge(); err != nil {
+		fmt.Fprintln(os.Stderr, "covmerge:", err)
+		os.Exit(1)
+	}
+}
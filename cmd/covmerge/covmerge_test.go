@@ -0,0 +1,117 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBinaries(t *testing.T) {
+	input := "foo\tpath/to/foo\tout/foo/foo\n" +
+		"\n" +
+		"libbar\tpath/to/bar\tout/bar/libbar.so\n"
+	got, err := parseBinaries(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []binary{
+		{"foo", "path/to/foo", "out/foo/foo"},
+		{"libbar", "path/to/bar", "out/bar/libbar.so"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBinaries() = %v, want %v", got, want)
+	}
+
+	if _, err := parseBinaries(strings.NewReader("foo out/foo\n")); err == nil {
+		t.Errorf("expected an error for a malformed line")
+	}
+}
+
+func TestSourceFilters(t *testing.T) {
+	binaries := []binary{
+		{"foo", "path/to/foo", "out/foo"},
+		{"foo_test", "path/to/foo", "out/foo_test"},
+		{"libbar", "path/to/bar", "out/libbar.so"},
+	}
+
+	got, err := sourceFilters(binaries, nil)
+	if err != nil || got != nil {
+		t.Errorf("sourceFilters(nil) = %q, %v, want no filters", got, err)
+	}
+
+	got, err = sourceFilters(binaries, []string{"libbar", "foo", "foo_test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"path/to/bar", "path/to/foo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sourceFilters() = %q, want %q", got, want)
+	}
+
+	if _, err := sourceFilters(binaries, []string{"libbaz"}); err == nil {
+		t.Errorf("expected an error for a module without a coverage binary")
+	}
+}
+
+func TestFindProfraws(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.profraw", "sub/b.profraw", "sub/c.txt"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	other := t.TempDir()
+	files, dirs, err := findProfraws([]string{dir, filepath.Join(other, "missing/profraw")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{filepath.Join(dir, "a.profraw"), filepath.Join(dir, "sub/b.profraw")}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("files = %q, want %q", files, wantFiles)
+	}
+	// The missing directory is tracked through its nearest existing parent.
+	wantDirs := []string{dir, filepath.Join(dir, "sub"), other}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("dirs = %q, want %q", dirs, wantDirs)
+	}
+}
+
+func TestObjectArgs(t *testing.T) {
+	dir := t.TempDir()
+	foo := filepath.Join(dir, "foo")
+	bar := filepath.Join(dir, "libbar.so")
+	for _, f := range []string{foo, bar} {
+		if err := os.WriteFile(f, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := objectArgs([]binary{
+		{"foo", "foo", foo},
+		{"missing", "missing", filepath.Join(dir, "missing")},
+		{"libbar", "bar", bar},
+	})
+	if want := []string{foo, "-object", bar}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objectArgs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gen_python_aconfig_library generates the Python module of a
+// python_aconfig_library from the flags of an aconfig_declarations module,
+// dumped with:
+//
+//	aconfig dump-cache --format='{package} {name} {namespace} {state:bool} {permission}'
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+type aconfigFlag struct {
+	Package   string
+	Name      string
+	Namespace string
+	Enabled   bool
+	ReadOnly  bool
+}
+
+// Constant returns the name of the constant holding the fully qualified name
+// of the flag, following the FLAG_ constants of the Java flag libraries.
+func (f aconfigFlag) Constant() string {
+	return "FLAG_" + strings.ToUpper(f.Name)
+}
+
+func (f aconfigFlag) FullyQualifiedName() string {
+	return f.Package + "." + f.Name
+}
+
+// Default returns the value of the flag as a Python literal.
+func (f aconfigFlag) Default() string {
+	if f.Enabled {
+		return "True"
+	}
+	return "False"
+}
+
+func readFlags(r io.Reader) ([]aconfigFlag, error) {
+	var ret []aconfigFlag
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid line %q, expected <package> <name> <namespace> <state> <permission>", scanner.Text())
+		}
+		ret = append(ret, aconfigFlag{
+			Package:   fields[0],
+			Name:      fields[1],
+			Namespace: fields[2],
+			Enabled:   fields[3] == "true",
+			ReadOnly:  strings.EqualFold(fields[4], "READ_ONLY"),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) > 0 {
+		for _, f := range ret[1:] {
+			if f.Package != ret[0].Package {
+				return nil, fmt.Errorf("flags of more than one package: %s and %s", ret[0].Package, f.Package)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+type templateData struct {
+	Package string
+	Mode    string
+	Flags   []aconfigFlag
+}
+
+// ReadAtRuntime returns whether the accessor of the flag reads its value from
+// the device config rather than returning a constant.
+func (d templateData) ReadAtRuntime(f aconfigFlag) bool {
+	switch d.Mode {
+	case "force-read-only":
+		return false
+	case "exported":
+		return true
+	}
+	return !f.ReadOnly
+}
+
+func (d templateData) Test() bool {
+	return d.Mode == "test"
+}
+
+func (d templateData) HasRuntimeFlags() bool {
+	for _, f := range d.Flags {
+		if d.ReadAtRuntime(f) {
+			return true
+		}
+	}
+	return false
+}
+
+var pythonTemplate = template.Must(template.New("python").Parse(
+	`# This file is generated by gen_python_aconfig_library. Do not edit.
+"""Flags of the {{.Package}} aconfig package, in {{.Mode}} mode."""
+{{- if .HasRuntimeFlags}}
+
+import functools
+import subprocess
+{{- end}}
+{{range .Flags}}
+{{.Constant}} = "{{.FullyQualifiedName}}"
+{{- end}}
+{{- if .HasRuntimeFlags}}
+
+
+@functools.cache
+def _read_flag(namespace: str, name: str, default: bool) -> bool:
+  """Returns the value of a flag in the device config, or its default value."""
+  prop = f"persist.device_config.aconfig_flags.{namespace}.{{.Package}}.{name}"
+  try:
+    value = subprocess.run(["getprop", prop], capture_output=True, text=True,
+                           check=True).stdout.strip()
+  except (OSError, subprocess.CalledProcessError):
+    # Not running on a device.
+    return default
+  if value in ("true", "false"):
+    return value == "true"
+  return default
+{{- end}}
+{{- if .Test}}
+
+
+_overrides: dict[str, bool] = {}
+
+
+def _flag_name(name: str) -> str:
+  name = name.removeprefix("{{.Package}}.")
+  if name not in { {{- range $i, $f := .Flags}}{{if $i}}, {{end}}"{{$f.Name}}"{{end -}} }:
+    raise KeyError(f"{name} is not a flag of {{.Package}}")
+  return name
+
+
+def set_flag(name: str, value: bool) -> None:
+  """Overrides the value of a flag, given its name or fully qualified name."""
+  _overrides[_flag_name(name)] = value
+
+
+def reset_flags() -> None:
+  """Removes all of the overrides set by set_flag."""
+  _overrides.clear()
+{{- end}}
+{{- range .Flags}}
+
+
+def {{.Name}}() -> bool:
+  """Returns the value of {{.FullyQualifiedName}}."""
+{{- if $.Test}}
+  if "{{.Name}}" in _overrides:
+    return _overrides["{{.Name}}"]
+{{- end}}
+{{- if $.ReadAtRuntime .}}
+  return _read_flag("{{.Namespace}}", "{{.Name}}", {{.Default}})
+{{- else}}
+  return {{.Default}}
+{{- end}}
+{{- end}}
+`))
+
+func generate(w io.Writer, mode string, flags []aconfigFlag) error {
+	data := templateData{Mode: mode, Flags: flags}
+	if len(flags) > 0 {
+		data.Package = flags[0].Package
+	}
+	return pythonTemplate.Execute(w, data)
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+
+	mode := flags.String("mode", "production", "production, test, exported or force-read-only")
+	flagsFile := flags.String("flags", "", "dump of the flags of the aconfig_declarations module")
+	out := flags.String("o", "", "output Python file")
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 0 || *flagsFile == "" || *out == "" {
+		fmt.Fprintf(os.Stderr, "usage: gen_python_aconfig_library --mode <mode> --flags <file> -o <file>\n")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(*flagsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer f.Close()
+	aconfigFlags, err := readFlags(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %s\n", *flagsFile, err.Error())
+		os.Exit(1)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := generate(buf, *mode, aconfigFlags); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0666); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
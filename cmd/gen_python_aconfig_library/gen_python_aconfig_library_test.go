@@ -0,0 +1,119 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testFlags = `
+com.example.package rw_flag ns false READ_WRITE
+com.example.package ro_flag ns true READ_ONLY
+`
+
+func mustGenerate(t *testing.T, mode string) string {
+	t.Helper()
+	flags, err := readFlags(strings.NewReader(testFlags))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &strings.Builder{}
+	if err := generate(out, mode, flags); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestReadFlags(t *testing.T) {
+	flags, err := readFlags(strings.NewReader(testFlags))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []aconfigFlag{
+		{Package: "com.example.package", Name: "ro_flag", Namespace: "ns", Enabled: true, ReadOnly: true},
+		{Package: "com.example.package", Name: "rw_flag", Namespace: "ns", Enabled: false, ReadOnly: false},
+	}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Errorf("expected %v, got %v", expected, flags)
+	}
+
+	if _, err := readFlags(strings.NewReader("com.example.package ro_flag ns true\n")); err == nil {
+		t.Errorf("expected an error for a line without a permission")
+	}
+	if _, err := readFlags(strings.NewReader("com.a a ns true READ_ONLY\ncom.b b ns true READ_ONLY\n")); err == nil {
+		t.Errorf("expected an error for flags of more than one package")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	testCases := []struct {
+		mode        string
+		contains    []string
+		notContains []string
+	}{
+		{
+			mode: "production",
+			contains: []string{
+				`FLAG_RO_FLAG = "com.example.package.ro_flag"`,
+				"def ro_flag() -> bool:\n  \"\"\"Returns the value of com.example.package.ro_flag.\"\"\"\n  return True\n",
+				`return _read_flag("ns", "rw_flag", False)`,
+				"persist.device_config.aconfig_flags.{namespace}.com.example.package.{name}",
+			},
+			notContains: []string{"def set_flag", "_overrides"},
+		},
+		{
+			mode: "test",
+			contains: []string{
+				"def set_flag(name: str, value: bool) -> None:",
+				"def reset_flags() -> None:",
+				`if name not in {"ro_flag", "rw_flag"}:`,
+				"  if \"ro_flag\" in _overrides:\n    return _overrides[\"ro_flag\"]\n  return True\n",
+			},
+		},
+		{
+			mode: "exported",
+			contains: []string{
+				`return _read_flag("ns", "ro_flag", True)`,
+				`return _read_flag("ns", "rw_flag", False)`,
+			},
+			notContains: []string{"def set_flag"},
+		},
+		{
+			mode: "force-read-only",
+			contains: []string{
+				"  return True\n",
+				"  return False\n",
+			},
+			notContains: []string{"_read_flag", "import subprocess", "def set_flag"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			out := mustGenerate(t, tc.mode)
+			for _, s := range tc.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("expected output to contain %q, got:\n%s", s, out)
+				}
+			}
+			for _, s := range tc.notContains {
+				if strings.Contains(out, s) {
+					t.Errorf("expected output not to contain %q, got:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"android/soong/compliance/license_graph"
+)
+
+// The subset of the CycloneDX 1.5 JSON schema written by gen_sbom.
+type cdxBom struct {
+	BomFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string         `json:"type"`
+	BomRef     string         `json:"bom-ref,omitempty"`
+	Name       string         `json:"name"`
+	Scope      string         `json:"scope,omitempty"`
+	Hashes     []cdxHash      `json:"hashes,omitempty"`
+	Licenses   []cdxLicense   `json:"licenses,omitempty"`
+	Properties []cdxProperty  `json:"properties,omitempty"`
+	Components []cdxComponent `json:"components,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cdxSerialNumber formats a digest of the SBOM as a UUID URN, so that the
+// serial number is reproducible.
+func cdxSerialNumber(s *sbom) string {
+	h := s.hash()
+	return fmt.Sprintf("urn:uuid:%s-%s-5%s-8%s-%s", h[0:8], h[8:12], h[13:16], h[17:20], h[20:32])
+}
+
+func cdxPackageComponent(s *sbom, p *sbomPackage, toolchains map[*sbomPackage]bool) cdxComponent {
+	c := cdxComponent{
+		Type:   "library",
+		BomRef: p.id,
+		Name:   p.name,
+	}
+	if p.metadata.GetIsContainer() {
+		c.Type = "application"
+	}
+	if p == s.root {
+		c.Type = "firmware"
+	}
+	if toolchains[p] {
+		c.Scope = "excluded"
+	}
+	if expression := p.licenseExpression(); expression != "" {
+		c.Licenses = []cdxLicense{{Expression: expression}}
+	}
+	if conditions := p.metadata.GetLicenseConditions(); len(conditions) > 0 {
+		c.Properties = append(c.Properties, cdxProperty{Name: "android:license_conditions", Value: strings.Join(conditions, ",")})
+	}
+	if projects := p.metadata.GetProjects(); len(projects) > 0 {
+		c.Properties = append(c.Properties, cdxProperty{Name: "android:projects", Value: strings.Join(projects, ",")})
+	}
+	if moduleTypes := p.metadata.GetModuleTypes(); len(moduleTypes) > 0 {
+		c.Properties = append(c.Properties, cdxProperty{Name: "android:module_types", Value: strings.Join(moduleTypes, ",")})
+	}
+	for _, f := range p.files {
+		c.Components = append(c.Components, cdxComponent{
+			Type:   "file",
+			BomRef: f.id,
+			Name:   f.containerPath,
+			Hashes: []cdxHash{
+				{Alg: "SHA-1", Content: f.sha1},
+				{Alg: "SHA-256", Content: f.sha256},
+			},
+		})
+	}
+	return c
+}
+
+// generateCycloneDX converts the license metadata graph into a CycloneDX 1.5
+// BOM. Files are nested inside the component that built them.
+func generateCycloneDX(s *sbom) *cdxBom {
+	// Packages that are only used as toolchains are marked as excluded from
+	// the container.
+	toolchains := make(map[*sbomPackage]bool)
+	for _, p := range s.packages {
+		for _, d := range p.deps {
+			if d.linkage == license_graph.LinkageToolchain {
+				toolchains[d.dep] = true
+			}
+		}
+	}
+	for _, p := range s.packages {
+		for _, d := range p.deps {
+			if d.linkage != license_graph.LinkageToolchain {
+				delete(toolchains, d.dep)
+			}
+		}
+	}
+
+	bom := &cdxBom{
+		BomFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: cdxSerialNumber(s),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: sbomTimestamp,
+			Tools: cdxTools{Components: []cdxComponent{{
+				Type: "application",
+				Name: "gen_sbom",
+			}}},
+			Component: cdxPackageComponent(s, s.root, toolchains),
+		},
+		Components: []cdxComponent{},
+	}
+	bom.Metadata.Component.Name = s.product
+
+	for _, p := range s.packages {
+		if p != s.root {
+			bom.Components = append(bom.Components, cdxPackageComponent(s, p, toolchains))
+		}
+		dependsOn := []string{}
+		for _, d := range p.deps {
+			dependsOn = append(dependsOn, d.dep.id)
+		}
+		bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: p.id, DependsOn: dependsOn})
+	}
+	return bom
+}
@@ -0,0 +1,353 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gen_sbom generates SPDX and CycloneDX software bills of materials for a
+// container (system image, APEX, APK, ...) from the license metadata files
+// written by build_license_metadata.
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"android/soong/compliance/license_graph"
+	"android/soong/compliance/license_metadata_proto"
+)
+
+func newMultiString(flags *flag.FlagSet, name, usage string) *multiString {
+	var f multiString
+	flags.Var(&f, name, usage)
+	return &f
+}
+
+type multiString []string
+
+func (ms *multiString) String() string     { return strings.Join(*ms, ", ") }
+func (ms *multiString) Set(s string) error { *ms = append(*ms, s); return nil }
+
+// sbomPackage is a module, identified by its license metadata file.
+type sbomPackage struct {
+	metadataFile string
+	metadata     *license_metadata_proto.LicenseMetadata
+
+	// name is the module name, falling back to the package name.
+	name string
+
+	// id is unique within the SBOM, and safe to use in SPDX identifiers.
+	id string
+
+	deps []*sbomDependency
+
+	// files lists the container files built by this package.
+	files []*sbomFile
+}
+
+// sbomDependency is an edge in the license metadata graph.
+type sbomDependency struct {
+	dep     *sbomPackage
+	linkage license_graph.Linkage
+}
+
+// sbomFile is a file inside the container.
+type sbomFile struct {
+	// hostPath is the path of the file in the build tree.
+	hostPath string
+
+	// containerPath is the absolute path of the file inside the container.
+	containerPath string
+
+	id     string
+	sha1   string
+	sha256 string
+
+	// owner is the package that built the file, or the container itself if
+	// it can't be determined.
+	owner *sbomPackage
+}
+
+// sbom is the license metadata graph of a container.
+type sbom struct {
+	product string
+	root    *sbomPackage
+
+	// packages lists every package, starting with root and then sorted by
+	// metadata file.
+	packages []*sbomPackage
+
+	// files lists the files in the container sorted by container path.
+	files []*sbomFile
+
+	// inputs lists every file read, for the depfile.
+	inputs []string
+}
+
+// hash returns a digest of the contents of the SBOM that can be used to build
+// unique but reproducible document identifiers.
+func (s *sbom) hash() string {
+	h := sha256.New()
+	fmt.Fprintln(h, s.product)
+	for _, p := range s.packages {
+		fmt.Fprintln(h, p.metadataFile)
+	}
+	for _, f := range s.files {
+		fmt.Fprintln(h, f.containerPath, f.sha256)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var idUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// uniqueIds hands out identifiers containing only the characters that are
+// allowed in SPDX identifiers.
+type uniqueIds map[string]bool
+
+func (ids uniqueIds) get(name string) string {
+	id := strings.Trim(idUnsafeChars.ReplaceAllString(name, "-"), "-")
+	if id == "" {
+		id = "unnamed"
+	}
+	ret := id
+	for i := 2; ids[ret]; i++ {
+		ret = fmt.Sprintf("%s-%d", id, i)
+	}
+	ids[ret] = true
+	return ret
+}
+
+// readSbom walks the license metadata graph starting at the container's
+// license metadata file rootFile.
+func readSbom(rootFile, product string, stripPrefix []string) (*sbom, error) {
+	g, err := license_graph.ReadGraph(rootFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &sbom{product: product, inputs: g.Inputs}
+
+	packages := make(map[*license_graph.Node]*sbomPackage)
+	get := func(n *license_graph.Node) *sbomPackage {
+		if p, ok := packages[n]; ok {
+			return p
+		}
+		p := &sbomPackage{
+			metadataFile: n.File,
+			metadata:     n.Metadata,
+			name:         n.Name(),
+		}
+		packages[n] = p
+		return p
+	}
+
+	// The packages are the modules in the container and the toolchains used
+	// to build them, but not the dependencies of the toolchains.
+	root := get(g.Root)
+	s.root = root
+	for _, n := range g.InContainer() {
+		p := get(n)
+		for _, e := range n.Deps {
+			p.deps = append(p.deps, &sbomDependency{dep: get(e.Dep), linkage: e.Linkage})
+		}
+	}
+
+	for _, p := range packages {
+		if p != root {
+			s.packages = append(s.packages, p)
+		}
+	}
+	sort.Slice(s.packages, func(i, j int) bool {
+		return s.packages[i].metadataFile < s.packages[j].metadataFile
+	})
+	s.packages = append([]*sbomPackage{root}, s.packages...)
+
+	ids := make(uniqueIds)
+	owners := make(map[string]*sbomPackage)
+	for _, p := range s.packages {
+		p.id = ids.get(p.name)
+		if p == root {
+			continue
+		}
+		for _, path := range slices.Concat(p.metadata.GetInstalled(), p.metadata.GetBuilt()) {
+			if _, ok := owners[path]; !ok {
+				owners[path] = p
+			}
+		}
+	}
+
+	installMap := make(map[string]string)
+	for _, m := range root.metadata.GetInstallMap() {
+		installMap[m.GetFromPath()] = m.GetContainerPath()
+	}
+
+	// The files in a container are its sources, anything else (e.g. an APK)
+	// is described by the files it builds.
+	sources := root.metadata.GetSources()
+	if !root.metadata.GetIsContainer() {
+		sources = root.metadata.GetBuilt()
+	}
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, fmt.Errorf("error reading container file: %w", err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		f := &sbomFile{
+			hostPath:      source,
+			containerPath: containerPath(source, installMap, stripPrefix),
+			owner:         owners[source],
+		}
+		if f.owner == nil {
+			f.owner = root
+		}
+		if f.sha1, f.sha256, err = hashFile(source); err != nil {
+			return nil, err
+		}
+		s.inputs = append(s.inputs, source)
+		s.files = append(s.files, f)
+	}
+	sort.Slice(s.files, func(i, j int) bool {
+		return s.files[i].containerPath < s.files[j].containerPath
+	})
+	for _, f := range s.files {
+		f.id = ids.get("File" + f.containerPath)
+		f.owner.files = append(f.owner.files, f)
+	}
+
+	return s, nil
+}
+
+// containerPath returns the absolute path of a file inside the container,
+// using the container's install map if it has one and the longest matching
+// prefix to strip otherwise.
+func containerPath(path string, installMap map[string]string, stripPrefix []string) string {
+	if p, ok := installMap[path]; ok {
+		path = p
+	} else {
+		longest := ""
+		for _, prefix := range stripPrefix {
+			if strings.HasPrefix(path, prefix) && len(prefix) > len(longest) {
+				longest = prefix
+			}
+		}
+		path = strings.TrimPrefix(path, longest)
+	}
+	return "/" + strings.TrimPrefix(path, "/")
+}
+
+func hashFile(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	h1 := sha1.New()
+	h256 := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), f); err != nil {
+		return "", "", fmt.Errorf("error hashing %q: %w", path, err)
+	}
+	return hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h256.Sum(nil)), nil
+}
+
+// licenseId converts a license kind into an SPDX license identifier. Kinds
+// that are not SPDX licenses become LicenseRefs.
+func licenseId(kind string) string {
+	if id, ok := strings.CutPrefix(kind, "SPDX-license-identifier-"); ok {
+		return id
+	}
+	return "LicenseRef-" + strings.Trim(idUnsafeChars.ReplaceAllString(kind, "-"), "-")
+}
+
+// licenseExpression returns the license expression for a package, or an
+// empty string if it has no license kinds.
+func (p *sbomPackage) licenseExpression() string {
+	var ids []string
+	for _, kind := range p.metadata.GetLicenseKinds() {
+		ids = append(ids, licenseId(kind))
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, " AND ")
+}
+
+func writeJson(file string, v any) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(buf, '\n'), 0666)
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+
+	spdxOut := flags.String("spdx", "", "output SPDX 2.3 JSON file")
+	cyclonedxOut := flags.String("cyclonedx", "", "output CycloneDX 1.5 JSON file")
+	depFile := flags.String("d", "", "output depfile")
+	product := flags.String("product", "", "name of the container")
+	stripPrefix := newMultiString(flags, "strip_prefix", "prefix to remove from paths to get the path inside the container")
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 || (*spdxOut == "" && *cyclonedxOut == "") {
+		fmt.Fprintf(os.Stderr, "usage: gen_sbom [--spdx file] [--cyclonedx file] [options] <container license metadata>\n")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	s, err := readSbom(flags.Arg(0), *product, *stripPrefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if s.product == "" {
+		s.product = s.root.name
+	}
+
+	target := *spdxOut
+	if *spdxOut != "" {
+		if err := writeJson(*spdxOut, generateSpdx(s)); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing %q: %s\n", *spdxOut, err.Error())
+			os.Exit(2)
+		}
+	}
+	if *cyclonedxOut != "" {
+		if err := writeJson(*cyclonedxOut, generateCycloneDX(s)); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing %q: %s\n", *cyclonedxOut, err.Error())
+			os.Exit(2)
+		}
+		if target == "" {
+			target = *cyclonedxOut
+		}
+	}
+	if *depFile != "" {
+		if err := license_graph.WriteDepFile(*depFile, target, s.inputs); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing %q: %s\n", *depFile, err.Error())
+			os.Exit(2)
+		}
+	}
+}
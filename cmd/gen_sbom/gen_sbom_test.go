@@ -0,0 +1,209 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestFiles writes the files relative to a temporary directory, and
+// changes into it.
+func writeTestFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+var testSbomFiles = map[string]string{
+	"img/meta_lic": `
+		module_name: "system_image"
+		license_kinds: "SPDX-license-identifier-Apache-2.0"
+		is_container: true
+		sources: "out/target/product/test/system/bin/foo"
+		sources: "out/target/product/test/system/lib64/libbar.so"
+		deps { file: "foo/meta_lic" }
+		deps { file: "libbar/meta_lic" }
+		deps { file: "libbaz/meta_lic" }
+	`,
+	"foo/meta_lic": `
+		module_name: "foo"
+		projects: "vendor/foo"
+		license_kinds: "SPDX-license-identifier-MIT"
+		license_kinds: "legacy_notice"
+		license_conditions: "notice"
+		installed: "out/target/product/test/system/bin/foo"
+		deps { file: "libbar/meta_lic" annotations: "dynamic" }
+		deps { file: "libbaz/meta_lic" }
+		deps { file: "clang/meta_lic" annotations: "toolchain" }
+	`,
+	"libbar/meta_lic": `
+		module_name: "libbar"
+		license_kinds: "SPDX-license-identifier-Apache-2.0"
+		installed: "out/target/product/test/system/lib64/libbar.so"
+	`,
+	"libbaz/meta_lic": `
+		module_name: "libbaz"
+		built: "out/soong/libbaz.a"
+	`,
+	"clang/meta_lic": `
+		module_name: "clang"
+		deps { file: "llvm/meta_lic" }
+	`,
+	"llvm/meta_lic": `
+		module_name: "llvm"
+	`,
+	"out/target/product/test/system/bin/foo":         "foo",
+	"out/target/product/test/system/lib64/libbar.so": "bar",
+}
+
+func TestSpdx(t *testing.T) {
+	writeTestFiles(t, testSbomFiles)
+	s, err := readSbom("img/meta_lic", "", []string{"out/target/product/test/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.product = "test_product"
+	doc := generateSpdx(s)
+
+	var names []string
+	for _, p := range doc.Packages {
+		names = append(names, p.Name)
+	}
+	// llvm is only used by the toolchain, so it is not included.
+	if expected := []string{"system_image", "clang", "foo", "libbar", "libbaz"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected packages %q, got %q", expected, names)
+	}
+	if expected := "LicenseRef-legacy-notice AND MIT"; doc.Packages[2].LicenseDeclared != expected {
+		t.Errorf("expected license %q, got %q", expected, doc.Packages[2].LicenseDeclared)
+	}
+	if expected := spdxNoAssertion; doc.Packages[4].LicenseDeclared != expected {
+		t.Errorf("expected license %q, got %q", expected, doc.Packages[4].LicenseDeclared)
+	}
+	if len(doc.ExtractedLicenses) != 1 || doc.ExtractedLicenses[0].LicenseId != "LicenseRef-legacy-notice" {
+		t.Errorf("expected LicenseRef-legacy-notice to be extracted, got %v", doc.ExtractedLicenses)
+	}
+
+	if len(doc.Files) != 2 {
+		t.Fatalf("expected 2 files, got %v", doc.Files)
+	}
+	foo := doc.Files[0]
+	if foo.FileName != "./system/bin/foo" {
+		t.Errorf("expected ./system/bin/foo, got %q", foo.FileName)
+	}
+	expectedChecksums := []spdxChecksum{
+		{Algorithm: "SHA1", ChecksumValue: "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"},
+		{Algorithm: "SHA256", ChecksumValue: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+	}
+	if !reflect.DeepEqual(foo.Checksums, expectedChecksums) {
+		t.Errorf("expected checksums %v, got %v", expectedChecksums, foo.Checksums)
+	}
+
+	relationships := make(map[spdxRelationship]bool)
+	for _, r := range doc.Relationships {
+		relationships[r] = true
+	}
+	for _, expected := range []spdxRelationship{
+		{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-system-image"},
+		{"SPDXRef-system-image", "CONTAINS", "SPDXRef-foo"},
+		{"SPDXRef-foo", "DYNAMIC_LINK", "SPDXRef-libbar"},
+		// Soong doesn't annotate static dependencies.
+		{"SPDXRef-foo", "STATIC_LINK", "SPDXRef-libbaz"},
+		{"SPDXRef-clang", "BUILD_TOOL_OF", "SPDXRef-foo"},
+		{"SPDXRef-system-image", "CONTAINS", "SPDXRef-File-system-bin-foo"},
+		{"SPDXRef-foo", "GENERATES", "SPDXRef-File-system-bin-foo"},
+		{"SPDXRef-libbar", "GENERATES", "SPDXRef-File-system-lib64-libbar.so"},
+	} {
+		if !relationships[expected] {
+			t.Errorf("missing relationship %v in %v", expected, doc.Relationships)
+		}
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	writeTestFiles(t, testSbomFiles)
+	s, err := readSbom("img/meta_lic", "test_product", []string{"out/target/product/test/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom := generateCycloneDX(s)
+
+	if bom.Metadata.Component.Name != "test_product" {
+		t.Errorf("expected test_product, got %q", bom.Metadata.Component.Name)
+	}
+	components := make(map[string]cdxComponent)
+	for _, c := range bom.Components {
+		components[c.Name] = c
+	}
+	if scope := components["clang"].Scope; scope != "excluded" {
+		t.Errorf("expected clang to be excluded, got %q", scope)
+	}
+	if scope := components["libbaz"].Scope; scope != "" {
+		t.Errorf("expected libbaz to be included, got %q", scope)
+	}
+	foo := components["foo"]
+	if len(foo.Licenses) != 1 || foo.Licenses[0].Expression != "LicenseRef-legacy-notice AND MIT" {
+		t.Errorf("unexpected licenses for foo: %v", foo.Licenses)
+	}
+	if len(foo.Components) != 1 || foo.Components[0].Name != "/system/bin/foo" {
+		t.Errorf("expected foo to contain /system/bin/foo, got %v", foo.Components)
+	}
+
+	for _, d := range bom.Dependencies {
+		if d.Ref == "foo" {
+			if expected := []string{"clang", "libbar", "libbaz"}; !reflect.DeepEqual(d.DependsOn, expected) {
+				t.Errorf("expected foo to depend on %q, got %q", expected, d.DependsOn)
+			}
+		}
+	}
+
+	// The serial number is derived from the contents.
+	if again := generateCycloneDX(s); again.SerialNumber != bom.SerialNumber {
+		t.Errorf("expected a reproducible serial number, got %q and %q", bom.SerialNumber, again.SerialNumber)
+	}
+}
+
+func TestContainerPath(t *testing.T) {
+	installMap := map[string]string{"out/soong/.intermediates/foo/foo": "bin/foo"}
+	stripPrefix := []string{"out/", "out/target/product/test/"}
+	for path, expected := range map[string]string{
+		"out/soong/.intermediates/foo/foo":    "/bin/foo",
+		"out/target/product/test/system/bin/": "/system/bin/",
+		"out/host/bin/bar":                    "/host/bin/bar",
+		"other/baz":                           "/other/baz",
+	} {
+		if actual := containerPath(path, installMap, stripPrefix); actual != expected {
+			t.Errorf("containerPath(%q): expected %q, got %q", path, expected, actual)
+		}
+	}
+}
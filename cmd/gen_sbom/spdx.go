@@ -0,0 +1,220 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"android/soong/compliance/license_graph"
+)
+
+const (
+	spdxNoAssertion  = "NOASSERTION"
+	spdxDocumentId   = "SPDXRef-DOCUMENT"
+	spdxNamespaceUri = "https://android.googlesource.com/platform/build/soong/sbom/spdx/"
+
+	// The SBOM has no timestamp of its own so that it is reproducible.
+	sbomTimestamp = "1970-01-01T00:00:00Z"
+)
+
+// The subset of the SPDX 2.3 JSON schema written by gen_sbom.
+type spdxDocument struct {
+	SpdxVersion       string                 `json:"spdxVersion"`
+	DataLicense       string                 `json:"dataLicense"`
+	SPDXID            string                 `json:"SPDXID"`
+	Name              string                 `json:"name"`
+	DocumentNamespace string                 `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo       `json:"creationInfo"`
+	Packages          []spdxPackage          `json:"packages"`
+	Files             []spdxFile             `json:"files,omitempty"`
+	Relationships     []spdxRelationship     `json:"relationships"`
+	ExtractedLicenses []spdxExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string `json:"name"`
+	SPDXID           string `json:"SPDXID"`
+	DownloadLocation string `json:"downloadLocation"`
+	FilesAnalyzed    bool   `json:"filesAnalyzed"`
+	LicenseConcluded string `json:"licenseConcluded"`
+	LicenseDeclared  string `json:"licenseDeclared"`
+	CopyrightText    string `json:"copyrightText"`
+	SourceInfo       string `json:"sourceInfo,omitempty"`
+	Comment          string `json:"comment,omitempty"`
+}
+
+type spdxFile struct {
+	FileName         string         `json:"fileName"`
+	SPDXID           string         `json:"SPDXID"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SpdxElementId      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSpdxElement string `json:"relatedSpdxElement"`
+}
+
+type spdxExtractedLicense struct {
+	LicenseId     string `json:"licenseId"`
+	Name          string `json:"name"`
+	ExtractedText string `json:"extractedText"`
+}
+
+func spdxId(id string) string {
+	return "SPDXRef-" + id
+}
+
+func spdxLicense(p *sbomPackage) string {
+	if expression := p.licenseExpression(); expression != "" {
+		return expression
+	}
+	return spdxNoAssertion
+}
+
+// spdxRelationshipType returns the SPDX relationship for a dependency edge, and
+// whether the dependency is the subject of the relationship instead of the
+// object.
+func spdxRelationshipType(d *sbomDependency) (string, bool) {
+	switch d.linkage {
+	case license_graph.LinkageToolchain:
+		return "BUILD_TOOL_OF", true
+	case license_graph.LinkageDynamic:
+		return "DYNAMIC_LINK", false
+	case license_graph.LinkageContainer:
+		return "CONTAINS", false
+	default:
+		return "STATIC_LINK", false
+	}
+}
+
+// generateSpdx converts the license metadata graph into an SPDX 2.3 document.
+func generateSpdx(s *sbom) *spdxDocument {
+	doc := &spdxDocument{
+		SpdxVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            spdxDocumentId,
+		Name:              s.product,
+		DocumentNamespace: spdxNamespaceUri + s.root.id + "-" + s.hash(),
+		CreationInfo: spdxCreationInfo{
+			Created:  sbomTimestamp,
+			Creators: []string{"Tool: gen_sbom"},
+		},
+		Relationships: []spdxRelationship{{
+			SpdxElementId:      spdxDocumentId,
+			RelationshipType:   "DESCRIBES",
+			RelatedSpdxElement: spdxId(s.root.id),
+		}},
+	}
+
+	extractedLicenses := make(map[string]*sbomPackage)
+	for _, p := range s.packages {
+		license := spdxLicense(p)
+		pkg := spdxPackage{
+			Name:             p.name,
+			SPDXID:           spdxId(p.id),
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: license,
+			LicenseDeclared:  license,
+			CopyrightText:    spdxNoAssertion,
+		}
+		if projects := p.metadata.GetProjects(); len(projects) > 0 {
+			pkg.SourceInfo = "built from " + strings.Join(projects, ", ")
+		}
+		if conditions := p.metadata.GetLicenseConditions(); len(conditions) > 0 {
+			pkg.Comment = "license conditions: " + strings.Join(conditions, ", ")
+		}
+		doc.Packages = append(doc.Packages, pkg)
+
+		for _, kind := range p.metadata.GetLicenseKinds() {
+			if id := licenseId(kind); strings.HasPrefix(id, "LicenseRef-") {
+				if _, ok := extractedLicenses[id]; !ok {
+					extractedLicenses[id] = p
+				}
+			}
+		}
+
+		for _, d := range p.deps {
+			relationship, reverse := spdxRelationshipType(d)
+			from, to := spdxId(p.id), spdxId(d.dep.id)
+			if reverse {
+				from, to = to, from
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SpdxElementId:      from,
+				RelationshipType:   relationship,
+				RelatedSpdxElement: to,
+			})
+		}
+		for _, f := range p.files {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SpdxElementId:      spdxId(p.id),
+				RelationshipType:   "GENERATES",
+				RelatedSpdxElement: spdxId(f.id),
+			})
+		}
+	}
+
+	for _, f := range s.files {
+		doc.Files = append(doc.Files, spdxFile{
+			FileName: "." + f.containerPath,
+			SPDXID:   spdxId(f.id),
+			Checksums: []spdxChecksum{
+				{Algorithm: "SHA1", ChecksumValue: f.sha1},
+				{Algorithm: "SHA256", ChecksumValue: f.sha256},
+			},
+			LicenseConcluded: spdxLicense(f.owner),
+			CopyrightText:    spdxNoAssertion,
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SpdxElementId:      spdxId(s.root.id),
+			RelationshipType:   "CONTAINS",
+			RelatedSpdxElement: spdxId(f.id),
+		})
+	}
+
+	var ids []string
+	for id := range extractedLicenses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := extractedLicenses[id]
+		text := "See the license texts of " + p.name
+		if texts := p.metadata.GetLicenseTexts(); len(texts) > 0 {
+			text = "See " + strings.Join(texts, ", ")
+		}
+		doc.ExtractedLicenses = append(doc.ExtractedLicenses, spdxExtractedLicense{
+			LicenseId:     id,
+			Name:          strings.TrimPrefix(id, "LicenseRef-"),
+			ExtractedText: text,
+		})
+	}
+
+	return doc
+}
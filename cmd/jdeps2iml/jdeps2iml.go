@@ -0,0 +1,483 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// jdeps2iml converts the module_bp_java_deps.json file generated by soong into IntelliJ / Android
+// Studio project files.
+//
+// Each of the modules selected on the command line becomes an IntelliJ source module with its own
+// .iml file. The transitive dependencies of the selected modules that were not selected themselves
+// are collapsed into module libraries that refer to their prebuilt or compiled jars.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ideInfo mirrors the parts of android.IdeInfo that are used to generate the project files.
+type ideInfo struct {
+	Deps               []string `json:"dependencies"`
+	Srcs               []string `json:"srcs"`
+	Jars               []string `json:"jars"`
+	Installed_paths    []string `json:"installed"`
+	SrcJars            []string `json:"srcjars"`
+	Paths              []string `json:"path"`
+	Kotlin_src_dirs    []string `json:"kotlin_src_dirs"`
+	Generated_src_dirs []string `json:"generated_src_dirs"`
+	Resource_dirs      []string `json:"resource_dirs"`
+	Sdk_version        string   `json:"sdk_version"`
+	System_modules     string   `json:"system_modules"`
+	Java_version       string   `json:"java_version"`
+}
+
+type sourceFolder struct {
+	Url       string
+	Generated bool
+	Resource  bool
+}
+
+type contentRoot struct {
+	Url     string
+	Folders []sourceFolder
+}
+
+type library struct {
+	Name    string
+	Classes []string
+	Sources []string
+}
+
+// orderEntry is either a dependency on another source module or a module library.
+type orderEntry struct {
+	Module  string
+	Library *library
+}
+
+type imlModule struct {
+	Name          string
+	LanguageLevel string
+	Jdk           string
+	Contents      []contentRoot
+	OrderEntries  []orderEntry
+}
+
+var funcMap = template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var buf bytes.Buffer
+		err := xml.EscapeText(&buf, []byte(s))
+		return buf.String(), err
+	},
+}
+
+var imlTemplate = template.Must(template.New("iml").Funcs(funcMap).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<module type="JAVA_MODULE" version="4">
+  <component name="NewModuleRootManager" inherit-compiler-output="true"{{if .LanguageLevel}} LANGUAGE_LEVEL="{{.LanguageLevel}}"{{end}}>
+    <exclude-output />
+{{- range .Contents}}
+    <content url="{{xml .Url}}">
+{{- range .Folders}}
+      <sourceFolder url="{{xml .Url}}"{{if .Resource}} type="java-resource"{{else}} isTestSource="false"{{end}}{{if .Generated}} generated="true"{{end}} />
+{{- end}}
+    </content>
+{{- end}}
+{{- if .Jdk}}
+    <orderEntry type="jdk" jdkName="{{xml .Jdk}}" jdkType="JavaSDK" />
+{{- else}}
+    <orderEntry type="inheritedJdk" />
+{{- end}}
+    <orderEntry type="sourceFolder" forTests="false" />
+{{- range .OrderEntries}}
+{{- if .Module}}
+    <orderEntry type="module" module-name="{{xml .Module}}" />
+{{- else}}
+{{- with .Library}}
+    <orderEntry type="module-library">
+      <library name="{{xml .Name}}">
+        <CLASSES>
+{{- range .Classes}}
+          <root url="{{xml .}}" />
+{{- end}}
+        </CLASSES>
+        <JAVADOC />
+        <SOURCES>
+{{- range .Sources}}
+          <root url="{{xml .}}" />
+{{- end}}
+        </SOURCES>
+      </library>
+    </orderEntry>
+{{- end}}
+{{- end}}
+{{- end}}
+  </component>
+</module>
+`))
+
+var modulesTemplate = template.Must(template.New("modules").Funcs(funcMap).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<project version="4">
+  <component name="ProjectModuleManager">
+    <modules>
+{{- range .}}
+      <module fileurl="file://$PROJECT_DIR$/{{xml .}}.iml" filepath="$PROJECT_DIR$/{{xml .}}.iml" />
+{{- end}}
+    </modules>
+  </component>
+</project>
+`))
+
+var packageRegexp = regexp.MustCompile(`^\s*package\s+([\w.]+)\s*;?`)
+
+// readPackage returns the package declared in the java or kotlin source file, or "" if it could
+// not be determined.
+func readPackage(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if m := packageRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// packageRoot returns the source root of a file in package pkg, i.e. the directory of the file
+// with the directories corresponding to the package removed. If the directory does not match the
+// package then the directory of the file is returned.
+func packageRoot(file, pkg string) string {
+	dir := filepath.Dir(file)
+	if pkg == "" {
+		return dir
+	}
+	pkgDir := filepath.FromSlash(strings.ReplaceAll(pkg, ".", "/"))
+	if dir == pkgDir {
+		return "."
+	}
+	if strings.HasSuffix(dir, string(filepath.Separator)+pkgDir) {
+		return strings.TrimSuffix(dir, string(filepath.Separator)+pkgDir)
+	}
+	return dir
+}
+
+// languageLevel converts the java version recorded by soong to an IntelliJ LANGUAGE_LEVEL.
+func languageLevel(javaVersion string) string {
+	switch javaVersion {
+	case "":
+		return ""
+	case "1.8":
+		return "JDK_1_8"
+	case "1.9":
+		return "JDK_1_9"
+	default:
+		return "JDK_" + strings.ReplaceAll(javaVersion, ".", "_")
+	}
+}
+
+// isUnder returns true if path is dir or is inside dir.
+func isUnder(path, dir string) bool {
+	return path == dir || dir == "." || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+type generator struct {
+	infos map[string]*ideInfo
+
+	// The absolute path to the root of the source tree, used to make the urls in the project files
+	// absolute.
+	root string
+
+	// The name of the JDK to use, or "" to use the project JDK.
+	jdk string
+
+	// The function used to find the package of a source file, relative to root.
+	readPackage func(file string) string
+}
+
+func (g *generator) fileUrl(path string) string {
+	return "file://" + filepath.Join(g.root, path)
+}
+
+func (g *generator) jarUrl(path string) string {
+	return "jar://" + filepath.Join(g.root, path) + "!/"
+}
+
+// sourceRoots returns the unique source roots of the .java and .kt files in srcs, plus any extra
+// dirs that are not already covered by one of the roots.
+func (g *generator) sourceRoots(srcs []string, dirs []string) []string {
+	seen := map[string]bool{}
+	var roots []string
+	add := func(root string) {
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	for _, src := range srcs {
+		if !strings.HasSuffix(src, ".java") && !strings.HasSuffix(src, ".kt") {
+			continue
+		}
+		add(packageRoot(src, g.readPackage(src)))
+	}
+	for _, dir := range dirs {
+		covered := false
+		for _, root := range roots {
+			if isUnder(dir, root) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			add(dir)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// transitiveDeps returns the names of all the modules that name depends upon, directly or
+// indirectly, in breadth first order.
+func (g *generator) transitiveDeps(name string) []string {
+	visited := map[string]bool{name: true}
+	var result []string
+	queue := []string{name}
+	for len(queue) > 0 {
+		info := g.infos[queue[0]]
+		queue = queue[1:]
+		if info == nil {
+			continue
+		}
+		for _, dep := range info.Deps {
+			if !visited[dep] {
+				visited[dep] = true
+				result = append(result, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return result
+}
+
+// library returns the module library that replaces the unselected module name.
+func (g *generator) library(name string) (library, bool) {
+	info := g.infos[name]
+	if info == nil {
+		return library{}, false
+	}
+	lib := library{Name: name}
+	seen := map[string]bool{}
+	for _, jar := range append(append([]string(nil), info.Jars...), info.Installed_paths...) {
+		if !seen[jar] && strings.HasSuffix(jar, ".jar") {
+			seen[jar] = true
+			lib.Classes = append(lib.Classes, g.jarUrl(jar))
+		}
+	}
+	if len(lib.Classes) == 0 {
+		return library{}, false
+	}
+	return lib, true
+}
+
+func (g *generator) module(name string, selected map[string]bool) (*imlModule, error) {
+	info := g.infos[name]
+	if info == nil {
+		return nil, fmt.Errorf("unknown module %q", name)
+	}
+
+	m := &imlModule{
+		Name:          name,
+		LanguageLevel: languageLevel(info.Java_version),
+		Jdk:           g.jdk,
+	}
+
+	// Group the source folders into content roots, using the module directory as the content root
+	// for all folders within it and the folder itself as the content root for any other folders.
+	moduleDir := ""
+	if len(info.Paths) > 0 {
+		moduleDir = info.Paths[0]
+	}
+	var moduleContent *contentRoot
+	if moduleDir != "" {
+		moduleContent = &contentRoot{Url: g.fileUrl(moduleDir)}
+	}
+	var otherContents []contentRoot
+	addFolder := func(folder string, generated, resource bool) {
+		sf := sourceFolder{Url: g.fileUrl(folder), Generated: generated, Resource: resource}
+		if moduleContent != nil && isUnder(folder, moduleDir) {
+			moduleContent.Folders = append(moduleContent.Folders, sf)
+		} else {
+			otherContents = append(otherContents, contentRoot{Url: sf.Url, Folders: []sourceFolder{sf}})
+		}
+	}
+
+	var checkedInSrcs, generatedSrcs []string
+	for _, src := range info.Srcs {
+		if strings.HasPrefix(src, "out/") {
+			generatedSrcs = append(generatedSrcs, src)
+		} else {
+			checkedInSrcs = append(checkedInSrcs, src)
+		}
+	}
+	for _, root := range g.sourceRoots(checkedInSrcs, info.Kotlin_src_dirs) {
+		addFolder(root, false, false)
+	}
+	for _, root := range g.sourceRoots(generatedSrcs, info.Generated_src_dirs) {
+		addFolder(root, true, false)
+	}
+	for _, dir := range info.Resource_dirs {
+		addFolder(dir, false, true)
+	}
+	if moduleContent != nil {
+		m.Contents = append(m.Contents, *moduleContent)
+	}
+	m.Contents = append(m.Contents, otherContents...)
+
+	// The system modules provide the boot classpath so must come before any other dependencies.
+	deps := g.transitiveDeps(name)
+	if info.System_modules != "" && info.System_modules != "none" {
+		deps = append([]string{info.System_modules}, deps...)
+	}
+	for _, dep := range deps {
+		if selected[dep] {
+			m.OrderEntries = append(m.OrderEntries, orderEntry{Module: dep})
+		} else if lib, ok := g.library(dep); ok {
+			m.OrderEntries = append(m.OrderEntries, orderEntry{Library: &lib})
+		}
+	}
+
+	// Generated source jars cannot be used as source folders so expose them as the sources of a
+	// library instead.
+	if len(info.SrcJars) > 0 {
+		lib := library{Name: name + "-srcjars"}
+		for _, srcJar := range info.SrcJars {
+			lib.Sources = append(lib.Sources, g.jarUrl(srcJar))
+		}
+		m.OrderEntries = append(m.OrderEntries, orderEntry{Library: &lib})
+	}
+
+	return m, nil
+}
+
+// generate returns the contents of the project files for the selected modules, keyed by the path
+// of the file relative to the project directory.
+func (g *generator) generate(modules []string) (map[string][]byte, error) {
+	selected := map[string]bool{}
+	for _, name := range modules {
+		selected[name] = true
+	}
+
+	files := map[string][]byte{}
+	for _, name := range modules {
+		m, err := g.module(name, selected)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := imlTemplate.Execute(&buf, m); err != nil {
+			return nil, err
+		}
+		files[name+".iml"] = buf.Bytes()
+	}
+
+	var buf bytes.Buffer
+	if err := modulesTemplate.Execute(&buf, modules); err != nil {
+		return nil, err
+	}
+	files[filepath.Join(".idea", "modules.xml")] = buf.Bytes()
+
+	return files, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `jdeps2iml, a tool to generate IntelliJ project files from module_bp_java_deps.json
+
+Usage: jdeps2iml -o <project dir> [flags] <module> [<module>...]
+
+The selected modules become IntelliJ source modules, and all the modules they depend upon that
+were not selected become module libraries containing their jars.
+
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	jdeps := flag.String("jdeps", "out/soong/module_bp_java_deps.json", "path to the module_bp_java_deps.json file generated by soong")
+	root := flag.String("root", ".", "path to the root of the source tree")
+	outDir := flag.String("o", "", "directory in which to write the project files")
+	jdk := flag.String("jdk", "", "name of the JDK to use for the modules, defaults to the project JDK")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *outDir == "" || flag.NArg() == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	absRoot, err := filepath.Abs(*root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	data, err := ioutil.ReadFile(*jdeps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	infos := map[string]*ideInfo{}
+	if err := json.Unmarshal(data, &infos); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing %s: %s\n", *jdeps, err)
+		os.Exit(1)
+	}
+
+	g := &generator{
+		infos: infos,
+		root:  absRoot,
+		jdk:   *jdk,
+		readPackage: func(file string) string {
+			return readPackage(filepath.Join(absRoot, file))
+		},
+	}
+
+	files, err := g.generate(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(*outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(path, contents, 0666); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackageRoot(t *testing.T) {
+	testCases := []struct {
+		file, pkg, expected string
+	}{
+		{"frameworks/base/core/java/android/os/Foo.java", "android.os", "frameworks/base/core/java"},
+		{"android/os/Foo.java", "android.os", "."},
+		{"frameworks/base/Foo.java", "android.os", "frameworks/base"},
+		{"frameworks/base/Foo.kt", "", "frameworks/base"},
+	}
+	for _, tc := range testCases {
+		if got := packageRoot(tc.file, tc.pkg); got != tc.expected {
+			t.Errorf("packageRoot(%q, %q) = %q, want %q", tc.file, tc.pkg, got, tc.expected)
+		}
+	}
+}
+
+func TestLanguageLevel(t *testing.T) {
+	testCases := map[string]string{
+		"":    "",
+		"1.8": "JDK_1_8",
+		"11":  "JDK_11",
+		"17":  "JDK_17",
+	}
+	for in, expected := range testCases {
+		if got := languageLevel(in); got != expected {
+			t.Errorf("languageLevel(%q) = %q, want %q", in, got, expected)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	g := &generator{
+		infos: map[string]*ideInfo{
+			"foo": {
+				Deps:               []string{"bar", "baz"},
+				Srcs:               []string{"a/src/com/foo/A.java", "a/kotlin/com/foo/B.kt", "out/soong/.intermediates/a/gen/com/foo/C.java"},
+				SrcJars:            []string{"out/soong/.intermediates/a/aidl.srcjar"},
+				Paths:              []string{"a"},
+				Kotlin_src_dirs:    []string{"a/kotlin/com/foo"},
+				Generated_src_dirs: []string{"out/soong/.intermediates/a/gen/com/foo"},
+				Resource_dirs:      []string{"a/res"},
+				System_modules:     "core-all-system-modules",
+				Java_version:       "17",
+			},
+			"bar": {
+				Deps:  []string{"qux"},
+				Srcs:  []string{"b/src/com/bar/Bar.java"},
+				Paths: []string{"b"},
+			},
+			"baz": {
+				Installed_paths: []string{"out/soong/.intermediates/baz/baz.jar"},
+			},
+			"qux": {
+				Jars: []string{"prebuilts/qux.jar"},
+			},
+			"core-all-system-modules": {
+				Jars: []string{"prebuilts/core.jar"},
+			},
+		},
+		root: "/src",
+		readPackage: func(file string) string {
+			switch {
+			case strings.Contains(file, "/foo/"):
+				return "com.foo"
+			case strings.Contains(file, "/bar/"):
+				return "com.bar"
+			}
+			return ""
+		},
+	}
+
+	files, err := g.generate([]string{"foo", "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFoo := `<?xml version="1.0" encoding="UTF-8"?>
+<module type="JAVA_MODULE" version="4">
+  <component name="NewModuleRootManager" inherit-compiler-output="true" LANGUAGE_LEVEL="JDK_17">
+    <exclude-output />
+    <content url="file:///src/a">
+      <sourceFolder url="file:///src/a/kotlin" isTestSource="false" />
+      <sourceFolder url="file:///src/a/src" isTestSource="false" />
+      <sourceFolder url="file:///src/a/res" type="java-resource" />
+    </content>
+    <content url="file:///src/out/soong/.intermediates/a/gen">
+      <sourceFolder url="file:///src/out/soong/.intermediates/a/gen" isTestSource="false" generated="true" />
+    </content>
+    <orderEntry type="inheritedJdk" />
+    <orderEntry type="sourceFolder" forTests="false" />
+    <orderEntry type="module-library">
+      <library name="core-all-system-modules">
+        <CLASSES>
+          <root url="jar:///src/prebuilts/core.jar!/" />
+        </CLASSES>
+        <JAVADOC />
+        <SOURCES>
+        </SOURCES>
+      </library>
+    </orderEntry>
+    <orderEntry type="module" module-name="bar" />
+    <orderEntry type="module-library">
+      <library name="baz">
+        <CLASSES>
+          <root url="jar:///src/out/soong/.intermediates/baz/baz.jar!/" />
+        </CLASSES>
+        <JAVADOC />
+        <SOURCES>
+        </SOURCES>
+      </library>
+    </orderEntry>
+    <orderEntry type="module-library">
+      <library name="qux">
+        <CLASSES>
+          <root url="jar:///src/prebuilts/qux.jar!/" />
+        </CLASSES>
+        <JAVADOC />
+        <SOURCES>
+        </SOURCES>
+      </library>
+    </orderEntry>
+    <orderEntry type="module-library">
+      <library name="foo-srcjars">
+        <CLASSES>
+        </CLASSES>
+        <JAVADOC />
+        <SOURCES>
+          <root url="jar:///src/out/soong/.intermediates/a/aidl.srcjar!/" />
+        </SOURCES>
+      </library>
+    </orderEntry>
+  </component>
+</module>
+`
+	if got := string(files["foo.iml"]); got != expectedFoo {
+		t.Errorf("foo.iml:\n%s\nwant:\n%s", got, expectedFoo)
+	}
+
+	expectedModules := `<?xml version="1.0" encoding="UTF-8"?>
+<project version="4">
+  <component name="ProjectModuleManager">
+    <modules>
+      <module fileurl="file://$PROJECT_DIR$/foo.iml" filepath="$PROJECT_DIR$/foo.iml" />
+      <module fileurl="file://$PROJECT_DIR$/bar.iml" filepath="$PROJECT_DIR$/bar.iml" />
+    </modules>
+  </component>
+</project>
+`
+	if got := string(files[".idea/modules.xml"]); got != expectedModules {
+		t.Errorf("modules.xml:\n%s\nwant:\n%s", got, expectedModules)
+	}
+
+	if _, err := g.generate([]string{"unknown"}); err == nil {
+		t.Errorf("expected error for unknown module")
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// linker_namespace_check checks that the DT_NEEDED libraries of the ELF files
+// in an APEX or in the system partition resolve in the linker namespace that
+// linkerconfig generates for them at runtime.
+//
+// The namespace of an APEX searches the lib or lib64 directory of the APEX,
+// and links to the other namespaces for the libraries in the requireNativeLibs
+// of its apex_manifest. The system namespace searches /system/lib or
+// /system/lib64, and links to the APEX namespaces for the requireLibs of the
+// system linker.config.pb. As the linker searches the namespace before its
+// links, a library that is both in the namespace and in its links resolves to
+// the copy in the namespace rather than to the one it is linked to.
+//
+// Like linkerconfig, every namespace loads the bootstrap bionic libraries
+// from the system namespace, and the copies of them in the bionic directory
+// of com.android.runtime are loaded by the linker itself, so they are neither
+// in the requireNativeLibs of the APEXes nor checked.
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The field numbers of LinkerConfig in linkerconfig/proto/linker_config.proto.
+const (
+	provideLibsField = 3
+	requireLibsField = 4
+)
+
+// bootstrapBionicLibs are the libraries that linkerconfig links every
+// namespace to the system namespace for.
+var bootstrapBionicLibs = map[string]bool{
+	"libc.so":          true,
+	"libm.so":          true,
+	"libdl.so":         true,
+	"libdl_android.so": true,
+}
+
+// namespace is the linker namespace of an APEX or of the system partition.
+type namespace struct {
+	name string
+
+	// root is the directory with the bin, lib and lib64 directories of the
+	// namespace.
+	root string
+
+	// links are the libraries that the namespace loads from other namespaces,
+	// and linksFrom is where they are listed.
+	links     map[string]bool
+	linksFrom string
+
+	// provides are the libraries that other namespaces load from this one.
+	provides []string
+
+	// allowUnresolved is true if the libraries that are not in the namespace
+	// or in its links may come from a namespace that is not known at build
+	// time, i.e. the VNDK namespace for an APEX that requires ":vndk".
+	allowUnresolved bool
+}
+
+type problem struct {
+	file    string
+	library string
+	message string
+}
+
+func (p problem) String() string {
+	if p.file == "" {
+		return fmt.Sprintf("%s: %s", p.library, p.message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.file, p.library, p.message)
+}
+
+func (ns *namespace) exists(libDir, library string) bool {
+	_, err := os.Lstat(filepath.Join(ns.root, libDir, library))
+	return err == nil
+}
+
+// libDir returns the directory that the linker searches for the libraries of an ELF file.
+func libDir(f *elf.File) string {
+	if f.Class == elf.ELFCLASS64 {
+		return "lib64"
+	}
+	return "lib"
+}
+
+// check returns the libraries that would fail to load, or that would resolve to the wrong
+// namespace.
+func (ns *namespace) check() ([]problem, error) {
+	var problems []problem
+	for _, dir := range []string{"bin", "lib", "lib64"} {
+		err := filepath.WalkDir(filepath.Join(ns.root, dir), func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(ns.root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() && (rel == "lib/bionic" || rel == "lib64/bionic") {
+				// The bootstrap bionic libraries, loaded by the linker.
+				return fs.SkipDir
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			p, err := ns.checkFile(path, rel)
+			problems = append(problems, p...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, library := range ns.provides {
+		if !ns.exists("lib", library) && !ns.exists("lib64", library) {
+			problems = append(problems, problem{library: library,
+				message: fmt.Sprintf("provided to the other namespaces, but not in lib or lib64 of the %s namespace", ns.name)})
+		}
+	}
+	return problems, nil
+}
+
+func (ns *namespace) checkFile(path, rel string) ([]problem, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		// Not an ELF file.
+		return nil, nil
+	}
+	defer f.Close()
+	needed, err := f.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+
+	return ns.resolve(rel, libDir(f), needed), nil
+}
+
+// resolve returns the libraries needed by a file that would fail to load, or that would resolve
+// to the wrong namespace, given the directory that the linker searches for them.
+func (ns *namespace) resolve(rel, dir string, needed []string) []problem {
+	var problems []problem
+	for _, library := range needed {
+		if strings.Contains(library, "/") {
+			// Loaded by path rather than from a namespace.
+			continue
+		}
+		local := ns.exists(dir, library)
+		linked := ns.links[library]
+		switch {
+		case local && linked:
+			problems = append(problems, problem{rel, library,
+				fmt.Sprintf("resolves to %s/%s in the %s namespace instead of the library in %s", dir, library, ns.name, ns.linksFrom)})
+		case local || linked || ns.allowUnresolved || bootstrapBionicLibs[library]:
+		default:
+			other := "lib"
+			if dir == "lib" {
+				other = "lib64"
+			}
+			if ns.exists(other, library) {
+				problems = append(problems, problem{rel, library,
+					fmt.Sprintf("not found in %s of the %s namespace, only in %s", dir, ns.name, other)})
+			} else {
+				problems = append(problems, problem{rel, library,
+					fmt.Sprintf("not found in the %s namespace or in %s", ns.name, ns.linksFrom)})
+			}
+		}
+	}
+	return problems
+}
+
+// namespaceName returns the name of the linker namespace of an APEX, e.g. com_android_foo.
+func namespaceName(apex string) string {
+	return strings.ReplaceAll(apex, ".", "_")
+}
+
+func apexNamespace(name, root, manifestFile string) (*namespace, error) {
+	buf, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		ProvideNativeLibs []string `json:"provideNativeLibs"`
+		RequireNativeLibs []string `json:"requireNativeLibs"`
+	}
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+	ns := &namespace{
+		name:      namespaceName(name),
+		root:      root,
+		links:     make(map[string]bool),
+		linksFrom: "the requireNativeLibs of the apex_manifest",
+		provides:  manifest.ProvideNativeLibs,
+	}
+	for _, library := range manifest.RequireNativeLibs {
+		if library == ":vndk" {
+			ns.allowUnresolved = true
+			continue
+		}
+		ns.links[library] = true
+	}
+	return ns, nil
+}
+
+// readLinkerConfig returns the provideLibs and the requireLibs of a linker.config.pb file.
+func readLinkerConfig(r io.Reader) (provideLibs, requireLibs []string, err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.BytesType && (num == provideLibsField || num == requireLibsField) {
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, nil, protowire.ParseError(n)
+			}
+			if num == provideLibsField {
+				provideLibs = append(provideLibs, string(value))
+			} else {
+				requireLibs = append(requireLibs, string(value))
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return provideLibs, requireLibs, nil
+}
+
+func systemNamespace(root string) (*namespace, error) {
+	ns := &namespace{
+		name:      "system",
+		root:      root,
+		links:     make(map[string]bool),
+		linksFrom: "the requireLibs of etc/linker.config.pb",
+	}
+	f, err := os.Open(filepath.Join(root, "etc", "linker.config.pb"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ns, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	provideLibs, requireLibs, err := readLinkerConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name(), err)
+	}
+	ns.provides = provideLibs
+	for _, library := range requireLibs {
+		ns.links[library] = true
+	}
+	return ns, nil
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+
+	checkType := flags.String("type", "", "apex or system")
+	name := flags.String("name", "", "name of the APEX")
+	root := flags.String("root", "", "directory with the contents of the APEX, or of the system partition")
+	apexManifest := flags.String("apex_manifest", "", "apex_manifest.json of the APEX")
+
+	flags.Parse(os.Args[1:])
+
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "usage: linker_namespace_check --type apex --name <apex> --apex_manifest <file> --root <dir>\n")
+		fmt.Fprintf(os.Stderr, "       linker_namespace_check --type system --root <dir>\n")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	if flags.NArg() != 0 || *root == "" {
+		usage()
+	}
+
+	var ns *namespace
+	var err error
+	switch *checkType {
+	case "apex":
+		if *name == "" || *apexManifest == "" {
+			usage()
+		}
+		ns, err = apexNamespace(*name, *root, *apexManifest)
+	case "system":
+		ns, err = systemNamespace(*root)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	problems, err := ns.check()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		sort.Slice(problems, func(i, j int) bool { return problems[i].String() < problems[j].String() })
+		fmt.Fprintf(os.Stderr, "%d libraries would fail to load, or would resolve to the wrong namespace, in the %s namespace:\n",
+			len(problems), ns.name)
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "    %s\n", p)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeElf writes a 64-bit ELF file with the DT_NEEDED entries, and just the
+// sections debug/elf reads them from.
+func writeElf(t *testing.T, path string, needed ...string) {
+	t.Helper()
+	dynstr := []byte{0}
+	var dynamic []elf.Dyn64
+	for _, library := range needed {
+		dynamic = append(dynamic, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: uint64(len(dynstr))})
+		dynstr = append(append(dynstr, library...), 0)
+	}
+	dynamic = append(dynamic, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	shstrtab := []byte("\x00.dynstr\x00.dynamic\x00.shstrtab\x00")
+
+	headerSize := uint64(binary.Size(elf.Header64{}))
+	dynamicSize := uint64(binary.Size(dynamic))
+	dynstrOff := headerSize
+	dynamicOff := dynstrOff + uint64(len(dynstr))
+	shstrtabOff := dynamicOff + dynamicSize
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: dynstrOff, Size: uint64(len(dynstr)), Addralign: 1},
+		{Name: 9, Type: uint32(elf.SHT_DYNAMIC), Off: dynamicOff, Size: dynamicSize, Link: 1, Addralign: 8,
+			Entsize: uint64(binary.Size(elf.Dyn64{}))},
+		{Name: 18, Type: uint32(elf.SHT_STRTAB), Off: shstrtabOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	}
+	header := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shstrtabOff + uint64(len(shstrtab)),
+		Ehsize:    uint16(headerSize),
+		Phentsize: 0x38,
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  3,
+	}
+	copy(header.Ident[:], "\x7fELF")
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	buf := &bytes.Buffer{}
+	for _, data := range []any{header, dynstr, dynamic, shstrtab, sections} {
+		if err := binary.Write(buf, binary.LittleEndian, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "lib64/libfoo.so", "lib64/libc.so", "lib/lib32only.so", "lib64/libprovided.so")
+	manifest := filepath.Join(t.TempDir(), "apex_manifest.json")
+	if err := os.WriteFile(manifest, []byte(`{
+		"name": "com.android.foo",
+		"provideNativeLibs": ["libprovided.so", "libmissing.so"],
+		"requireNativeLibs": ["libc.so", "libm.so"]
+	}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := apexNamespace("com.android.foo", root, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := ns.resolve("bin/foo", "lib64", []string{
+		"libfoo.so",             // in the APEX
+		"libm.so",               // through the link
+		"libc.so",               // in the APEX, shadowing the link
+		"lib32only.so",          // only in lib
+		"libbar.so",             // nowhere
+		"/system/lib64/libx.so", // by path
+	})
+	expected := []problem{
+		{"bin/foo", "libc.so", "resolves to lib64/libc.so in the com_android_foo namespace instead of the library in the requireNativeLibs of the apex_manifest"},
+		{"bin/foo", "lib32only.so", "not found in lib64 of the com_android_foo namespace, only in lib"},
+		{"bin/foo", "libbar.so", "not found in the com_android_foo namespace or in the requireNativeLibs of the apex_manifest"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+
+	// The check walks the ELF files, and there is none, but still checks the provided libraries.
+	problems, err = ns.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []problem{
+		{library: "libmissing.so", message: "provided to the other namespaces, but not in lib or lib64 of the com_android_foo namespace"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+}
+
+func TestRuntimeApex(t *testing.T) {
+	// com.android.runtime installs the bootstrap bionic libraries in the
+	// bionic directory, and does not list them in its apex_manifest.
+	root := t.TempDir()
+	writeElf(t, filepath.Join(root, "lib64", "bionic", "libc.so"), "ld-android.so")
+	writeElf(t, filepath.Join(root, "lib64", "bionic", "libdl.so"), "ld-android.so", "libc.so")
+	writeElf(t, filepath.Join(root, "lib64", "bionic", "libm.so"), "libc.so")
+	writeElf(t, filepath.Join(root, "lib64", "bionic", "libdl_android.so"), "ld-android.so", "libc.so")
+	writeElf(t, filepath.Join(root, "lib64", "libdexfile.so"), "libc.so", "libm.so", "libdl.so", "libdl_android.so", "libmissing.so")
+	writeElf(t, filepath.Join(root, "bin", "linkerconfig"), "libc.so", "libdexfile.so")
+	manifest := filepath.Join(t.TempDir(), "apex_manifest.json")
+	if err := os.WriteFile(manifest, []byte(`{
+		"name": "com.android.runtime",
+		"provideNativeLibs": ["libdexfile.so"]
+	}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := apexNamespace("com.android.runtime", root, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := ns.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []problem{
+		{"lib64/libdexfile.so", "libmissing.so", "not found in the com_android_runtime namespace or in the requireNativeLibs of the apex_manifest"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+}
+
+func TestVndkApex(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "apex_manifest.json")
+	if err := os.WriteFile(manifest, []byte(`{"requireNativeLibs": [":vndk"]}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := apexNamespace("com.android.foo", t.TempDir(), manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := ns.resolve("bin/foo", "lib64", []string{"libvndk.so"}); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestReadLinkerConfig(t *testing.T) {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "/system/${LIB}/extra")
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+	b = protowire.AppendTag(b, provideLibsField, protowire.BytesType)
+	b = protowire.AppendString(b, "libfoo.so")
+	b = protowire.AppendTag(b, requireLibsField, protowire.BytesType)
+	b = protowire.AppendString(b, "libbar.so")
+	b = protowire.AppendTag(b, requireLibsField, protowire.BytesType)
+	b = protowire.AppendString(b, "libbaz.so")
+
+	provideLibs, requireLibs, err := readLinkerConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"libfoo.so"}; !reflect.DeepEqual(provideLibs, expected) {
+		t.Errorf("expected provideLibs %v, got %v", expected, provideLibs)
+	}
+	if expected := []string{"libbar.so", "libbaz.so"}; !reflect.DeepEqual(requireLibs, expected) {
+		t.Errorf("expected requireLibs %v, got %v", expected, requireLibs)
+	}
+
+	if _, _, err := readLinkerConfig(bytes.NewReader([]byte{0x1a, 0x10, 'a'})); err == nil {
+		t.Errorf("expected an error for a truncated linker config")
+	}
+}
+
+func TestSystemNamespace(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "lib64/libfoo.so")
+	var b []byte
+	b = protowire.AppendTag(b, requireLibsField, protowire.BytesType)
+	b = protowire.AppendString(b, "libapex.so")
+	b = protowire.AppendTag(b, requireLibsField, protowire.BytesType)
+	b = protowire.AppendString(b, "libfoo.so")
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "linker.config.pb"), b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	ns, err := systemNamespace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := ns.resolve("bin/foo", "lib64", []string{"libapex.so", "libfoo.so"})
+	expected := []problem{
+		{"bin/foo", "libfoo.so", "resolves to lib64/libfoo.so in the system namespace instead of the library in the requireLibs of etc/linker.config.pb"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// merge_compdb merges compile_commands.json fragments into a single compile_commands.json file.
+// When several fragments have an entry for the same file, the entry of the first fragment is
+// kept. Arguments starting with @ are read as response files listing more fragments.
+//
+// With -dirs, only the fragments of the directories listed in the file, and of their
+// subdirectories, are merged, or all of them if the file lists no directory. The directory of a
+// fragment is its path relative to the -fragments_root directory. As the file is read when the
+// merge runs, the selected directories can be changed without regenerating the build.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	outFile       = flag.String("o", "", "output compile_commands.json file")
+	dirsFile      = flag.String("dirs", "", "file listing the directories whose fragments are merged")
+	fragmentsRoot = flag.String("fragments_root", "", "with -dirs, the directory the fragments of each directory are in")
+)
+
+// entry is an entry of a compile_commands.json file, as written by cc/compdb.go in Soong.
+type entry struct {
+	Directory string   `json:"directory"`
+	Arguments []string `json:"arguments"`
+	File      string   `json:"file"`
+	Output    string   `json:"output,omitempty"`
+}
+
+// expandArgs replaces the response file arguments with the files they list.
+func expandArgs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			files = append(files, arg)
+			continue
+		}
+		data, err := os.ReadFile(strings.TrimPrefix(arg, "@"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, strings.Fields(string(data))...)
+	}
+	return files, nil
+}
+
+// dirSelected returns true if the directory is one of the selected directories or one of their
+// subdirectories.
+func dirSelected(dir string, selectedDirs []string) bool {
+	for _, selected := range selectedDirs {
+		selected = filepath.Clean(selected)
+		if dir == selected || strings.HasPrefix(dir, selected+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFragments returns the fragments of the selected directories, which are the directories of
+// the fragments relative to root, or all the fragments if no directory is selected.
+func selectFragments(files []string, root string, selectedDirs []string) ([]string, error) {
+	if len(selectedDirs) == 0 {
+		return files, nil
+	}
+	var ret []string
+	for _, file := range files {
+		dir, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil {
+			return nil, err
+		}
+		if dirSelected(dir, selectedDirs) {
+			ret = append(ret, file)
+		}
+	}
+	return ret, nil
+}
+
+// merge merges the entries of the fragments, keeping the first entry of each file, sorted by
+// file.
+func merge(fragments [][]entry) []entry {
+	seen := make(map[string]bool)
+	merged := []entry{}
+	for _, fragment := range fragments {
+		for _, e := range fragment {
+			if !seen[e.File] {
+				seen[e.File] = true
+				merged = append(merged, e)
+			}
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].File < merged[j].File })
+	return merged
+}
+
+func mergeCompdb(files []string) error {
+	var fragments [][]entry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var fragment []entry
+		if err := json.Unmarshal(data, &fragment); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		fragments = append(fragments, fragment)
+	}
+
+	data, err := json.MarshalIndent(merge(fragments), "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*outFile, data, 0666)
+}
+
+func main() {
+	flag.Parse()
+
+	if *outFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: merge_compdb -o <compile_commands.json> "+
+			"[-dirs <file> -fragments_root <dir>] <fragments>")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	files, err := expandArgs(flag.Args())
+	if err == nil && *dirsFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(*dirsFile); err == nil {
+			files, err = selectFragments(files, *fragmentsRoot, strings.Fields(string(data)))
+		}
+	}
+	if err == nil {
+		err = mergeCompdb(files)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "merge_compdb:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	fragments := [][]entry{
+		{
+			{Directory: "/src", Arguments: []string{"clang++", "-DFOO", "foo/b.cpp"}, File: "foo/b.cpp"},
+			{Directory: "/src", Arguments: []string{"clang++", "-DFOO", "foo/a.cpp"}, File: "foo/a.cpp"},
+		},
+		{
+			{Directory: "/src", Arguments: []string{"clang++", "-DBAR", "foo/a.cpp"}, File: "foo/a.cpp"},
+			{Directory: "/src", Arguments: []string{"clang++", "-DBAR", "out/gen/bar.h"}, File: "out/gen/bar.h"},
+		},
+		nil,
+	}
+
+	got := merge(fragments)
+	want := []entry{
+		{Directory: "/src", Arguments: []string{"clang++", "-DFOO", "foo/a.cpp"}, File: "foo/a.cpp"},
+		{Directory: "/src", Arguments: []string{"clang++", "-DFOO", "foo/b.cpp"}, File: "foo/b.cpp"},
+		{Directory: "/src", Arguments: []string{"clang++", "-DBAR", "out/gen/bar.h"}, File: "out/gen/bar.h"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merge() = %v, want %v", got, want)
+	}
+
+	if got := merge(nil); got == nil || len(got) != 0 {
+		t.Errorf("merge(nil) = %#v, want an empty list", got)
+	}
+}
+
+func TestExpandArgs(t *testing.T) {
+	rsp := filepath.Join(t.TempDir(), "fragments.rsp")
+	if err := os.WriteFile(rsp, []byte("b.json\nc.json d.json\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := expandArgs([]string{"a.json", "@" + rsp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.json", "b.json", "c.json", "d.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expandArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestSelectFragments(t *testing.T) {
+	files := []string{
+		"out/fragments/foo/compile_commands.json",
+		"out/fragments/foo/baz/compile_commands.json",
+		"out/fragments/foobar/compile_commands.json",
+		"out/fragments/bar/compile_commands.json",
+	}
+
+	got, err := selectFragments(files, "out/fragments", []string{"foo/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"out/fragments/foo/compile_commands.json",
+		"out/fragments/foo/baz/compile_commands.json",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectFragments() = %q, want %q", got, want)
+	}
+
+	// Without selected directories, all the fragments are merged.
+	got, err = selectFragments(files, "out/fragments", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("selectFragments() = %q, want %q", got, files)
+	}
+}
@@ -58,7 +58,9 @@ type Flags struct {
 type CommandFunc func(*rc_lib.ReleaseConfigs, Flags, string, []string) error
 
 var commandMap map[string]CommandFunc = map[string]CommandFunc{
+	"diff":  DiffCommand,
 	"get":   GetCommand,
+	"lint":  LintCommand,
 	"set":   SetCommand,
 	"trace": GetCommand, // Also handled by GetCommand
 }
@@ -333,6 +335,66 @@ func SetCommand(configs *rc_lib.ReleaseConfigs, commonFlags Flags, cmd string, a
 	return nil
 }
 
+func DiffCommand(configs *rc_lib.ReleaseConfigs, commonFlags Flags, cmd string, args []string) error {
+	diffFlags := flag.NewFlagSet("diff", flag.ExitOnError)
+	diffFlags.Parse(args)
+	if len(diffFlags.Args()) > 0 {
+		return fmt.Errorf("diff command takes no arguments, got: %s", strings.Join(diffFlags.Args(), " "))
+	}
+
+	releaseConfigList, err := GetReleaseArgs(configs, commonFlags)
+	if err != nil {
+		return err
+	}
+	if len(releaseConfigList) != 2 {
+		return fmt.Errorf("diff command requires exactly two --release arguments.  Got: %s", strings.Join(commonFlags.targetReleases, " "))
+	}
+	diff := rc_lib.DiffReleaseConfigs(releaseConfigList[0], releaseConfigList[1])
+
+	outputOneRelease := func(config *rc_lib.ReleaseConfig, fa *rc_lib.FlagArtifact) {
+		if fa == nil {
+			fmt.Printf("  %s: REDACTED\n", config.Name)
+			return
+		}
+		fmt.Printf("  %s: '%s'\n", config.Name, rc_lib.MarshalValue(fa.Value))
+		for _, trace := range fa.Traces {
+			fmt.Printf("    => \"%s\" in %s\n", rc_lib.MarshalValue(trace.Value), *trace.Source)
+		}
+	}
+	for _, fd := range diff.FlagDiffs {
+		fmt.Println(fd.Name)
+		outputOneRelease(diff.A, fd.A)
+		outputOneRelease(diff.B, fd.B)
+	}
+	if len(diff.AconfigValueSetsOnlyA) > 0 || len(diff.AconfigValueSetsOnlyB) > 0 {
+		fmt.Println("RELEASE_ACONFIG_VALUE_SETS")
+		for _, v := range diff.AconfigValueSetsOnlyA {
+			fmt.Printf("  %s only: %s\n", diff.A.Name, v)
+		}
+		for _, v := range diff.AconfigValueSetsOnlyB {
+			fmt.Printf("  %s only: %s\n", diff.B.Name, v)
+		}
+	}
+	return nil
+}
+
+func LintCommand(configs *rc_lib.ReleaseConfigs, commonFlags Flags, cmd string, args []string) error {
+	lintFlags := flag.NewFlagSet("lint", flag.ExitOnError)
+	lintFlags.Parse(args)
+	if len(lintFlags.Args()) > 0 {
+		return fmt.Errorf("lint command takes no arguments, got: %s", strings.Join(lintFlags.Args(), " "))
+	}
+
+	issues := configs.Lint()
+	for _, issue := range issues {
+		fmt.Println(issue.String())
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("lint found %d issue(s)", len(issues))
+	}
+	return nil
+}
+
 func main() {
 	var commonFlags Flags
 	var configs *rc_lib.ReleaseConfigs
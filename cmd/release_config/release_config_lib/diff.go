@@ -0,0 +1,116 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release_config_lib
+
+import (
+	"google.golang.org/protobuf/proto"
+)
+
+// A build flag whose resolved value differs between two release configs.
+type FlagDiff struct {
+	// The name of the flag.
+	Name string
+
+	// The flag artifact in each release config, or nil if the flag is
+	// redacted (or otherwise absent) in that release config.
+	A *FlagArtifact
+	B *FlagArtifact
+}
+
+// The differences between two generated release configs.
+type ReleaseConfigDiff struct {
+	// The release configs being compared.
+	A *ReleaseConfig
+	B *ReleaseConfig
+
+	// Flags whose value differs, sorted by name.
+	FlagDiffs []*FlagDiff
+
+	// Aconfig value sets used only by A or only by B, sorted.
+	AconfigValueSetsOnlyA []string
+	AconfigValueSetsOnlyB []string
+}
+
+// Returns true if there are no differences between the release configs.
+func (diff *ReleaseConfigDiff) Empty() bool {
+	return len(diff.FlagDiffs) == 0 && len(diff.AconfigValueSetsOnlyA) == 0 && len(diff.AconfigValueSetsOnlyB) == 0
+}
+
+// Compare the resolved flag artifacts of two generated release configs.
+//
+// RELEASE_ACONFIG_VALUE_SETS is not compared as a flag, the aconfig value
+// sets that it is assembled from are compared instead.
+//
+// Args:
+//
+//	a, b *ReleaseConfig: the release configs to compare.
+//
+// Returns:
+//
+//	*ReleaseConfigDiff: the differences between the release configs.
+func DiffReleaseConfigs(a, b *ReleaseConfig) *ReleaseConfigDiff {
+	ret := &ReleaseConfigDiff{A: a, B: b}
+
+	namesMap := make(map[string]bool)
+	for name := range a.FlagArtifacts {
+		namesMap[name] = true
+	}
+	for name := range b.FlagArtifacts {
+		namesMap[name] = true
+	}
+	for _, name := range SortedMapKeys(namesMap) {
+		if name == "RELEASE_ACONFIG_VALUE_SETS" {
+			continue
+		}
+		faA, faB := a.FlagArtifacts[name], b.FlagArtifacts[name]
+		if faA != nil && faA.Redacted {
+			faA = nil
+		}
+		if faB != nil && faB.Redacted {
+			faB = nil
+		}
+		if faA != nil && faB != nil && proto.Equal(faA.Value, faB.Value) {
+			continue
+		}
+		if faA == nil && faB == nil {
+			continue
+		}
+		ret.FlagDiffs = append(ret.FlagDiffs, &FlagDiff{Name: name, A: faA, B: faB})
+	}
+
+	valueSetsA := aconfigValueSetsMap(a)
+	valueSetsB := aconfigValueSetsMap(b)
+	for _, v := range SortedMapKeys(valueSetsA) {
+		if !valueSetsB[v] {
+			ret.AconfigValueSetsOnlyA = append(ret.AconfigValueSetsOnlyA, v)
+		}
+	}
+	for _, v := range SortedMapKeys(valueSetsB) {
+		if !valueSetsA[v] {
+			ret.AconfigValueSetsOnlyB = append(ret.AconfigValueSetsOnlyB, v)
+		}
+	}
+	return ret
+}
+
+func aconfigValueSetsMap(config *ReleaseConfig) map[string]bool {
+	ret := make(map[string]bool)
+	for _, v := range config.ReleaseConfigArtifact.GetAconfigValueSets() {
+		if v != "" {
+			ret[v] = true
+		}
+	}
+	return ret
+}
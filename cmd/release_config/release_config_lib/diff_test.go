@@ -0,0 +1,60 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release_config_lib
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffReleaseConfigs(t *testing.T) {
+	configs, _ := testReleaseConfigs(t)
+	trunkStaging, err := configs.GetReleaseConfig("trunk_staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trunk, err := configs.GetReleaseConfig("trunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffReleaseConfigs(trunkStaging, trunk)
+	if len(diff.FlagDiffs) != 1 {
+		t.Fatalf("Expected one differing flag, found %d", len(diff.FlagDiffs))
+	}
+	fd := diff.FlagDiffs[0]
+	if fd.Name != "RELEASE_LAUNCH" {
+		t.Errorf("Expected RELEASE_LAUNCH found %q", fd.Name)
+	}
+	if actual := MarshalValue(fd.A.Value); actual != "" {
+		t.Errorf("Expected %q found %q", "", actual)
+	}
+	if actual := MarshalValue(fd.B.Value); actual != "true" {
+		t.Errorf("Expected %q found %q", "true", actual)
+	}
+	if len(fd.B.Traces) != 2 {
+		t.Errorf("Expected 2 traces found %d", len(fd.B.Traces))
+	}
+	if !slices.Equal(diff.AconfigValueSetsOnlyA, []string{"aconfig_staging"}) {
+		t.Errorf("Expected %q found %q", []string{"aconfig_staging"}, diff.AconfigValueSetsOnlyA)
+	}
+	if len(diff.AconfigValueSetsOnlyB) != 0 {
+		t.Errorf("Expected no aconfig value sets only in trunk, found %q", diff.AconfigValueSetsOnlyB)
+	}
+
+	if diff := DiffReleaseConfigs(trunk, trunk); !diff.Empty() {
+		t.Errorf("Expected no differences, found %v", diff.FlagDiffs)
+	}
+}
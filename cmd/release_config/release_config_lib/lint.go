@@ -0,0 +1,202 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release_config_lib
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	rc_proto "android/soong/cmd/release_config/release_config_proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A problem found by Lint.
+type LintIssue struct {
+	// The file that should be changed to resolve the issue.
+	Path string
+
+	// The name of the flag.
+	Flag string
+
+	// A description of the problem.
+	Message string
+}
+
+func (issue *LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", issue.Path, issue.Flag, issue.Message)
+}
+
+// Check the release configs for problems which are not errors.
+//
+// This reports:
+//   - flag values which are the same as the value already inherited,
+//   - flags which are declared but never set by any release config,
+//   - flag values in release configs with prior_stages that do not follow
+//     the workflow of the flag declaration.
+//
+// The release configs must already be generated.
+//
+// Returns:
+//
+//	[]*LintIssue: the issues found, sorted by path and flag.
+func (configs *ReleaseConfigs) Lint() []*LintIssue {
+	var ret []*LintIssue
+	for _, config := range configs.GetSortedReleaseConfigs() {
+		ret = append(ret, config.lintRedundantValues()...)
+		ret = append(ret, configs.lintPriorStages(config)...)
+	}
+	ret = append(ret, configs.lintUnsetFlags()...)
+
+	slices.SortFunc(ret, func(a, b *LintIssue) int {
+		if n := cmp.Compare(a.Path, b.Path); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.Flag, b.Flag)
+	})
+	return slices.CompactFunc(ret, func(a, b *LintIssue) bool {
+		return *a == *b
+	})
+}
+
+// Returns the paths of the flag_values files contributed by this release config.
+func (config *ReleaseConfig) flagValuePaths() map[string]bool {
+	ret := make(map[string]bool)
+	for _, contrib := range config.Contributions {
+		for _, value := range contrib.FlagValues {
+			ret[value.path] = true
+		}
+	}
+	return ret
+}
+
+// Find values set by this release config that match the value it would
+// otherwise have.
+func (config *ReleaseConfig) lintRedundantValues() []*LintIssue {
+	var ret []*LintIssue
+	myPaths := config.flagValuePaths()
+	for _, name := range config.FlagArtifacts.SortedFlagNames() {
+		fa := config.FlagArtifacts[name]
+		for idx := 1; idx < len(fa.Traces); idx++ {
+			trace := fa.Traces[idx]
+			if !myPaths[trace.GetSource()] || trace.Value == nil {
+				continue
+			}
+			prev := fa.Traces[idx-1]
+			if proto.Equal(trace.Value, prev.Value) {
+				ret = append(ret, &LintIssue{
+					Path:    trace.GetSource(),
+					Flag:    name,
+					Message: fmt.Sprintf("value %q is already set in %s", MarshalValue(trace.Value), prev.GetSource()),
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// Find flags which no release config sets.
+func (configs *ReleaseConfigs) lintUnsetFlags() []*LintIssue {
+	var ret []*LintIssue
+	for _, name := range configs.FlagArtifacts.SortedFlagNames() {
+		decl := configs.FlagArtifacts[name]
+		if name == "RELEASE_ACONFIG_VALUE_SETS" || decl.Value.GetObsolete() || len(decl.Traces) == 0 {
+			continue
+		}
+		isSet := false
+		for _, config := range configs.ReleaseConfigs {
+			fa, ok := config.FlagArtifacts[name]
+			// Redacted flags are removed from the release config.
+			if !ok || len(fa.Traces) > 1 {
+				isSet = true
+				break
+			}
+		}
+		if !isSet {
+			ret = append(ret, &LintIssue{
+				Path:    decl.Traces[0].GetSource(),
+				Flag:    name,
+				Message: "declared but not set in any release config",
+			})
+		}
+	}
+	return ret
+}
+
+// Find values which advance a flag in a way that the prior stages of this
+// release config do not allow.
+func (configs *ReleaseConfigs) lintPriorStages(config *ReleaseConfig) []*LintIssue {
+	var ret []*LintIssue
+	if len(config.PriorStagesMap) == 0 {
+		return ret
+	}
+	priorStages := []*ReleaseConfig{}
+	for _, name := range SortedMapKeys(config.PriorStagesMap) {
+		priorStage, err := configs.GetReleaseConfig(name)
+		if err != nil || priorStage.Name == config.Name {
+			ret = append(ret, &LintIssue{
+				Path:    config.Contributions[0].path,
+				Flag:    "-",
+				Message: fmt.Sprintf("unknown prior stage %s", name),
+			})
+			continue
+		}
+		priorStages = append(priorStages, priorStage)
+	}
+	if len(priorStages) == 0 {
+		return ret
+	}
+
+	myPaths := config.flagValuePaths()
+	for _, name := range config.FlagArtifacts.SortedFlagNames() {
+		fa := config.FlagArtifacts[name]
+		source := fa.Traces[len(fa.Traces)-1].GetSource()
+		if !myPaths[source] {
+			continue
+		}
+		// Values from the prior stages, skipping any that are redacted there.
+		priorValues := []*rc_proto.Value{}
+		for _, priorStage := range priorStages {
+			if pfa, ok := priorStage.FlagArtifacts[name]; ok {
+				priorValues = append(priorValues, pfa.Value)
+			}
+		}
+		if len(priorValues) == 0 {
+			continue
+		}
+		inPriorStage := slices.ContainsFunc(priorValues, func(v *rc_proto.Value) bool {
+			return proto.Equal(v, fa.Value)
+		})
+		addIssue := func(format string, args ...any) {
+			ret = append(ret, &LintIssue{Path: source, Flag: name, Message: fmt.Sprintf(format, args...)})
+		}
+		switch fa.FlagDeclaration.GetWorkflow() {
+		case rc_proto.Workflow_LAUNCH:
+			if _, ok := fa.Value.Val.(*rc_proto.Value_BoolValue); !ok {
+				addIssue("LAUNCH flag has non-boolean value %q", MarshalValue(fa.Value))
+			} else if fa.Value.GetBoolValue() && !inPriorStage {
+				addIssue("LAUNCH flag is enabled before it is enabled in any of the prior stages %v",
+					SortedMapKeys(config.PriorStagesMap))
+			}
+		case rc_proto.Workflow_PREBUILT:
+			if !inPriorStage {
+				addIssue("PREBUILT flag value %q is not used in any of the prior stages %v",
+					MarshalValue(fa.Value), SortedMapKeys(config.PriorStagesMap))
+			}
+		}
+	}
+	return ret
+}
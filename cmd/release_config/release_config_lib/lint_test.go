@@ -0,0 +1,96 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release_config_lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A small release config tree used by the lint and diff tests.
+var testReleaseConfigFiles = map[string]string{
+	"release_config_map.textproto": `default_containers: "system"`,
+
+	"flag_declarations/RELEASE_LAUNCH.textproto":   `name: "RELEASE_LAUNCH" namespace: "test" value {bool_value: false} workflow: LAUNCH`,
+	"flag_declarations/RELEASE_PREBUILT.textproto": `name: "RELEASE_PREBUILT" namespace: "test" value {string_value: "1"} workflow: PREBUILT`,
+	"flag_declarations/RELEASE_MANUAL.textproto":   `name: "RELEASE_MANUAL" namespace: "test" value {string_value: "a"} workflow: MANUAL`,
+	"flag_declarations/RELEASE_UNSET.textproto":    `name: "RELEASE_UNSET" namespace: "test" value {string_value: "a"} workflow: MANUAL`,
+
+	"release_configs/trunk_staging.textproto": `name: "trunk_staging" aconfig_value_sets: "aconfig_common" aconfig_value_sets: "aconfig_staging"`,
+	"release_configs/trunk.textproto":         `name: "trunk" aconfig_value_sets: "aconfig_common" prior_stages: "trunk_staging"`,
+	"release_configs/next.textproto":          `name: "next" prior_stages: "trunk_staging"`,
+
+	"flag_values/trunk_staging/RELEASE_PREBUILT.textproto": `name: "RELEASE_PREBUILT" value {string_value: "2"}`,
+	"flag_values/trunk_staging/RELEASE_MANUAL.textproto":   `name: "RELEASE_MANUAL" value {string_value: "a"}`,
+	"flag_values/trunk/RELEASE_LAUNCH.textproto":           `name: "RELEASE_LAUNCH" value {bool_value: true}`,
+	"flag_values/trunk/RELEASE_PREBUILT.textproto":         `name: "RELEASE_PREBUILT" value {string_value: "2"}`,
+	"flag_values/next/RELEASE_PREBUILT.textproto":          `name: "RELEASE_PREBUILT" value {string_value: "3"}`,
+}
+
+func testReleaseConfigs(t *testing.T) (*ReleaseConfigs, string) {
+	t.Helper()
+	DisableWarnings()
+	dir := filepath.Join(t.TempDir(), "build", "release")
+	for name, data := range testReleaseConfigFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configs, err := ReadReleaseConfigMaps(StringList{filepath.Join(dir, "release_config_map.textproto")}, "trunk_staging", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return configs, dir
+}
+
+func TestLint(t *testing.T) {
+	configs, dir := testReleaseConfigs(t)
+	expected := []LintIssue{
+		{
+			Path:    filepath.Join(dir, "flag_declarations/RELEASE_UNSET.textproto"),
+			Flag:    "RELEASE_UNSET",
+			Message: "declared but not set in any release config",
+		},
+		{
+			Path:    filepath.Join(dir, "flag_values/next/RELEASE_PREBUILT.textproto"),
+			Flag:    "RELEASE_PREBUILT",
+			Message: `PREBUILT flag value "3" is not used in any of the prior stages [trunk_staging]`,
+		},
+		{
+			Path:    filepath.Join(dir, "flag_values/trunk/RELEASE_LAUNCH.textproto"),
+			Flag:    "RELEASE_LAUNCH",
+			Message: "LAUNCH flag is enabled before it is enabled in any of the prior stages [trunk_staging]",
+		},
+		{
+			Path:    filepath.Join(dir, "flag_values/trunk_staging/RELEASE_MANUAL.textproto"),
+			Flag:    "RELEASE_MANUAL",
+			Message: `value "a" is already set in ` + filepath.Join(dir, "flag_declarations/RELEASE_MANUAL.textproto"),
+		},
+	}
+	actual := configs.Lint()
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d issues, found %d: %v", len(expected), len(actual), actual)
+	}
+	for i := range expected {
+		if *actual[i] != expected[i] {
+			t.Errorf("Expected %q found %q", expected[i].String(), actual[i].String())
+		}
+	}
+}
@@ -0,0 +1,559 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sdk_snapshot_diff compares two snapshot zips of the same sdk or
+// module_exports module, as built by `m <sdk>`, and classifies the change as
+// compatible or breaking for the builds that use the snapshot.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint/parser"
+)
+
+// The properties of the snapshot modules that can change without affecting the builds that use
+// the snapshot.
+var compatibleProperties = map[string]bool{
+	"prefer":                true,
+	"use_source_config_var": true,
+}
+
+// property is the value of a property of a snapshot module. Nested properties are flattened, so
+// that each property has a string or a list of strings value.
+type property struct {
+	list   bool
+	values []string
+}
+
+func (p property) String() string {
+	if !p.list {
+		return p.values[0]
+	}
+	return "[" + strings.Join(p.values, ", ") + "]"
+}
+
+// member is a module in the Android.bp file of a snapshot.
+type member struct {
+	moduleType string
+	name       string
+
+	// properties maps the dotted path of each property, e.g. "arch.arm64.srcs", to its value.
+	properties map[string]property
+}
+
+func (m *member) String() string {
+	return m.moduleType + " " + m.name
+}
+
+// snapshot is the contents of a snapshot zip.
+type snapshot struct {
+	members map[string]*member
+	files   map[string][]byte
+}
+
+func readSnapshot(file string) (*snapshot, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	s := &snapshot{files: make(map[string][]byte)}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		buf, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", file, f.Name, err)
+		}
+		s.files[f.Name] = buf
+	}
+
+	bp, ok := s.files["Android.bp"]
+	if !ok {
+		return nil, fmt.Errorf("%s: missing Android.bp, not an sdk snapshot", file)
+	}
+	s.members, err = parseMembers(file+":Android.bp", bp)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseMembers returns the modules defined in the Android.bp file of a snapshot, by name.
+func parseMembers(filename string, contents []byte) (map[string]*member, error) {
+	file, errs := parser.Parse(filename, bytes.NewReader(contents), parser.NewScope(nil))
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	members := make(map[string]*member)
+	for _, def := range file.Defs {
+		mod, ok := def.(*parser.Module)
+		if !ok {
+			continue
+		}
+		nameProperty, ok := mod.GetProperty("name")
+		if !ok {
+			// The package module.
+			continue
+		}
+		name, ok := nameProperty.Value.(*parser.String)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: name is not a string", nameProperty.NamePos, mod.Type)
+		}
+		m := &member{moduleType: mod.Type, name: name.Value, properties: make(map[string]property)}
+		flattenProperties(m.properties, "", mod.Properties)
+		delete(m.properties, "name")
+		members[m.name] = m
+	}
+	return members, nil
+}
+
+func flattenProperties(ret map[string]property, prefix string, properties []*parser.Property) {
+	for _, p := range properties {
+		name := prefix + p.Name
+		switch v := p.Value.(type) {
+		case *parser.Map:
+			flattenProperties(ret, name+".", v.Properties)
+		case *parser.List:
+			var values []string
+			for _, e := range v.Values {
+				values = append(values, expressionString(e))
+			}
+			ret[name] = property{list: true, values: values}
+		default:
+			ret[name] = property{values: []string{expressionString(v)}}
+		}
+	}
+}
+
+func expressionString(e parser.Expression) string {
+	switch v := e.(type) {
+	case *parser.String:
+		return fmt.Sprintf("%q", v.Value)
+	case *parser.Bool:
+		return fmt.Sprint(v.Value)
+	case *parser.Int64:
+		return fmt.Sprint(v.Value)
+	default:
+		return fmt.Sprint(e)
+	}
+}
+
+// propertyChange is a change to a property of a member present in both snapshots.
+type propertyChange struct {
+	member   string
+	property string
+	old, new *property
+	breaking bool
+}
+
+func (c propertyChange) String() string {
+	switch {
+	case c.old == nil:
+		return fmt.Sprintf("%s: %s added: %s", c.member, c.property, c.new)
+	case c.new == nil:
+		return fmt.Sprintf("%s: %s removed: %s", c.member, c.property, c.old)
+	case c.old.list && c.new.list:
+		removed, added := diffLists(c.old.values, c.new.values)
+		var changes []string
+		for _, v := range removed {
+			changes = append(changes, "-"+v)
+		}
+		for _, v := range added {
+			changes = append(changes, "+"+v)
+		}
+		return fmt.Sprintf("%s: %s: %s", c.member, c.property, strings.Join(changes, " "))
+	default:
+		return fmt.Sprintf("%s: %s: %s -> %s", c.member, c.property, c.old, c.new)
+	}
+}
+
+// fileChange lists the lines of an API text file, or the exported symbols of an ELF file, that
+// were removed or added.
+type fileChange struct {
+	path           string
+	removed, added []string
+}
+
+func (c fileChange) breaking() bool {
+	return len(c.removed) > 0
+}
+
+// snapshotDiff is the difference between two snapshots.
+type snapshotDiff struct {
+	removedMembers  []string
+	addedMembers    []string
+	propertyChanges []propertyChange
+	apiChanges      []fileChange
+	symbolChanges   []fileChange
+}
+
+// breaking returns true if a build that uses the old snapshot may fail to build or run with the
+// new snapshot.
+func (d *snapshotDiff) breaking() bool {
+	if len(d.removedMembers) > 0 {
+		return true
+	}
+	for _, c := range d.propertyChanges {
+		if c.breaking {
+			return true
+		}
+	}
+	for _, c := range slices.Concat(d.apiChanges, d.symbolChanges) {
+		if c.breaking() {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *snapshotDiff) empty() bool {
+	return len(d.removedMembers) == 0 && len(d.addedMembers) == 0 && len(d.propertyChanges) == 0 &&
+		len(d.apiChanges) == 0 && len(d.symbolChanges) == 0
+}
+
+func diffSnapshots(a, b *snapshot) (*snapshotDiff, error) {
+	d := &snapshotDiff{}
+
+	for _, name := range sortedKeys(a.members) {
+		bMember, ok := b.members[name]
+		if !ok {
+			d.removedMembers = append(d.removedMembers, a.members[name].String())
+			continue
+		}
+		d.propertyChanges = append(d.propertyChanges, diffMembers(a.members[name], bMember)...)
+	}
+	for _, name := range sortedKeys(b.members) {
+		if _, ok := a.members[name]; !ok {
+			d.addedMembers = append(d.addedMembers, b.members[name].String())
+		}
+	}
+
+	for _, file := range sortedKeys(unionFiles(a.files, b.files)) {
+		aContents, bContents := a.files[file], b.files[file]
+		if bytes.Equal(aContents, bContents) {
+			continue
+		}
+		switch {
+		case isApiFile(file):
+			removed, added := diffLists(apiLines(aContents), apiLines(bContents))
+			if len(removed) > 0 || len(added) > 0 {
+				d.apiChanges = append(d.apiChanges, fileChange{path: file, removed: removed, added: added})
+			}
+		case path.Ext(file) == ".so":
+			aSymbols, err := exportedSymbols(aContents)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			bSymbols, err := exportedSymbols(bContents)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			removed, added := diffLists(aSymbols, bSymbols)
+			if len(removed) > 0 || len(added) > 0 {
+				d.symbolChanges = append(d.symbolChanges, fileChange{path: file, removed: removed, added: added})
+			}
+		}
+	}
+	return d, nil
+}
+
+// diffMembers compares the properties of a member in two snapshots. Adding properties or list
+// elements is compatible, while removing or changing them is breaking, except for the
+// compatibleProperties.
+func diffMembers(a, b *member) []propertyChange {
+	var ret []propertyChange
+	if a.moduleType != b.moduleType {
+		ret = append(ret, propertyChange{
+			member:   a.String(),
+			property: "module type",
+			old:      &property{values: []string{a.moduleType}},
+			new:      &property{values: []string{b.moduleType}},
+			breaking: true,
+		})
+	}
+	for _, name := range sortedKeys(unionProperties(a.properties, b.properties)) {
+		aValue, inA := a.properties[name]
+		bValue, inB := b.properties[name]
+		c := propertyChange{member: a.String(), property: name}
+		switch {
+		case !inA:
+			c.new = &bValue
+		case !inB:
+			c.old = &aValue
+			c.breaking = true
+		case aValue.list && bValue.list:
+			removed, added := diffLists(aValue.values, bValue.values)
+			if len(removed) == 0 && len(added) == 0 {
+				continue
+			}
+			c.old, c.new = &aValue, &bValue
+			c.breaking = len(removed) > 0
+		default:
+			if aValue.String() == bValue.String() {
+				continue
+			}
+			c.old, c.new = &aValue, &bValue
+			c.breaking = true
+		}
+		if compatibleProperties[name] {
+			c.breaking = false
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+// isApiFile returns true for the API signature files of the java_sdk_library members.
+func isApiFile(file string) bool {
+	return strings.HasPrefix(file, "sdk_library/") && path.Ext(file) == ".txt"
+}
+
+// apiLines returns the lines of an API signature file that declare packages, classes and
+// members. Class declarations are qualified with their package and members with their enclosing
+// class, e.g. "android.foo.Foo: method public void close();", so that the same member in
+// different classes is not confused.
+func apiLines(contents []byte) []string {
+	var ret []string
+	var pkg, class string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		case line == "}":
+			if class != "" {
+				class = ""
+			} else {
+				pkg = ""
+			}
+			continue
+		case strings.HasPrefix(line, "package ") && strings.HasSuffix(line, "{"):
+			pkg = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "package "), "{"))
+			line = "package " + pkg
+		case pkg != "" && class == "" && strings.HasSuffix(line, "{"):
+			line = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+			class = pkg + "." + apiClassName(line)
+			line = class + ": " + line
+		case class != "":
+			line = class + ": " + line
+		}
+		ret = append(ret, line)
+	}
+	return ret
+}
+
+// apiClassName returns the name of the class declared by a line of an API signature file, without
+// type parameters, e.g. "Foo.Bar" for "public static class Foo.Bar<T> extends Foo".
+func apiClassName(declaration string) string {
+	fields := strings.Fields(declaration)
+	for i, field := range fields {
+		if i+1 < len(fields) && (field == "class" || field == "interface" || field == "enum" || field == "@interface") {
+			name, _, _ := strings.Cut(fields[i+1], "<")
+			return name
+		}
+	}
+	return declaration
+}
+
+// exportedSymbols returns the dynamic symbols defined by an ELF file.
+func exportedSymbols(contents []byte) ([]string, error) {
+	if contents == nil {
+		return nil, nil
+	}
+	f, err := elf.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	symbols, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	var ret []string
+	for _, s := range symbols {
+		bind := elf.ST_BIND(s.Info)
+		// Version definitions are absolute symbols.
+		if s.Section == elf.SHN_UNDEF || s.Section == elf.SHN_ABS ||
+			(bind != elf.STB_GLOBAL && bind != elf.STB_WEAK) ||
+			elf.ST_VISIBILITY(s.Other) != elf.STV_DEFAULT {
+			continue
+		}
+		ret = append(ret, s.Name)
+	}
+	return ret, nil
+}
+
+// diffLists returns the sorted values only in a and only in b.
+func diffLists(a, b []string) (onlyA, onlyB []string) {
+	inA := make(map[string]bool)
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[string]bool)
+	for _, v := range b {
+		inB[v] = true
+	}
+	for _, v := range sortedKeys(inA) {
+		if !inB[v] {
+			onlyA = append(onlyA, v)
+		}
+	}
+	for _, v := range sortedKeys(inB) {
+		if !inA[v] {
+			onlyB = append(onlyB, v)
+		}
+	}
+	return onlyA, onlyB
+}
+
+func unionFiles(a, b map[string][]byte) map[string][]byte {
+	ret := make(map[string][]byte)
+	for k, v := range a {
+		ret[k] = v
+	}
+	for k, v := range b {
+		ret[k] = v
+	}
+	return ret
+}
+
+func unionProperties(a, b map[string]property) map[string]property {
+	ret := make(map[string]property)
+	for k, v := range a {
+		ret[k] = v
+	}
+	for k, v := range b {
+		ret[k] = v
+	}
+	return ret
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func breakingSuffix(breaking bool) string {
+	if breaking {
+		return " [breaking]"
+	}
+	return ""
+}
+
+func writeFileChanges(w io.Writer, title string, changes []fileChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, c := range changes {
+		fmt.Fprintf(w, "  %s%s\n", c.path, breakingSuffix(c.breaking()))
+		for _, line := range c.removed {
+			fmt.Fprintf(w, "    - %s\n", line)
+		}
+		for _, line := range c.added {
+			fmt.Fprintf(w, "    + %s\n", line)
+		}
+	}
+}
+
+// writeReport writes a human readable description of the difference, ending with the
+// classification of the change.
+func writeReport(w io.Writer, d *snapshotDiff) {
+	if len(d.removedMembers) > 0 {
+		fmt.Fprintf(w, "Removed members:\n")
+		for _, m := range d.removedMembers {
+			fmt.Fprintf(w, "  %s%s\n", m, breakingSuffix(true))
+		}
+	}
+	if len(d.addedMembers) > 0 {
+		fmt.Fprintf(w, "Added members:\n")
+		for _, m := range d.addedMembers {
+			fmt.Fprintf(w, "  %s\n", m)
+		}
+	}
+	if len(d.propertyChanges) > 0 {
+		fmt.Fprintf(w, "Property changes:\n")
+		for _, c := range d.propertyChanges {
+			fmt.Fprintf(w, "  %s%s\n", c.String(), breakingSuffix(c.breaking))
+		}
+	}
+	writeFileChanges(w, "API file changes", d.apiChanges)
+	writeFileChanges(w, "Exported symbol changes", d.symbolChanges)
+
+	switch {
+	case d.empty():
+		fmt.Fprintf(w, "Result: identical\n")
+	case d.breaking():
+		fmt.Fprintf(w, "Result: breaking\n")
+	default:
+		fmt.Fprintf(w, "Result: compatible\n")
+	}
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdk_snapshot_diff <old snapshot zip> <new snapshot zip>\n\n")
+		fmt.Fprintf(os.Stderr, "Exits with status 1 if the change is breaking.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var snapshots []*snapshot
+	for _, file := range flags.Args() {
+		s, err := readSnapshot(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			os.Exit(2)
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	d, err := diffSnapshots(snapshots[0], snapshots[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(2)
+	}
+	writeReport(os.Stdout, d)
+	if d.breaking() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSnapshot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "snapshot.zip")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, name := range sortedKeys(files) {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+const testBp = `// This is auto-generated. DO NOT EDIT.
+
+package {
+    default_visibility: ["//visibility:public"],
+}
+
+java_sdk_library_import {
+    name: "myjavalib",
+    prefer: false,
+    visibility: ["//visibility:public"],
+    apex_available: ["com.android.foo"],
+    shared_library: true,
+    public: {
+        jars: ["sdk_library/public/myjavalib-stubs.jar"],
+        current_api: "sdk_library/public/myjavalib.txt",
+        sdk_version: "current",
+    },
+}
+
+cc_prebuilt_library_shared {
+    name: "libfoo",
+    prefer: false,
+    min_sdk_version: "29",
+    apex_available: ["com.android.foo"],
+}
+`
+
+const testApi = `// Signature format: 2.0
+package android.foo {
+
+  public class Bar implements java.io.Closeable {
+    method public void close();
+  }
+
+  public class Foo implements java.io.Closeable {
+    method public void close();
+    method public void foo();
+  }
+
+}
+`
+
+func testSnapshotDiff(t *testing.T, a, b map[string]string) (*snapshotDiff, string) {
+	t.Helper()
+	aSnapshot, err := readSnapshot(writeSnapshot(t, a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSnapshot, err := readSnapshot(writeSnapshot(t, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := diffSnapshots(aSnapshot, bSnapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &strings.Builder{}
+	writeReport(report, d)
+	return d, report.String()
+}
+
+type edit struct {
+	file, from, to string
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	base := map[string]string{
+		"Android.bp":                         testBp,
+		"sdk_library/public/myjavalib.txt":   testApi,
+		"snapshot-creation-build-number.txt": "1",
+	}
+
+	testCases := []struct {
+		name     string
+		edits    []edit
+		expected []string
+	}{
+		{
+			name: "identical",
+			edits: []edit{
+				{"snapshot-creation-build-number.txt", "1", "2"},
+			},
+			expected: []string{"Result: identical\n"},
+		},
+		{
+			name: "compatible",
+			edits: []edit{
+				{"Android.bp", "cc_prebuilt_library_shared {", "cc_prebuilt_library_shared {\n    name: \"libbar\",\n}\n\ncc_prebuilt_library_shared {"},
+				{"Android.bp", "prefer: false", "prefer: true"},
+				{"Android.bp", `apex_available: ["com.android.foo"]`, `apex_available: ["com.android.foo", "com.android.bar"]`},
+				{"sdk_library/public/myjavalib.txt", "method public void foo();", "method public void foo();\n    method public void bar();"},
+			},
+			expected: []string{
+				"Added members:\n  cc_prebuilt_library_shared libbar\n",
+				`  java_sdk_library_import myjavalib: apex_available: +"com.android.bar"` + "\n",
+				"  java_sdk_library_import myjavalib: prefer: false -> true\n",
+				"API file changes:\n  sdk_library/public/myjavalib.txt\n    + android.foo.Foo: method public void bar();\n",
+				"Result: compatible\n",
+			},
+		},
+		{
+			name: "breaking",
+			edits: []edit{
+				{"Android.bp", "min_sdk_version: \"29\",\n    apex_available: [\"com.android.foo\"],", `min_sdk_version: "30",`},
+				{"sdk_library/public/myjavalib.txt", "method public void foo();", "method public void bar();"},
+			},
+			expected: []string{
+				`  cc_prebuilt_library_shared libfoo: apex_available removed: ["com.android.foo"] [breaking]` + "\n",
+				`  cc_prebuilt_library_shared libfoo: min_sdk_version: "29" -> "30" [breaking]` + "\n",
+				"  sdk_library/public/myjavalib.txt [breaking]\n    - android.foo.Foo: method public void foo();\n    + android.foo.Foo: method public void bar();\n",
+				"Result: breaking\n",
+			},
+		},
+		{
+			// The member is removed from one class, but is still in another one.
+			name: "removed class member",
+			edits: []edit{
+				{"sdk_library/public/myjavalib.txt", "    method public void close();\n    method public void foo();", "    method public void foo();"},
+			},
+			expected: []string{
+				"  sdk_library/public/myjavalib.txt [breaking]\n    - android.foo.Foo: method public void close();\n",
+				"Result: breaking\n",
+			},
+		},
+		{
+			name: "removed member",
+			edits: []edit{
+				{"Android.bp", `name: "libfoo"`, `name: "libbar"`},
+			},
+			expected: []string{
+				"Removed members:\n  cc_prebuilt_library_shared libfoo [breaking]\n",
+				"Added members:\n  cc_prebuilt_library_shared libbar\n",
+				"Result: breaking\n",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := make(map[string]string)
+			for name, contents := range base {
+				modified[name] = contents
+			}
+			for _, e := range tc.edits {
+				if !strings.Contains(modified[e.file], e.from) {
+					t.Fatalf("%q not found in %s", e.from, e.file)
+				}
+				modified[e.file] = strings.Replace(modified[e.file], e.from, e.to, -1)
+			}
+
+			d, report := testSnapshotDiff(t, base, modified)
+			for _, expected := range tc.expected {
+				if !strings.Contains(report, expected) {
+					t.Errorf("expected %q in report:\n%s", expected, report)
+				}
+			}
+			if d.breaking() != strings.HasSuffix(report, "Result: breaking\n") {
+				t.Errorf("unexpected classification in report:\n%s", report)
+			}
+		})
+	}
+}
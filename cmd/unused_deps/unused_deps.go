@@ -0,0 +1,517 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// unused_deps finds the header_libs, shared_libs and static_libs of a cc module variant that are
+// not used. It reads the depfiles of the compiled sources to find the headers that were included,
+// the output of lld --trace to find the static libraries that no archive member was extracted from,
+// and the dynamic symbol tables of the linked output and its shared libraries to count the
+// referenced symbols that each shared library defines. lld does not implement the
+// --print-symbol-counts option of gold, which reports the same counts.
+//
+// The headers of the dependencies that are reexported with an export_*_lib_headers property may be
+// included by the reverse dependencies of the module rather than by the module itself. The input of
+// each module variant lists the headers reexported by its dependencies, and its report lists the ones
+// it includes. The export_*_lib_headers entries, and the header_libs they reexport, are only
+// reported as unused if neither the module nor any of its reverse dependencies includes the headers.
+//
+// With -merge, it combines the reports of all the variants of all modules into a single report.
+// A dependency is only reported as unused if it is unused in every variant that declares it. The
+// merged report includes the edits that remove the unused dependencies, which can also be written
+// to a separate file that bpfix -edits applies.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"android/soong/bpfix/bpfix"
+	"android/soong/makedeps"
+)
+
+var (
+	outFile   = flag.String("o", "", "output report file")
+	merge     = flag.Bool("merge", false, "merge the reports of module variants")
+	editsFile = flag.String("edits", "", "with -merge, also write the suggested edits to this file")
+)
+
+// dep is a dependency of a module variant declared in its Android.bp file, as described by Soong.
+type dep struct {
+	Name        string   `json:"name"`
+	Property    string   `json:"property"`
+	IncludeDirs []string `json:"include_dirs,omitempty"`
+	LinkFile    string   `json:"link_file,omitempty"`
+	Reexported  bool     `json:"reexported,omitempty"`
+}
+
+// reexportRef identifies a dependency whose headers a module reexports.
+type reexportRef struct {
+	Module string `json:"module"`
+	File   string `json:"file"`
+	Name   string `json:"name"`
+}
+
+// reexport is a dependency whose headers a module reexports, as described by Soong.
+type reexport struct {
+	reexportRef
+	IncludeDirs []string `json:"include_dirs,omitempty"`
+}
+
+// moduleInput describes a module variant and the files produced when building it. It is written
+// by Soong in cc/unused_deps.go.
+type moduleInput struct {
+	Module    string   `json:"module"`
+	Variant   string   `json:"variant"`
+	File      string   `json:"file"`
+	DepFiles  []string `json:"dep_files"`
+	LinkTrace string   `json:"link_trace,omitempty"`
+	Output    string   `json:"output,omitempty"`
+	Deps      []dep    `json:"deps"`
+	// DepReexports are the headers reexported by the dependencies of the module variant.
+	DepReexports []reexport `json:"dep_reexports,omitempty"`
+}
+
+// depRef identifies a dependency in a property of a module.
+type depRef struct {
+	Name     string `json:"name"`
+	Property string `json:"property"`
+}
+
+type unusedDep struct {
+	depRef
+	Reason string `json:"reason"`
+	// True if the headers of a shared or static library are included even though it is not used by
+	// the linker. Such a dependency cannot simply be removed.
+	HeadersUsed bool `json:"headers_used,omitempty"`
+	// True if the headers of the dependency are reexported, so that they may be included by the
+	// reverse dependencies of the module.
+	Reexported bool `json:"reexported,omitempty"`
+}
+
+// variantReport is the report of a single module variant.
+type variantReport struct {
+	Module  string      `json:"module"`
+	Variant string      `json:"variant"`
+	File    string      `json:"file"`
+	Checked []depRef    `json:"checked"`
+	Unused  []unusedDep `json:"unused"`
+	// ReverseUses are the reexported headers of the dependencies that the variant includes.
+	ReverseUses []reexportRef `json:"reverse_uses,omitempty"`
+}
+
+type moduleReport struct {
+	Module string      `json:"module"`
+	File   string      `json:"file"`
+	Unused []unusedDep `json:"unused"`
+}
+
+type report struct {
+	Modules []moduleReport `json:"modules"`
+	Edits   []bpfix.Edit   `json:"edits"`
+}
+
+const (
+	reasonNoHeaders = "no exported header is included"
+	reasonNoSymbols = "no referenced symbol is defined"
+	reasonNoMembers = "no archive member is linked"
+)
+
+// exportProperties are the properties that reexport the headers of the dependencies listed in each
+// property.
+var exportProperties = map[string]string{
+	"header_libs": "export_header_lib_headers",
+	"shared_libs": "export_shared_lib_headers",
+	"static_libs": "export_static_lib_headers",
+}
+
+// includedFiles returns the files listed as inputs of the depfiles.
+func includedFiles(depFiles []string) ([]string, error) {
+	var files []string
+	for _, depFile := range depFiles {
+		data, err := os.ReadFile(depFile)
+		if err != nil {
+			return nil, err
+		}
+		deps, err := makedeps.Parse(depFile, bytes.NewBuffer(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", depFile, err)
+		}
+		for _, input := range deps.Inputs {
+			files = append(files, filepath.Clean(input))
+		}
+	}
+	return files, nil
+}
+
+// headersUsed returns true if any of the files is in one of the include directories.
+func headersUsed(includeDirs []string, files []string) bool {
+	for _, dir := range includeDirs {
+		dir = filepath.Clean(dir)
+		prefix := dir + "/"
+		if dir == "." {
+			prefix = ""
+		}
+		for _, file := range files {
+			if strings.HasPrefix(file, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseLinkTrace parses the output of lld --trace, which lists each file loaded by the linker, and
+// returns the number of members extracted from each archive. Extracted members are listed as
+// archive(member), the archives that no member was extracted from are not listed.
+func parseLinkTrace(r io.Reader) (map[string]int, error) {
+	extracted := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasSuffix(line, ")") {
+			continue
+		}
+		i := strings.LastIndex(line, "(")
+		if i <= 0 {
+			continue
+		}
+		extracted[filepath.Clean(line[:i])]++
+	}
+	return extracted, scanner.Err()
+}
+
+// dynamicSymbols returns the names of the undefined or the defined dynamic symbols of an ELF file.
+func dynamicSymbols(file string, defined bool) (map[string]bool, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	syms, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, fmt.Errorf("failed to read dynamic symbols of %s: %s", file, err)
+	}
+	names := make(map[string]bool)
+	for _, sym := range syms {
+		if (sym.Section != elf.SHN_UNDEF) == defined && sym.Name != "" {
+			names[sym.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// symbolCount returns the number of undefined symbols of the linked output that a shared library
+// defines.
+func symbolCount(undefined, defined map[string]bool) int {
+	count := 0
+	for name := range undefined {
+		if defined[name] {
+			count++
+		}
+	}
+	return count
+}
+
+// check returns the report of a module variant.
+func check(input moduleInput) (*variantReport, error) {
+	files, err := includedFiles(input.DepFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var extractedMembers map[string]int
+	if input.LinkTrace != "" {
+		f, err := os.Open(input.LinkTrace)
+		if err != nil {
+			return nil, err
+		}
+		extractedMembers, err = parseLinkTrace(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var undefined map[string]bool
+	if input.Output != "" {
+		undefined, err = dynamicSymbols(input.Output, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &variantReport{
+		Module:  input.Module,
+		Variant: input.Variant,
+		File:    input.File,
+		Checked: []depRef{},
+		Unused:  []unusedDep{},
+	}
+	for _, d := range input.Deps {
+		ref := depRef{Name: d.Name, Property: d.Property}
+		usesHeaders := headersUsed(d.IncludeDirs, files)
+
+		switch d.Property {
+		case "shared_libs":
+			if undefined == nil || d.LinkFile == "" {
+				break
+			}
+			defined, err := dynamicSymbols(d.LinkFile, true)
+			if err != nil {
+				return nil, err
+			}
+			ret.Checked = append(ret.Checked, ref)
+			if symbolCount(undefined, defined) == 0 {
+				ret.Unused = append(ret.Unused, unusedDep{ref, reasonNoSymbols, usesHeaders, d.Reexported})
+			}
+		case "static_libs":
+			if extractedMembers == nil || d.LinkFile == "" {
+				break
+			}
+			ret.Checked = append(ret.Checked, ref)
+			if extractedMembers[filepath.Clean(d.LinkFile)] == 0 {
+				ret.Unused = append(ret.Unused, unusedDep{ref, reasonNoMembers, usesHeaders, d.Reexported})
+			}
+		default:
+			ret.Checked = append(ret.Checked, ref)
+			if !usesHeaders {
+				ret.Unused = append(ret.Unused, unusedDep{ref, reasonNoHeaders, false, d.Reexported})
+			}
+		}
+
+		if d.Reexported {
+			exportRef := depRef{Name: d.Name, Property: exportProperties[d.Property]}
+			ret.Checked = append(ret.Checked, exportRef)
+			if !usesHeaders {
+				ret.Unused = append(ret.Unused, unusedDep{exportRef, reasonNoHeaders, false, true})
+			}
+		}
+	}
+
+	for _, r := range input.DepReexports {
+		if headersUsed(r.IncludeDirs, files) {
+			ret.ReverseUses = append(ret.ReverseUses, r.reexportRef)
+		}
+	}
+	return ret, nil
+}
+
+// mergeReports combines the reports of module variants. A dependency is unused if it is unused in
+// every variant of the module that checked it. The reexported headers of a dependency are used if
+// any variant of any module includes them.
+func mergeReports(variants []*variantReport) *report {
+	reverseUsed := make(map[reexportRef]bool)
+	for _, v := range variants {
+		for _, r := range v.ReverseUses {
+			reverseUsed[r] = true
+		}
+	}
+
+	type moduleKey struct {
+		file, module string
+	}
+	type depState struct {
+		checked, unused int
+		unusedDep       unusedDep
+	}
+
+	var keys []moduleKey
+	states := make(map[moduleKey]map[depRef]*depState)
+	for _, v := range variants {
+		key := moduleKey{v.File, v.Module}
+		deps := states[key]
+		if deps == nil {
+			deps = make(map[depRef]*depState)
+			states[key] = deps
+			keys = append(keys, key)
+		}
+		for _, ref := range v.Checked {
+			s := deps[ref]
+			if s == nil {
+				s = &depState{}
+				deps[ref] = s
+			}
+			s.checked++
+		}
+		for _, u := range v.Unused {
+			if u.Reexported && reverseUsed[reexportRef{Module: v.Module, File: v.File, Name: u.Name}] {
+				if u.Property != "shared_libs" && u.Property != "static_libs" {
+					// The headers are all that is used of header libraries.
+					continue
+				}
+				u.HeadersUsed = true
+			}
+			if s := deps[u.depRef]; s != nil {
+				if s.unused == 0 {
+					s.unusedDep = u
+				}
+				s.unusedDep.HeadersUsed = s.unusedDep.HeadersUsed || u.HeadersUsed
+				s.unused++
+			}
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].file != keys[j].file {
+			return keys[i].file < keys[j].file
+		}
+		return keys[i].module < keys[j].module
+	})
+
+	ret := &report{
+		Modules: []moduleReport{},
+		Edits:   []bpfix.Edit{},
+	}
+	for _, key := range keys {
+		var unused []unusedDep
+		for _, s := range states[key] {
+			if s.unused == s.checked {
+				unused = append(unused, s.unusedDep)
+			}
+		}
+		if len(unused) == 0 {
+			continue
+		}
+		sort.Slice(unused, func(i, j int) bool {
+			if unused[i].Property != unused[j].Property {
+				return unused[i].Property < unused[j].Property
+			}
+			return unused[i].Name < unused[j].Name
+		})
+		ret.Modules = append(ret.Modules, moduleReport{
+			Module: key.module,
+			File:   key.file,
+			Unused: unused,
+		})
+
+		// Dependencies whose headers are used cannot be removed, they would need to be moved to
+		// header_libs instead.
+		var edit *bpfix.Edit
+		for _, u := range unused {
+			if u.HeadersUsed {
+				continue
+			}
+			if edit == nil || edit.Property != u.Property {
+				ret.Edits = append(ret.Edits, bpfix.Edit{
+					File:     key.file,
+					Module:   key.module,
+					Property: u.Property,
+				})
+				edit = &ret.Edits[len(ret.Edits)-1]
+			}
+			edit.Remove = append(edit.Remove, u.Name)
+		}
+	}
+	return ret
+}
+
+func writeJSON(file string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0666)
+}
+
+func readJSON(file string, v interface{}) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %s", file, err)
+	}
+	return nil
+}
+
+// expandArgs expands the response files among the arguments.
+func expandArgs(args []string) ([]string, error) {
+	var ret []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			ret = append(ret, arg)
+			continue
+		}
+		data, err := os.ReadFile(strings.TrimPrefix(arg, "@"))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, strings.Fields(string(data))...)
+	}
+	return ret, nil
+}
+
+func run() error {
+	if *outFile == "" {
+		return fmt.Errorf("-o is required")
+	}
+	args, err := expandArgs(flag.Args())
+	if err != nil {
+		return err
+	}
+
+	if !*merge {
+		if len(args) != 1 {
+			return fmt.Errorf("expected a single module input file, got %q", args)
+		}
+		var input moduleInput
+		if err := readJSON(args[0], &input); err != nil {
+			return err
+		}
+		r, err := check(input)
+		if err != nil {
+			return fmt.Errorf("%s: %s", input.Module, err)
+		}
+		return writeJSON(*outFile, r)
+	}
+
+	var variants []*variantReport
+	for _, arg := range args {
+		v := &variantReport{}
+		if err := readJSON(arg, v); err != nil {
+			return err
+		}
+		variants = append(variants, v)
+	}
+	r := mergeReports(variants)
+	if *editsFile != "" {
+		if err := writeJSON(*editsFile, r.Edits); err != nil {
+			return err
+		}
+	}
+	return writeJSON(*outFile, r)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -o <report.json> <module.json>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -merge -o <report.json> [-edits <edits.json>] <report.json>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "unused_deps:", err)
+		os.Exit(1)
+	}
+}
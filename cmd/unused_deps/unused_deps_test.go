@@ -0,0 +1,234 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"android/soong/bpfix/bpfix"
+)
+
+func TestParseLinkTrace(t *testing.T) {
+	trace := "out/crtbegin.o\n" +
+		"out/foo.o\n" +
+		"out/libfoo.a(a.o)\n" +
+		"out/./libfoo.a(b.o)\n" +
+		"out/libbar.a(bar.o)\n" +
+		"out/libbaz.so\n"
+	got, err := parseLinkTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"out/libfoo.a": 2, "out/libbar.a": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLinkTrace() = %v, want %v", got, want)
+	}
+}
+
+func TestHeadersUsed(t *testing.T) {
+	files := []string{"foo/include/foo.h", "bar/bar.h"}
+	testCases := []struct {
+		includeDirs []string
+		want        bool
+	}{
+		{[]string{"foo/include"}, true},
+		{[]string{"foo/include/"}, true},
+		{[]string{"foo/inc"}, false},
+		{[]string{"baz", "bar"}, true},
+		{nil, false},
+	}
+	for _, tc := range testCases {
+		if got := headersUsed(tc.includeDirs, files); got != tc.want {
+			t.Errorf("headersUsed(%q) = %v, want %v", tc.includeDirs, got, tc.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	depFile := write("foo.deps", "out/foo.o: foo/foo.cpp libused/include/used.h \\\n  ./libstatic/include/static.h\n")
+	linkTrace := write("link_trace", "out/foo.o\n"+
+		"out/libother.a(a.o)\n"+
+		"out/libother.a(b.o)\n")
+
+	input := moduleInput{
+		Module:    "foo",
+		Variant:   "android_arm64_armv8-a",
+		File:      "foo/Android.bp",
+		DepFiles:  []string{depFile},
+		LinkTrace: linkTrace,
+		Deps: []dep{
+			{Name: "libused", Property: "header_libs", IncludeDirs: []string{"libused/include"}},
+			{Name: "libunused", Property: "header_libs", IncludeDirs: []string{"libunused/include"}},
+			// The headers of reexported header libraries may be used by reverse dependencies.
+			{Name: "libreexported", Property: "header_libs", IncludeDirs: []string{"libreexported/include"}, Reexported: true},
+			{Name: "libstatic", Property: "static_libs", IncludeDirs: []string{"libstatic/include"}, LinkFile: "out/libstatic.a"},
+			{Name: "libother", Property: "static_libs", LinkFile: "out/libother.a"},
+			{Name: "libstaticreexported", Property: "static_libs", LinkFile: "out/libstaticreexported.a", Reexported: true},
+			// Shared libraries are not checked without a linked output.
+			{Name: "libshared", Property: "shared_libs", LinkFile: "out/libshared.so"},
+		},
+		DepReexports: []reexport{
+			{reexportRef{"libdep", "libdep/Android.bp", "libused"}, []string{"libused/include"}},
+			{reexportRef{"libdep", "libdep/Android.bp", "libunused"}, []string{"libunused/include"}},
+		},
+	}
+
+	got, err := check(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantChecked := []depRef{
+		{"libused", "header_libs"},
+		{"libunused", "header_libs"},
+		{"libreexported", "header_libs"},
+		{"libreexported", "export_header_lib_headers"},
+		{"libstatic", "static_libs"},
+		{"libother", "static_libs"},
+		{"libstaticreexported", "static_libs"},
+		{"libstaticreexported", "export_static_lib_headers"},
+	}
+	if !reflect.DeepEqual(got.Checked, wantChecked) {
+		t.Errorf("checked = %v, want %v", got.Checked, wantChecked)
+	}
+	// The reexported headers that the module does not include are unused unless a reverse
+	// dependency includes them, which is only known when the reports are merged.
+	wantUnused := []unusedDep{
+		{depRef{"libunused", "header_libs"}, reasonNoHeaders, false, false},
+		{depRef{"libreexported", "header_libs"}, reasonNoHeaders, false, true},
+		{depRef{"libreexported", "export_header_lib_headers"}, reasonNoHeaders, false, true},
+		{depRef{"libstatic", "static_libs"}, reasonNoMembers, true, false},
+		{depRef{"libstaticreexported", "static_libs"}, reasonNoMembers, false, true},
+		{depRef{"libstaticreexported", "export_static_lib_headers"}, reasonNoHeaders, false, true},
+	}
+	if !reflect.DeepEqual(got.Unused, wantUnused) {
+		t.Errorf("unused = %v, want %v", got.Unused, wantUnused)
+	}
+
+	wantReverseUses := []reexportRef{{"libdep", "libdep/Android.bp", "libused"}}
+	if !reflect.DeepEqual(got.ReverseUses, wantReverseUses) {
+		t.Errorf("reverse uses = %v, want %v", got.ReverseUses, wantReverseUses)
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	variants := []*variantReport{
+		{
+			Module: "foo",
+			File:   "foo/Android.bp",
+			Checked: []depRef{
+				{"liba", "header_libs"},
+				{"libb", "header_libs"},
+				{"libc", "shared_libs"},
+				{"libd", "static_libs"},
+			},
+			Unused: []unusedDep{
+				{depRef{"liba", "header_libs"}, reasonNoHeaders, false, false},
+				{depRef{"libb", "header_libs"}, reasonNoHeaders, false, false},
+				{depRef{"libc", "shared_libs"}, reasonNoSymbols, false, false},
+				{depRef{"libd", "static_libs"}, reasonNoMembers, true, false},
+			},
+		},
+		{
+			Module: "qux",
+			File:   "qux/Android.bp",
+			Checked: []depRef{
+				{"libe", "header_libs"},
+				{"libe", "export_header_lib_headers"},
+				{"libf", "header_libs"},
+				{"libf", "export_header_lib_headers"},
+				{"libg", "shared_libs"},
+				{"libg", "export_shared_lib_headers"},
+			},
+			// None of the reexported headers are included by qux itself.
+			Unused: []unusedDep{
+				{depRef{"libe", "header_libs"}, reasonNoHeaders, false, true},
+				{depRef{"libe", "export_header_lib_headers"}, reasonNoHeaders, false, true},
+				{depRef{"libf", "header_libs"}, reasonNoHeaders, false, true},
+				{depRef{"libf", "export_header_lib_headers"}, reasonNoHeaders, false, true},
+				{depRef{"libg", "shared_libs"}, reasonNoSymbols, false, true},
+				{depRef{"libg", "export_shared_lib_headers"}, reasonNoHeaders, false, true},
+			},
+		},
+		{
+			Module: "foo",
+			File:   "foo/Android.bp",
+			Checked: []depRef{
+				{"libb", "header_libs"},
+			},
+			// libb is used by this variant.
+			Unused: []unusedDep{},
+		},
+		{
+			Module: "bar",
+			File:   "bar/Android.bp",
+			Checked: []depRef{
+				{"liba", "header_libs"},
+			},
+			Unused: []unusedDep{},
+			// bar includes the headers of libe and libg reexported by qux.
+			ReverseUses: []reexportRef{
+				{"qux", "qux/Android.bp", "libe"},
+				{"qux", "qux/Android.bp", "libg"},
+			},
+		},
+	}
+
+	got := mergeReports(variants)
+	want := &report{
+		Modules: []moduleReport{
+			{
+				Module: "foo",
+				File:   "foo/Android.bp",
+				Unused: []unusedDep{
+					{depRef{"liba", "header_libs"}, reasonNoHeaders, false, false},
+					{depRef{"libc", "shared_libs"}, reasonNoSymbols, false, false},
+					{depRef{"libd", "static_libs"}, reasonNoMembers, true, false},
+				},
+			},
+			{
+				Module: "qux",
+				File:   "qux/Android.bp",
+				Unused: []unusedDep{
+					{depRef{"libf", "export_header_lib_headers"}, reasonNoHeaders, false, true},
+					{depRef{"libf", "header_libs"}, reasonNoHeaders, false, true},
+					{depRef{"libg", "shared_libs"}, reasonNoSymbols, true, true},
+				},
+			},
+		},
+		Edits: []bpfix.Edit{
+			{File: "foo/Android.bp", Module: "foo", Property: "header_libs", Remove: []string{"liba"}},
+			{File: "foo/Android.bp", Module: "foo", Property: "shared_libs", Remove: []string{"libc"}},
+			{File: "qux/Android.bp", Module: "qux", Property: "export_header_lib_headers", Remove: []string{"libf"}},
+			{File: "qux/Android.bp", Module: "qux", Property: "header_libs", Remove: []string{"libf"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeReports() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// check_license_policy walks the license metadata graph of a container and
+// reports the dependencies that violate a license policy.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"android/soong/compliance/license_graph"
+)
+
+// policy is the format of the policy file.
+type policy struct {
+	Rules []*policyRule `json:"rules"`
+}
+
+// policyRule forbids modules with any of the target conditions from depending,
+// directly or transitively through edges with one of the linkages, on modules
+// with any of the dependency conditions.
+type policyRule struct {
+	// Name identifies the rule in error messages.
+	Name string `json:"name"`
+
+	// Description explains the rule in error messages.
+	Description string `json:"description"`
+
+	// TargetConditions lists the license conditions of the depending modules
+	// the rule applies to.
+	TargetConditions []string `json:"target_conditions"`
+
+	// DependencyConditions lists the license conditions of the dependencies
+	// that are forbidden.
+	DependencyConditions []string `json:"dependency_conditions"`
+
+	// Linkage lists the kinds of dependency edges that are followed, one of
+	// "static", "dynamic" or "toolchain". Defaults to "static".
+	Linkage []license_graph.Linkage `json:"linkage"`
+}
+
+func readPolicy(file string) (*policy, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy %q: %w", file, err)
+	}
+	p := &policy{}
+	if err := json.Unmarshal(buf, p); err != nil {
+		return nil, fmt.Errorf("error parsing policy %q: %w", file, err)
+	}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%s: rule %d has no name", file, i)
+		}
+		if len(rule.TargetConditions) == 0 || len(rule.DependencyConditions) == 0 {
+			return nil, fmt.Errorf("%s: rule %q needs target_conditions and dependency_conditions", file, rule.Name)
+		}
+		if len(rule.Linkage) == 0 {
+			rule.Linkage = []license_graph.Linkage{license_graph.LinkageStatic}
+		}
+		for _, linkage := range rule.Linkage {
+			switch linkage {
+			case license_graph.LinkageStatic, license_graph.LinkageDynamic, license_graph.LinkageToolchain:
+			default:
+				return nil, fmt.Errorf("%s: rule %q has unknown linkage %q", file, rule.Name, linkage)
+			}
+		}
+	}
+	return p, nil
+}
+
+func hasAnyCondition(n *license_graph.Node, conditions []string) bool {
+	for _, condition := range n.Metadata.GetLicenseConditions() {
+		if slices.Contains(conditions, condition) {
+			return true
+		}
+	}
+	return false
+}
+
+// violation is a dependency path that breaks a policy rule.
+type violation struct {
+	rule *policyRule
+	path []*license_graph.Node
+}
+
+func (v *violation) String() string {
+	var names []string
+	for _, n := range v.path {
+		names = append(names, n.Name())
+	}
+	target, dep := v.path[0], v.path[len(v.path)-1]
+	return fmt.Sprintf("%s: %s\n    %s (%s) depends on %s (%s)\n    dependency path: %s",
+		v.rule.Name, v.rule.Description,
+		target.Name(), strings.Join(target.Metadata.GetLicenseConditions(), ", "),
+		dep.Name(), strings.Join(dep.Metadata.GetLicenseConditions(), ", "),
+		strings.Join(names, " -> "))
+}
+
+// check applies the policy to every module in the container, returning the
+// violations sorted by rule and dependency path.
+func check(g *license_graph.Graph, p *policy) []*violation {
+	inContainer := g.InContainer()
+
+	var ret []*violation
+	for _, rule := range p.Rules {
+		for _, target := range inContainer {
+			if !hasAnyCondition(target, rule.TargetConditions) {
+				continue
+			}
+			ret = append(ret, checkTarget(rule, target)...)
+		}
+	}
+	return ret
+}
+
+// checkTarget finds the shortest path from the target to each dependency that
+// the rule forbids.
+func checkTarget(rule *policyRule, target *license_graph.Node) []*violation {
+	var ret []*violation
+	parents := map[*license_graph.Node]*license_graph.Node{target: nil}
+	queue := []*license_graph.Node{target}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range n.Deps {
+			if !slices.Contains(rule.Linkage, e.Linkage) {
+				continue
+			}
+			if _, ok := parents[e.Dep]; ok {
+				continue
+			}
+			parents[e.Dep] = n
+			queue = append(queue, e.Dep)
+			if hasAnyCondition(e.Dep, rule.DependencyConditions) {
+				var path []*license_graph.Node
+				for p := e.Dep; p != nil; p = parents[p] {
+					path = append([]*license_graph.Node{p}, path...)
+				}
+				ret = append(ret, &violation{rule: rule, path: path})
+			}
+		}
+	}
+	return ret
+}
+
+func run(w io.Writer, policyFile, rootFile, outFile, depFile string) (bool, error) {
+	p, err := readPolicy(policyFile)
+	if err != nil {
+		return false, err
+	}
+	g, err := license_graph.ReadGraph(rootFile)
+	if err != nil {
+		return false, err
+	}
+	violations := check(g, p)
+	for _, v := range violations {
+		fmt.Fprintf(w, "%s: license policy violation %s\n", g.Root.Name(), v.String())
+	}
+	if depFile != "" {
+		if err := license_graph.WriteDepFile(depFile, outFile, append([]string{policyFile}, g.Inputs...)); err != nil {
+			return false, err
+		}
+	}
+	if len(violations) > 0 {
+		return false, nil
+	}
+	if outFile != "" {
+		if err := os.WriteFile(outFile, nil, 0666); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func main() {
+	flags := flag.NewFlagSet("flags", flag.ExitOnError)
+
+	policyFile := flags.String("policy", "", "license policy file")
+	outFile := flags.String("o", "", "timestamp file to write when there are no violations")
+	depFile := flags.String("d", "", "output depfile")
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 || *policyFile == "" {
+		fmt.Fprintf(os.Stderr, "usage: check_license_policy --policy <policy> [-o <timestamp>] [-d <depfile>] <container license metadata>\n")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	ok, err := run(os.Stderr, *policyFile, flags.Arg(0), *outFile, *depFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
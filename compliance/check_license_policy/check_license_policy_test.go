@@ -0,0 +1,130 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `{
+	"rules": [{
+		"name": "restricted_static_linking",
+		"description": "restricted-licensed code may not be statically linked into proprietary modules",
+		"target_conditions": ["proprietary"],
+		"dependency_conditions": ["restricted"]
+	}]
+}`
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCheckLicensePolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name: "static",
+			files: map[string]string{
+				"img": `module_name: "img" is_container: true deps { file: "vendor_bin" } deps { file: "libgpl" }`,
+				"vendor_bin": `module_name: "vendor_bin" license_conditions: "proprietary"
+					deps { file: "libwrapper" }`,
+				"libwrapper": `module_name: "libwrapper" license_conditions: "notice"
+					deps { file: "libgpl" }`,
+				"libgpl": `module_name: "libgpl" license_conditions: "restricted"`,
+			},
+			expected: []string{"vendor_bin -> libwrapper -> libgpl"},
+		},
+		{
+			name: "dynamic",
+			files: map[string]string{
+				"img": `module_name: "img" is_container: true deps { file: "vendor_bin" } deps { file: "libgpl" }`,
+				"vendor_bin": `module_name: "vendor_bin" license_conditions: "proprietary"
+					deps { file: "libgpl" annotations: "dynamic" }`,
+				"libgpl": `module_name: "libgpl" license_conditions: "restricted"`,
+			},
+		},
+		{
+			name: "toolchain",
+			files: map[string]string{
+				"img": `module_name: "img" is_container: true deps { file: "vendor_bin" }`,
+				"vendor_bin": `module_name: "vendor_bin" license_conditions: "proprietary"
+					deps { file: "gpl_compiler" annotations: "toolchain" }`,
+				"gpl_compiler": `module_name: "gpl_compiler" license_conditions: "restricted"`,
+			},
+		},
+		{
+			name: "container",
+			files: map[string]string{
+				// Aggregating into a proprietary container is not linking.
+				"img": `module_name: "img" is_container: true license_conditions: "proprietary"
+					deps { file: "libgpl" }`,
+				"libgpl": `module_name: "libgpl" license_conditions: "restricted"`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.files["policy.json"] = testPolicy
+			dir := writeTestFiles(t, tc.files)
+			wd, _ := os.Getwd()
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			stderr := &strings.Builder{}
+			ok, err := run(stderr, "policy.json", "img", "check.timestamp", "check.d")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (len(tc.expected) == 0) {
+				t.Errorf("expected %d violations, got %q", len(tc.expected), stderr.String())
+			}
+			for _, path := range tc.expected {
+				if !strings.Contains(stderr.String(), "dependency path: "+path+"\n") {
+					t.Errorf("expected violation %q, got %q", path, stderr.String())
+				}
+			}
+			_, err = os.Stat("check.timestamp")
+			if ok != (err == nil) {
+				t.Errorf("expected the timestamp to be written only without violations")
+			}
+			depFile, err := os.ReadFile("check.d")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(depFile), "check.timestamp: policy.json img ") {
+				t.Errorf("unexpected depfile %q", string(depFile))
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package license_graph loads the license metadata graph of a container from
+// the license metadata files written by build_license_metadata, for the tools
+// that report on it.
+package license_graph
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+
+	"android/soong/compliance/license_metadata_proto"
+)
+
+// Linkage is the kind of a dependency edge in the license metadata graph.
+type Linkage string
+
+// Soong annotates the dynamic and toolchain dependencies. Edges that are not
+// annotated link the dependency statically, except for the edges from a
+// container, which only aggregates its dependencies.
+const (
+	LinkageStatic    Linkage = "static"
+	LinkageDynamic   Linkage = "dynamic"
+	LinkageToolchain Linkage = "toolchain"
+	LinkageContainer Linkage = "container"
+)
+
+// EdgeLinkage returns the kind of the edge from the module described by
+// metadata to the dependency dep.
+func EdgeLinkage(metadata *license_metadata_proto.LicenseMetadata, dep *license_metadata_proto.AnnotatedDependency) Linkage {
+	switch {
+	case slices.Contains(dep.GetAnnotations(), string(LinkageToolchain)):
+		return LinkageToolchain
+	case slices.Contains(dep.GetAnnotations(), string(LinkageDynamic)):
+		return LinkageDynamic
+	case metadata.GetIsContainer():
+		return LinkageContainer
+	default:
+		return LinkageStatic
+	}
+}
+
+// Node is a module in the license metadata graph, identified by its license
+// metadata file.
+type Node struct {
+	File     string
+	Metadata *license_metadata_proto.LicenseMetadata
+
+	// Deps lists the dependency edges sorted by the license metadata file of
+	// the dependency.
+	Deps []*Edge
+}
+
+// Edge is a dependency edge in the license metadata graph.
+type Edge struct {
+	Dep     *Node
+	Linkage Linkage
+}
+
+// Name returns the module name, falling back to the package name and then to
+// the license metadata file.
+func (n *Node) Name() string {
+	if name := n.Metadata.GetModuleName(); name != "" {
+		return name
+	}
+	if name := n.Metadata.GetPackageName(); name != "" {
+		return name
+	}
+	return n.File
+}
+
+// Graph is the license metadata graph of a container.
+type Graph struct {
+	Root *Node
+
+	// Nodes maps the license metadata files to the nodes of the graph.
+	Nodes map[string]*Node
+
+	// Inputs lists every license metadata file read, for the depfile.
+	Inputs []string
+}
+
+// ReadGraph loads the license metadata graph reachable from the container's
+// license metadata file rootFile.
+func ReadGraph(rootFile string) (*Graph, error) {
+	g := &Graph{Nodes: make(map[string]*Node)}
+
+	var load func(file string) (*Node, error)
+	load = func(file string) (*Node, error) {
+		if n, ok := g.Nodes[file]; ok {
+			return n, nil
+		}
+		metadata, err := ReadMetadata(file)
+		if err != nil {
+			return nil, err
+		}
+		n := &Node{File: file, Metadata: metadata}
+		g.Nodes[file] = n
+		g.Inputs = append(g.Inputs, file)
+		for _, d := range metadata.GetDeps() {
+			dep, err := load(d.GetFile())
+			if err != nil {
+				return nil, err
+			}
+			n.Deps = append(n.Deps, &Edge{Dep: dep, Linkage: EdgeLinkage(metadata, d)})
+		}
+		sort.SliceStable(n.Deps, func(i, j int) bool {
+			return n.Deps[i].Dep.File < n.Deps[j].Dep.File
+		})
+		return n, nil
+	}
+
+	root, err := load(rootFile)
+	if err != nil {
+		return nil, err
+	}
+	g.Root = root
+	return g, nil
+}
+
+// InContainer returns the nodes that are part of the container, starting with
+// the root in breadth-first order. The toolchains used to build the container
+// and their dependencies are not part of it.
+func (g *Graph) InContainer() []*Node {
+	var ret []*Node
+	visited := map[*Node]bool{g.Root: true}
+	queue := []*Node{g.Root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		ret = append(ret, n)
+		for _, e := range n.Deps {
+			if e.Linkage != LinkageToolchain && !visited[e.Dep] {
+				visited[e.Dep] = true
+				queue = append(queue, e.Dep)
+			}
+		}
+	}
+	return ret
+}
+
+// ReadMetadata reads a license metadata textproto.
+func ReadMetadata(file string) (*license_metadata_proto.LicenseMetadata, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading textproto %q: %w", file, err)
+	}
+
+	metadata := &license_metadata_proto.LicenseMetadata{}
+	if err := prototext.Unmarshal(buf, metadata); err != nil {
+		return nil, fmt.Errorf("error unmarshalling textproto %q: %w", file, err)
+	}
+
+	return metadata, nil
+}
+
+// WriteDepFile writes a depfile listing the inputs of target.
+func WriteDepFile(file, target string, inputs []string) error {
+	var escaped []string
+	for _, input := range inputs {
+		escaped = append(escaped, strings.ReplaceAll(input, " ", `\ `))
+	}
+	return os.WriteFile(file, []byte(target+": "+strings.Join(escaped, " ")+"\n"), 0666)
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package license_graph
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadGraph(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"img": `module_name: "img" is_container: true
+			deps { file: "bin" } deps { file: "libshared" }`,
+		"bin": `module_name: "bin"
+			deps { file: "libstatic" }
+			deps { file: "libshared" annotations: "dynamic" }
+			deps { file: "clang" annotations: "toolchain" }`,
+		"libstatic": `package_name: "static package"`,
+		"libshared": `module_name: "libshared"`,
+		"clang":     `module_name: "clang" deps { file: "llvm" }`,
+		"llvm":      `module_name: "llvm"`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	g, err := ReadGraph("img")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linkages := make(map[string]Linkage)
+	for _, n := range g.Nodes {
+		for _, e := range n.Deps {
+			linkages[n.Name()+" -> "+e.Dep.Name()] = e.Linkage
+		}
+	}
+	// Edges without annotations are static, except for the edges from a container.
+	expected := map[string]Linkage{
+		"img -> bin":            LinkageContainer,
+		"img -> libshared":      LinkageContainer,
+		"bin -> static package": LinkageStatic,
+		"bin -> libshared":      LinkageDynamic,
+		"bin -> clang":          LinkageToolchain,
+		"clang -> llvm":         LinkageStatic,
+	}
+	if !reflect.DeepEqual(linkages, expected) {
+		t.Errorf("expected linkages %v, got %v", expected, linkages)
+	}
+
+	var inContainer []string
+	for _, n := range g.InContainer() {
+		inContainer = append(inContainer, n.Name())
+	}
+	if expected := []string{"img", "bin", "libshared", "static package"}; !reflect.DeepEqual(inContainer, expected) {
+		t.Errorf("expected %q in the container, got %q", expected, inContainer)
+	}
+	if len(g.Inputs) != 6 {
+		t.Errorf("expected 6 inputs, got %q", g.Inputs)
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	"android/soong/android"
 	"android/soong/cc"
+	"android/soong/provenance"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/proptools"
@@ -57,6 +58,9 @@ type filesystem struct {
 	// Function that filters PackagingSpec in PackagingBase.GatherPackagingSpecs()
 	filterPackagingSpec func(spec android.PackagingSpec) bool
 
+	// Function that builds validations of the root directory and of the image built from it
+	buildValidations func(ctx android.ModuleContext, root android.OutputPath, image android.Path) android.Paths
+
 	output     android.OutputPath
 	installDir android.InstallPath
 
@@ -223,6 +227,15 @@ func (f *filesystem) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	ctx.InstallFile(f.installDir, f.installFileName(), f.output)
 
 	ctx.SetOutputFiles([]android.Path{f.output}, "")
+
+	// SBOMs describing the contents of the image, built with `m <name>-sbom`.
+	android.BuildSbomFromLicenseMetadata(ctx, f.output, []string{
+		filepath.Join(ctx.Config().OutDir(), "target", "product", ctx.Config().DeviceName()) + "/",
+		ctx.Config().SoongOutDir() + "/",
+	})
+
+	// SLSA provenance of the image, built with `m <name>-provenance`.
+	provenance.GenerateSlsaProvenance(ctx, f.output)
 }
 
 func validatePartitionType(ctx android.ModuleContext, p partition) {
@@ -323,7 +336,8 @@ func (f *filesystem) buildImageUsingBuildImage(ctx android.ModuleContext) androi
 		Input(propFile).
 		Implicits(toolDeps).
 		Output(output).
-		Text(rootDir.String()) // directory where to find fs_config_files|dirs
+		Text(rootDir.String()). // directory where to find fs_config_files|dirs
+		Validations(f.validations(ctx, rootDir, output))
 
 	// rootDir is not deleted. Might be useful for quick inspection.
 	builder.Build("build_filesystem_image", fmt.Sprintf("Creating filesystem %s", f.BaseModuleName()))
@@ -331,6 +345,15 @@ func (f *filesystem) buildImageUsingBuildImage(ctx android.ModuleContext) androi
 	return output
 }
 
+// validations returns the validations of the rule that builds the image from the root directory.
+func (f *filesystem) validations(ctx android.ModuleContext, rootDir android.OutputPath, image android.Path) android.Paths {
+	validations := android.BuildLicensePolicyCheck(ctx)
+	if f.buildValidations != nil {
+		validations = append(validations, f.buildValidations(ctx, rootDir, image)...)
+	}
+	return validations
+}
+
 func (f *filesystem) buildFileContexts(ctx android.ModuleContext) android.OutputPath {
 	builder := android.NewRuleBuilder(pctx, ctx)
 	fcBin := android.PathForModuleOut(ctx, "file_contexts.bin")
@@ -464,6 +487,7 @@ func (f *filesystem) buildCpioImage(ctx android.ModuleContext, compressed bool)
 	} else {
 		cmd.Text(">").Output(output)
 	}
+	cmd.Validations(f.validations(ctx, rootDir, output))
 
 	// rootDir is not deleted. Might be useful for quick inspection.
 	builder.Build("build_cpio_image", fmt.Sprintf("Creating filesystem %s", f.BaseModuleName()))
@@ -185,6 +185,31 @@ func TestFileSystemFillsLinkerConfigWithStubLibs(t *testing.T) {
 		output.RuleParams.Command, "libbar.so")
 }
 
+func TestSystemImageLinkerNamespaceCheck(t *testing.T) {
+	result := fixture.RunTestWithBp(t, `
+		android_system_image {
+			name: "myfilesystem",
+			deps: ["libfoo"],
+			linker_config_src: "linker.config.json",
+		}
+
+		cc_library {
+			name: "libfoo",
+		}
+	`)
+
+	module := result.ModuleForTests("myfilesystem", "android_common")
+	rule := module.Rule("linker_namespace_check")
+	android.AssertStringDoesContain(t, "linker_namespace_check should check the system namespace",
+		rule.RuleParams.Command, "--type system ")
+	android.AssertStringDoesContain(t, "linker_namespace_check should check the system partition",
+		rule.RuleParams.Command, "--root out/soong/.intermediates/myfilesystem/android_common/root/system ")
+
+	output := module.Output("myfilesystem.img")
+	android.AssertStringListContains(t, "linker_namespace_check should validate the image",
+		output.Validations.Strings(), "out/soong/.intermediates/myfilesystem/android_common/linker_namespace_check.timestamp")
+}
+
 func registerComponent(ctx android.RegistrationContext) {
 	ctx.RegisterModuleType("component", componentFactory)
 }
@@ -560,3 +585,65 @@ func TestFilterOutUnsupportedArches(t *testing.T) {
 		}
 	}
 }
+
+func TestFileSystemSbom(t *testing.T) {
+	result := fixture.RunTestWithBp(t, `
+		android_filesystem {
+			name: "myfilesystem",
+		}
+	`)
+
+	module := result.ModuleForTests("myfilesystem", "android_common")
+	sbom := module.Rule("sbom")
+	android.AssertPathsRelativeToTopEquals(t, "sbom outputs",
+		[]string{
+			"out/soong/.intermediates/myfilesystem/android_common/sbom/myfilesystem.img.cdx.json",
+			"out/soong/.intermediates/myfilesystem/android_common/sbom/myfilesystem.img.spdx.json",
+		},
+		android.SortedUniquePaths(append(android.Paths{sbom.Output}, sbom.ImplicitOutputs...)))
+	android.AssertPathsRelativeToTopEquals(t, "sbom license metadata input",
+		[]string{"out/soong/.intermediates/myfilesystem/android_common/meta_lic"}, sbom.Inputs)
+	android.AssertStringListContains(t, "sbom must depend on the image",
+		android.PathsRelativeToTop(sbom.Implicits), "out/soong/.intermediates/myfilesystem/android_common/myfilesystem.img")
+}
+
+func TestFileSystemLicensePolicyCheck(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		fixture,
+		android.FixtureAddTextFile("build/soong/compliance/license_policy.json", "{}"),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.LicensePolicyFile = proptools.StringPtr("build/soong/compliance/license_policy.json")
+		}),
+	).RunTestWithBp(t, `
+		android_filesystem {
+			name: "myfilesystem",
+		}
+	`)
+
+	module := result.ModuleForTests("myfilesystem", "android_common")
+	check := module.Rule("licensePolicyCheckRule")
+	android.AssertPathRelativeToTopEquals(t, "license policy check input",
+		"out/soong/.intermediates/myfilesystem/android_common/meta_lic", check.Input)
+	android.AssertStringEquals(t, "license policy", "build/soong/compliance/license_policy.json", check.Args["policy"])
+
+	image := module.Output("myfilesystem.img")
+	android.AssertPathsRelativeToTopEquals(t, "image validations",
+		[]string{"out/soong/.intermediates/myfilesystem/android_common/license_policy_check.timestamp"},
+		image.Validations)
+}
+
+func TestFileSystemWithoutLicensePolicy(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		fixture,
+		android.FixtureAddTextFile("build/soong/compliance/license_policy.json", "{}"),
+	).RunTestWithBp(t, `
+		android_filesystem {
+			name: "myfilesystem",
+		}
+	`)
+
+	// The policy is only checked if the product sets one.
+	module := result.ModuleForTests("myfilesystem", "android_common")
+	android.AssertBoolEquals(t, "license policy check", false, module.MaybeRule("licensePolicyCheckRule").Rule != nil)
+	android.AssertIntEquals(t, "image validations", 0, len(module.Output("myfilesystem.img").Validations))
+}
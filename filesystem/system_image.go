@@ -38,6 +38,7 @@ func systemImageFactory() android.Module {
 	module.AddProperties(&module.properties)
 	module.filesystem.buildExtraFiles = module.buildExtraFiles
 	module.filesystem.filterPackagingSpec = module.filterPackagingSpec
+	module.filesystem.buildValidations = module.buildValidations
 	initFilesystemModule(&module.filesystem)
 	return module
 }
@@ -51,6 +52,12 @@ func (s *systemImage) buildExtraFiles(ctx android.ModuleContext, root android.Ou
 	return []android.OutputPath{lc}
 }
 
+// buildValidations checks that the libraries needed by the ELF files in the system partition
+// resolve in the system linker namespace.
+func (s *systemImage) buildValidations(ctx android.ModuleContext, root android.OutputPath, image android.Path) android.Paths {
+	return android.Paths{linkerconfig.BuildSystemLinkerNamespaceCheck(ctx, root.Join(ctx, "system"), image)}
+}
+
 func (s *systemImage) buildLinkerConfigFile(ctx android.ModuleContext, root android.OutputPath) android.OutputPath {
 	input := android.PathForModuleSrc(ctx, android.String(s.properties.Linker_config_src))
 	output := root.Join(ctx, "system", "etc", "linker.config.pb")
@@ -130,6 +130,7 @@ type aapt struct {
 	hasNoCode                          bool
 	LoggingParent                      string
 	resourceFiles                      android.Paths
+	resourceDirs                       android.Paths
 
 	splitNames []string
 	splits     []split
@@ -220,6 +221,7 @@ func (a *aapt) aapt2Flags(ctx android.ModuleContext, sdkContext android.SdkConte
 	assetDirs := android.PathsWithOptionalDefaultForModuleSrc(ctx, a.aaptProperties.Asset_dirs, "assets")
 	resourceDirs := android.PathsWithOptionalDefaultForModuleSrc(ctx, a.aaptProperties.Resource_dirs, "res")
 	resourceZips := android.PathsForModuleSrc(ctx, a.aaptProperties.Resource_zips)
+	a.resourceDirs = resourceDirs
 
 	// Glob directories into lists of paths
 	for _, dir := range resourceDirs {
@@ -917,6 +919,7 @@ func (a *aapt) IDEInfo(dpInfo *android.IdeInfo) {
 	if a.rJar != nil {
 		dpInfo.Jars = append(dpInfo.Jars, a.rJar.String())
 	}
+	dpInfo.Resource_dirs = append(dpInfo.Resource_dirs, a.resourceDirs.Strings()...)
 }
 
 // android_library builds and links sources into a `.jar` file for the device along with Android resources.
@@ -0,0 +1,190 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+// The api_changelog singleton collects the API signature files generated by every droidstubs
+// module (including those created by java_sdk_library) that is checked against a last released
+// API, and generates a release-wide changelog of the APIs that were added, removed or deprecated
+// since that release. The changelog is generated in $OUT/soong/api_changelog/ as both JSON and
+// HTML and can be built with `m api_changelog`.
+
+func init() {
+	registerApiChangelogBuildComponents(android.InitRegistrationContext)
+}
+
+func registerApiChangelogBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterParallelSingletonType("api_changelog", apiChangelogSingletonFactory)
+}
+
+var PrepareForTestWithApiChangelog = android.FixtureRegisterWithContext(registerApiChangelogBuildComponents)
+
+// ApiChangelogInfo contains the current and last released API signature files of a droidstubs
+// module.
+type ApiChangelogInfo struct {
+	// The name of the module whose API is described, i.e. the name of the java_sdk_library for
+	// droidstubs modules created by one.
+	Module string
+
+	// The API surface, e.g. public, system, module-lib, etc. May be empty for droidstubs modules
+	// that do not specify an api_surface.
+	ApiSurface string
+
+	// The API and removed API signature files generated for each of the stubs types.
+	ApiFiles        map[StubsType]android.Path
+	RemovedApiFiles map[StubsType]android.Path
+
+	// The last released API and removed API signature files that the generated files are checked
+	// against, ordered from the narrowest to the widest API surface.
+	LastReleasedApiFiles        android.Paths
+	LastReleasedRemovedApiFiles android.Paths
+}
+
+var ApiChangelogInfoProvider = blueprint.NewProvider[ApiChangelogInfo]()
+
+// setApiChangelogInfo sets the ApiChangelogInfoProvider for a droidstubs module whose API is
+// checked against a last released API.
+func (d *Droidstubs) setApiChangelogInfo(ctx android.ModuleContext) {
+	info := ApiChangelogInfo{
+		Module:                      proptools.StringDefault(d.SdkLibraryName(), ctx.ModuleName()),
+		ApiSurface:                  proptools.String(d.properties.Api_surface),
+		ApiFiles:                    make(map[StubsType]android.Path),
+		RemovedApiFiles:             make(map[StubsType]android.Path),
+		LastReleasedApiFiles:        android.PathsForModuleSrc(ctx, []string{String(d.properties.Check_api.Last_released.Api_file)}),
+		LastReleasedRemovedApiFiles: android.PathsForModuleSrc(ctx, []string{String(d.properties.Check_api.Last_released.Removed_api_file)}),
+	}
+	for _, stubsType := range []StubsType{Everything, Exportable} {
+		if apiFile, err := d.ApiFilePath(stubsType); err == nil {
+			info.ApiFiles[stubsType] = apiFile
+		}
+		if removedApiFile, err := d.RemovedApiFilePath(stubsType); err == nil {
+			info.RemovedApiFiles[stubsType] = removedApiFile
+		}
+	}
+	android.SetProvider(ctx, ApiChangelogInfoProvider, info)
+}
+
+func apiChangelogSingletonFactory() android.Singleton {
+	return &apiChangelogSingleton{}
+}
+
+type apiChangelogSingleton struct{}
+
+// apiChangelogEntry is the JSON representation of a single API surface of a module that is passed
+// to the api_changelog tool.
+type apiChangelogEntry struct {
+	Module                  string `json:"module"`
+	Scope                   string `json:"scope"`
+	StubsType               string `json:"stubs_type"`
+	ApiFile                 string `json:"api_file"`
+	RemovedApiFile          string `json:"removed_api_file,omitempty"`
+	LastReleasedApiFile     string `json:"last_released_api_file"`
+	LastReleasedRemovedFile string `json:"last_released_removed_api_file,omitempty"`
+}
+
+func apiChangelogPath(ctx android.PathContext, name string) android.WritablePath {
+	return android.PathForOutput(ctx, "api_changelog", name)
+}
+
+func (a *apiChangelogSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var entries []apiChangelogEntry
+	var inputs android.Paths
+
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled(ctx) {
+			return
+		}
+		info, ok := android.SingletonModuleProvider(ctx, module, ApiChangelogInfoProvider)
+		if !ok || len(info.LastReleasedApiFiles) == 0 {
+			return
+		}
+
+		// The last released files are ordered from the narrowest to the widest API surface and
+		// the generated files only contain the delta from the next narrowest surface, so the
+		// last released file for this surface is the last one.
+		lastReleasedApiFile := info.LastReleasedApiFiles[len(info.LastReleasedApiFiles)-1]
+		var lastReleasedRemovedFile android.Path
+		if len(info.LastReleasedRemovedApiFiles) > 0 {
+			lastReleasedRemovedFile = info.LastReleasedRemovedApiFiles[len(info.LastReleasedRemovedApiFiles)-1]
+		}
+
+		for _, stubsType := range []StubsType{Everything, Exportable} {
+			apiFile := info.ApiFiles[stubsType]
+			if apiFile == nil {
+				continue
+			}
+			entry := apiChangelogEntry{
+				Module:              info.Module,
+				Scope:               info.ApiSurface,
+				StubsType:           stubsType.String(),
+				ApiFile:             apiFile.String(),
+				LastReleasedApiFile: lastReleasedApiFile.String(),
+			}
+			inputs = append(inputs, apiFile, lastReleasedApiFile)
+			if removedApiFile := info.RemovedApiFiles[stubsType]; removedApiFile != nil && lastReleasedRemovedFile != nil {
+				entry.RemovedApiFile = removedApiFile.String()
+				entry.LastReleasedRemovedFile = lastReleasedRemovedFile.String()
+				inputs = append(inputs, removedApiFile, lastReleasedRemovedFile)
+			}
+			entries = append(entries, entry)
+		}
+	})
+
+	if len(entries) == 0 {
+		// nothing to do.
+		return
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Module != entries[j].Module {
+			return entries[i].Module < entries[j].Module
+		}
+		if entries[i].Scope != entries[j].Scope {
+			return entries[i].Scope < entries[j].Scope
+		}
+		return entries[i].StubsType < entries[j].StubsType
+	})
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal api changelog inputs: %s", err)
+		return
+	}
+	manifest := apiChangelogPath(ctx, "api_changelog_inputs.json")
+	android.WriteFileRule(ctx, manifest, string(content))
+
+	jsonOutput := apiChangelogPath(ctx, "api_changelog.json")
+	htmlOutput := apiChangelogPath(ctx, "api_changelog.html")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		BuiltTool("api_changelog").
+		FlagWithInput("--inputs ", manifest).
+		FlagWithOutput("--json ", jsonOutput).
+		FlagWithOutput("--html ", htmlOutput).
+		Implicits(android.FirstUniquePaths(inputs))
+	rule.Build("api_changelog", "Generate API changelog")
+
+	ctx.Phony("api_changelog", jsonOutput, htmlOutput)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestApiChangelog(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		PrepareForTestWithJavaSdkLibraryFiles,
+		PrepareForTestWithApiChangelog,
+		FixtureWithLastReleaseApis("foo"),
+	).RunTestWithBp(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+			public: {
+				enabled: true,
+			},
+			system: {
+				enabled: true,
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo.stubs.source.system", "android_common")
+	info, _ := android.SingletonModuleProvider(result, foo.Module(), ApiChangelogInfoProvider)
+	android.AssertStringEquals(t, "module", "foo", info.Module)
+	android.AssertStringEquals(t, "api surface", "system", info.ApiSurface)
+	android.AssertPathsRelativeToTopEquals(t, "last released api files", []string{
+		"prebuilts/sdk/30/public/api/foo.txt",
+		"prebuilts/sdk/30/system/api/foo.txt",
+	}, info.LastReleasedApiFiles)
+
+	singleton := result.SingletonForTests("api_changelog")
+	manifest := singleton.Output("api_changelog/api_changelog_inputs.json")
+	var entries []apiChangelogEntry
+	if err := json.Unmarshal([]byte(android.ContentFromFileRuleForTests(t, result.TestContext, manifest)), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	var scopes, lastReleased []string
+	for _, entry := range entries {
+		if entry.StubsType != Everything.String() {
+			continue
+		}
+		scopes = append(scopes, entry.Scope)
+		lastReleased = append(lastReleased, entry.LastReleasedApiFile, entry.LastReleasedRemovedFile)
+	}
+	android.AssertArrayString(t, "scopes", []string{"public", "system"}, scopes)
+	android.AssertArrayString(t, "last released files", []string{
+		"prebuilts/sdk/30/public/api/foo.txt",
+		"prebuilts/sdk/30/public/api/foo-removed.txt",
+		"prebuilts/sdk/30/system/api/foo.txt",
+		"prebuilts/sdk/30/system/api/foo-removed.txt",
+	}, lastReleased)
+
+	rule := singleton.Output("api_changelog/api_changelog.json")
+	command := android.StringRelativeToTop(result.Config, rule.RuleParams.Command)
+	android.AssertStringDoesContain(t, "api_changelog command", command,
+		"--inputs out/soong/api_changelog/api_changelog_inputs.json")
+	android.AssertStringDoesContain(t, "api_changelog command", command,
+		"--html out/soong/api_changelog/api_changelog.html")
+}
@@ -32,6 +32,7 @@ import (
 	"android/soong/cc"
 	"android/soong/dexpreopt"
 	"android/soong/genrule"
+	"android/soong/provenance"
 	"android/soong/tradefed"
 )
 
@@ -101,6 +102,10 @@ type appProperties struct {
 	// they are used from inside the APK at runtime.
 	Use_embedded_dex *bool
 
+	// If set, also build an Android App Bundle (.aab) of the app, which is available as the ".aab"
+	// output. Default is false.
+	Build_bundle *bool
+
 	// Forces native libraries to always be packaged into the APK,
 	// Use_embedded_native_libs still selects whether they are stored uncompressed and aligned or compressed.
 	// True for android_test* modules.
@@ -189,6 +194,7 @@ type AndroidApp struct {
 	jniCoverageOutputs       android.Paths
 
 	bundleFile android.Path
+	aabFile    android.Path
 
 	// the install APK name is normally the same as the module name, but can be overridden with PRODUCT_PACKAGE_NAME_OVERRIDES.
 	installApkName string
@@ -921,6 +927,18 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 	BuildBundleModule(ctx, bundleFile, a.exportPackage, jniJarFile, dexJarFile)
 	a.bundleFile = bundleFile
 
+	if Bool(a.appProperties.Build_bundle) {
+		aabFile := android.PathForModuleOut(ctx, a.installApkName+".aab")
+		BuildAppBundle(ctx, aabFile, bundleFile, a.dexpreopter.uncompressedDex, a.useEmbeddedNativeLibs(ctx))
+		a.aabFile = aabFile
+	}
+
+	// SBOMs describing the app package, built with `m <app>-sbom`.
+	android.BuildSbomFromLicenseMetadata(ctx, a.outputFile, []string{filepath.Dir(a.outputFile.String()) + "/"})
+
+	// SLSA provenance of the app package, built with `m <app>-provenance`.
+	provenance.GenerateSlsaProvenance(ctx, a.outputFile)
+
 	allowlist := a.createPrivappAllowlist(ctx)
 	if allowlist != nil {
 		a.privAppAllowlist = android.OptionalPathForPath(allowlist)
@@ -1229,6 +1247,10 @@ func (a *AndroidApp) OutputFiles(tag string) (android.Paths, error) {
 		return []android.Path{a.outputFile}, nil
 	case ".export-package.apk":
 		return []android.Path{a.exportPackage}, nil
+	case ".aab":
+		if a.aabFile != nil {
+			return []android.Path{a.aabFile}, nil
+		}
 	case ".manifest.xml":
 		return []android.Path{a.aapt.manifestPath}, nil
 	}
@@ -219,6 +219,38 @@ func BuildBundleModule(ctx android.ModuleContext, outputFile android.WritablePat
 	})
 }
 
+// The BundleConfig of the app bundle records the version of the prebuilt bundletool, which is the one
+// that builds the APKs from it.
+var buildAppBundle = pctx.AndroidStaticRule("buildAppBundle",
+	blueprint.RuleParams{
+		Command: `${config.BuildAabCmd} -o ${out} -base ${in} ` +
+			`-bundletool-version $$(${config.JavaCmd} -jar ${config.BundletoolJar} version) ${flags}`,
+		CommandDeps: []string{"${config.BuildAabCmd}", "${config.JavaCmd}", "${config.BundletoolJar}"},
+	}, "flags")
+
+// Builds an Android App Bundle (.aab) from a module built by BuildBundleModule
+func BuildAppBundle(ctx android.ModuleContext, outputFile android.WritablePath,
+	bundleModule android.Path, uncompressDex, uncompressJni bool) {
+
+	var flags []string
+	if uncompressDex {
+		flags = append(flags, "-uncompress-dex")
+	}
+	if uncompressJni {
+		flags = append(flags, "-uncompress-native-libs")
+	}
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        buildAppBundle,
+		Input:       bundleModule,
+		Output:      outputFile,
+		Description: "app bundle",
+		Args: map[string]string{
+			"flags": strings.Join(flags, " "),
+		},
+	})
+}
+
 func TransformJniLibsToJar(
 	ctx android.ModuleContext,
 	outputFile android.WritablePath,
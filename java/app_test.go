@@ -126,6 +126,102 @@ func TestAppSplits(t *testing.T) {
 	android.AssertPathsRelativeToTopEquals(t, `OutputFiles("")`, expectedOutputs, outputFiles)
 }
 
+func TestAppBundle(t *testing.T) {
+	ctx, _ := testJava(t, cc.GatherRequiredDepsForTest(android.Android)+`
+		cc_library {
+			name: "libjni",
+			system_shared_libs: [],
+			stl: "none",
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			jni_libs: ["libjni"],
+			use_embedded_native_libs: true,
+			use_embedded_dex: true,
+			build_bundle: true,
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			build_bundle: true,
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "baz",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+		`)
+
+	testCases := []struct {
+		name           string
+		bundleInputs   []string
+		uncompressDex  bool
+		uncompressJnis bool
+	}{
+		{
+			name: "foo",
+			bundleInputs: []string{
+				"out/soong/.intermediates/foo/android_common/bundle/apk.zip",
+				"out/soong/.intermediates/foo/android_common/bundle/dex.zip",
+				"out/soong/.intermediates/foo/android_common/bundle/res.zip",
+				"out/soong/.intermediates/foo/android_common/jnilibs.zip",
+			},
+			uncompressDex:  true,
+			uncompressJnis: true,
+		},
+		{
+			name: "bar",
+			bundleInputs: []string{
+				"out/soong/.intermediates/bar/android_common/bundle/apk.zip",
+				"out/soong/.intermediates/bar/android_common/bundle/dex.zip",
+				"out/soong/.intermediates/bar/android_common/bundle/res.zip",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			app := ctx.ModuleForTests(test.name, "android_common")
+
+			bundleModule := app.Output("base.zip")
+			android.AssertPathsRelativeToTopEquals(t, "base module inputs", test.bundleInputs, bundleModule.Inputs)
+
+			aab := app.Output(test.name + ".aab")
+			android.AssertPathRelativeToTopEquals(t, "aab input",
+				"out/soong/.intermediates/"+test.name+"/android_common/base.zip", aab.Input)
+			android.AssertStringDoesContain(t, "aab command", aab.RuleParams.Command,
+				"-bundletool-version $$(${config.JavaCmd} -jar ${config.BundletoolJar} version)")
+			android.AssertBoolEquals(t, "uncompress dex", test.uncompressDex,
+				strings.Contains(aab.Args["flags"], "-uncompress-dex"))
+			android.AssertBoolEquals(t, "uncompress native libs", test.uncompressJnis,
+				strings.Contains(aab.Args["flags"], "-uncompress-native-libs"))
+
+			outputFiles, err := app.Module().(*AndroidApp).OutputFiles(".aab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			android.AssertPathsRelativeToTopEquals(t, `OutputFiles(".aab")`,
+				[]string{"out/soong/.intermediates/" + test.name + "/android_common/" + test.name + ".aab"}, outputFiles)
+		})
+	}
+
+	// An app bundle is only built when requested.
+	baz := ctx.ModuleForTests("baz", "android_common")
+	if baz.MaybeOutput("baz.aab").Rule != nil {
+		t.Errorf("expected no app bundle for baz")
+	}
+	if _, err := baz.Module().(*AndroidApp).OutputFiles(".aab"); err == nil {
+		t.Errorf(`expected an error for OutputFiles(".aab") of baz`)
+	}
+}
+
 func TestPlatformAPIs(t *testing.T) {
 	testJava(t, `
 		android_app {
@@ -504,6 +504,16 @@ type Module struct {
 	// will be used by android.IDEInfo struct
 	expandIDEInfoCompiledSrcs []string
 
+	// list of directories containing generated .java and .kt files, will be used by
+	// android.IDEInfo struct
+	expandIDEInfoGeneratedSrcDirs []string
+
+	// list of java resource directories, will be used by android.IDEInfo struct
+	expandIDEInfoResourceDirs []string
+
+	// the java language level the sources are compiled with, will be used by android.IDEInfo struct
+	ideInfoJavaVersion string
+
 	// expanded Jarjar_rules
 	expandJarjarRules android.Path
 
@@ -522,6 +532,9 @@ type Module struct {
 	// list of the xref extraction files
 	kytheFiles android.Paths
 
+	// list of the compile actions, will be used by the java_compile_actions singleton
+	compileActions []javaCompileAction
+
 	hideApexVariantFromMake bool
 
 	sdkVersion    android.SdkSpec
@@ -1198,6 +1211,18 @@ func (j *Module) compile(ctx android.ModuleContext, extraSrcJars, extraClasspath
 	// Collect .java and .kt files for AIDEGen
 	j.expandIDEInfoCompiledSrcs = append(j.expandIDEInfoCompiledSrcs, uniqueSrcFiles.Strings()...)
 
+	// Collect the directories of generated sources, the java resource directories and the language
+	// level for IDE project generation.
+	for _, src := range uniqueSrcFiles {
+		if _, ok := src.(android.WritablePath); ok {
+			j.expandIDEInfoGeneratedSrcDirs = append(j.expandIDEInfoGeneratedSrcDirs, filepath.Dir(src.String()))
+		}
+	}
+	for _, dir := range j.properties.Java_resource_dirs {
+		j.expandIDEInfoResourceDirs = append(j.expandIDEInfoResourceDirs, filepath.Join(ctx.ModuleDir(), dir))
+	}
+	j.ideInfoJavaVersion = flags.javaVersion.String()
+
 	var kotlinJars android.Paths
 	var kotlinHeaderJars android.Paths
 
@@ -2055,6 +2080,16 @@ func (j *Module) IDEInfo(dpInfo *android.IdeInfo) {
 	dpInfo.Static_libs = append(dpInfo.Static_libs, j.properties.Static_libs...)
 	dpInfo.Libs = append(dpInfo.Libs, j.properties.Libs...)
 	dpInfo.SrcJars = append(dpInfo.SrcJars, j.annoSrcJars.Strings()...)
+	for _, src := range j.expandIDEInfoCompiledSrcs {
+		if strings.HasSuffix(src, ".kt") {
+			dpInfo.Kotlin_src_dirs = append(dpInfo.Kotlin_src_dirs, filepath.Dir(src))
+		}
+	}
+	dpInfo.Generated_src_dirs = append(dpInfo.Generated_src_dirs, j.expandIDEInfoGeneratedSrcDirs...)
+	dpInfo.Resource_dirs = append(dpInfo.Resource_dirs, j.expandIDEInfoResourceDirs...)
+	dpInfo.Sdk_version = proptools.String(j.deviceProperties.Sdk_version)
+	dpInfo.System_modules = j.SystemModules()
+	dpInfo.Java_version = j.ideInfoJavaVersion
 }
 
 func (j *Module) CompilerDeps() []string {
@@ -486,6 +486,22 @@ func TestSnapshotWithBootclasspathFragment_HiddenAPI(t *testing.T) {
 		"--single-package sdklibrary",
 	}, " ")
 	android.AssertStringDoesContain(t, "signature patterns command", rule.RuleParams.Command, expectedCommand)
+
+	// Make sure that the provenance file is generated alongside the all-flags.csv file and that
+	// each flag file is annotated with its category and the fragment that provided it.
+	rule = fragment.Output("modular-hiddenapi/all-flags.provenance.csv")
+	android.AssertStringDoesContain(t, "all flags command", rule.RuleParams.Command,
+		"--provenance-output out/soong/.intermediates/mybootclasspathfragment/android_common/modular-hiddenapi/all-flags.provenance.csv")
+	android.AssertStringDoesContain(t, "all flags command", rule.RuleParams.Command,
+		"--max-target-q my-new-max-target-q.txt --category max_target_q --fragment mybootclasspathfragment")
+	android.AssertStringDoesContain(t, "all flags command", rule.RuleParams.Command,
+		"--blocked my-blocked.txt --category blocked --fragment mybootclasspathfragment")
+	android.AssertStringMatches(t, "all flags command", rule.RuleParams.Command,
+		"module-hiddenapi/removed-dex-signatures.txt --ignore-conflicts +--tag removed --category removed --fragment mybootclasspathfragment")
+	hiddenAPIInfo, _ := android.SingletonModuleProvider(result, fragment.Module(), HiddenAPIInfoProvider)
+	android.AssertPathRelativeToTopEquals(t, "provenance path",
+		"out/soong/.intermediates/mybootclasspathfragment/android_common/modular-hiddenapi/all-flags.provenance.csv",
+		hiddenAPIInfo.ProvenancePath)
 }
 
 func TestBootclasspathFragment_Test(t *testing.T) {
@@ -493,6 +493,8 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 		Implicits:   deps,
 		Args:        args,
 	})
+
+	recordJavaCompileAction(ctx, "turbine", outputFile, srcFiles, srcJars, len(flags.classpath)+len(flags.bootClasspath))
 }
 
 // TurbineApt produces a rule to run annotation processors using turbine.
@@ -534,6 +536,8 @@ func TurbineApt(ctx android.ModuleContext, outputSrcJar, outputResJar android.Wr
 		Implicits:       deps,
 		Args:            args,
 	})
+
+	recordJavaCompileAction(ctx, "turbine_apt", outputs[0], srcFiles, srcJars, len(flags.classpath)+len(flags.bootClasspath))
 }
 
 // transformJavaToClasses takes source files and converts them to a jar containing .class files.
@@ -625,6 +629,9 @@ func transformJavaToClasses(ctx android.ModuleContext, outputFile android.Writab
 			"javaVersion":   flags.javaVersion.String(),
 		},
 	})
+
+	recordJavaCompileAction(ctx, intermediatesDir, outputFile, srcFiles, srcJars,
+		len(javacClasspath)+len(flags.bootClasspath))
 }
 
 func TransformResourcesToJar(ctx android.ModuleContext, outputFile android.WritablePath,
@@ -0,0 +1,123 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"encoding/json"
+	"sort"
+
+	"android/soong/android"
+)
+
+// This singleton generates a map from the outputs of the javac, kotlinc, kapt, turbine, r8 and d8
+// actions of every java module to the module and compile step that the action was run for, along
+// with the number of sources and the size of the classpath of the action. It is written to
+// $OUT/soong/java_compile_actions.json and used by soong_ui to attribute the time spent in these
+// actions to modules in java_compile_report.json.
+
+func init() {
+	registerJavaCompileActionsBuildComponents(android.InitRegistrationContext)
+}
+
+func registerJavaCompileActionsBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterParallelSingletonType("java_compile_actions", javaCompileActionsSingletonFactory)
+}
+
+var PrepareForTestWithJavaCompileActions = android.FixtureRegisterWithContext(registerJavaCompileActionsBuildComponents)
+
+const javaCompileActionsFileName = "java_compile_actions.json"
+
+// javaCompileAction describes a single compile step of a java module. The JSON format must be kept
+// in sync with ui/build/java_compile_report.go.
+type javaCompileAction struct {
+	Output        string `json:"output"`
+	Module        string `json:"module"`
+	Step          string `json:"step"`
+	SrcFiles      int    `json:"src_files"`
+	SrcJars       int    `json:"src_jars"`
+	ClasspathSize int    `json:"classpath_size"`
+}
+
+// javaCompileActionRecorder is implemented by modules that record the compile actions they create.
+type javaCompileActionRecorder interface {
+	recordJavaCompileAction(action javaCompileAction)
+	javaCompileActions() []javaCompileAction
+}
+
+func (j *Module) recordJavaCompileAction(action javaCompileAction) {
+	j.compileActions = append(j.compileActions, action)
+}
+
+func (j *Module) javaCompileActions() []javaCompileAction {
+	return j.compileActions
+}
+
+// recordJavaCompileAction records a compile step of the current module so that the time spent in
+// the action that produces output can be attributed to the module and step.
+func recordJavaCompileAction(ctx android.ModuleContext, step string, output android.Path,
+	srcFiles, srcJars android.Paths, classpathSize int) {
+
+	if recorder, ok := ctx.Module().(javaCompileActionRecorder); ok {
+		recorder.recordJavaCompileAction(javaCompileAction{
+			Output:        output.String(),
+			Module:        ctx.ModuleName(),
+			Step:          step,
+			SrcFiles:      len(srcFiles),
+			SrcJars:       len(srcJars),
+			ClasspathSize: classpathSize,
+		})
+	}
+}
+
+func javaCompileActionsSingletonFactory() android.Singleton {
+	return &javaCompileActionsSingleton{}
+}
+
+type javaCompileActionsSingleton struct{}
+
+func (j *javaCompileActionsSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	// Initialize to an empty list so that the file always contains a valid JSON list.
+	actions := []javaCompileAction{}
+
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled(ctx) {
+			return
+		}
+		if recorder, ok := module.(javaCompileActionRecorder); ok {
+			actions = append(actions, recorder.javaCompileActions()...)
+		}
+	})
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Output < actions[j].Output
+	})
+
+	path := android.PathForOutput(ctx, javaCompileActionsFileName)
+	buf, err := json.MarshalIndent(actions, "", "  ")
+	if err != nil {
+		ctx.Errorf("JSON marshal of java compile actions failed: %s", err)
+		return
+	}
+	if err := android.WriteFileToOutputDir(path, buf, 0666); err != nil {
+		ctx.Errorf("Writing java compile actions to %s failed: %s", path.String(), err)
+		return
+	}
+
+	// This is necessary to satisfy the dangling rules check as this file is written by Soong rather than a rule.
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   android.Touch,
+		Output: path,
+	})
+}
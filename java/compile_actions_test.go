@@ -0,0 +1,61 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestJavaCompileActions(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		PrepareForTestWithJavaCompileActions,
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			libs: ["bar"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["c.java"],
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	actions := make(map[string]javaCompileAction)
+	for _, action := range foo.Module().(*Library).javaCompileActions() {
+		android.AssertStringEquals(t, "module", "foo", action.Module)
+		actions[action.Step] = action
+	}
+
+	for _, step := range []string{"javac", "kotlinc", "d8"} {
+		rule := foo.Rule(step)
+		action, ok := actions[step]
+		if !ok {
+			t.Fatalf("missing %s compile action, found %v", step, actions)
+		}
+		android.AssertStringEquals(t, step+" output", rule.Output.String(), action.Output)
+	}
+
+	android.AssertIntEquals(t, "javac src files", 1, actions["javac"].SrcFiles)
+	android.AssertIntEquals(t, "kotlinc src files", 2, actions["kotlinc"].SrcFiles)
+	android.AssertBoolEquals(t, "javac classpath includes bar", true, actions["javac"].ClasspathSize > 0)
+
+	result.SingletonForTests("java_compile_actions").Output(javaCompileActionsFileName)
+}
@@ -163,6 +163,7 @@ func init() {
 	pctx.HostBinToolVariable("ResourceShrinkerCmd", "resourceshrinker")
 	pctx.HostBinToolVariable("HiddenAPICmd", "hiddenapi")
 	pctx.HostBinToolVariable("ExtractApksCmd", "extract_apks")
+	pctx.HostBinToolVariable("BuildAabCmd", "build_aab")
 	pctx.VariableFunc("TurbineJar", func(ctx android.PackageVarContext) string {
 		turbine := "turbine.jar"
 		if ctx.Config().AlwaysUsePrebuiltSdks() {
@@ -180,6 +181,7 @@ func init() {
 	pctx.HostJavaToolVariable("JetifierJar", "jetifier.jar")
 	pctx.HostJavaToolVariable("R8Jar", "r8.jar")
 	pctx.HostJavaToolVariable("D8Jar", "d8.jar")
+	pctx.HostJavaToolVariable("BundletoolJar", "bundletool.jar")
 
 	pctx.HostBinToolVariable("SoongJavacWrapper", "soong_javac_wrapper")
 	pctx.HostBinToolVariable("DexpreoptGen", "dexpreopt_gen")
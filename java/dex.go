@@ -499,6 +499,8 @@ func (d *dexer) compileDex(ctx android.ModuleContext, dexParams *compileDexParam
 			Implicits:       r8Deps,
 			Args:            args,
 		})
+		recordJavaCompileAction(ctx, "r8", javalibJar, nil, android.Paths{dexParams.classesJar},
+			len(dexParams.flags.bootClasspath)+len(dexParams.flags.dexClasspath))
 	} else {
 		implicitOutputs := android.WritablePaths{}
 		d8Flags, d8Deps, d8ArtProfileOutputPath := d.d8Flags(ctx, dexParams)
@@ -528,6 +530,8 @@ func (d *dexer) compileDex(ctx android.ModuleContext, dexParams *compileDexParam
 				"mergeZipsFlags": mergeZipsFlags,
 			},
 		})
+		recordJavaCompileAction(ctx, "d8", javalibJar, nil, android.Paths{dexParams.classesJar},
+			len(dexParams.flags.bootClasspath)+len(dexParams.flags.dexClasspath))
 	}
 	if proptools.Bool(d.dexProperties.Uncompress_dex) {
 		alignedJavalibJar := android.PathForModuleOut(ctx, "aligned", dexParams.jarName).OutputPath
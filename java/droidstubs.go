@@ -1244,6 +1244,12 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	stubCmdParams.stubsType = Exportable
 	d.exportableStubCmd(ctx, stubCmdParams)
 
+	// Make the API files, and the last released API files that they are checked against, available
+	// to the api_changelog singleton.
+	if doCheckReleased {
+		d.setApiChangelogInfo(ctx)
+	}
+
 	if apiCheckEnabled(ctx, d.properties.Check_api.Current, "current") {
 
 		if len(d.Javadoc.properties.Out) > 0 {
@@ -562,6 +562,21 @@ func (s FlagFilesByCategory) sort() {
 	}
 }
 
+// FlagFileProviders maps from the path of a flag file to the name of the module that provided it.
+//
+// It is only used to record where the flags came from in the provenance file generated alongside
+// the flags file and so it is not an error if a flag file has no entry.
+type FlagFileProviders map[string]string
+
+// addAll records that all the flag files in flagFilesByCategory were provided by the named module.
+func (p FlagFileProviders) addAll(name string, flagFilesByCategory FlagFilesByCategory) {
+	for _, paths := range flagFilesByCategory {
+		for _, path := range paths {
+			p[path.String()] = name
+		}
+	}
+}
+
 // HiddenAPIInfo contains information provided by the hidden API processing.
 //
 // That includes paths resolved from HiddenAPIFlagFileProperties and also generated by hidden API
@@ -912,6 +927,12 @@ type HiddenAPIFlagOutput struct {
 	// The path to the generated all-flags.csv file.
 	AllFlagsPath android.Path
 
+	// The path to the generated all-flags.provenance.csv file which records, for each signature in
+	// all-flags.csv, the flag file, category, fragment and API scope that contributed each flag.
+	//
+	// This is not available in prebuilt bootclasspath_fragment modules.
+	ProvenancePath android.Path
+
 	// The path to the generated signature-patterns.txt file which defines the subset of the
 	// monolithic hidden API files provided in this.
 	SignaturePatternsPath android.Path
@@ -973,6 +994,16 @@ func pathForValidation(ctx android.PathContext, path android.WritablePath) andro
 	return path.ReplaceExtension(ctx, extWithoutLeadingDot+".valid")
 }
 
+// pathForProvenance creates a path of the same type as the supplied type but with a name of
+// <path without extension>.provenance<ext>.
+//
+// e.g. If path is an OutputPath for out/soong/hiddenapi/hiddenapi-flags.csv then this will return
+// an OutputPath for out/soong/hiddenapi/hiddenapi-flags.provenance.csv
+func pathForProvenance(ctx android.PathContext, path android.WritablePath) android.WritablePath {
+	extWithoutLeadingDot := strings.TrimPrefix(path.Ext(), ".")
+	return path.ReplaceExtension(ctx, "provenance."+extWithoutLeadingDot)
+}
+
 // buildRuleToGenerateHiddenApiFlags creates a rule to create the monolithic hidden API flags from
 // the flags from all the modules, the stub flags, augmented with some additional configuration
 // files.
@@ -986,31 +1017,47 @@ func pathForValidation(ctx android.PathContext, path android.WritablePath) andro
 //
 // hiddenAPIInfo is a struct containing paths to files that augment the information provided by
 // the annotationFlags.
+//
+// flagFileProviders records which module provided each of the flag files and is used, along with
+// the category of each flag file, to annotate the provenance file that is generated alongside
+// outputPath. The path to the provenance file is returned.
 func buildRuleToGenerateHiddenApiFlags(ctx android.BuilderContext, name, desc string,
 	outputPath android.WritablePath, baseFlagsPath android.Path, annotationFlagPaths android.Paths,
-	flagFilesByCategory FlagFilesByCategory, flagSubsets SignatureCsvSubsets, generatedRemovedDexSignatures android.OptionalPath) {
+	flagFilesByCategory FlagFilesByCategory, flagFileProviders FlagFileProviders,
+	flagSubsets SignatureCsvSubsets, generatedRemovedDexSignatures android.OptionalPath) android.Path {
 
 	// Create the rule that will generate the flag files.
 	tempPath := tempPathForRestat(ctx, outputPath)
+	provenancePath := pathForProvenance(ctx, outputPath)
 	rule := android.NewRuleBuilder(pctx, ctx)
 	command := rule.Command().
 		BuiltTool("generate_hiddenapi_lists").
 		FlagWithInput("--csv ", baseFlagsPath).
 		Inputs(annotationFlagPaths).
-		FlagWithOutput("--output ", tempPath)
+		FlagWithOutput("--output ", tempPath).
+		FlagWithOutput("--provenance-output ", provenancePath)
+
+	// Add a flag file, annotated with its category and the module that provided it.
+	addFlagFile := func(category hiddenAPIFlagFileCategory, path android.Path) {
+		category.commandMutator(command, path)
+		command.FlagWithArg("--category ", category.PropertyName())
+		if provider, ok := flagFileProviders[path.String()]; ok {
+			command.FlagWithArg("--fragment ", provider)
+		}
+	}
 
 	// Add the options for the different categories of flag files.
 	for _, category := range HiddenAPIFlagFileCategories {
 		paths := flagFilesByCategory[category]
 		for _, path := range paths {
-			category.commandMutator(command, path)
+			addFlagFile(category, path)
 		}
 	}
 
 	// If available then pass the automatically generated file containing dex signatures of removed
 	// API members to the rule so they can be marked as removed.
 	if generatedRemovedDexSignatures.Valid() {
-		hiddenAPIFlagFileCategoryRemoved.commandMutator(command, generatedRemovedDexSignatures.Path())
+		addFlagFile(hiddenAPIFlagFileCategoryRemoved, generatedRemovedDexSignatures.Path())
 	}
 
 	commitChangeForRestat(rule, tempPath, outputPath)
@@ -1029,6 +1076,8 @@ func buildRuleToGenerateHiddenApiFlags(ctx android.BuilderContext, name, desc st
 	}
 
 	rule.Build(name, desc)
+
+	return provenancePath
 }
 
 // SignatureCsvSubset describes a subset of a monolithic flags file, i.e. either
@@ -1169,6 +1218,7 @@ func buildRuleValidateOverlappingCsvFiles(ctx android.BuilderContext, name strin
 // * metadata.csv
 // * index.csv
 // * all-flags.csv
+// * all-flags.provenance.csv
 func hiddenAPIFlagRulesForBootclasspathFragment(ctx android.ModuleContext, bootDexInfoByModule bootDexInfoByModule, contents []android.Module, input HiddenAPIFlagInput, suffix string) HiddenAPIFlagOutput {
 	hiddenApiSubDir := "modular-hiddenapi" + suffix
 
@@ -1202,7 +1252,12 @@ func hiddenAPIFlagRulesForBootclasspathFragment(ctx android.ModuleContext, bootD
 	// Generate the all-flags.csv which are the flags that will, in future, be encoded into the dex
 	// files.
 	allFlagsCSV := android.PathForModuleOut(ctx, hiddenApiSubDir, "all-flags.csv")
-	buildRuleToGenerateHiddenApiFlags(ctx, "modularHiddenApiAllFlags"+suffix, "modular hiddenapi all flags"+suffix, allFlagsCSV, stubFlagsCSV, android.Paths{annotationFlagsCSV}, input.FlagFilesByCategory, nil, removedDexSignatures)
+	flagFileProviders := FlagFileProviders{}
+	flagFileProviders.addAll(ctx.ModuleName(), input.FlagFilesByCategory)
+	if removedDexSignatures.Valid() {
+		flagFileProviders[removedDexSignatures.String()] = ctx.ModuleName()
+	}
+	provenanceCSV := buildRuleToGenerateHiddenApiFlags(ctx, "modularHiddenApiAllFlags"+suffix, "modular hiddenapi all flags"+suffix, allFlagsCSV, stubFlagsCSV, android.Paths{annotationFlagsCSV}, input.FlagFilesByCategory, flagFileProviders, nil, removedDexSignatures)
 
 	// Generate the filtered-stub-flags.csv file which contains the filtered stub flags that will be
 	// compared against the monolithic stub flags.
@@ -1225,6 +1280,7 @@ func hiddenAPIFlagRulesForBootclasspathFragment(ctx android.ModuleContext, bootD
 		IndexPath:             indexCSV,
 		StubFlagsPath:         stubFlagsCSV,
 		AllFlagsPath:          allFlagsCSV,
+		ProvenancePath:        provenanceCSV,
 		FilteredStubFlagsPath: filteredStubFlagsCSV,
 		FilteredFlagsPath:     filteredFlagsCSV,
 	}
@@ -29,6 +29,10 @@ type MonolithicHiddenAPIInfo struct {
 	// that category.
 	FlagsFilesByCategory FlagFilesByCategory
 
+	// FlagFileProviders maps from each of the paths in FlagsFilesByCategory to the name of the
+	// module that provided it.
+	FlagFileProviders FlagFileProviders
+
 	// The paths to the generated annotation-flags.csv files.
 	AnnotationFlagsPaths android.Paths
 
@@ -56,6 +60,8 @@ func newMonolithicHiddenAPIInfo(ctx android.ModuleContext, flagFilesByCategory F
 	monolithicInfo := MonolithicHiddenAPIInfo{}
 
 	monolithicInfo.FlagsFilesByCategory = flagFilesByCategory
+	monolithicInfo.FlagFileProviders = FlagFileProviders{}
+	monolithicInfo.FlagFileProviders.addAll(ctx.ModuleName(), flagFilesByCategory)
 
 	// Merge all the information from the classpathElements. The fragments form a DAG so it is possible that
 	// this will introduce duplicates so they will be resolved after processing all the classpathElements.
@@ -81,6 +87,7 @@ func newMonolithicHiddenAPIInfo(ctx android.ModuleContext, flagFilesByCategory F
 // append appends all the files from the supplied info to the corresponding files in this struct.
 func (i *MonolithicHiddenAPIInfo) append(ctx android.ModuleContext, otherModule android.Module, other *HiddenAPIInfo) {
 	i.FlagsFilesByCategory.append(other.FlagFilesByCategory)
+	i.FlagFileProviders.addAll(android.RemoveOptionalPrebuiltPrefix(otherModule.Name()), other.FlagFilesByCategory)
 	i.AnnotationFlagsPaths = append(i.AnnotationFlagsPaths, other.AnnotationFlagsPath)
 	i.MetadataPaths = append(i.MetadataPaths, other.MetadataPath)
 	i.IndexPaths = append(i.IndexPaths, other.IndexPath)
@@ -78,6 +78,9 @@ func (j *jdepsGeneratorSingleton) GenerateBuildActions(ctx android.SingletonCont
 		dpInfo.Paths = []string{ctx.ModuleDir(module)}
 		dpInfo.Static_libs = android.FirstUniqueStrings(dpInfo.Static_libs)
 		dpInfo.Libs = android.FirstUniqueStrings(dpInfo.Libs)
+		dpInfo.Kotlin_src_dirs = android.FirstUniqueStrings(dpInfo.Kotlin_src_dirs)
+		dpInfo.Generated_src_dirs = android.FirstUniqueStrings(dpInfo.Generated_src_dirs)
+		dpInfo.Resource_dirs = android.FirstUniqueStrings(dpInfo.Resource_dirs)
 		moduleInfos[name] = dpInfo
 
 		mkProvider, ok := module.(android.AndroidMkDataProvider)
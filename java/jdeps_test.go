@@ -18,6 +18,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/google/blueprint/proptools"
+
 	"android/soong/android"
 )
 
@@ -85,3 +87,59 @@ func TestCollectJavaLibraryPropertiesAddJarjarRules(t *testing.T) {
 		t.Errorf("Library.IDEInfo() Jarjar_rules = %v, want %v", dpInfo.Jarjar_rules[0], expected)
 	}
 }
+
+func TestCollectJavaLibraryPropertiesAddKotlinSrcDirs(t *testing.T) {
+	module := LibraryFactory().(*Library)
+	module.expandIDEInfoCompiledSrcs = append(module.expandIDEInfoCompiledSrcs, "a/Foo.java", "b/Bar.kt")
+	dpInfo := &android.IdeInfo{}
+
+	module.IDEInfo(dpInfo)
+
+	expected := []string{"b"}
+	if !reflect.DeepEqual(dpInfo.Kotlin_src_dirs, expected) {
+		t.Errorf("Library.IDEInfo() Kotlin_src_dirs = %v, want %v", dpInfo.Kotlin_src_dirs, expected)
+	}
+}
+
+func TestCollectJavaLibraryPropertiesAddSdkAndSystemModules(t *testing.T) {
+	module := LibraryFactory().(*Library)
+	module.deviceProperties.Sdk_version = proptools.StringPtr("system_current")
+	module.deviceProperties.System_modules = proptools.StringPtr("core-all-system-modules")
+	dpInfo := &android.IdeInfo{}
+
+	module.IDEInfo(dpInfo)
+
+	if dpInfo.Sdk_version != "system_current" {
+		t.Errorf("Library.IDEInfo() Sdk_version = %v, want %v", dpInfo.Sdk_version, "system_current")
+	}
+	if dpInfo.System_modules != "core-all-system-modules" {
+		t.Errorf("Library.IDEInfo() System_modules = %v, want %v", dpInfo.System_modules, "core-all-system-modules")
+	}
+}
+
+func TestCollectJavaLibraryIdeInfoFromBuild(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "kt/b.kt", ":gen"],
+			java_resource_dirs: ["java-res"],
+			java_version: "11",
+		}
+
+		genrule {
+			name: "gen",
+			out: ["gen/c.java"],
+			cmd: "touch $(out)",
+		}
+	`)
+
+	module := ctx.ModuleForTests("foo", "android_common").Module().(*Library)
+	dpInfo := &android.IdeInfo{}
+	module.IDEInfo(dpInfo)
+
+	android.AssertArrayString(t, "kotlin src dirs", []string{"kt"}, dpInfo.Kotlin_src_dirs)
+	android.AssertArrayString(t, "generated src dirs",
+		[]string{"out/soong/.intermediates/gen/gen/gen"}, android.StringsRelativeToTop(ctx.Config(), dpInfo.Generated_src_dirs))
+	android.AssertArrayString(t, "resource dirs", []string{"java-res"}, dpInfo.Resource_dirs)
+	android.AssertStringEquals(t, "java version", "11", dpInfo.Java_version)
+}
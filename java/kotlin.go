@@ -123,6 +123,8 @@ func kotlinCompile(ctx android.ModuleContext, outputFile, headerOutputFile andro
 			"name":              kotlinName,
 		},
 	})
+
+	recordJavaCompileAction(ctx, "kotlinc", outputFile, srcFiles, srcJars, len(flags.kotlincClasspath))
 }
 
 var kaptStubs = pctx.AndroidRemoteStaticRule("kaptStubs", android.RemoteRuleSupports{Goma: true},
@@ -228,6 +230,7 @@ func kotlinKapt(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile an
 			"classesJarOut":     resJarOutputFile.String(),
 		},
 	})
+	recordJavaCompileAction(ctx, "kapt", kaptStubsJar, srcFiles, srcJars, len(flags.kotlincClasspath))
 
 	// Then run turbine to perform annotation processing on the stubs and any .java srcFiles.
 	javaSrcFiles := srcFiles.FilterByExt(".java")
@@ -52,6 +52,9 @@ type platformBootclasspathModule struct {
 	// Path to the monolithic hiddenapi-flags.csv file.
 	hiddenAPIFlagsCSV android.OutputPath
 
+	// Path to the provenance file generated alongside the monolithic hiddenapi-flags.csv file.
+	hiddenAPIFlagsProvenanceCSV android.WritablePath
+
 	// Path to the monolithic hiddenapi-index.csv file.
 	hiddenAPIIndexCSV android.OutputPath
 
@@ -94,6 +97,8 @@ func (b *platformBootclasspathModule) OutputFiles(tag string) (android.Paths, er
 	switch tag {
 	case "hiddenapi-flags.csv":
 		return android.Paths{b.hiddenAPIFlagsCSV}, nil
+	case "hiddenapi-flags.provenance.csv":
+		return android.Paths{b.hiddenAPIFlagsProvenanceCSV}, nil
 	case "hiddenapi-index.csv":
 		return android.Paths{b.hiddenAPIIndexCSV}, nil
 	case "hiddenapi-metadata.csv":
@@ -295,7 +300,7 @@ func (b *platformBootclasspathModule) checkApexModules(ctx android.ModuleContext
 // generateHiddenAPIBuildActions generates all the hidden API related build rules.
 func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.ModuleContext, modules []android.Module, fragments []android.Module) bootDexJarByModule {
 	createEmptyHiddenApiFiles := func() {
-		paths := android.OutputPaths{b.hiddenAPIFlagsCSV, b.hiddenAPIIndexCSV, b.hiddenAPIMetadataCSV}
+		paths := android.WritablePaths{b.hiddenAPIFlagsCSV, b.hiddenAPIFlagsProvenanceCSV, b.hiddenAPIIndexCSV, b.hiddenAPIMetadataCSV}
 		for _, path := range paths {
 			ctx.Build(pctx, android.BuildParams{
 				Rule:   android.Touch,
@@ -306,6 +311,7 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 
 	// Save the paths to the monolithic files for retrieval via OutputFiles().
 	b.hiddenAPIFlagsCSV = hiddenAPISingletonPaths(ctx).flags
+	b.hiddenAPIFlagsProvenanceCSV = pathForProvenance(ctx, b.hiddenAPIFlagsCSV)
 	b.hiddenAPIIndexCSV = hiddenAPISingletonPaths(ctx).index
 	b.hiddenAPIMetadataCSV = hiddenAPISingletonPaths(ctx).metadata
 
@@ -360,7 +366,7 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 	allAnnotationFlagFiles := android.Paths{annotationFlags}
 	allAnnotationFlagFiles = append(allAnnotationFlagFiles, monolithicInfo.AnnotationFlagsPaths...)
 	allFlags := hiddenAPISingletonPaths(ctx).flags
-	buildRuleToGenerateHiddenApiFlags(ctx, "hiddenAPIFlagsFile", "monolithic hidden API flags", allFlags, stubFlags, allAnnotationFlagFiles, monolithicInfo.FlagsFilesByCategory, monolithicInfo.FlagSubsets, android.OptionalPath{})
+	buildRuleToGenerateHiddenApiFlags(ctx, "hiddenAPIFlagsFile", "monolithic hidden API flags", allFlags, stubFlags, allAnnotationFlagFiles, monolithicInfo.FlagsFilesByCategory, monolithicInfo.FlagFileProviders, monolithicInfo.FlagSubsets, android.OptionalPath{})
 
 	// Generate an intermediate monolithic hiddenapi-metadata.csv file directly from the annotations
 	// in the source code.
@@ -0,0 +1,59 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkerconfig
+
+import (
+	"fmt"
+
+	"android/soong/android"
+)
+
+// BuildApexLinkerNamespaceCheck checks that the DT_NEEDED libraries of the ELF files in the
+// unpacked payload of an APEX resolve in its linker namespace, given the provideNativeLibs and
+// requireNativeLibs of its apex_manifest.json. apexFile is the APEX built from imageDir, so that
+// the check runs after imageDir is populated. Returns a timestamp to use as a validation.
+func BuildApexLinkerNamespaceCheck(ctx android.ModuleContext, apexName string, imageDir android.Path,
+	apexManifest android.Path, apexFile android.Path) android.Path {
+
+	timestamp := android.PathForModuleOut(ctx, "linker_namespace_check.timestamp")
+	builder := android.NewRuleBuilder(pctx, ctx)
+	builder.Command().
+		BuiltTool("linker_namespace_check").
+		FlagWithArg("--type ", "apex").
+		FlagWithArg("--name ", apexName).
+		FlagWithInput("--apex_manifest ", apexManifest).
+		FlagWithArg("--root ", imageDir.String()).
+		Implicit(apexFile)
+	builder.Command().Text("touch").Output(timestamp)
+	builder.Build("linker_namespace_check", fmt.Sprintf("Checking linker namespace of %s", apexName))
+	return timestamp
+}
+
+// BuildSystemLinkerNamespaceCheck checks that the DT_NEEDED libraries of the ELF files in the
+// system partition resolve in the system linker namespace, given the provideLibs and requireLibs
+// of systemDir/etc/linker.config.pb. image is the filesystem image built from systemDir, so that
+// the check runs after systemDir is populated. Returns a timestamp to use as a validation.
+func BuildSystemLinkerNamespaceCheck(ctx android.ModuleContext, systemDir android.Path, image android.Path) android.Path {
+	timestamp := android.PathForModuleOut(ctx, "linker_namespace_check.timestamp")
+	builder := android.NewRuleBuilder(pctx, ctx)
+	builder.Command().
+		BuiltTool("linker_namespace_check").
+		FlagWithArg("--type ", "system").
+		FlagWithArg("--root ", systemDir.String()).
+		Implicit(image)
+	builder.Command().Text("touch").Output(timestamp)
+	builder.Build("linker_namespace_check", fmt.Sprintf("Checking linker namespace of %s", ctx.ModuleName()))
+	return timestamp
+}
@@ -0,0 +1,384 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gen_slsa_provenance writes in-toto statements with SLSA provenance predicates
+// for build outputs, wrapped in DSSE envelopes.
+//
+// The parameters shared by every output of the build, including the digests of
+// the toolchains, are collected once with:
+//
+//	gen_slsa_provenance build-parameters -o <json> ...
+//
+// and then each output is attested with:
+//
+//	gen_slsa_provenance attest --build_parameters <json> --subject <name>=<file> -o <out.intoto.jsonl> ...
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	statementType     = "https://in-toto.io/Statement/v1"
+	provenanceType    = "https://slsa.dev/provenance/v1"
+	inTotoPayloadType = "application/vnd.in-toto+json"
+
+	// buildType identifies the format of the buildDefinition written by this
+	// tool, and builderId identifies the build system.
+	buildType = "https://android.googlesource.com/platform/build/soong/+/HEAD/provenance/gen_slsa_provenance/v1"
+	builderId = "https://android.googlesource.com/platform/build/soong"
+)
+
+type multiString []string
+
+func (ms *multiString) String() string     { return strings.Join(*ms, ", ") }
+func (ms *multiString) Set(s string) error { *ms = append(*ms, s); return nil }
+
+// resourceDescriptor is an in-toto ResourceDescriptor.
+type resourceDescriptor struct {
+	Name        string            `json:"name,omitempty"`
+	Uri         string            `json:"uri,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// buildParameters are the parameters shared by every output of the build.
+type buildParameters struct {
+	Product       string `json:"product"`
+	ReleaseConfig string `json:"releaseConfig"`
+	BuildVariant  string `json:"buildVariant"`
+	BuildId       string `json:"buildId,omitempty"`
+
+	// Sources lists the projects of the source tree, from the repo manifest.
+	Sources []resourceDescriptor `json:"sources,omitempty"`
+
+	// Toolchains lists the digests of the toolchains.
+	Toolchains []resourceDescriptor `json:"toolchains,omitempty"`
+}
+
+// statement is an in-toto Statement with a SLSA provenance predicate.
+type statement struct {
+	Type          string               `json:"_type"`
+	Subject       []resourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     provenance           `json:"predicate"`
+}
+
+type provenance struct {
+	BuildDefinition buildDefinition `json:"buildDefinition"`
+	RunDetails      runDetails      `json:"runDetails"`
+}
+
+type buildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   externalParameters   `json:"externalParameters"`
+	InternalParameters   map[string]string    `json:"internalParameters,omitempty"`
+	ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type externalParameters struct {
+	Product       string `json:"product"`
+	ReleaseConfig string `json:"releaseConfig"`
+	BuildVariant  string `json:"buildVariant"`
+	Target        string `json:"target"`
+	BuildCommand  string `json:"buildCommand"`
+}
+
+type runDetails struct {
+	Builder  builder   `json:"builder"`
+	Metadata *metadata `json:"metadata,omitempty"`
+}
+
+type builder struct {
+	Id string `json:"id"`
+}
+
+type metadata struct {
+	InvocationId string `json:"invocationId,omitempty"`
+}
+
+// envelope is a DSSE envelope.
+type envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []signature `json:"signatures"`
+}
+
+type signature struct {
+	KeyId string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// repoManifest is the subset of a repo manifest that identifies the revision
+// of each project.
+type repoManifest struct {
+	Default struct {
+		Revision string `xml:"revision,attr"`
+	} `xml:"default"`
+	Projects []struct {
+		Name     string `xml:"name,attr"`
+		Path     string `xml:"path,attr"`
+		Revision string `xml:"revision,attr"`
+	} `xml:"project"`
+}
+
+var gitCommitRegexp = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// readRepoManifest returns the projects of a repo manifest. Projects pinned to
+// a commit, as in the output of `repo manifest -r`, have a gitCommit digest.
+func readRepoManifest(r io.Reader) ([]resourceDescriptor, error) {
+	var manifest repoManifest
+	if err := xml.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	var ret []resourceDescriptor
+	for _, p := range manifest.Projects {
+		d := resourceDescriptor{Name: p.Path, Uri: p.Name}
+		if d.Name == "" {
+			d.Name = p.Name
+		}
+		revision := p.Revision
+		if revision == "" {
+			revision = manifest.Default.Revision
+		}
+		if gitCommitRegexp.MatchString(revision) {
+			d.Digest = map[string]string{"gitCommit": revision}
+		} else if revision != "" {
+			d.Annotations = map[string]string{"revision": revision}
+		}
+		ret = append(ret, d)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+func sha256File(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// digestFiles returns a resource descriptor with the sha256 digest of each
+// <name>=<file> argument.
+func digestFiles(args []string) ([]resourceDescriptor, error) {
+	var ret []resourceDescriptor
+	for _, arg := range args {
+		name, file, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid argument %q, expected <name>=<file>", arg)
+		}
+		digest, err := sha256File(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, resourceDescriptor{Name: name, Uri: file, Digest: map[string]string{"sha256": digest}})
+	}
+	return ret, nil
+}
+
+// newStatement returns the provenance of the subjects, built with `m <target>`.
+func newStatement(params *buildParameters, target string, subjects []resourceDescriptor) *statement {
+	// Subjects are identified by their digest, not by their location in the
+	// out directory.
+	for i := range subjects {
+		subjects[i].Uri = ""
+	}
+	buildCommand := fmt.Sprintf("build/soong/soong_ui.bash --make-mode TARGET_PRODUCT=%s TARGET_RELEASE=%s TARGET_BUILD_VARIANT=%s %s",
+		params.Product, params.ReleaseConfig, params.BuildVariant, target)
+	s := &statement{
+		Type:          statementType,
+		Subject:       subjects,
+		PredicateType: provenanceType,
+		Predicate: provenance{
+			BuildDefinition: buildDefinition{
+				BuildType: buildType,
+				ExternalParameters: externalParameters{
+					Product:       params.Product,
+					ReleaseConfig: params.ReleaseConfig,
+					BuildVariant:  params.BuildVariant,
+					Target:        target,
+					BuildCommand:  buildCommand,
+				},
+				ResolvedDependencies: append(append([]resourceDescriptor(nil), params.Sources...), params.Toolchains...),
+			},
+			RunDetails: runDetails{
+				Builder: builder{Id: builderId},
+			},
+		},
+	}
+	if params.BuildId != "" {
+		s.Predicate.BuildDefinition.InternalParameters = map[string]string{"buildId": params.BuildId}
+		s.Predicate.RunDetails.Metadata = &metadata{InvocationId: params.BuildId}
+	}
+	return s
+}
+
+// pae returns the DSSE pre-authentication encoding of a payload, which is
+// what gets signed.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// newEnvelope wraps the statement in a DSSE envelope, signed by the signer if
+// there is one.
+func newEnvelope(s *statement, signer signer) (*envelope, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	e := &envelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []signature{},
+	}
+	if signer != nil {
+		sig, err := signer.sign(pae(inTotoPayloadType, payload))
+		if err != nil {
+			return nil, fmt.Errorf("error signing provenance: %w", err)
+		}
+		e.Signatures = append(e.Signatures, signature{KeyId: signer.keyId(), Sig: base64.StdEncoding.EncodeToString(sig)})
+	}
+	return e, nil
+}
+
+func writeJson(file string, v any, indent bool) error {
+	var buf []byte
+	var err error
+	if indent {
+		buf, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		buf, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(buf, '\n'), 0666)
+}
+
+func buildParametersCommand(args []string) error {
+	flags := flag.NewFlagSet("build-parameters", flag.ExitOnError)
+	out := flags.String("o", "", "output file")
+	params := &buildParameters{}
+	flags.StringVar(&params.Product, "product", "", "name of the product")
+	flags.StringVar(&params.ReleaseConfig, "release_config", "", "name of the release config")
+	flags.StringVar(&params.BuildVariant, "build_variant", "", "build variant")
+	flags.StringVar(&params.BuildId, "build_id", "", "build id")
+	repoManifestFile := flags.String("repo_manifest", "", "repo manifest with the revisions of the source tree")
+	var toolchains multiString
+	flags.Var(&toolchains, "toolchain", "<name>=<file> of a toolchain binary to record the digest of")
+	flags.Parse(args)
+
+	if *out == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if *repoManifestFile != "" {
+		f, err := os.Open(*repoManifestFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		params.Sources, err = readRepoManifest(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *repoManifestFile, err)
+		}
+	}
+	var err error
+	params.Toolchains, err = digestFiles(toolchains)
+	if err != nil {
+		return err
+	}
+	return writeJson(*out, params, true)
+}
+
+func attestCommand(args []string) error {
+	flags := flag.NewFlagSet("attest", flag.ExitOnError)
+	out := flags.String("o", "", "output .intoto.jsonl file")
+	buildParametersFile := flags.String("build_parameters", "", "output of the build-parameters command")
+	target := flags.String("target", "", "build target that builds the subjects")
+	signingKey := flags.String("signing_key", "", "PEM encoded private key to sign the provenance with")
+	signingCommand := flags.String("signing_command", "", "command that signs its standard input, writing the signature to its standard output")
+	var subjects multiString
+	flags.Var(&subjects, "subject", "<name>=<file> of an output to attest")
+	flags.Parse(args)
+
+	if *out == "" || *buildParametersFile == "" || *target == "" || len(subjects) == 0 || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	buf, err := os.ReadFile(*buildParametersFile)
+	if err != nil {
+		return err
+	}
+	params := &buildParameters{}
+	if err := json.Unmarshal(buf, params); err != nil {
+		return fmt.Errorf("%s: %w", *buildParametersFile, err)
+	}
+
+	signer, err := newSigner(*signingKey, *signingCommand)
+	if err != nil {
+		return err
+	}
+
+	digests, err := digestFiles(subjects)
+	if err != nil {
+		return err
+	}
+	e, err := newEnvelope(newStatement(params, *target, digests), signer)
+	if err != nil {
+		return err
+	}
+	return writeJson(*out, e, false)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: gen_slsa_provenance build-parameters|attest [flags]\n")
+		os.Exit(1)
+	}
+	var err error
+	switch os.Args[1] {
+	case "build-parameters":
+		err = buildParametersCommand(os.Args[2:])
+	case "attest":
+		err = attestCommand(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
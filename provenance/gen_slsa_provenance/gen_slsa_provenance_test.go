@@ -0,0 +1,185 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRepoManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <remote name="aosp" fetch=".."/>
+  <default revision="main" remote="aosp"/>
+  <project path="build/soong" name="platform/build/soong" revision="0123456789abcdef0123456789abcdef01234567"/>
+  <project path="art" name="platform/art"/>
+</manifest>
+`
+
+func TestReadRepoManifest(t *testing.T) {
+	sources, err := readRepoManifest(strings.NewReader(testRepoManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []resourceDescriptor{
+		{
+			Name:        "art",
+			Uri:         "platform/art",
+			Annotations: map[string]string{"revision": "main"},
+		},
+		{
+			Name:   "build/soong",
+			Uri:    "platform/build/soong",
+			Digest: map[string]string{"gitCommit": "0123456789abcdef0123456789abcdef01234567"},
+		},
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("expected %v, got %v", expected, sources)
+	}
+}
+
+func testStatement() *statement {
+	params := &buildParameters{
+		Product:       "aosp_arm64",
+		ReleaseConfig: "trunk_staging",
+		BuildVariant:  "userdebug",
+		BuildId:       "12345",
+		Sources: []resourceDescriptor{
+			{Name: "build/soong", Digest: map[string]string{"gitCommit": "0123456789abcdef0123456789abcdef01234567"}},
+		},
+		Toolchains: []resourceDescriptor{
+			{Name: "clang", Digest: map[string]string{"sha256": "abcd"}},
+		},
+	}
+	subjects := []resourceDescriptor{
+		{Name: "system.img", Uri: "out/target/product/generic/system.img", Digest: map[string]string{"sha256": "1234"}},
+	}
+	return newStatement(params, "systemimage", subjects)
+}
+
+func TestNewStatement(t *testing.T) {
+	s := testStatement()
+
+	if s.Subject[0].Uri != "" {
+		t.Errorf("expected the subject uri to be cleared, got %q", s.Subject[0].Uri)
+	}
+	params := s.Predicate.BuildDefinition.ExternalParameters
+	expectedCommand := "build/soong/soong_ui.bash --make-mode TARGET_PRODUCT=aosp_arm64 TARGET_RELEASE=trunk_staging TARGET_BUILD_VARIANT=userdebug systemimage"
+	if params.BuildCommand != expectedCommand {
+		t.Errorf("expected build command %q, got %q", expectedCommand, params.BuildCommand)
+	}
+	if params.ReleaseConfig != "trunk_staging" {
+		t.Errorf("expected release config trunk_staging, got %q", params.ReleaseConfig)
+	}
+	var deps []string
+	for _, d := range s.Predicate.BuildDefinition.ResolvedDependencies {
+		deps = append(deps, d.Name)
+	}
+	if expected := []string{"build/soong", "clang"}; !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected resolved dependencies %v, got %v", expected, deps)
+	}
+	if id := s.Predicate.BuildDefinition.InternalParameters["buildId"]; id != "12345" {
+		t.Errorf("expected build id 12345, got %q", id)
+	}
+}
+
+func TestSignedEnvelope(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newKeySigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := newEnvelope(testStatement(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PayloadType != inTotoPayloadType {
+		t.Errorf("expected payload type %q, got %q", inTotoPayloadType, e.PayloadType)
+	}
+	if len(e.Signatures) != 1 {
+		t.Fatalf("expected 1 signature, got %d", len(e.Signatures))
+	}
+	if e.Signatures[0].KeyId != signer.keyId() || e.Signatures[0].KeyId == "" {
+		t.Errorf("unexpected key id %q", e.Signatures[0].KeyId)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(e.Signatures[0].Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), pae(e.PayloadType, payload), sig) {
+		t.Errorf("signature does not verify")
+	}
+
+	var s statement
+	if err := json.Unmarshal(payload, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != statementType || s.PredicateType != provenanceType {
+		t.Errorf("unexpected statement types %q, %q", s.Type, s.PredicateType)
+	}
+}
+
+func TestCommandSigner(t *testing.T) {
+	e, err := newEnvelope(testStatement(), &commandSigner{command: "sha256sum | cut -d' ' -f1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Signatures) != 1 || e.Signatures[0].KeyId != "" {
+		t.Fatalf("unexpected signatures %v", e.Signatures)
+	}
+}
+
+func TestUnsignedEnvelope(t *testing.T) {
+	e, err := newEnvelope(testStatement(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Signatures) != 0 {
+		t.Errorf("expected no signatures, got %v", e.Signatures)
+	}
+	buf, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), `"signatures":[]`) {
+		t.Errorf("expected an empty signatures list, got %s", buf)
+	}
+}
+
+func TestPae(t *testing.T) {
+	expected := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if actual := string(pae("http://example.com/HelloWorld", []byte("hello world"))); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// signer signs the DSSE pre-authentication encoding of the provenance.
+type signer interface {
+	sign(message []byte) ([]byte, error)
+
+	// keyId returns the identifier of the key, or an empty string if it is
+	// not known.
+	keyId() string
+}
+
+// newSigner returns the signer for the --signing_key or --signing_command
+// arguments, or nil if the provenance is not signed.
+func newSigner(keyFile, command string) (signer, error) {
+	switch {
+	case keyFile != "" && command != "":
+		return nil, fmt.Errorf("--signing_key and --signing_command are mutually exclusive")
+	case keyFile != "":
+		buf, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		s, err := newKeySigner(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+		return s, nil
+	case command != "":
+		return &commandSigner{command: command}, nil
+	}
+	return nil, nil
+}
+
+// keySigner signs with a local private key, e.g. a test key in CI.
+type keySigner struct {
+	key crypto.Signer
+	id  string
+}
+
+// newKeySigner parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key. The
+// key id is the sha256 digest of the DER encoded public key.
+func newKeySigner(buf []byte) (*keySigner, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cryptoSigner, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(cryptoSigner.Public())
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(pub)
+	return &keySigner{key: cryptoSigner, id: hex.EncodeToString(id[:])}, nil
+}
+
+func (s *keySigner) sign(message []byte) ([]byte, error) {
+	switch s.key.(type) {
+	case ed25519.PrivateKey:
+		// ed25519 signs the message itself rather than a digest.
+		return s.key.Sign(rand.Reader, message, crypto.Hash(0))
+	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", s.key)
+}
+
+func (s *keySigner) keyId() string {
+	return s.id
+}
+
+// commandSigner signs by running a command through the shell, which reads the
+// message from its standard input and writes the raw signature to its standard
+// output. This allows signing with keys that are not available as files, e.g.
+// in a hardware security module.
+type commandSigner struct {
+	command string
+}
+
+func (s *commandSigner) sign(message []byte) ([]byte, error) {
+	cmd := exec.Command("/bin/bash", "-c", s.command)
+	cmd.Stdin = bytes.NewReader(message)
+	cmd.Stderr = os.Stderr
+	sig, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%q failed: %w", s.command, err)
+	}
+	if len(sig) == 0 {
+		return nil, fmt.Errorf("%q did not write a signature", s.command)
+	}
+	return sig, nil
+}
+
+func (s *commandSigner) keyId() string {
+	return ""
+}
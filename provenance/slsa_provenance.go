@@ -0,0 +1,176 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provenance
+
+import (
+	"path/filepath"
+	"strings"
+
+	"android/soong/android"
+	cc_config "android/soong/cc/config"
+	rust_config "android/soong/rust/config"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// SlsaProvenanceInfo lists the in-toto attestations with SLSA provenance
+// predicates written for the outputs of a module.
+type SlsaProvenanceInfo struct {
+	Attestations android.Paths
+}
+
+var SlsaProvenanceInfoProvider = blueprint.NewProvider[SlsaProvenanceInfo]()
+
+// SlsaProvenancePhonyName returns the name of the phony target that builds the
+// SLSA provenance of the outputs of the named module.
+func SlsaProvenancePhonyName(moduleName string) string {
+	return moduleName + "-provenance"
+}
+
+// slsaBuildParametersFile returns the path of the parameters shared by the SLSA
+// provenance of every output of the build, which are written by the
+// slsa_provenance_singleton.
+func slsaBuildParametersFile(ctx android.PathContext) android.OutputPath {
+	return android.PathForOutput(ctx, "provenance", "slsa_build_parameters.json")
+}
+
+// addSlsaSigningFlags adds the flags that sign the provenance with the
+// configured key or command. The key is a path relative to the root of the
+// source tree, so that a test key can be checked in for CI builds.
+func addSlsaSigningFlags(ctx android.PathContext, deviceConfig android.DeviceConfig, cmd *android.RuleBuilderCommand) {
+	if key := deviceConfig.ProvenanceSigningKey(); key != "" {
+		cmd.FlagWithInput("--signing_key ", android.PathForSource(ctx, key))
+	} else if command := deviceConfig.ProvenanceSigningCommand(); command != "" {
+		cmd.FlagWithArg("--signing_command ", proptools.ShellEscape(command))
+	}
+}
+
+// GenerateSlsaProvenance writes an in-toto statement with a SLSA provenance
+// predicate for an output of the current context module, and adds it to the
+// <module>-provenance phony target. It is used for the filesystem images,
+// APEXes and apps built by Soong; the provenance of the target-files package is
+// written by Make from the SOONG_SLSA_PROVENANCE_* make vars. The statement
+// records the digest of the output along with the revisions of the source
+// tree, the release config, the digests of the toolchains and the command that
+// builds the output.
+func GenerateSlsaProvenance(ctx android.ModuleContext, subject android.Path) android.Path {
+	attestation := android.PathForModuleOut(ctx, "provenance", subject.Base()+".intoto.jsonl")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().
+		BuiltTool("gen_slsa_provenance").
+		Text("attest").
+		FlagWithInput("--build_parameters ", slsaBuildParametersFile(ctx)).
+		FlagWithArg("--target ", ctx.ModuleName()).
+		FlagWithInput("--subject "+subject.Base()+"=", subject)
+	addSlsaSigningFlags(ctx, ctx.DeviceConfig(), cmd)
+	cmd.FlagWithOutput("-o ", attestation)
+	rule.Build("slsa_provenance", "SLSA provenance for "+subject.Base())
+
+	ctx.Phony(SlsaProvenancePhonyName(ctx.ModuleName()), attestation)
+	android.SetProvider(ctx, SlsaProvenanceInfoProvider, SlsaProvenanceInfo{
+		Attestations: android.Paths{attestation},
+	})
+	return attestation
+}
+
+func init() {
+	RegisterSlsaProvenanceSingleton(android.InitRegistrationContext)
+}
+
+func RegisterSlsaProvenanceSingleton(ctx android.RegistrationContext) {
+	ctx.RegisterParallelSingletonType("slsa_provenance_singleton", slsaProvenanceSingletonFactory)
+}
+
+var PrepareForTestWithSlsaProvenanceSingleton = android.FixtureRegisterWithContext(RegisterSlsaProvenanceSingleton)
+
+func slsaProvenanceSingletonFactory() android.Singleton {
+	return &slsaProvenanceSingleton{}
+}
+
+type slsaProvenanceSingleton struct {
+	attestations android.Paths
+}
+
+// slsaToolchains returns the toolchain binaries whose digests are recorded in
+// the provenance, skipping the ones that are not in the source tree.
+func slsaToolchains(ctx android.SingletonContext) map[string]android.Path {
+	ret := make(map[string]android.Path)
+	add := func(name, path string) {
+		if p := android.ExistentPathForSource(ctx, path); p.Valid() {
+			ret[name] = p.Path()
+		}
+	}
+	add("clang", cc_config.ClangPath(ctx, "bin/clang").String())
+	add("rustc", filepath.Join(rust_config.RustDefaultBase, rust_config.HostPrebuiltTag(ctx.Config()),
+		rust_config.GetRustVersion(ctx), "bin", "rustc"))
+	if javaHome := ctx.Config().Getenv("ANDROID_JAVA_HOME"); javaHome != "" && !filepath.IsAbs(javaHome) {
+		add("javac", filepath.Join(javaHome, "bin", "javac"))
+	}
+	return ret
+}
+
+func (s *slsaProvenanceSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	config := ctx.Config()
+	buildParameters := slsaBuildParametersFile(ctx)
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().
+		BuiltTool("gen_slsa_provenance").
+		Text("build-parameters").
+		FlagWithArg("--product ", config.DeviceProduct()).
+		FlagWithArg("--release_config ", config.ReleaseVersion()).
+		FlagWithArg("--build_variant ", config.BuildVariant()).
+		FlagWithArg("--build_id ", proptools.ShellEscape(config.BuildId()))
+	if manifest := ctx.DeviceConfig().ProvenanceRepoManifest(); manifest != "" {
+		cmd.FlagWithInput("--repo_manifest ", android.PathForSource(ctx, manifest))
+	}
+	toolchains := slsaToolchains(ctx)
+	for _, name := range android.SortedKeys(toolchains) {
+		cmd.FlagWithInput("--toolchain "+name+"=", toolchains[name])
+	}
+	cmd.FlagWithOutput("-o ", buildParameters)
+	rule.Build("slsa_build_parameters", "SLSA provenance build parameters")
+
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled(ctx) {
+			return
+		}
+		if info, ok := android.SingletonModuleProvider(ctx, module, SlsaProvenanceInfoProvider); ok {
+			s.attestations = append(s.attestations, info.Attestations...)
+		}
+	})
+	s.attestations = android.SortedUniquePaths(s.attestations)
+
+	ctx.Phony("slsa_provenance", s.attestations...)
+}
+
+func (s *slsaProvenanceSingleton) MakeVars(ctx android.MakeVarsContext) {
+	ctx.DistForGoal("slsa_provenance", s.attestations...)
+
+	// The provenance of the target-files package is written by Make, using
+	// the same build parameters and signing flags.
+	ctx.StrictRaw("SOONG_SLSA_PROVENANCE_BUILD_PARAMETERS", slsaBuildParametersFile(ctx).String())
+	var signingArgs []string
+	if key := ctx.DeviceConfig().ProvenanceSigningKey(); key != "" {
+		signingArgs = append(signingArgs, "--signing_key", android.PathForSource(ctx, key).String())
+	} else if command := ctx.DeviceConfig().ProvenanceSigningCommand(); command != "" {
+		signingArgs = append(signingArgs, "--signing_command", proptools.ShellEscape(command))
+	}
+	ctx.StrictRaw("SOONG_SLSA_PROVENANCE_SIGNING_ARGS", strings.Join(signingArgs, " "))
+}
+
+var _ android.SingletonMakeVarsProvider = (*slsaProvenanceSingleton)(nil)
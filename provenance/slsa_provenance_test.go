@@ -0,0 +1,134 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provenance
+
+import (
+	"strings"
+	"testing"
+
+	"android/soong/android"
+
+	"github.com/google/blueprint/proptools"
+)
+
+type testImageModule struct {
+	android.ModuleBase
+}
+
+func testImageFactory() android.Module {
+	m := &testImageModule{}
+	android.InitAndroidModule(m)
+	return m
+}
+
+func (m *testImageModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	image := android.PathForModuleOut(ctx, ctx.ModuleName()+".img")
+	android.WriteFileRule(ctx, image, ctx.ModuleName())
+	GenerateSlsaProvenance(ctx, image)
+}
+
+var prepareForSlsaProvenanceTest = android.GroupFixturePreparers(
+	PrepareForTestWithSlsaProvenanceSingleton,
+	android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+		ctx.RegisterModuleType("test_image", testImageFactory)
+	}),
+	android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+		variables.DeviceProduct = proptools.StringPtr("aosp_arm64")
+		variables.ReleaseVersion = "trunk_staging"
+		variables.ProvenanceRepoManifest = proptools.StringPtr("manifest.xml")
+		variables.ProvenanceSigningKey = proptools.StringPtr("build/provenance/test_key.pem")
+	}),
+	android.FixtureMergeMockFs(android.MockFS{
+		"manifest.xml":                  nil,
+		"build/provenance/test_key.pem": nil,
+	}),
+)
+
+func TestSlsaProvenance(t *testing.T) {
+	result := prepareForSlsaProvenanceTest.RunTestWithBp(t, `
+		test_image {
+			name: "system",
+		}
+	`)
+
+	attest := result.ModuleForTests("system", "").Output("provenance/system.img.intoto.jsonl")
+	command := attest.RuleParams.Command
+	android.AssertStringDoesContain(t, "attest command", command, "gen_slsa_provenance attest")
+	android.AssertStringDoesContain(t, "attest command", command,
+		"--build_parameters out/soong/provenance/slsa_build_parameters.json")
+	android.AssertStringDoesContain(t, "attest command", command, "--target system")
+	android.AssertStringDoesContain(t, "attest command", command,
+		"--subject system.img=out/soong/.intermediates/system/system.img")
+	android.AssertStringDoesContain(t, "attest command", command, "--signing_key build/provenance/test_key.pem")
+	android.AssertStringListContains(t, "attest inputs", android.PathsRelativeToTop(attest.Inputs),
+		"build/provenance/test_key.pem")
+
+	singleton := result.SingletonForTests("slsa_provenance_singleton")
+	parameters := singleton.Output("provenance/slsa_build_parameters.json")
+	command = parameters.RuleParams.Command
+	android.AssertStringDoesContain(t, "build parameters command", command, "--product aosp_arm64")
+	android.AssertStringDoesContain(t, "build parameters command", command, "--release_config trunk_staging")
+	android.AssertStringDoesContain(t, "build parameters command", command, "--build_variant user")
+	android.AssertStringDoesContain(t, "build parameters command", command, "--repo_manifest manifest.xml")
+}
+
+func TestSlsaProvenanceSigningCommand(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForSlsaProvenanceTest,
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.ProvenanceSigningKey = nil
+			variables.ProvenanceSigningCommand = proptools.StringPtr("sign --key foo")
+		}),
+	).RunTestWithBp(t, `
+		test_image {
+			name: "system",
+		}
+	`)
+
+	attest := result.ModuleForTests("system", "").Output("provenance/system.img.intoto.jsonl")
+	android.AssertStringDoesContain(t, "attest command", attest.RuleParams.Command,
+		"--signing_command 'sign --key foo'")
+	android.AssertStringDoesNotContain(t, "attest command", attest.RuleParams.Command, "--signing_key")
+}
+
+func TestSlsaProvenanceMakeVars(t *testing.T) {
+	makeVars := func(t *testing.T, preparers ...android.FixturePreparer) map[string]string {
+		result := android.GroupFixturePreparers(
+			prepareForSlsaProvenanceTest,
+			android.PrepareForTestAccessingMakeVars,
+			android.GroupFixturePreparers(preparers...),
+		).RunTest(t)
+		vars := map[string]string{}
+		for _, v := range result.MakeVarsForTesting(func(v android.MakeVarVariable) bool {
+			return strings.HasPrefix(v.Name(), "SOONG_SLSA_PROVENANCE_")
+		}) {
+			vars[v.Name()] = android.StringRelativeToTop(result.Config, v.Value())
+		}
+		return vars
+	}
+
+	vars := makeVars(t)
+	android.AssertStringEquals(t, "build parameters", "out/soong/provenance/slsa_build_parameters.json",
+		vars["SOONG_SLSA_PROVENANCE_BUILD_PARAMETERS"])
+	android.AssertStringEquals(t, "signing args", "--signing_key build/provenance/test_key.pem",
+		vars["SOONG_SLSA_PROVENANCE_SIGNING_ARGS"])
+
+	vars = makeVars(t, android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+		variables.ProvenanceSigningKey = nil
+		variables.ProvenanceSigningCommand = proptools.StringPtr("sign --key foo")
+	}))
+	android.AssertStringEquals(t, "signing args", "--signing_command 'sign --key foo'",
+		vars["SOONG_SLSA_PROVENANCE_SIGNING_ARGS"])
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"android/soong/android"
+)
+
+// Generator is implemented by module types that generate the sources of a
+// Python library, e.g. python_aconfig_library.
+type Generator interface {
+	GeneratorProps() []interface{}
+	GeneratorDeps(ctx android.BottomUpMutatorContext)
+
+	// GeneratorSources returns the generated .py files. They are added to
+	// the library at their path relative to the module's gen directory, e.g.
+	// PathForModuleGen(ctx, "foo", "bar.py") is imported as foo.bar.
+	GeneratorSources(ctx android.ModuleContext) android.Paths
+}
+
+func GeneratedPythonLibraryModuleFactory(callbacks Generator) android.Module {
+	module := newModule(android.HostAndDeviceSupported, android.MultilibBoth)
+	module.generators = append(module.generators, callbacks)
+	return module.init()
+}
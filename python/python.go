@@ -153,6 +153,10 @@ type PythonLibraryModule struct {
 	precompiledSrcsZip android.Path
 
 	sourceProperties android.SourceProperties
+
+	// generators add generated Python sources to the module, see
+	// GeneratedPythonLibraryModuleFactory.
+	generators []Generator
 }
 
 // newModule generates new Python base module
@@ -206,6 +210,9 @@ var _ pythonDependency = (*PythonLibraryModule)(nil)
 
 func (p *PythonLibraryModule) init() android.Module {
 	p.AddProperties(&p.properties, &p.protoProperties, &p.sourceProperties)
+	for _, generator := range p.generators {
+		p.AddProperties(generator.GeneratorProps()...)
+	}
 	android.InitAndroidArchModule(p, p.hod, p.multilib)
 	android.InitDefaultableModule(p)
 	return p
@@ -336,6 +343,10 @@ func (p *PythonLibraryModule) DepsMutator(ctx android.BottomUpMutatorContext) {
 	ctx.AddVariationDependencies(javaDataVariation, javaDataTag, p.properties.Java_data...)
 
 	p.AddDepsOnPythonLauncherAndStdlib(ctx, hostStdLibTag, hostLauncherTag, hostlauncherSharedLibTag, false, ctx.Config().BuildOSTarget)
+
+	for _, generator := range p.generators {
+		generator.GeneratorDeps(ctx)
+	}
 }
 
 // AddDepsOnPythonLauncherAndStdlib will make the current module depend on the python stdlib,
@@ -429,6 +440,10 @@ func (p *PythonLibraryModule) GenerateAndroidBuildActions(ctx android.ModuleCont
 		TopLevelTarget: p.sourceProperties.Top_level_test_target,
 	})
 
+	for _, generator := range p.generators {
+		expandedSrcs = append(expandedSrcs, generator.GeneratorSources(ctx)...)
+	}
+
 	// expand data files from "data" property.
 	expandedData := android.PathsForModuleSrc(ctx, p.properties.Data)
 
@@ -46,6 +46,7 @@ type compiler interface {
 	crateName() string
 	edition() string
 	features() []string
+	cfgs(ctx ModuleContext) []string
 	rustdoc(ctx ModuleContext, flags Flags, deps PathDeps) android.OptionalPath
 	Thinlto() bool
 
@@ -348,6 +349,10 @@ func (compiler *baseCompiler) features() []string {
 	return compiler.Properties.Features
 }
 
+func (compiler *baseCompiler) cfgs(ctx ModuleContext) []string {
+	return compiler.Properties.Cfgs.GetOrDefault(ctx, nil)
+}
+
 func (compiler *baseCompiler) featuresToFlags() []string {
 	flags := []string{}
 	for _, feature := range compiler.features() {
@@ -383,7 +388,7 @@ func CommonDefaultCfgFlags(flags Flags, vendor bool, product bool) Flags {
 func (compiler *baseCompiler) cfgFlags(ctx ModuleContext, flags Flags) Flags {
 	flags = CommonDefaultCfgFlags(flags, ctx.RustModule().InVendor(), ctx.RustModule().InProduct())
 
-	cfgFlags := cfgsToFlags(compiler.Properties.Cfgs.GetOrDefault(ctx, nil))
+	cfgFlags := cfgsToFlags(compiler.cfgs(ctx))
 	flags.RustFlags = append(flags.RustFlags, cfgFlags...)
 	flags.RustdocFlags = append(flags.RustdocFlags, cfgFlags...)
 
@@ -17,6 +17,7 @@ package rust
 import (
 	"github.com/google/blueprint"
 
+	"android/soong/android"
 	"android/soong/cc"
 )
 
@@ -86,9 +87,22 @@ func (cov *coverage) flags(ctx ModuleContext, flags Flags, deps PathDeps) (Flags
 	return flags, deps
 }
 
+// linked returns whether the module links a binary or a library that contains its own coverage
+// mapping.
+func (cov *coverage) linked(mod *Module) bool {
+	if mod.Binary() {
+		return true
+	}
+	if library, ok := mod.compiler.(libraryInterface); ok {
+		return library.dylib() || library.shared()
+	}
+	return false
+}
+
 func (cov *coverage) begin(ctx BaseModuleContext) {
-	if ctx.Host() {
-		// Host coverage not yet supported.
+	if ctx.Host() && ctx.Os() != android.Linux {
+		// Host coverage is only supported on linux_glibc, where the report is generated by
+		// the native_coverage_report singleton.
 	} else {
 		// Update useSdk and sdkVersion args if Rust modules become SDK aware.
 		cov.Properties = cc.SetCoverageProperties(ctx, cov.Properties, ctx.RustModule().nativeCoverage(), false, "")
@@ -108,3 +108,27 @@ func TestCoverageDeps(t *testing.T) {
 		t.Fatalf("missing expected coverage 'libprofile-clang-extras' dependency in linkFlags: %#v", fizz.Args["linkFlags"])
 	}
 }
+
+func TestHostCoverageReport(t *testing.T) {
+	ctx := testRustCov(t, `
+		rust_library_host {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+		}
+		rust_test_host {
+			name: "foo_test",
+			srcs: ["foo.rs"],
+			rustlibs: ["libfoo"],
+		}`)
+
+	fooTest := ctx.ModuleForTests("foo_test", "linux_glibc_x86_64_cov")
+	rustc := fooTest.Rule("rustc")
+	if !strings.Contains(rustc.Args["rustcFlags"], "-C instrument-coverage") {
+		t.Errorf("missing rustc flag '-C instrument-coverage' for host test with coverage enabled; rustcFlags: %#v", rustc.Args["rustcFlags"])
+	}
+
+	report := ctx.SingletonForTests("native_coverage_report").Output("native_coverage/coverage.lcov")
+	unstripped := fooTest.Module().(*Module).UnstrippedOutputFile().String()
+	android.AssertStringListContains(t, "coverage report binaries", report.Implicits.Strings(), unstripped)
+}
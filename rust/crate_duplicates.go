@@ -0,0 +1,386 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+	"android/soong/cc"
+)
+
+// This singleton reports the crates that are provided by more than one rust library module, or by
+// the same module with different features or cfgs, i.e. the variants of each crate_name. For every
+// binary, shared library and APEX it lists the crates of which more than one variant is linked in
+// or packaged, along with the dependency path that pulled in each variant. The report is written
+// to $OUT/soong/rust_crate_duplicates.json.
+//
+// The report is built by running m rust_crate_duplicates. m rust_crate_duplicates_check fails if
+// a binary, shared library or APEX contains duplicate crates, which can be used in CI. Crates that
+// are known to be duplicated can be allowed with RUST_CRATE_DUPLICATES_ALLOWLIST, a space
+// separated list of crate names.
+
+const (
+	envVariableRustCrateDuplicatesAllowlist = "RUST_CRATE_DUPLICATES_ALLOWLIST"
+	rustCrateDuplicatesFileName             = "rust_crate_duplicates.json"
+)
+
+var rustCrateDuplicatesCheck = pctx.AndroidStaticRule("rustCrateDuplicatesCheck",
+	blueprint.RuleParams{
+		Command: "if [ -s ${in} ]; then cat ${in}; " +
+			"echo 'Duplicate rust crates found, see ${report} for details.'; exit 1; fi; touch ${out}",
+	}, "report")
+
+// CrateInfo describes the crate compiled by a rust library module variant.
+type CrateInfo struct {
+	CrateName string
+	// Version is the value of the cargo_pkg_version property.
+	Version  string
+	Features []string
+	Cfgs     []string
+}
+
+var CrateInfoProvider = blueprint.NewProvider[CrateInfo]()
+
+// setCrateInfoProvider sets the CrateInfoProvider of library variants that compile a crate.
+func (mod *Module) setCrateInfoProvider(ctx ModuleContext) {
+	library, ok := mod.compiler.(libraryInterface)
+	if !ok || library.source() || mod.compiler.crateName() == "" {
+		return
+	}
+	android.SetProvider(ctx, CrateInfoProvider, CrateInfo{
+		CrateName: mod.compiler.crateName(),
+		Version:   mod.compiler.cargoPkgVersion(),
+		Features:  android.SortedUniqueStrings(mod.compiler.features()),
+		Cfgs:      android.SortedUniqueStrings(mod.compiler.cfgs(ctx)),
+	})
+}
+
+// crateVariant identifies a variant of a crate. The arch, linkage or image variants of a module
+// are the same crate variant.
+type crateVariant struct {
+	crateName string
+	module    string
+	version   string
+	features  string
+	cfgs      string
+}
+
+type crateVariantJson struct {
+	Module   string   `json:"module"`
+	Version  string   `json:"version,omitempty"`
+	Features []string `json:"features"`
+	Cfgs     []string `json:"cfgs"`
+	// Path is the dependency path from the binary, shared library or APEX to the module.
+	Path []string `json:"path,omitempty"`
+}
+
+type crateDuplicatesJson struct {
+	CrateName string             `json:"crate_name"`
+	Variants  []crateVariantJson `json:"variants"`
+}
+
+type crateDuplicatesModuleJson struct {
+	Name       string                `json:"name"`
+	Variant    string                `json:"variant"`
+	Kind       string                `json:"kind"`
+	Duplicates []crateDuplicatesJson `json:"duplicates"`
+}
+
+type crateDuplicatesReportJson struct {
+	// Crates lists all the crates that have more than one variant.
+	Crates []crateDuplicatesJson `json:"crates"`
+	// Modules lists the binaries, shared libraries and APEXes that contain more than one variant
+	// of a crate.
+	Modules []crateDuplicatesModuleJson `json:"modules"`
+}
+
+func init() {
+	android.RegisterParallelSingletonType("rust_crate_duplicates", crateDuplicatesSingletonFactory)
+}
+
+func crateDuplicatesSingletonFactory() android.Singleton {
+	return &crateDuplicatesSingleton{}
+}
+
+type crateDuplicatesSingleton struct {
+	// variants are the crate variants of each crate name.
+	variants map[string]map[crateVariant]CrateInfo
+	// linked memoizes the duplicated crate variants linked into each module, with the path from
+	// the module to each variant.
+	linked map[android.Module]map[crateVariant][]string
+}
+
+func newCrateVariant(ctx android.SingletonContext, module android.Module, info CrateInfo) crateVariant {
+	return crateVariant{
+		crateName: info.CrateName,
+		module:    ctx.ModuleName(module),
+		version:   info.Version,
+		features:  strings.Join(info.Features, ","),
+		cfgs:      strings.Join(info.Cfgs, ","),
+	}
+}
+
+// duplicated returns whether the crate has more than one variant in the tree.
+func (s *crateDuplicatesSingleton) duplicated(crateName string) bool {
+	return len(s.variants[crateName]) > 1
+}
+
+// crateDuplicatesRootKind returns the kind of the module if it is a binary, shared library or APEX,
+// i.e. a module whose duplicate crates are reported.
+func crateDuplicatesRootKind(module android.Module) string {
+	if _, ok := module.(android.ApexBundleDepsInfoIntf); ok {
+		return "apex"
+	}
+	if linkable, ok := module.(cc.LinkableInterface); ok {
+		if rModule, ok := module.(*Module); ok && rModule.ProcMacro() {
+			return ""
+		}
+		switch {
+		case linkable.Binary():
+			return "binary"
+		case linkable.Shared(), linkable.RustLibraryInterface() && linkable.Dylib():
+			return "shared_library"
+		}
+	}
+	return ""
+}
+
+// isLinkedDep returns whether the dependency is linked or packaged with the module, i.e. it is not
+// a stub library, a proc-macro or a tool built for another OS.
+func isLinkedDep(ctx android.SingletonContext, module, dep android.Module) bool {
+	linkable, ok := dep.(cc.LinkableInterface)
+	if !ok || !dep.Enabled(ctx) || dep.Os() != module.Os() || linkable.IsStubs() {
+		return false
+	}
+	rModule, ok := dep.(*Module)
+	return !ok || !rModule.ProcMacro()
+}
+
+// isLinkBoundary returns whether the crates of the dependency are not linked into the module, i.e.
+// it is a binary or a shared library. Rust dylibs are not boundaries, the crates they depend on are
+// loaded in the same process as the module and must be consistent with its own crates.
+func isLinkBoundary(dep android.Module) bool {
+	linkable, ok := dep.(cc.LinkableInterface)
+	return ok && (linkable.Binary() || linkable.Shared())
+}
+
+// linkedCrates returns the duplicated crate variants linked into the module, which are the crate
+// of the module itself and the crates of its dependencies up to the next binary or shared library.
+func (s *crateDuplicatesSingleton) linkedCrates(ctx android.SingletonContext, module android.Module) map[crateVariant][]string {
+	if crates, ok := s.linked[module]; ok {
+		return crates
+	}
+	crates := make(map[crateVariant][]string)
+	name := ctx.ModuleName(module)
+	if info, ok := android.SingletonModuleProvider(ctx, module, CrateInfoProvider); ok && s.duplicated(info.CrateName) {
+		crates[newCrateVariant(ctx, module, info)] = []string{name}
+	}
+	ctx.VisitDirectDeps(module, func(dep android.Module) {
+		if !isLinkedDep(ctx, module, dep) || isLinkBoundary(dep) {
+			return
+		}
+		for variant, path := range s.linkedCrates(ctx, dep) {
+			if _, exists := crates[variant]; !exists {
+				crates[variant] = append([]string{name}, path...)
+			}
+		}
+	})
+	s.linked[module] = crates
+	return crates
+}
+
+// packagedCrates returns the duplicated crate variants of the binaries and shared libraries
+// packaged in the APEX.
+func (s *crateDuplicatesSingleton) packagedCrates(ctx android.SingletonContext, apex android.Module) map[crateVariant][]string {
+	crates := make(map[crateVariant][]string)
+	visited := make(map[android.Module]bool)
+	var visit func(module android.Module, path []string)
+	visit = func(module android.Module, path []string) {
+		ctx.VisitDirectDeps(module, func(dep android.Module) {
+			if !isLinkedDep(ctx, apex, dep) || visited[dep] {
+				return
+			}
+			visited[dep] = true
+			depPath := append(append([]string(nil), path...), ctx.ModuleName(dep))
+			if crateDuplicatesRootKind(dep) != "" {
+				for variant, linkedPath := range s.linkedCrates(ctx, dep) {
+					if _, exists := crates[variant]; !exists {
+						crates[variant] = append(append([]string(nil), path...), linkedPath...)
+					}
+				}
+			}
+			visit(dep, depPath)
+		})
+	}
+	visit(apex, []string{ctx.ModuleName(apex)})
+	return crates
+}
+
+// crateDuplicates groups the crate variants by crate name and returns the crates with more than
+// one variant, sorted by crate name and module name.
+func (s *crateDuplicatesSingleton) crateDuplicates(crates map[crateVariant][]string) []crateDuplicatesJson {
+	byCrate := make(map[string][]crateVariant)
+	for variant := range crates {
+		byCrate[variant.crateName] = append(byCrate[variant.crateName], variant)
+	}
+	var ret []crateDuplicatesJson
+	for _, crateName := range android.SortedKeys(byCrate) {
+		variants := byCrate[crateName]
+		if len(variants) < 2 {
+			continue
+		}
+		sortCrateVariants(variants)
+		duplicates := crateDuplicatesJson{CrateName: crateName}
+		for _, variant := range variants {
+			info := s.variants[crateName][variant]
+			duplicates.Variants = append(duplicates.Variants, crateVariantJson{
+				Module:   variant.module,
+				Version:  info.Version,
+				Features: append([]string{}, info.Features...),
+				Cfgs:     append([]string{}, info.Cfgs...),
+				Path:     crates[variant],
+			})
+		}
+		ret = append(ret, duplicates)
+	}
+	return ret
+}
+
+func sortCrateVariants(variants []crateVariant) {
+	sort.Slice(variants, func(i, j int) bool {
+		a, b := variants[i], variants[j]
+		if a.module != b.module {
+			return a.module < b.module
+		}
+		if a.version != b.version {
+			return a.version < b.version
+		}
+		if a.features != b.features {
+			return a.features < b.features
+		}
+		return a.cfgs < b.cfgs
+	})
+}
+
+func (s *crateDuplicatesSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	s.variants = make(map[string]map[crateVariant]CrateInfo)
+	s.linked = make(map[android.Module]map[crateVariant][]string)
+
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled(ctx) {
+			return
+		}
+		if info, ok := android.SingletonModuleProvider(ctx, module, CrateInfoProvider); ok {
+			if s.variants[info.CrateName] == nil {
+				s.variants[info.CrateName] = make(map[crateVariant]CrateInfo)
+			}
+			s.variants[info.CrateName][newCrateVariant(ctx, module, info)] = info
+		}
+	})
+
+	report := crateDuplicatesReportJson{
+		Crates:  []crateDuplicatesJson{},
+		Modules: []crateDuplicatesModuleJson{},
+	}
+	allCrates := make(map[crateVariant][]string)
+	for _, variants := range s.variants {
+		for variant := range variants {
+			allCrates[variant] = nil
+		}
+	}
+	report.Crates = append(report.Crates, s.crateDuplicates(allCrates)...)
+
+	allowed := strings.Fields(ctx.Config().Getenv(envVariableRustCrateDuplicatesAllowlist))
+	var errors []string
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled(ctx) {
+			return
+		}
+		kind := crateDuplicatesRootKind(module)
+		var crates map[crateVariant][]string
+		switch kind {
+		case "":
+			return
+		case "apex":
+			crates = s.packagedCrates(ctx, module)
+		default:
+			crates = s.linkedCrates(ctx, module)
+		}
+		duplicates := s.crateDuplicates(crates)
+		if len(duplicates) == 0 {
+			return
+		}
+		report.Modules = append(report.Modules, crateDuplicatesModuleJson{
+			Name:       ctx.ModuleName(module),
+			Variant:    ctx.ModuleSubDir(module),
+			Kind:       kind,
+			Duplicates: duplicates,
+		})
+		for _, duplicate := range duplicates {
+			if android.InList(duplicate.CrateName, allowed) {
+				continue
+			}
+			var modules []string
+			for _, variant := range duplicate.Variants {
+				modules = append(modules, variant.Module)
+			}
+			errors = append(errors, fmt.Sprintf("%s (%s): crate %s is provided by %s",
+				ctx.ModuleName(module), ctx.ModuleSubDir(module), duplicate.CrateName,
+				strings.Join(android.FirstUniqueStrings(modules), ", ")))
+		}
+	})
+	sort.Slice(report.Modules, func(i, j int) bool {
+		if report.Modules[i].Name != report.Modules[j].Name {
+			return report.Modules[i].Name < report.Modules[j].Name
+		}
+		return report.Modules[i].Variant < report.Modules[j].Variant
+	})
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal rust crate duplicates report: %s", err)
+		return
+	}
+	reportFile := android.PathForOutput(ctx, rustCrateDuplicatesFileName)
+	android.WriteFileRule(ctx, reportFile, string(data))
+	ctx.Phony("rust_crate_duplicates", reportFile)
+
+	// The errors file is empty when there are no duplicates, which the check rule tests for.
+	sort.Strings(errors)
+	errorsContent := ""
+	if len(errors) > 0 {
+		errorsContent = strings.Join(errors, "\n") + "\n"
+	}
+	errorsFile := android.PathForOutput(ctx, "rust_crate_duplicates", "errors.txt")
+	android.WriteFileRuleVerbatim(ctx, errorsFile, errorsContent)
+	checkFile := android.PathForOutput(ctx, "rust_crate_duplicates", "check.timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        rustCrateDuplicatesCheck,
+		Description: "check rust crate duplicates",
+		Output:      checkFile,
+		Input:       errorsFile,
+		Implicit:    reportFile,
+		Args: map[string]string{
+			"report": reportFile.String(),
+		},
+	})
+	ctx.Phony("rust_crate_duplicates_check", checkFile)
+}
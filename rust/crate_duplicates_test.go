@@ -0,0 +1,124 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+)
+
+const crateDuplicatesBp = `
+	rust_library {
+		name: "libfoo",
+		srcs: ["foo.rs"],
+		crate_name: "foo",
+		features: ["std"],
+	}
+	rust_library {
+		name: "libfoo_v2",
+		srcs: ["foo.rs"],
+		crate_name: "foo",
+		cargo_pkg_version: "2.0.0",
+	}
+	rust_library {
+		name: "libbar",
+		srcs: ["bar.rs"],
+		crate_name: "bar",
+		rustlibs: ["libfoo"],
+	}
+	rust_binary {
+		name: "fizz",
+		srcs: ["fizz.rs"],
+		rustlibs: ["libbar", "libfoo_v2"],
+	}
+	rust_binary {
+		name: "buzz",
+		srcs: ["buzz.rs"],
+		rustlibs: ["libbar"],
+	}
+`
+
+func testCrateDuplicates(t *testing.T, preparers ...android.FixturePreparer) (*android.TestContext, crateDuplicatesReportJson) {
+	t.Helper()
+	skipTestIfOsNotSupported(t)
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		android.GroupFixturePreparers(preparers...),
+		rustMockedFiles.AddToFixture(),
+	).RunTestWithBp(t, crateDuplicatesBp)
+
+	singleton := result.SingletonForTests("rust_crate_duplicates")
+	content := android.ContentFromFileRuleForTests(t, result.TestContext, singleton.Output(rustCrateDuplicatesFileName))
+	var report crateDuplicatesReportJson
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		t.Fatalf("failed to parse the rust crate duplicates report: %s", err)
+	}
+	return result.TestContext, report
+}
+
+func TestCrateDuplicates(t *testing.T) {
+	ctx, report := testCrateDuplicates(t)
+
+	if len(report.Crates) != 1 || report.Crates[0].CrateName != "foo" {
+		t.Fatalf("expected crate foo to be reported as duplicated, got %#v", report.Crates)
+	}
+	variants := report.Crates[0].Variants
+	if len(variants) != 2 {
+		t.Fatalf("expected two variants of crate foo, got %#v", variants)
+	}
+	android.AssertStringEquals(t, "first variant", "libfoo", variants[0].Module)
+	android.AssertArrayString(t, "first variant features", []string{"std"}, variants[0].Features)
+	android.AssertStringEquals(t, "second variant", "libfoo_v2", variants[1].Module)
+	android.AssertStringEquals(t, "second variant version", "2.0.0", variants[1].Version)
+
+	// Only fizz links in both variants of foo, buzz only gets libfoo through libbar.
+	if len(report.Modules) != 1 {
+		t.Fatalf("expected only fizz to contain duplicate crates, got %#v", report.Modules)
+	}
+	fizz := report.Modules[0]
+	android.AssertStringEquals(t, "module", "fizz", fizz.Name)
+	android.AssertStringEquals(t, "kind", "binary", fizz.Kind)
+	if len(fizz.Duplicates) != 1 || len(fizz.Duplicates[0].Variants) != 2 {
+		t.Fatalf("expected fizz to contain two variants of foo, got %#v", fizz.Duplicates)
+	}
+	android.AssertArrayString(t, "libfoo path", []string{"fizz", "libbar", "libfoo"},
+		fizz.Duplicates[0].Variants[0].Path)
+	android.AssertArrayString(t, "libfoo_v2 path", []string{"fizz", "libfoo_v2"},
+		fizz.Duplicates[0].Variants[1].Path)
+
+	singleton := ctx.SingletonForTests("rust_crate_duplicates")
+	errors := android.ContentFromFileRuleForTests(t, ctx, singleton.Output("rust_crate_duplicates/errors.txt"))
+	android.AssertStringDoesContain(t, "check errors", errors,
+		"fizz (android_arm64_armv8-a): crate foo is provided by libfoo, libfoo_v2")
+	check := singleton.Rule("rustCrateDuplicatesCheck")
+	android.AssertPathRelativeToTopEquals(t, "check input", "out/soong/rust_crate_duplicates/errors.txt",
+		check.Input)
+}
+
+func TestCrateDuplicatesAllowlist(t *testing.T) {
+	ctx, report := testCrateDuplicates(t, android.FixtureMergeEnv(map[string]string{
+		envVariableRustCrateDuplicatesAllowlist: "foo",
+	}))
+
+	// Allowed crates are still reported, but don't fail the check.
+	if len(report.Modules) != 1 {
+		t.Fatalf("expected fizz to be reported, got %#v", report.Modules)
+	}
+	singleton := ctx.SingletonForTests("rust_crate_duplicates")
+	errors := android.ContentFromFileRuleForTests(t, ctx, singleton.Output("rust_crate_duplicates/errors.txt"))
+	android.AssertStringEquals(t, "check errors", "", errors)
+}
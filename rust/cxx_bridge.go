@@ -0,0 +1,218 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+	"android/soong/cc"
+)
+
+var (
+	_ = pctx.HostBinToolVariable("cxxbridgeCmd", "cxxbridge")
+
+	// cxxbridge infers the kind of output from the extension of each -o argument.
+	cxxBridge = pctx.AndroidStaticRule("cxxBridge",
+		blueprint.RuleParams{
+			Command:     "cp -f $in $out && $cxxbridgeCmd $flags $in -o $header -o $cc",
+			CommandDeps: []string{"$cxxbridgeCmd"},
+		},
+		"flags", "header", "cc")
+)
+
+const (
+	// The crate providing the cxx::bridge macro, which generates the Rust side of the bridge.
+	cxxCrate = "libcxx"
+
+	// The directory of the module output that the generated header is written to, which is
+	// exported to the cc modules using the bridge.
+	cxxBridgeIncludeDir = "cxxbridge"
+)
+
+func init() {
+	android.RegisterModuleType("rust_cxx_bridge", RustCxxBridgeFactory)
+	android.RegisterModuleType("rust_cxx_bridge_host", RustCxxBridgeHostFactory)
+}
+
+var _ SourceProvider = (*cxxBridgeDecorator)(nil)
+
+type CxxBridgeProperties struct {
+	// The Rust source file containing the #[cxx::bridge] module. It is copied to <source_stem>.rs
+	// and used as the crate root of the library variants.
+	Src *string `android:"path,arch_variant"`
+
+	// list of cxxbridge-specific flags and options
+	Cxxbridge_flags []string `android:"arch_variant"`
+
+	// list of header libraries added to the generated C++ library, e.g. the library providing
+	// rust/cxx.h.
+	Header_libs []string `android:"arch_variant"`
+}
+
+type cxxBridgeDecorator struct {
+	*BaseSourceProvider
+
+	Properties CxxBridgeProperties
+}
+
+func (c *cxxBridgeDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) android.Path {
+	src := android.OptionalPathForModuleSrc(ctx, c.Properties.Src)
+	if !src.Valid() {
+		ctx.PropertyErrorf("src", "invalid path to bridge source")
+		return nil
+	}
+
+	stem := c.BaseSourceProvider.getStem(ctx)
+	outputFile := android.PathForModuleOut(ctx, stem+".rs")
+	header := android.PathForModuleOut(ctx, cxxBridgeIncludeDir, stem+".rs.h")
+	ccFile := android.PathForModuleOut(ctx, stem+".rs.cc")
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:            cxxBridge,
+		Description:     "cxxbridge " + src.Path().Rel(),
+		Output:          outputFile,
+		ImplicitOutputs: android.WritablePaths{header, ccFile},
+		Input:           src.Path(),
+		Args: map[string]string{
+			"flags":  strings.Join(proptools.NinjaAndShellEscapeList(c.Properties.Cxxbridge_flags), " "),
+			"header": header.String(),
+			"cc":     ccFile.String(),
+		},
+	})
+
+	// The generated C++ source is appended after the entry point so it can be picked up by the
+	// generated cc_library_static, which ignores the .rs files.
+	c.BaseSourceProvider.OutputFiles = android.Paths{outputFile, ccFile}
+
+	// The generated header allows the rust_cxx_bridge module to be used in the generated_headers
+	// and export_generated_headers properties of cc modules.
+	android.SetProvider(ctx, cc.GeneratedCcSourcesInfoProvider, cc.GeneratedCcSourcesInfo{
+		Sources:    android.Paths{header},
+		HeaderDirs: android.Paths{android.PathForModuleOut(ctx, cxxBridgeIncludeDir)},
+		Deps:       android.Paths{header},
+	})
+
+	return outputFile
+}
+
+func (c *cxxBridgeDecorator) SourceProviderProps() []interface{} {
+	return append(c.BaseSourceProvider.SourceProviderProps(), &c.Properties)
+}
+
+func (c *cxxBridgeDecorator) SourceProviderDeps(ctx DepsContext, deps Deps) Deps {
+	deps = c.BaseSourceProvider.SourceProviderDeps(ctx, deps)
+	if ctx.toolchain().Bionic() && !ctx.RustModule().compiler.noStdlibs() {
+		deps = bionicDeps(ctx, deps, false)
+	} else if ctx.Os() == android.LinuxMusl {
+		deps = muslDeps(ctx, deps, false)
+	}
+
+	if !ctx.RustModule().Source() {
+		// This is not the source variant, so link the generated C++ side of the bridge and add
+		// the crate providing the cxx::bridge macro.
+		//
+		// The static library is not a dependency of the source variant to avoid a circular
+		// dependency, as it compiles the C++ source generated by the source variant.
+		deps.StaticLibs = append(deps.StaticLibs, cxxBridgeStaticLibName(ctx.ModuleName()))
+		deps.Rustlibs = append(deps.Rustlibs, cxxCrate)
+	}
+	return deps
+}
+
+// cxxBridgeStaticLibName returns the name of the cc_library_static compiling the C++ side of the
+// rust_cxx_bridge module.
+func cxxBridgeStaticLibName(name string) string {
+	return name + "_cxx"
+}
+
+// rust_cxx_bridge generates both sides of a Rust/C++ interop bridge using cxx, given a Rust source
+// file annotated with #[cxx::bridge]. The source is the crate root of the generated Rust library,
+// which should be added as a dependency in the rustlibs property. The C++ side is compiled into
+// a cc_library_static named <name>_cxx, which is linked into the Rust library and can be added
+// to the static_libs property of cc modules. The generated header, <source_stem>.rs.h, is
+// exported to cc modules listing the rust_cxx_bridge module in generated_headers and
+// export_generated_headers.
+func RustCxxBridgeFactory() android.Module {
+	module, _ := NewRustCxxBridge(android.HostAndDeviceSupported)
+	return module.Init()
+}
+
+func RustCxxBridgeHostFactory() android.Module {
+	module, _ := NewRustCxxBridge(android.HostSupported)
+	return module.Init()
+}
+
+func NewRustCxxBridge(hod android.HostOrDeviceSupported) (*Module, *cxxBridgeDecorator) {
+	bridge := &cxxBridgeDecorator{
+		BaseSourceProvider: NewSourceProvider(),
+		Properties:         CxxBridgeProperties{},
+	}
+
+	module := NewSourceProviderModule(hod, bridge, false, true)
+
+	android.AddLoadHook(module, func(ctx android.LoadHookContext) {
+		cxxBridgeLoadHook(ctx, module, bridge, hod)
+	})
+
+	return module, bridge
+}
+
+type cxxBridgeStaticLibProperties struct {
+	Name                      *string
+	Srcs                      []string
+	Generated_headers         []string
+	Export_generated_headers  []string
+	Header_libs               []string
+	Export_header_lib_headers []string
+	Host_supported            *bool
+	Vendor_available          *bool
+	Product_available         *bool
+	Recovery_available        *bool
+	Apex_available            []string
+	Min_sdk_version           *string
+}
+
+// cxxBridgeLoadHook creates the cc_library_static compiling the C++ source generated by the
+// rust_cxx_bridge module. The library inherits the visibility of the rust_cxx_bridge module.
+func cxxBridgeLoadHook(ctx android.LoadHookContext, module *Module, bridge *cxxBridgeDecorator,
+	hod android.HostOrDeviceSupported) {
+
+	bridgeRef := ":" + ctx.ModuleName()
+	props := cxxBridgeStaticLibProperties{
+		Name:                      proptools.StringPtr(cxxBridgeStaticLibName(ctx.ModuleName())),
+		Srcs:                      []string{bridgeRef},
+		Generated_headers:         []string{ctx.ModuleName()},
+		Export_generated_headers:  []string{ctx.ModuleName()},
+		Header_libs:               bridge.Properties.Header_libs,
+		Export_header_lib_headers: bridge.Properties.Header_libs,
+		Vendor_available:          module.VendorProperties.Vendor_available,
+		Product_available:         module.VendorProperties.Product_available,
+		Recovery_available:        module.Properties.Recovery_available,
+		Apex_available:            module.ApexProperties.Apex_available,
+		Min_sdk_version:           module.Properties.Min_sdk_version,
+	}
+
+	factory := cc.LibraryStaticFactory
+	if hod == android.HostSupported {
+		factory = cc.LibraryHostStaticFactory
+	} else {
+		props.Host_supported = proptools.BoolPtr(module.HostSupported())
+	}
+	ctx.CreateModule(factory, &props)
+}
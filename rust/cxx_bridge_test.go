@@ -0,0 +1,167 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestRustCxxBridge(t *testing.T) {
+	ctx := testRust(t, `
+		rust_cxx_bridge {
+			name: "libbridge",
+			src: "src/bridge.rs",
+			crate_name: "bridge",
+			source_stem: "bridge",
+			cxxbridge_flags: ["--cfg=feature=\"foo\""],
+			header_libs: ["cxx-bridge-header"],
+		}
+		rust_library {
+			name: "libcxx",
+			srcs: ["foo.rs"],
+			crate_name: "cxx",
+		}
+		cc_library_headers {
+			name: "cxx-bridge-header",
+			export_include_dirs: ["cxx_include"],
+		}
+		cc_library_shared {
+			name: "libuser",
+			srcs: ["user.cpp"],
+			static_libs: ["libbridge_cxx"],
+			generated_headers: ["libbridge"],
+			export_generated_headers: ["libbridge"],
+		}
+	`)
+
+	bridge := ctx.ModuleForTests("libbridge", "android_arm64_armv8-a_source").Output("bridge.rs")
+	android.AssertStringEquals(t, "bridge input", "src/bridge.rs", bridge.Input.String())
+	android.AssertStringDoesContain(t, "cxxbridge flags", bridge.Args["flags"], `'--cfg=feature="foo"'`)
+	var implicitOutputs []string
+	for _, output := range bridge.ImplicitOutputs {
+		implicitOutputs = append(implicitOutputs, output.Rel())
+	}
+	android.AssertArrayString(t, "cxxbridge implicit outputs",
+		[]string{"cxxbridge/bridge.rs.h", "bridge.rs.cc"}, implicitOutputs)
+
+	// The generated C++ source is compiled by the generated cc_library_static.
+	cxxLib := ctx.ModuleForTests("libbridge_cxx", "android_arm64_armv8-a_static")
+	cxxObj := cxxLib.Output("obj/bridge.rs.o")
+	android.AssertStringEquals(t, "cxx library source", "bridge.rs.cc", cxxObj.Input.Rel())
+	android.AssertStringDoesContain(t, "cxx library cflags", cxxObj.Args["cFlags"], "-Icxx_include")
+
+	// The library variants link the generated cc_library_static and depend on the cxx crate.
+	rlib := ctx.ModuleForTests("libbridge", "android_arm64_armv8-a_rlib_rlib-std").Module().(*Module)
+	if !android.InList("libbridge_cxx", rlib.Properties.AndroidMkStaticLibs) {
+		t.Errorf("libbridge_cxx is not a static library of the rlib variant: %#v", rlib.Properties.AndroidMkStaticLibs)
+	}
+	if !android.InList("libcxx.rlib-std", rlib.Properties.AndroidMkRlibs) {
+		t.Errorf("libcxx is not an rlib dependency of the rlib variant: %#v", rlib.Properties.AndroidMkRlibs)
+	}
+
+	// The generated header is exported to cc modules using generated_headers.
+	includeDir := "-I" + strings.TrimSuffix(bridge.ImplicitOutputs[0].String(), "/bridge.rs.h")
+	userObj := ctx.ModuleForTests("libuser", "android_arm64_armv8-a_shared").Output("obj/user.o")
+	android.AssertStringDoesContain(t, "cc module includes the bridge header", userObj.Args["cFlags"], includeDir)
+	android.AssertStringListContains(t, "cc module depends on the bridge header",
+		android.PathsRelativeToTop(append(append(android.Paths(nil), userObj.Implicits...), userObj.OrderOnly...)),
+		android.PathRelativeToTop(bridge.ImplicitOutputs[0]))
+}
+
+func TestRustCxxBridgeHost(t *testing.T) {
+	ctx := testRust(t, `
+		rust_cxx_bridge_host {
+			name: "libbridge",
+			src: "src/bridge.rs",
+			crate_name: "bridge",
+			source_stem: "bridge",
+		}
+		rust_library_host {
+			name: "libcxx",
+			srcs: ["foo.rs"],
+			crate_name: "cxx",
+		}
+	`)
+
+	ctx.ModuleForTests("libbridge", "linux_glibc_x86_64_source").Output("bridge.rs")
+	ctx.ModuleForTests("libbridge_cxx", "linux_glibc_x86_64_static").Output("obj/bridge.rs.o")
+}
+
+func TestRustSourceProviderIsNotAGeneratedHeader(t *testing.T) {
+	// Only rust_cxx_bridge modules generate headers for cc modules, other Rust modules can't be
+	// used in generated_headers.
+	testRustError(t, `module "libbindgen" is not a genrule`, `
+		rust_bindgen {
+			name: "libbindgen",
+			wrapper_src: "src/any.h",
+			crate_name: "bindgen",
+			stem: "libbindgen",
+			source_stem: "bindings",
+		}
+		cc_library_shared {
+			name: "libuser",
+			srcs: ["user.cpp"],
+			generated_headers: ["libbindgen"],
+		}
+	`)
+}
+
+func TestRustCxxBridgeVisibility(t *testing.T) {
+	bp := `
+		rust_library {
+			name: "libcxx",
+			srcs: ["foo.rs"],
+			crate_name: "cxx",
+		}
+	`
+	bridgeBp := `
+		rust_cxx_bridge {
+			name: "libbridge",
+			src: "bridge.rs",
+			crate_name: "bridge",
+			source_stem: "bridge",
+			%s
+		}
+	`
+	userBp := `
+		cc_library_shared {
+			name: "libuser",
+			srcs: ["user.cpp"],
+			static_libs: ["libbridge_cxx"],
+		}
+	`
+
+	// The generated cc_library_static is as visible as the rust_cxx_bridge module.
+	android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureAddTextFile("foo/Android.bp", fmt.Sprintf(bridgeBp, "")),
+		android.FixtureAddTextFile("bar/Android.bp", userBp),
+	).RunTestWithBp(t, bp)
+
+	android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureAddTextFile("foo/Android.bp", fmt.Sprintf(bridgeBp, `visibility: ["//visibility:private"],`)),
+		android.FixtureAddTextFile("bar/Android.bp", userBp),
+	).
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`depends on //foo:libbridge_cxx which is not visible to this module`)).
+		RunTestWithBp(t, bp)
+}
@@ -17,8 +17,12 @@ package rust
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"android/soong/android"
+	"android/soong/rust/config"
 )
 
 // This singleton collects Rust crate definitions and generates a JSON file
@@ -28,10 +32,16 @@ import (
 // For example,
 //
 //   $ SOONG_GEN_RUST_PROJECT=1 m nothing
+//
+// The generation can be limited to the crates defined in a set of directories,
+// and their dependencies, with SOONG_GEN_RUST_PROJECT_DIRS. For example,
+//
+//   $ SOONG_GEN_RUST_PROJECT=1 SOONG_GEN_RUST_PROJECT_DIRS="system/keystore2 packages/modules/Virtualization" m nothing
 
 const (
 	// Environment variables used to control the behavior of this singleton.
 	envVariableCollectRustDeps = "SOONG_GEN_RUST_PROJECT"
+	envVariableRustProjectDirs = "SOONG_GEN_RUST_PROJECT_DIRS"
 	rustProjectJsonFileName    = "rust-project.json"
 )
 
@@ -43,30 +53,54 @@ type rustProjectDep struct {
 	Name  string `json:"name"`
 }
 
+// rustProjectSource lists the directories of the files belonging to a crate. If it is not set,
+// the crate is made of the files in the directory of its root module.
+type rustProjectSource struct {
+	IncludeDirs []string `json:"include_dirs"`
+	ExcludeDirs []string `json:"exclude_dirs"`
+}
+
 type rustProjectCrate struct {
-	DisplayName string            `json:"display_name"`
-	RootModule  string            `json:"root_module"`
-	Edition     string            `json:"edition,omitempty"`
-	Deps        []rustProjectDep  `json:"deps"`
-	Cfg         []string          `json:"cfg"`
-	Env         map[string]string `json:"env"`
-	ProcMacro   bool              `json:"is_proc_macro"`
+	DisplayName string             `json:"display_name"`
+	RootModule  string             `json:"root_module"`
+	Edition     string             `json:"edition,omitempty"`
+	Target      string             `json:"target,omitempty"`
+	Deps        []rustProjectDep   `json:"deps"`
+	Cfg         []string           `json:"cfg"`
+	Env         map[string]string  `json:"env"`
+	ProcMacro   bool               `json:"is_proc_macro"`
+	Source      *rustProjectSource `json:"source,omitempty"`
+
+	// The additional directories of the crate sources, i.e. the directory of the sources
+	// generated in OUT_DIR. Generated crates only include the directory of their root module.
+	extraIncludeDirs []string
+	generated        bool
 }
 
 type rustProjectJson struct {
-	Crates []rustProjectCrate `json:"crates"`
+	SysrootSrc string             `json:"sysroot_src,omitempty"`
+	Crates     []rustProjectCrate `json:"crates"`
 }
 
 // crateInfo is used during the processing to keep track of the known crates.
 type crateInfo struct {
-	Idx    int            // Index of the crate in rustProjectJson.Crates slice.
-	Deps   map[string]int // The keys are the module names and not the crate names.
-	Device bool           // True if the crate at idx was a device crate
+	Idx  int            // Index of the crate in rustProjectJson.Crates slice.
+	Deps map[string]int // The keys are the crate keys of the dependencies.
 }
 
 type projectGeneratorSingleton struct {
 	project     rustProjectJson
-	knownCrates map[string]crateInfo // Keys are module names.
+	knownCrates map[string]crateInfo // Keys are crate keys, see crateKey.
+}
+
+// crateKey returns the key of the crate of a module in knownCrates. The host and device variants
+// of a module are separate crates, as they may have different dependencies and cfgs. The other
+// variants (e.g. arch, rlib or dylib) are merged into one crate.
+func crateKey(module *Module) string {
+	if module.Host() {
+		return module.Name() + "#host"
+	}
+	return module.Name()
 }
 
 func rustProjectGeneratorSingleton() android.Singleton {
@@ -94,7 +128,7 @@ func (singleton *projectGeneratorSingleton) mergeDependencies(ctx android.Single
 		}
 		// For unknown dependency, add it first.
 		var childId int
-		cInfo, known := singleton.knownCrates[rChild.Name()]
+		cInfo, known := singleton.knownCrates[crateKey(rChild)]
 		if !known {
 			childId, ok = singleton.addCrate(ctx, rChild)
 			if !ok {
@@ -104,11 +138,11 @@ func (singleton *projectGeneratorSingleton) mergeDependencies(ctx android.Single
 			childId = cInfo.Idx
 		}
 		// Is this dependency known already?
-		if _, ok = deps[child.Name()]; ok {
+		if _, ok = deps[crateKey(rChild)]; ok {
 			return
 		}
 		crate.Deps = append(crate.Deps, rustProjectDep{Crate: childId, Name: rChild.CrateName()})
-		deps[child.Name()] = childId
+		deps[crateKey(rChild)] = childId
 	})
 }
 
@@ -141,14 +175,17 @@ func (singleton *projectGeneratorSingleton) addCrate(ctx android.SingletonContex
 		DisplayName: rModule.Name(),
 		RootModule:  rootModule.String(),
 		Edition:     rModule.compiler.edition(),
+		Target:      config.FindToolchain(rModule.Os(), rModule.Arch()).RustTriple(),
 		Deps:        make([]rustProjectDep, 0),
 		Cfg:         make([]string, 0),
 		Env:         make(map[string]string),
 		ProcMacro:   procMacro,
+		generated:   rModule.sourceProvider != nil,
 	}
 
 	if rModule.compiler.cargoOutDir().Valid() {
 		crate.Env["OUT_DIR"] = rModule.compiler.cargoOutDir().String()
+		crate.extraIncludeDirs = append(crate.extraIncludeDirs, rModule.compiler.cargoOutDir().String())
 	}
 
 	for _, feature := range rModule.compiler.features() {
@@ -158,14 +195,14 @@ func (singleton *projectGeneratorSingleton) addCrate(ctx android.SingletonContex
 	singleton.mergeDependencies(ctx, rModule, &crate, deps)
 
 	var idx int
-	if cInfo, ok := singleton.knownCrates[rModule.Name()]; ok {
+	if cInfo, ok := singleton.knownCrates[crateKey(rModule)]; ok {
 		idx = cInfo.Idx
 		singleton.project.Crates[idx] = crate
 	} else {
 		idx = len(singleton.project.Crates)
 		singleton.project.Crates = append(singleton.project.Crates, crate)
 	}
-	singleton.knownCrates[rModule.Name()] = crateInfo{Idx: idx, Deps: deps, Device: rModule.Device()}
+	singleton.knownCrates[crateKey(rModule)] = crateInfo{Idx: idx, Deps: deps}
 	return idx, true
 }
 
@@ -178,12 +215,7 @@ func (singleton *projectGeneratorSingleton) appendCrateAndDependencies(ctx andro
 		return
 	}
 	// If we have seen this crate already; merge any new dependencies.
-	if cInfo, ok := singleton.knownCrates[module.Name()]; ok {
-		// If we have a new device variant, override the old one
-		if !cInfo.Device && rModule.Device() {
-			singleton.addCrate(ctx, rModule)
-			return
-		}
+	if cInfo, ok := singleton.knownCrates[crateKey(rModule)]; ok {
 		crate := singleton.project.Crates[cInfo.Idx]
 		singleton.mergeDependencies(ctx, rModule, &crate, cInfo.Deps)
 		singleton.project.Crates[cInfo.Idx] = crate
@@ -198,9 +230,17 @@ func (singleton *projectGeneratorSingleton) GenerateBuildActions(ctx android.Sin
 	}
 
 	singleton.knownCrates = make(map[string]crateInfo)
+	dirs := strings.Fields(ctx.Config().Getenv(envVariableRustProjectDirs))
 	ctx.VisitAllModules(func(module android.Module) {
+		// The dependencies of the crates in the selected directories are added regardless
+		// of their directory.
+		if len(dirs) > 0 && !inRustProjectDirs(ctx.ModuleDir(module), dirs) {
+			return
+		}
 		singleton.appendCrateAndDependencies(ctx, module)
 	})
+	singleton.project.SysrootSrc = rustSysrootSrc(ctx)
+	singleton.setCrateSources()
 
 	path := android.PathForOutput(ctx, rustProjectJsonFileName)
 	err := createJsonFile(singleton.project, path)
@@ -209,6 +249,61 @@ func (singleton *projectGeneratorSingleton) GenerateBuildActions(ctx android.Sin
 	}
 }
 
+// inRustProjectDirs returns whether dir is one of dirs or one of their subdirectories.
+func inRustProjectDirs(dir string, dirs []string) bool {
+	for _, d := range dirs {
+		d = filepath.Clean(d)
+		if dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rustSysrootSrc returns the sources of the standard library in the prebuilt toolchain.
+func rustSysrootSrc(ctx android.SingletonContext) string {
+	base := ctx.Config().Getenv("RUST_PREBUILTS_BASE")
+	if base == "" {
+		base = config.RustDefaultBase
+	}
+	return filepath.Join(base, config.HostPrebuiltTag(ctx.Config()), config.GetRustVersion(ctx),
+		"lib/rustlib/src/rust/library")
+}
+
+// setCrateSources sets the source directories of the crates that are not only made of the files
+// in the directory of their root module: the crates with sources generated in OUT_DIR, the
+// generated crates, and the crates containing the directories of other crates, which are
+// excluded.
+func (singleton *projectGeneratorSingleton) setCrateSources() {
+	var rootDirs []string
+	for _, crate := range singleton.project.Crates {
+		if !crate.generated {
+			rootDirs = append(rootDirs, filepath.Dir(crate.RootModule))
+		}
+	}
+	rootDirs = android.SortedUniqueStrings(rootDirs)
+
+	for i := range singleton.project.Crates {
+		crate := &singleton.project.Crates[i]
+		rootDir := filepath.Dir(crate.RootModule)
+
+		var excludeDirs []string
+		if !crate.generated {
+			prefix := rootDir + "/"
+			for j := sort.SearchStrings(rootDirs, prefix); j < len(rootDirs) && strings.HasPrefix(rootDirs[j], prefix); j++ {
+				excludeDirs = append(excludeDirs, rootDirs[j])
+			}
+		}
+
+		if crate.generated || len(crate.extraIncludeDirs) > 0 || len(excludeDirs) > 0 {
+			crate.Source = &rustProjectSource{
+				IncludeDirs: append([]string{rootDir}, crate.extraIncludeDirs...),
+				ExcludeDirs: append([]string{}, excludeDirs...),
+			}
+		}
+	}
+}
+
 func createJsonFile(project rustProjectJson, rustProjectPath android.WritablePath) error {
 	buf, err := json.MarshalIndent(project, "", "  ")
 	if err != nil {
@@ -27,10 +27,11 @@ import (
 
 // testProjectJson run the generation of rust-project.json. It returns the raw
 // content of the generated file.
-func testProjectJson(t *testing.T, bp string) []byte {
+func testProjectJson(t *testing.T, bp string, preparers ...android.FixturePreparer) []byte {
 	result := android.GroupFixturePreparers(
 		prepareForRustTest,
 		android.FixtureMergeEnv(map[string]string{"SOONG_GEN_RUST_PROJECT": "1"}),
+		android.GroupFixturePreparers(preparers...),
 	).RunTestWithBp(t, bp)
 
 	// The JSON file is generated via WriteFileToOutputDir. Therefore, it
@@ -265,9 +266,16 @@ func TestProjectJsonBindGen(t *testing.T) {
 		if !ok {
 			t.Fatalf("Unexpected type for root_module: %v", crate["root_module"])
 		}
-		if strings.Contains(rootModule, "libbindings1") && !strings.Contains(rootModule, "android_arm64") {
+		target, _ := crate["target"].(string)
+		if strings.Contains(rootModule, "libbindings1") && strings.Contains(target, "android") &&
+			!strings.Contains(rootModule, "android_arm64") {
 			t.Errorf("The source path for libbindings1 does not contain android_arm64, got %v", rootModule)
 		}
+		if strings.Contains(rootModule, "libbindings1") && !strings.Contains(target, "android") &&
+			!strings.Contains(rootModule, buildOS.String()) {
+			t.Errorf("The source path for the host libbindings1 does not contain the BuildOs, got %v; want %v",
+				rootModule, buildOS.String())
+		}
 		if strings.Contains(rootModule, "libbindings2") && !strings.Contains(rootModule, buildOS.String()) {
 			t.Errorf("The source path for libbindings2 does not contain the BuildOs, got %v; want %v",
 				rootModule, buildOS.String())
@@ -349,3 +357,163 @@ func TestProjectJsonMultiVersion(t *testing.T) {
 	}
 	t.Errorf("libb crate has not been found: %v", crates)
 }
+
+// parseProjectJson parses the generated rust-project.json and returns the crates
+// indexed by display name and host or device.
+func parseProjectJson(t *testing.T, content []byte) (rustProjectJson, map[string]rustProjectCrate) {
+	var project rustProjectJson
+	if err := json.Unmarshal(content, &project); err != nil {
+		t.Fatalf("Unable to parse the rust-project.json: %v", err)
+	}
+	crates := make(map[string]rustProjectCrate)
+	for _, crate := range project.Crates {
+		key := crate.DisplayName
+		if !strings.Contains(crate.Target, "android") {
+			key += "#host"
+		}
+		if _, ok := crates[key]; ok {
+			t.Errorf("Duplicate crate %s in rust-project.json", key)
+		}
+		crates[key] = crate
+	}
+	return project, crates
+}
+
+func TestProjectJsonHostAndDevice(t *testing.T) {
+	bp := `
+	rust_library {
+		name: "liba",
+		srcs: ["a/src/lib.rs"],
+		crate_name: "a",
+		host_supported: true,
+	}
+	rust_library {
+		name: "libb",
+		srcs: ["b/src/lib.rs"],
+		crate_name: "b",
+		host_supported: true,
+		rustlibs: ["liba"],
+	}
+	`
+	project, crates := parseProjectJson(t, testProjectJson(t, bp))
+	for _, name := range []string{"liba", "libb"} {
+		device, ok := crates[name]
+		if !ok {
+			t.Fatalf("No device crate for %s: %v", name, project.Crates)
+		}
+		host, ok := crates[name+"#host"]
+		if !ok {
+			t.Fatalf("No host crate for %s: %v", name, project.Crates)
+		}
+		android.AssertStringEquals(t, name+" device target", "aarch64-linux-android", device.Target)
+		android.AssertStringDoesContain(t, name+" host target", host.Target, "linux")
+	}
+
+	// Each variant of libb depends on the same variant of liba.
+	for _, key := range []string{"libb", "libb#host"} {
+		found := false
+		for _, dep := range crates[key].Deps {
+			if dep.Name != "a" {
+				continue
+			}
+			found = true
+			depCrate := project.Crates[dep.Crate]
+			android.AssertStringEquals(t, key+" dependency", "liba", depCrate.DisplayName)
+			android.AssertStringEquals(t, key+" dependency target", crates[key].Target, depCrate.Target)
+		}
+		if !found {
+			t.Errorf("%s does not depend on liba: %v", key, crates[key].Deps)
+		}
+	}
+}
+
+func TestProjectJsonSources(t *testing.T) {
+	bp := `
+	rust_library {
+		name: "libd",
+		srcs: ["d/src/lib.rs", ":libbindings"],
+		crate_name: "d",
+	}
+	rust_bindgen {
+		name: "libbindings",
+		crate_name: "bindings",
+		source_stem: "bindings",
+		wrapper_src: "src/any.h",
+	}
+	rust_library {
+		name: "libn",
+		srcs: ["n/src/lib.rs"],
+		crate_name: "n",
+	}
+	rust_binary {
+		name: "tool",
+		srcs: ["n/src/bin/tool.rs"],
+		rustlibs: ["libn"],
+	}
+	`
+	project, crates := parseProjectJson(t, testProjectJson(t, bp))
+
+	android.AssertStringDoesContain(t, "sysroot_src", project.SysrootSrc, "lib/rustlib/src/rust/library")
+
+	libd := crates["libd"]
+	if libd.Source == nil {
+		t.Fatalf("libd has no source: %v", libd)
+	}
+	android.AssertArrayString(t, "libd include dirs", []string{"d/src", libd.Env["OUT_DIR"]}, libd.Source.IncludeDirs)
+
+	bindings := crates["libbindings"]
+	if bindings.Source == nil {
+		t.Fatalf("libbindings has no source: %v", bindings)
+	}
+	android.AssertArrayString(t, "libbindings include dirs",
+		[]string{filepath.Dir(bindings.RootModule)}, bindings.Source.IncludeDirs)
+
+	libn := crates["libn"]
+	if libn.Source == nil {
+		t.Fatalf("libn has no source: %v", libn)
+	}
+	android.AssertArrayString(t, "libn include dirs", []string{"n/src"}, libn.Source.IncludeDirs)
+	android.AssertArrayString(t, "libn exclude dirs", []string{"n/src/bin"}, libn.Source.ExcludeDirs)
+
+	if tool := crates["tool"]; tool.Source != nil {
+		t.Errorf("tool should not have a source: %v", tool.Source)
+	}
+}
+
+func TestProjectJsonDirs(t *testing.T) {
+	jsonContent := testProjectJson(t, "",
+		android.FixtureAddTextFile("a/Android.bp", `
+			rust_library {
+				name: "liba",
+				srcs: ["src/lib.rs"],
+				crate_name: "a",
+			}
+		`),
+		android.FixtureAddTextFile("b/Android.bp", `
+			rust_library {
+				name: "libb",
+				srcs: ["src/lib.rs"],
+				crate_name: "b",
+				rustlibs: ["liba"],
+			}
+		`),
+		android.FixtureAddTextFile("z/Android.bp", `
+			rust_library {
+				name: "libz",
+				srcs: ["src/lib.rs"],
+				crate_name: "z",
+			}
+		`),
+		android.FixtureMergeEnv(map[string]string{"SOONG_GEN_RUST_PROJECT_DIRS": "b"}),
+	)
+	_, crates := parseProjectJson(t, jsonContent)
+
+	// Only libb and its dependencies are generated.
+	var names []string
+	for name := range crates {
+		names = append(names, name)
+	}
+	android.AssertStringListContains(t, "crates", names, "libb")
+	android.AssertStringListContains(t, "crates", names, "liba")
+	android.AssertStringListDoesNotContain(t, "crates", names, "libz")
+}
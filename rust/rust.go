@@ -950,6 +950,9 @@ func (mod *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 			mod.kytheFiles = append(mod.kytheFiles, buildOutput.kytheFile)
 		}
 		bloaty.MeasureSizeForPaths(ctx, mod.compiler.strippedOutputFilePath(), android.OptionalPathForPath(mod.compiler.unstrippedOutputFilePath()))
+		if mod.coverage != nil && mod.coverage.linked(mod) {
+			cc.SetNativeCoverageReportInfo(ctx, mod.coverage.Properties.CoverageEnabled, mod.compiler.unstrippedOutputFilePath())
+		}
 
 		mod.docTimestampFile = mod.compiler.rustdoc(ctx, flags, deps)
 		if mod.docTimestampFile.Valid() {
@@ -982,6 +985,7 @@ func (mod *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 		}
 
 		ctx.Phony("rust", ctx.RustModule().OutputFile().Path())
+		mod.setCrateInfoProvider(ctx)
 	}
 	if mod.testModule {
 		android.SetProvider(ctx, testing.TestModuleProviderKey, testing.TestModuleProviderData{})
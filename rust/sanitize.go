@@ -33,6 +33,9 @@ type SanitizeProperties struct {
 		Address   *bool `android:"arch_variant"`
 		Hwaddress *bool `android:"arch_variant"`
 
+		// MemorySanitizer, only available on 64-bit linux_glibc hosts
+		Memory *bool `android:"arch_variant"`
+
 		// Memory-tagging, only available on arm64
 		// if diag.memtag unset or false, enables async memory tagging
 		Memtag_heap *bool `android:"arch_variant"`
@@ -79,6 +82,13 @@ var asanFlags = []string{
 	"-Z sanitizer=address",
 }
 
+// See cc/sanitize.go's msanCflags. The runtime is linked by rustc, or by clang when the Rust code
+// is linked into a C++ executable.
+var msanFlags = []string{
+	"-Z sanitizer=memory",
+	"-Z sanitizer-memory-track-origins",
+}
+
 // See cc/sanitize.go's hwasanGlobalOptions for global hwasan options.
 var hwasanFlags = []string{
 	"-Z external-clangrt=true",
@@ -162,6 +172,10 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 			s.Address = proptools.BoolPtr(true)
 		}
 
+		if found, globalSanitizers = android.RemoveFromList("memory", globalSanitizers); found && s.Memory == nil {
+			s.Memory = proptools.BoolPtr(true)
+		}
+
 		if found, globalSanitizers = android.RemoveFromList("fuzzer", globalSanitizers); found && s.Fuzzer == nil {
 			// TODO(b/204776996): HWASan for static Rust binaries isn't supported yet, and fuzzer enables HWAsan
 			if !ctx.RustModule().StaticExecutable() {
@@ -212,6 +226,13 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 		s.Memtag_heap = nil
 	}
 
+	// MSan is only supported by rustc for x86_64 linux_glibc, and can't be combined with the
+	// other sanitizers.
+	if ctx.Os() != android.Linux || ctx.Arch().ArchType != android.X86_64 ||
+		Bool(s.Address) || Bool(s.Hwaddress) || Bool(s.Fuzzer) || ctx.RustModule().StaticExecutable() {
+		s.Memory = nil
+	}
+
 	// Disable sanitizers for musl x86 modules, rustc does not support any sanitizers.
 	if ctx.Os() == android.LinuxMusl && ctx.Arch().ArchType == android.X86 {
 		s.Never = boolPtr(true)
@@ -219,7 +240,8 @@ func (sanitize *sanitize) begin(ctx BaseModuleContext) {
 
 	// TODO:(b/178369775)
 	// For now sanitizing is only supported on non-windows targets
-	if ctx.Os() != android.Windows && (Bool(s.Hwaddress) || Bool(s.Address) || Bool(s.Memtag_heap) || Bool(s.Fuzzer)) {
+	if ctx.Os() != android.Windows && (Bool(s.Hwaddress) || Bool(s.Address) || Bool(s.Memtag_heap) || Bool(s.Fuzzer) ||
+		Bool(s.Memory)) {
 		sanitize.Properties.SanitizerEnabled = true
 	}
 }
@@ -249,6 +271,10 @@ func (sanitize *sanitize) flags(ctx ModuleContext, flags Flags, deps PathDeps) (
 			flags.LinkFlags = append(flags.LinkFlags, []string{"-Wl,--no-as-needed"}...)
 		}
 	}
+
+	if Bool(sanitize.Properties.Sanitize.Memory) {
+		flags.RustFlags = append(flags.RustFlags, msanFlags...)
+	}
 	return flags, deps
 }
 
@@ -329,6 +355,9 @@ func (sanitize *sanitize) SetSanitizer(t cc.SanitizerType, b bool) {
 	case cc.Memtag_heap:
 		sanitize.Properties.Sanitize.Memtag_heap = boolPtr(b)
 		sanitizerSet = true
+	case cc.Msan:
+		sanitize.Properties.Sanitize.Memory = boolPtr(b)
+		sanitizerSet = true
 	default:
 		panic(fmt.Errorf("setting unsupported sanitizerType %d", t))
 	}
@@ -390,6 +419,8 @@ func (sanitize *sanitize) getSanitizerBoolPtr(t cc.SanitizerType) *bool {
 		return sanitize.Properties.Sanitize.Hwaddress
 	case cc.Memtag_heap:
 		return sanitize.Properties.Sanitize.Memtag_heap
+	case cc.Msan:
+		return sanitize.Properties.Sanitize.Memory
 	default:
 		return nil
 	}
@@ -423,6 +454,8 @@ func (mod *Module) SanitizerSupported(t cc.SanitizerType) bool {
 		return true
 	case cc.Memtag_heap:
 		return true
+	case cc.Msan:
+		return true
 	default:
 		return false
 	}
@@ -363,3 +363,69 @@ func TestSanitizeMemtagHeapWithSanitizeDeviceDiag(t *testing.T) {
 	checkHasMemtagNote(t, ctx.ModuleForTests("unset_test_override_default_disable", variant), Sync)
 	checkHasMemtagNote(t, ctx.ModuleForTests("unset_test_override_default_sync", variant), Sync)
 }
+
+func TestSanitizeMemory(t *testing.T) {
+	ctx := testRust(t, `
+		rust_binary_host {
+			name: "bin_with_msan",
+			srcs: ["foo.rs"],
+			rustlibs: [
+				"libfoo",
+				"libnever",
+			],
+			sanitize: {
+				memory: true,
+			},
+		}
+		rust_library_host {
+			name: "libfoo",
+			crate_name: "foo",
+			srcs: ["foo.rs"],
+		}
+		rust_library_host {
+			name: "libnever",
+			crate_name: "never",
+			srcs: ["foo.rs"],
+			sanitize: {
+				never: true,
+			},
+		}
+		rust_ffi_host_static {
+			name: "libffi",
+			crate_name: "ffi",
+			srcs: ["foo.rs"],
+		}
+		cc_binary_host {
+			name: "cc_bin_with_msan",
+			static_libs: ["libffi"],
+			sanitize: {
+				memory: true,
+			},
+		}
+	`)
+
+	const msanFlag = "-Z sanitizer=memory"
+	variant := "linux_glibc_x86_64"
+
+	bin := ctx.ModuleForTests("bin_with_msan", variant+"_msan").Rule("rustc")
+	android.AssertStringDoesContain(t, "bin_with_msan rustcFlags", bin.Args["rustcFlags"], msanFlag)
+
+	libfoo := ctx.ModuleForTests("libfoo", variant+"_rlib_rlib-std_msan").Output("libfoo.rlib")
+	android.AssertStringDoesContain(t, "libfoo rustcFlags", libfoo.Args["rustcFlags"], msanFlag)
+
+	libnever := ctx.ModuleForTests("libnever", variant+"_rlib_rlib-std").Output("libnever.rlib")
+	android.AssertStringDoesNotContain(t, "libnever rustcFlags", libnever.Args["rustcFlags"], msanFlag)
+
+	// Rust dependencies of C++ modules are instrumented too.
+	var ffiMsanVariants []string
+	for _, v := range ctx.ModuleVariantsForTests("libffi") {
+		if strings.HasSuffix(v, "_msan") {
+			ffiMsanVariants = append(ffiMsanVariants, v)
+		}
+	}
+	if len(ffiMsanVariants) == 0 {
+		t.Fatalf("expected an msan variant of libffi, got %q", ctx.ModuleVariantsForTests("libffi"))
+	}
+	libffi := ctx.ModuleForTests("libffi", ffiMsanVariants[0]).Rule("rustc")
+	android.AssertStringDoesContain(t, "libffi rustcFlags", libffi.Args["rustcFlags"], msanFlag)
+}
@@ -70,6 +70,32 @@ FLAG_PACKAGES = 'packages'
 # tag that should be added to the matching APIs.
 FLAG_TAG = 'tag'
 
+# Option specified after one of FLAGS_API_LIST to record the name of the
+# hiddenAPIFlagFileCategory from which the preceding list came. Only used for
+# the provenance output.
+FLAG_CATEGORY = 'category'
+
+# Option specified after one of FLAGS_API_LIST to record the name of the
+# bootclasspath_fragment (or platform_bootclasspath) that provided the
+# preceding list. Only used for the provenance output.
+FLAG_FRAGMENT = 'fragment'
+
+# Flags that are derived from the API stubs and so identify the API scope
+# that contributed them.
+API_SCOPE_FLAGS_SET = set([
+    FLAG_CORE_PLATFORM_API,
+    FLAG_PUBLIC_API,
+    FLAG_SYSTEM_API,
+    FLAG_TEST_API,
+])
+
+# Categories used in the provenance output for flags that do not come from a
+# flag file.
+PROVENANCE_CATEGORY_API_SCOPE = 'api-scope'
+PROVENANCE_CATEGORY_ANNOTATION = 'annotation'
+PROVENANCE_CATEGORY_SERIALIZATION = 'serialization'
+PROVENANCE_CATEGORY_DEFAULT = 'default'
+
 # Regex patterns of fields/methods used in serialization. These are
 # considered public API despite being hidden.
 SERIALIZATION_PATTERNS = [
@@ -116,6 +142,10 @@ def get_args():
     """
     parser = argparse.ArgumentParser()
     parser.add_argument('--output', required=True)
+    parser.add_argument(
+        '--provenance-output',
+        help='CSV file into which a record of where each flag came from '
+        'will be written')
     parser.add_argument(
         '--csv',
         nargs='*',
@@ -154,6 +184,22 @@ def get_args():
         action=StoreOrderedOptions,
         help='Adds an extra tag to the previous list of entries. '
         'Must follow a list of entries and applies to the preceding such list.')
+    parser.add_argument(
+        '--' + FLAG_CATEGORY,
+        dest='ordered_flags',
+        nargs=1,
+        action=StoreOrderedOptions,
+        help='Records the flag file category of the previous list of entries '
+        'in the provenance output. Must follow a list of entries and applies '
+        'to the preceding such list.')
+    parser.add_argument(
+        '--' + FLAG_FRAGMENT,
+        dest='ordered_flags',
+        nargs=1,
+        action=StoreOrderedOptions,
+        help='Records the module that provided the previous list of entries '
+        'in the provenance output. Must follow a list of entries and applies '
+        'to the preceding such list.')
 
     return parser.parse_args()
 
@@ -213,6 +259,7 @@ class FlagsDict:
     def __init__(self):
         self._dict_keyset = set()
         self._dict = defaultdict(set)
+        self._provenance = defaultdict(list)
 
     def _check_entries_set(self, keys_subset, source):
         assert isinstance(keys_subset, set)
@@ -280,6 +327,29 @@ class FlagsDict:
             lines.append(','.join([api] + flags))
         return sorted(lines)
 
+    def _record_provenance(self, api, flag, category, source, fragment):
+        self._provenance[api].append(
+            Provenance(flag, category or '', source or '', fragment or ''))
+
+    def generate_provenance_csv(self):
+        """Constructs CSV entries recording where each flag came from.
+
+        The format is:
+            <api signature>,<flag>,<category>,<source>,<fragment>
+
+        There is one line for each flag that was assigned to a signature, in
+        the order in which they were assigned.
+
+        Returns:
+            List of lines comprising a CSV file.
+        """
+        lines = []
+        for api in sorted(self._provenance):
+            for p in self._provenance[api]:
+                lines.append(','.join(
+                    [api, p.flag, p.category, p.source, p.fragment]))
+        return lines
+
     def parse_and_merge_csv(self, csv_lines, source='<unknown>'):
         """Parses CSV entries and merges them into a given dictionary.
 
@@ -310,8 +380,20 @@ class FlagsDict:
             if (FLAG_PUBLIC_API in flags) or (FLAG_SYSTEM_API in flags):
                 flags.append(FLAG_SDK)
             self._dict[csv[0]].update(flags)
-
-    def assign_flag(self, flag, apis, source='<unknown>', tag=None):
+            for flag in flags:
+                if flag in API_SCOPE_FLAGS_SET or flag == FLAG_SDK:
+                    category = PROVENANCE_CATEGORY_API_SCOPE
+                else:
+                    category = PROVENANCE_CATEGORY_ANNOTATION
+                self._record_provenance(csv[0], flag, category, source, None)
+
+    def assign_flag(self,
+                    flag,
+                    apis,
+                    source='<unknown>',
+                    tag=None,
+                    category=None,
+                    fragment=None):
         """Assigns a flag to given subset of entries.
 
         Args:
@@ -319,6 +401,11 @@ class FlagsDict:
             apis (set): Subset of APIs to receive the flag.
             source (string): Origin of `entries_subset`. Will be printed in
               error messages.
+            tag (string): Optional extra tag to add to each entry.
+            category (string): Optional flag file category recorded in the
+              provenance.
+            fragment (string): Optional name of the module that provided
+              `apis`, recorded in the provenance.
         Throws: AssertionError if parsed API signatures of flags are invalid.
         """
         # Check that all APIs exist in the dict.
@@ -331,26 +418,33 @@ class FlagsDict:
         # flag to it.
         for api in apis:
             self._dict[api].add(flag)
+            self._record_provenance(api, flag, category, source, fragment)
             if tag:
                 self._dict[api].add(tag)
+                self._record_provenance(api, tag, category, source, fragment)
+
 
+FlagFile = namedtuple('FlagFile', ('flag', 'file', 'ignore_conflicts',
+                                   'packages', 'tag', 'category', 'fragment'))
 
-FlagFile = namedtuple('FlagFile',
-                      ('flag', 'file', 'ignore_conflicts', 'packages', 'tag'))
+Provenance = namedtuple('Provenance',
+                        ('flag', 'category', 'source', 'fragment'))
 
 
 def parse_ordered_flags(ordered_flags):
     r = []
     currentflag, file, ignore_conflicts, packages, tag = None, None, False, \
         False, None
+    category, fragment = None, None
     for flag_value in ordered_flags:
         flag, value = flag_value[0], flag_value[1]
         if flag in ALL_FLAGS_SET:
             if currentflag:
                 r.append(
                     FlagFile(currentflag, file, ignore_conflicts, packages,
-                             tag))
+                             tag, category, fragment))
                 ignore_conflicts, packages, tag = False, False, None
+                category, fragment = None, None
             currentflag = flag
             file = value
         else:
@@ -364,9 +458,15 @@ def parse_ordered_flags(ordered_flags):
                 packages = True
             elif flag == FLAG_TAG:
                 tag = value[0]
+            elif flag == FLAG_CATEGORY:
+                category = value[0]
+            elif flag == FLAG_FRAGMENT:
+                fragment = value[0]
 
     if currentflag:
-        r.append(FlagFile(currentflag, file, ignore_conflicts, packages, tag))
+        r.append(
+            FlagFile(currentflag, file, ignore_conflicts, packages, tag,
+                     category, fragment))
     return r
 
 
@@ -388,13 +488,16 @@ def main(argv): #pylint: disable=unused-argument
 
     # Combine inputs which do not require any particular order.
     # (1) Assign serialization API to SDK.
-    flags.assign_flag(FLAG_SDK, flags.filter_apis(IS_SERIALIZATION))
+    flags.assign_flag(
+        FLAG_SDK,
+        flags.filter_apis(IS_SERIALIZATION),
+        category=PROVENANCE_CATEGORY_SERIALIZATION)
 
     # (2) Merge text files with a known flag into the dictionary.
     for info in flagfiles:
         if (not info.ignore_conflicts) and (not info.packages):
             flags.assign_flag(info.flag, read_lines(info.file), info.file,
-                              info.tag)
+                              info.tag, info.category, info.fragment)
 
     # Merge text files where conflicts should be ignored.
     # This will only assign the given flag if:
@@ -406,7 +509,8 @@ def main(argv): #pylint: disable=unused-argument
         if info.ignore_conflicts:
             valid_entries = flags.get_valid_subset_of_unassigned_apis(
                 read_lines(info.file))
-            flags.assign_flag(info.flag, valid_entries, filename, info.tag) #pylint: disable=undefined-loop-variable
+            flags.assign_flag(info.flag, valid_entries, info.file, info.tag,
+                              info.category, info.fragment)
 
     # All members in the specified packages will be assigned the appropriate
     # flag.
@@ -416,13 +520,19 @@ def main(argv): #pylint: disable=unused-argument
             should_add_signature_to_list = lambda sig, lists: extract_package(
                 sig) in packages_needing_list and not lists #pylint: disable=cell-var-from-loop
             valid_entries = flags.filter_apis(should_add_signature_to_list)
-            flags.assign_flag(info.flag, valid_entries, info.file, info.tag)
+            flags.assign_flag(info.flag, valid_entries, info.file, info.tag,
+                              info.category, info.fragment)
 
     # Mark all remaining entries as blocked.
-    flags.assign_flag(FLAG_BLOCKED, flags.filter_apis(HAS_NO_API_LIST_ASSIGNED))
+    flags.assign_flag(
+        FLAG_BLOCKED,
+        flags.filter_apis(HAS_NO_API_LIST_ASSIGNED),
+        category=PROVENANCE_CATEGORY_DEFAULT)
 
     # Write output.
     write_lines(args['output'], flags.generate_csv())
+    if args['provenance_output']:
+        write_lines(args['provenance_output'], flags.generate_provenance_csv())
 
 
 if __name__ == '__main__':
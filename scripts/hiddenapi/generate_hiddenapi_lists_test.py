@@ -99,6 +99,44 @@ class TestHiddenapiListGeneration(unittest.TestCase):
         with self.assertRaises(AssertionError):
             flags.assign_flag('foo', set(['A']))
 
+    def test_provenance(self):
+        flags = FlagsDict()
+        flags.parse_and_merge_csv(['A,' + FLAG_PUBLIC_API, 'B'], 'stub.csv')
+        flags.assign_flag(
+            FLAG_MAX_TARGET_O,
+            set(['B']),
+            'max-target-o.txt',
+            tag='lo-prio',
+            category='max_target_o_low_priority',
+            fragment='art-bootclasspath-fragment')
+        self.assertEqual(
+            flags.generate_provenance_csv(),
+            [
+                'A,public-api,api-scope,stub.csv,',
+                'A,sdk,api-scope,stub.csv,',
+                'B,max-target-o,max_target_o_low_priority,max-target-o.txt,'
+                'art-bootclasspath-fragment',
+                'B,lo-prio,max_target_o_low_priority,max-target-o.txt,'
+                'art-bootclasspath-fragment',
+            ],
+        )
+
+    def test_parse_ordered_flags(self):
+        flagfiles = parse_ordered_flags([
+            ['unsupported', 'a.txt'],
+            ['category', ['unsupported']],
+            ['fragment', ['my-fragment']],
+            ['max-target-o', 'b.txt'],
+            ['ignore-conflicts', []],
+            ['tag', ['lo-prio']],
+        ])
+        self.assertEqual(flagfiles, [
+            FlagFile('unsupported', 'a.txt', False, False, None,
+                     'unsupported', 'my-fragment'),
+            FlagFile('max-target-o', 'b.txt', True, False, 'lo-prio', None,
+                     None),
+        ])
+
     def test_extract_package(self):
         signature = 'Lcom/foo/bar/Baz;->method1()Lcom/bar/Baz;'
         expected_package = 'com.foo.bar'
@@ -0,0 +1,110 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2024 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Explain why a dex signature has the hidden API flags that it has.
+
+Reads the provenance file generated alongside a hidden API flags file by
+generate_hiddenapi_lists.py and prints, for each requested signature, the
+chain of inputs that contributed each of its flags.
+"""
+import argparse
+from collections import namedtuple
+import sys
+
+ProvenanceEntry = namedtuple('ProvenanceEntry',
+                             ('flag', 'category', 'source', 'fragment'))
+
+
+def read_provenance(lines):
+    """Parses the lines of a provenance CSV file.
+
+    Args:
+        lines (iterable of string): Lines in the format
+          <signature>,<flag>,<category>,<source>,<fragment>
+
+    Returns:
+        dict mapping from signature to a list of ProvenanceEntry in the order
+        in which the flags were assigned.
+    """
+    result = {}
+    for line in lines:
+        line = line.rstrip('\n')
+        if not line:
+            continue
+        # The signature may contain commas so split from the right.
+        signature, flag, category, source, fragment = line.rsplit(',', 4)
+        result.setdefault(signature, []).append(
+            ProvenanceEntry(flag, category, source, fragment))
+    return result
+
+
+def explain(signature, provenance):
+    """Returns the lines describing where the flags for signature came from.
+
+    Args:
+        signature (string): The dex signature to explain.
+        provenance (dict): The result of read_provenance.
+
+    Returns:
+        List of strings, or None if the signature is unknown.
+    """
+    entries = provenance.get(signature)
+    if entries is None:
+        return None
+
+    flags = sorted(set(e.flag for e in entries))
+    lines = ['%s: %s' % (signature, ','.join(flags))]
+    for e in entries:
+        line = '  %s <- %s' % (e.flag, e.category)
+        if e.source:
+            line += ' from %s' % e.source
+        if e.fragment:
+            line += ' (provided by %s)' % e.fragment
+        lines.append(line)
+    return lines
+
+
+def main(argv):
+    parser = argparse.ArgumentParser(description=__doc__)
+    parser.add_argument(
+        '--provenance',
+        required=True,
+        help='The provenance CSV file generated alongside the flags file, '
+        'e.g. out/soong/hiddenapi/hiddenapi-flags.provenance.csv')
+    parser.add_argument(
+        'signatures',
+        nargs='+',
+        metavar='SIGNATURE',
+        help='The dex signatures to explain, e.g. '
+        'Ljava/lang/Object;->hashCode()I')
+    args = parser.parse_args(argv[1:])
+
+    with open(args.provenance, 'r', encoding='utf8') as f:
+        provenance = read_provenance(f)
+
+    status = 0
+    for signature in args.signatures:
+        lines = explain(signature, provenance)
+        if lines is None:
+            print('%s: not found in %s' % (signature, args.provenance),
+                  file=sys.stderr)
+            status = 1
+            continue
+        print('\n'.join(lines))
+    return status
+
+
+if __name__ == '__main__':
+    sys.exit(main(sys.argv))
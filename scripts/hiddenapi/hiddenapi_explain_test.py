@@ -0,0 +1,63 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2024 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Unit tests for hiddenapi_explain.py."""
+import unittest
+
+from hiddenapi_explain import *  # pylint: disable=wildcard-import,unused-wildcard-import
+
+
+class TestHiddenapiExplain(unittest.TestCase):
+
+    def test_read_provenance(self):
+        provenance = read_provenance([
+            'La/B;->c(II)V,public-api,api-scope,stub-flags.csv,\n',
+            'La/B;->c(II)V,blocked,blocked,blocked.txt,my-fragment\n',
+            '\n',
+        ])
+        self.assertEqual(
+            provenance, {
+                'La/B;->c(II)V': [
+                    ProvenanceEntry('public-api', 'api-scope',
+                                    'stub-flags.csv', ''),
+                    ProvenanceEntry('blocked', 'blocked', 'blocked.txt',
+                                    'my-fragment'),
+                ]
+            })
+
+    def test_explain(self):
+        provenance = read_provenance([
+            'La/B;->d:I,max-target-o,max_target_o_low_priority,o.txt,frag',
+            'La/B;->d:I,lo-prio,max_target_o_low_priority,o.txt,frag',
+            'La/B;->e:I,blocked,default,,',
+        ])
+        self.assertEqual(
+            explain('La/B;->d:I', provenance), [
+                'La/B;->d:I: lo-prio,max-target-o',
+                '  max-target-o <- max_target_o_low_priority from o.txt '
+                '(provided by frag)',
+                '  lo-prio <- max_target_o_low_priority from o.txt '
+                '(provided by frag)',
+            ])
+        self.assertEqual(
+            explain('La/B;->e:I', provenance), [
+                'La/B;->e:I: blocked',
+                '  blocked <- default',
+            ])
+        self.assertIsNone(explain('La/B;->f:I', provenance))
+
+
+if __name__ == '__main__':
+    unittest.main(verbosity=2)
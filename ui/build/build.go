@@ -344,6 +344,7 @@ func Build(ctx Context, config Config) {
 			installCleanIfNecessary(ctx, config)
 		}
 		runNinjaForBuild(ctx, config)
+		writeJavaCompileReport(ctx, config)
 	}
 
 	if what&RunDistActions != 0 {
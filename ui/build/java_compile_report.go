@@ -0,0 +1,128 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"android/soong/ui/metrics"
+	"android/soong/ui/status"
+)
+
+// The name of the file written by the java_compile_actions singleton in the Soong output directory.
+const javaCompileActionsFile = "java_compile_actions.json"
+
+// javaCompileAction is a single compile step of a java module as written by the
+// java_compile_actions singleton in java/compile_actions.go.
+type javaCompileAction struct {
+	Output        string `json:"output"`
+	Module        string `json:"module"`
+	Step          string `json:"step"`
+	SrcFiles      int    `json:"src_files"`
+	SrcJars       int    `json:"src_jars"`
+	ClasspathSize int    `json:"classpath_size"`
+}
+
+// javaCompileReportEntry is the time spent in a compile step of a java module during this build.
+type javaCompileReportEntry struct {
+	Module        string `json:"module"`
+	Step          string `json:"step"`
+	TimeMillis    int64  `json:"time_ms"`
+	Actions       int    `json:"actions"`
+	SrcFiles      int    `json:"src_files"`
+	SrcJars       int    `json:"src_jars"`
+	ClasspathSize int    `json:"classpath_size"`
+}
+
+// javaCompileReport combines the compile steps of java modules with the time attributed to them,
+// keeping the order of times, which is ranked from the longest to the shortest.
+func javaCompileReport(actions []javaCompileAction, times []status.AttributedTime) []javaCompileReportEntry {
+	type summary struct {
+		srcFiles, srcJars, classpathSize int
+	}
+	summaries := make(map[status.ActionTag]*summary)
+	for _, action := range actions {
+		tag := status.ActionTag{Module: action.Module, Tool: action.Step}
+		s := summaries[tag]
+		if s == nil {
+			s = &summary{}
+			summaries[tag] = s
+		}
+		// Sharded javac actions compile separate sets of sources with the same classpath.
+		s.srcFiles += action.SrcFiles
+		s.srcJars += action.SrcJars
+		if action.ClasspathSize > s.classpathSize {
+			s.classpathSize = action.ClasspathSize
+		}
+	}
+
+	report := make([]javaCompileReportEntry, 0, len(times))
+	for _, t := range times {
+		entry := javaCompileReportEntry{
+			Module:     t.Module,
+			Step:       t.Tool,
+			TimeMillis: t.Duration.Milliseconds(),
+			Actions:    t.Actions,
+		}
+		if s := summaries[t.ActionTag]; s != nil {
+			entry.SrcFiles = s.srcFiles
+			entry.SrcJars = s.srcJars
+			entry.ClasspathSize = s.classpathSize
+		}
+		report = append(report, entry)
+	}
+	return report
+}
+
+// writeJavaCompileReport writes java_compile_report.json to the logs directory, ranking the javac,
+// kotlinc, kapt, turbine, r8 and d8 steps of each java module by the time spent running them
+// during this build.
+func writeJavaCompileReport(ctx Context, config Config) {
+	if ctx.CriticalPath == nil {
+		return
+	}
+
+	ctx.BeginTrace(metrics.RunShutdownTool, "java_compile_report")
+	defer ctx.EndTrace()
+
+	data, err := os.ReadFile(filepath.Join(config.SoongOutDir(), javaCompileActionsFile))
+	if err != nil {
+		ctx.Verbosef("Skipping java compile report: %s", err)
+		return
+	}
+	var actions []javaCompileAction
+	if err := json.Unmarshal(data, &actions); err != nil {
+		ctx.Verbosef("Skipping java compile report: failed to parse %s: %s", javaCompileActionsFile, err)
+		return
+	}
+
+	tags := make(map[string]status.ActionTag, len(actions))
+	for _, action := range actions {
+		tags[action.Output] = status.ActionTag{Module: action.Module, Tool: action.Step}
+	}
+
+	report := javaCompileReport(actions, ctx.CriticalPath.Attribute(tags))
+	buf, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		ctx.Verbosef("Failed to marshal java compile report: %s", err)
+		return
+	}
+	reportFile := filepath.Join(config.LogsDir(), config.GetLogsPrefix()+"java_compile_report.json")
+	if err := os.WriteFile(reportFile, buf, 0666); err != nil {
+		ctx.Verbosef("Failed to write %s: %s", reportFile, err)
+	}
+}
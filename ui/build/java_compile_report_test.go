@@ -0,0 +1,46 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"android/soong/ui/status"
+)
+
+func TestJavaCompileReport(t *testing.T) {
+	actions := []javaCompileAction{
+		{Output: "foo/javac/shard0/classes.jar", Module: "foo", Step: "javac", SrcFiles: 10, ClasspathSize: 5},
+		{Output: "foo/javac/shard1/classes.jar", Module: "foo", Step: "javac", SrcFiles: 4, ClasspathSize: 5},
+		{Output: "foo/kotlinc/classes.jar", Module: "foo", Step: "kotlinc", SrcFiles: 8, SrcJars: 1, ClasspathSize: 7},
+		{Output: "bar/dex/bar.jar", Module: "bar", Step: "r8", SrcJars: 1, ClasspathSize: 20},
+	}
+	times := []status.AttributedTime{
+		{ActionTag: status.ActionTag{Module: "bar", Tool: "r8"}, Duration: 30 * time.Second, Actions: 1},
+		{ActionTag: status.ActionTag{Module: "foo", Tool: "javac"}, Duration: 12 * time.Second, Actions: 2},
+		{ActionTag: status.ActionTag{Module: "baz", Tool: "turbine"}, Duration: time.Second, Actions: 1},
+	}
+
+	want := []javaCompileReportEntry{
+		{Module: "bar", Step: "r8", TimeMillis: 30000, Actions: 1, SrcJars: 1, ClasspathSize: 20},
+		{Module: "foo", Step: "javac", TimeMillis: 12000, Actions: 2, SrcFiles: 14, ClasspathSize: 5},
+		{Module: "baz", Step: "turbine", TimeMillis: 1000, Actions: 1},
+	}
+	if got := javaCompileReport(actions, times); !reflect.DeepEqual(got, want) {
+		t.Errorf("javaCompileReport() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"sort"
+	"time"
+)
+
+// ActionTag identifies the module and the tool that an action was run for.
+type ActionTag struct {
+	Module string
+	Tool   string
+}
+
+// AttributedTime is the time spent in the actions with the same tag that ran during this build.
+type AttributedTime struct {
+	ActionTag
+	Duration time.Duration
+	Actions  int
+}
+
+// Attribute sums the durations of the actions that finished during this build by the tags of their
+// outputs, and returns them ordered from the longest to the shortest total duration. Actions
+// whose outputs are not tagged are ignored.
+func (cp *CriticalPath) Attribute(tags map[string]ActionTag) []AttributedTime {
+	times := make(map[ActionTag]*AttributedTime)
+	seen := make(map[*node]bool)
+	for _, node := range cp.nodes {
+		// An action with multiple outputs has a node for each of them.
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+
+		for _, output := range node.action.Outputs {
+			tag, ok := tags[output]
+			if !ok {
+				continue
+			}
+			t := times[tag]
+			if t == nil {
+				t = &AttributedTime{ActionTag: tag}
+				times[tag] = t
+			}
+			t.Duration += node.duration
+			t.Actions++
+			break
+		}
+	}
+
+	ret := make([]AttributedTime, 0, len(times))
+	for _, t := range times {
+		ret = append(ret, *t)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Duration != ret[j].Duration {
+			return ret[i].Duration > ret[j].Duration
+		}
+		if ret[i].Module != ret[j].Module {
+			return ret[i].Module < ret[j].Module
+		}
+		return ret[i].Tool < ret[j].Tool
+	})
+	return ret
+}
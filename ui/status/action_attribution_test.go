@@ -0,0 +1,56 @@
+// Copyright 2024 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAttribute(t *testing.T) {
+	cp := &testCriticalPath{
+		CriticalPath: NewCriticalPath(),
+		actions:      make(map[int]*Action),
+	}
+
+	cp.start(0, 0, []string{"foo/javac/foo.jar", "foo/javac/foo.jar.rsp"}, nil)
+	cp.start(1, 0, []string{"foo/kotlin/foo.jar"}, nil)
+	cp.start(2, 0, []string{"bar/javac/bar.jar"}, nil)
+	cp.start(3, 0, []string{"untagged"}, nil)
+	cp.finish(0, 1000)
+	cp.finish(1, 3000)
+	cp.finish(2, 500)
+	cp.finish(3, 9000)
+	cp.start(4, 3000, []string{"foo/javac/shard1/foo.jar"}, nil)
+	cp.finish(4, 5000)
+
+	fooJavac := ActionTag{Module: "foo", Tool: "javac"}
+	tags := map[string]ActionTag{
+		"foo/javac/foo.jar":        fooJavac,
+		"foo/javac/foo.jar.rsp":    fooJavac,
+		"foo/javac/shard1/foo.jar": fooJavac,
+		"foo/kotlin/foo.jar":       {Module: "foo", Tool: "kotlinc"},
+		"bar/javac/bar.jar":        {Module: "bar", Tool: "javac"},
+	}
+
+	want := []AttributedTime{
+		{ActionTag: fooJavac, Duration: 3000, Actions: 2},
+		{ActionTag: ActionTag{Module: "foo", Tool: "kotlinc"}, Duration: 3000, Actions: 1},
+		{ActionTag: ActionTag{Module: "bar", Tool: "javac"}, Duration: 500, Actions: 1},
+	}
+	if got := cp.Attribute(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("Attribute() = %v, want %v", got, want)
+	}
+}